@@ -0,0 +1,130 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// APIKey is the identity an issued API key stands for
+type APIKey struct {
+	// Identity is the label requests carrying the key are rate limited under, e.g. "partner-acme"
+	Identity string
+	// Plan is the plan whose limits override the top-level ones for the key; empty leaves the plan
+	// to the plan resolver
+	Plan string
+}
+
+// APIKeyValue is an entry of the keys list of an API keys file,
+// e.g. {"key_sha256": "9f86d081...", "identity": "partner-acme", "plan": "pro"}
+type APIKeyValue struct {
+	// Key is the API key itself
+	Key string `json:"key" yaml:"key"`
+	// KeySHA256 is the hex encoded SHA-256 hash of the API key, for files that must not hold the key
+	KeySHA256 string `json:"key_sha256" yaml:"key_sha256"`
+	// Identity is the label requests carrying the key are rate limited under
+	Identity string `json:"identity" yaml:"identity"`
+	// Plan is the plan of the key
+	Plan string `json:"plan" yaml:"plan"`
+}
+
+// convertAPIKeyExtractor validates and copies the settings of an api_key extractor, loading its keys
+func convertAPIKeyExtractor(extractor *KeyExtractor, value KeyExtractorValue) error {
+	if value.Header == "" && value.Name == "" && value.MetadataKey == "" {
+		return fmt.Errorf("api_key extractor needs a header, a query parameter name or a metadata key")
+	}
+	extractor.Headers = []string{value.Header}
+	extractor.MetadataKeys = []string{value.MetadataKey}
+
+	if value.KeysFile == "" {
+		return fmt.Errorf("api_key extractor needs a keys file")
+	}
+	var err error
+	if extractor.APIKeys, err = LoadAPIKeys(value.KeysFile); err != nil {
+		return err
+	}
+	extractor.KeysFile = value.KeysFile
+
+	if value.ReloadInterval != "" {
+		if extractor.ReloadInterval, err = time.ParseDuration(value.ReloadInterval); err != nil {
+			return fmt.Errorf("invalid reload interval %q: %w", value.ReloadInterval, err)
+		}
+		if extractor.ReloadInterval <= 0 {
+			return fmt.Errorf("reload interval must be positive, got %s", extractor.ReloadInterval)
+		}
+	}
+	return convertInvalidTokenTreatment(extractor, value)
+}
+
+// LoadAPIKeys loads an API keys file, JSON or YAML by extension, e.g. {"keys": [{"key": "...",
+// "identity": "partner-acme"}]}
+// The keys are returned by the hex encoded SHA-256 hash of the API key, see HashAPIKey
+func LoadAPIKeys(path string) (map[string]APIKey, error) {
+	// #nosec G304 - the keys file path comes from the service configuration
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys file %q: %w", path, err)
+	}
+
+	var file struct {
+		Keys []APIKeyValue `json:"keys" yaml:"keys"`
+	}
+	switch ext := filepath.Ext(path); ext {
+	case ".json":
+		err = json.Unmarshal(data, &file)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &file)
+	default:
+		return nil, fmt.Errorf("unsupported API keys file extension %q, supported: .json, .yaml, .yml", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse API keys file %q: %w", path, err)
+	}
+
+	keys := make(map[string]APIKey, len(file.Keys))
+	for i, value := range file.Keys {
+		hash, err := apiKeyHash(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid API keys file %q: key %d: %w", path, i+1, err)
+		}
+		if value.Identity == "" {
+			return nil, fmt.Errorf("invalid API keys file %q: key %d needs an identity", path, i+1)
+		}
+		if _, ok := keys[hash]; ok {
+			return nil, fmt.Errorf("invalid API keys file %q: key %d is listed twice", path, i+1)
+		}
+		keys[hash] = APIKey{Identity: value.Identity, Plan: value.Plan}
+	}
+	return keys, nil
+}
+
+// apiKeyHash returns the hash of the API key of an entry, given either the key or its hash
+func apiKeyHash(value APIKeyValue) (string, error) {
+	switch {
+	case value.Key != "" && value.KeySHA256 != "":
+		return "", fmt.Errorf("key and key_sha256 are mutually exclusive")
+	case value.Key != "":
+		return HashAPIKey(value.Key), nil
+	case value.KeySHA256 != "":
+		hash := strings.ToLower(value.KeySHA256)
+		if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+			return "", fmt.Errorf("key_sha256 must be a hex encoded SHA-256 hash")
+		}
+		return hash, nil
+	default:
+		return "", fmt.Errorf("needs a key or a key_sha256")
+	}
+}
+
+// HashAPIKey returns the hex encoded SHA-256 hash of an API key, as listed in key_sha256
+func HashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,190 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadAPIKeys(t *testing.T) {
+	hash := HashAPIKey("sk_live_acme")
+
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		expected map[string]APIKey
+		hasError bool
+	}{
+		{
+			name: "JSON with a plain key",
+			file: "keys.json",
+			content: `{"keys": [{"key": "sk_live_acme", "identity": "partner-acme", "plan": "pro"},
+				{"key": "sk_live_globex", "identity": "partner-globex"}]}`,
+			expected: map[string]APIKey{
+				hash:                         {Identity: "partner-acme", Plan: "pro"},
+				HashAPIKey("sk_live_globex"): {Identity: "partner-globex"},
+			},
+		},
+		{
+			name:     "YAML with a hashed key",
+			file:     "keys.yaml",
+			content:  "keys:\n  - key_sha256: " + hash + "\n    identity: partner-acme\n",
+			expected: map[string]APIKey{hash: {Identity: "partner-acme"}},
+		},
+		{
+			name:     "no keys",
+			file:     "keys.yml",
+			content:  "keys: []\n",
+			expected: map[string]APIKey{},
+		},
+		{
+			name:     "key and hash",
+			file:     "keys.json",
+			content:  `{"keys": [{"key": "sk_live_acme", "key_sha256": "` + hash + `", "identity": "partner-acme"}]}`,
+			hasError: true,
+		},
+		{
+			name:     "neither key nor hash",
+			file:     "keys.json",
+			content:  `{"keys": [{"identity": "partner-acme"}]}`,
+			hasError: true,
+		},
+		{
+			name:     "invalid hash",
+			file:     "keys.json",
+			content:  `{"keys": [{"key_sha256": "abc123", "identity": "partner-acme"}]}`,
+			hasError: true,
+		},
+		{
+			name:     "missing identity",
+			file:     "keys.json",
+			content:  `{"keys": [{"key": "sk_live_acme"}]}`,
+			hasError: true,
+		},
+		{
+			name: "duplicate key",
+			file: "keys.json",
+			content: `{"keys": [{"key": "sk_live_acme", "identity": "partner-acme"},
+				{"key_sha256": "` + hash + `", "identity": "partner-globex"}]}`,
+			hasError: true,
+		},
+		{
+			name:     "unsupported extension",
+			file:     "keys.txt",
+			content:  "sk_live_acme",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(filePath, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			keys, err := LoadAPIKeys(filePath)
+			if (err != nil) != tt.hasError {
+				t.Fatalf("LoadAPIKeys() error = %v, hasError %v", err, tt.hasError)
+			}
+			if tt.hasError {
+				return
+			}
+
+			if len(keys) != len(tt.expected) {
+				t.Fatalf("LoadAPIKeys() returned %d keys, want %d", len(keys), len(tt.expected))
+			}
+			for hash, expected := range tt.expected {
+				if keys[hash] != expected {
+					t.Errorf("key %s = %+v, want %+v", hash, keys[hash], expected)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFromFile_APIKeyExtractor(t *testing.T) {
+	keysFile := filepath.Join(t.TempDir(), "api_keys.yaml")
+	content := "keys:\n  - {key: sk_live_acme, identity: partner-acme}\n"
+	if err := os.WriteFile(keysFile, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write keys file: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		extractor      string
+		reloadInterval time.Duration
+		onInvalid      InvalidTokenTreatment
+		hasError       bool
+	}{
+		{
+			name:      "header",
+			extractor: "{type: api_key, header: X-API-Key, keys_file: " + keysFile + "}",
+			onInvalid: InvalidTokenReject,
+		},
+		{
+			name: "query parameter and metadata with reloads",
+			extractor: "{type: api_key, name: api_key, metadata_key: x-api-key, keys_file: " + keysFile +
+				", reload_interval: 30s, on_invalid: ignore}",
+			reloadInterval: 30 * time.Second,
+			onInvalid:      InvalidTokenIgnore,
+		},
+		{
+			name:      "nothing to read",
+			extractor: "{type: api_key, keys_file: " + keysFile + "}",
+			hasError:  true,
+		},
+		{
+			name:      "missing keys file",
+			extractor: "{type: api_key, header: X-API-Key}",
+			hasError:  true,
+		},
+		{
+			name:      "unreadable keys file",
+			extractor: "{type: api_key, header: X-API-Key, keys_file: " + keysFile + ".missing}",
+			hasError:  true,
+		},
+		{
+			name:      "invalid reload interval",
+			extractor: "{type: api_key, header: X-API-Key, keys_file: " + keysFile + ", reload_interval: 0s}",
+			hasError:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := `
+rate_limits:
+  global: {rate: 100, burst: 10}
+  http: {rate: 50, burst: 5, default_method_rate: 10}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+user_identification:
+  extractors: [` + tt.extractor + `]
+`
+			filePath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(filePath, []byte(content), 0600); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			config, err := LoadFromFile(filePath)
+			if (err != nil) != tt.hasError {
+				t.Fatalf("LoadFromFile() error = %v, hasError %v", err, tt.hasError)
+			}
+			if tt.hasError {
+				return
+			}
+
+			extractor := config.KeyExtractors[0]
+			if extractor.APIKeys[HashAPIKey("sk_live_acme")].Identity != "partner-acme" {
+				t.Errorf("APIKeys = %+v, want the key of partner-acme", extractor.APIKeys)
+			}
+			if extractor.KeysFile != keysFile || extractor.ReloadInterval != tt.reloadInterval ||
+				extractor.OnInvalid != tt.onInvalid {
+				t.Errorf("extractor = %+v, want reload interval %v and on_invalid %q", extractor,
+					tt.reloadInterval, tt.onInvalid)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ClientCertSource names a field of a verified client certificate a client_cert extractor may
+// derive the key from
+type ClientCertSource string
+
+const (
+	// ClientCertSPIFFE reads the SPIFFE ID of a URI SAN, e.g. "spiffe://example.org/ns/prod/sa/billing"
+	ClientCertSPIFFE ClientCertSource = "spiffe"
+	// ClientCertDNS reads the first DNS SAN, e.g. "billing.internal.example.org"
+	ClientCertDNS ClientCertSource = "dns"
+	// ClientCertCN reads the common name of the subject
+	ClientCertCN ClientCertSource = "cn"
+)
+
+// DefaultClientCertSources are the fields a client_cert extractor tries when it sets none
+var DefaultClientCertSources = []ClientCertSource{ClientCertSPIFFE, ClientCertDNS, ClientCertCN}
+
+// convertClientCertExtractor validates and copies the settings of a client_cert extractor
+func convertClientCertExtractor(extractor *KeyExtractor, value KeyExtractorValue) error {
+	extractor.CertSources = nil
+	for _, source := range value.Sources {
+		switch source := ClientCertSource(source); source {
+		case ClientCertSPIFFE, ClientCertDNS, ClientCertCN:
+			extractor.CertSources = append(extractor.CertSources, source)
+		default:
+			return fmt.Errorf("invalid certificate source %q: must be %s, %s or %s", source, ClientCertSPIFFE,
+				ClientCertDNS, ClientCertCN)
+		}
+	}
+	if len(extractor.CertSources) == 0 {
+		extractor.CertSources = slices.Clone(DefaultClientCertSources)
+	}
+
+	extractor.TrustDomain = value.TrustDomain
+	if strings.ContainsAny(extractor.TrustDomain, ":/") {
+		return fmt.Errorf("trust domain %q must be a bare name such as example.org", value.TrustDomain)
+	}
+	return nil
+}
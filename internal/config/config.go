@@ -18,6 +18,11 @@ type Config struct {
 	UserHeader string
 	// GrpcMetadataKey is the gRPC metadata key used to identify users
 	GrpcMetadataKey string
+	// KeyExtractors is the chain of extractors identifying users, tried in order; empty reads
+	// UserHeader and GrpcMetadataKey
+	KeyExtractors []KeyExtractor
+	// AnonymousKey is the key requests no extractor identifies share; empty means "anonymous"
+	AnonymousKey string
 	// PerEndpointRate is the rate limit per endpoint per user (requests per second)
 	PerEndpointRate int
 	// GlobalRate is the global rate limit per user across all endpoints (requests per second)
@@ -42,6 +47,115 @@ type Config struct {
 	GRPCMethods map[string]int
 	// GRPCDefaultMethodRate is the default rate for gRPC methods not explicitly configured
 	GRPCDefaultMethodRate int
+	// HTTPMethodCosts is a map of HTTP method+path to the number of tokens one request consumes
+	HTTPMethodCosts map[string]int
+	// GRPCMethodCosts is a map of gRPC method to the number of tokens one request consumes
+	GRPCMethodCosts map[string]int
+	// GlobalPeriod is the period GlobalRate applies to; zero means one second
+	GlobalPeriod time.Duration
+	// PerEndpointPeriod is the period PerEndpointRate applies to; zero means one second
+	PerEndpointPeriod time.Duration
+	// HTTPPeriod is the period HTTPRate applies to; zero means one second
+	HTTPPeriod time.Duration
+	// GRPCPeriod is the period GRPCRate applies to; zero means one second
+	GRPCPeriod time.Duration
+	// HTTPDefaultMethodPeriod is the period HTTPDefaultMethodRate applies to; zero means one second
+	HTTPDefaultMethodPeriod time.Duration
+	// GRPCDefaultMethodPeriod is the period GRPCDefaultMethodRate applies to; zero means one second
+	GRPCDefaultMethodPeriod time.Duration
+	// HTTPMethodPeriods is a map of HTTP method+path to the period of its rate
+	HTTPMethodPeriods map[string]time.Duration
+	// GRPCMethodPeriods is a map of gRPC method to the period of its rate
+	GRPCMethodPeriods map[string]time.Duration
+	// GlobalExtraLimits are windows enforced on the global tier in addition to GlobalRate
+	GlobalExtraLimits []Limit
+	// HTTPExtraLimits are windows enforced on the HTTP-only tier in addition to HTTPRate
+	HTTPExtraLimits []Limit
+	// GRPCExtraLimits are windows enforced on the gRPC-only tier in addition to GRPCRate
+	GRPCExtraLimits []Limit
+	// HTTPMethodExtraLimits is a map of HTTP method+path to windows enforced in addition to its rate
+	HTTPMethodExtraLimits map[string][]Limit
+	// GRPCMethodExtraLimits is a map of gRPC method to windows enforced in addition to its rate
+	GRPCMethodExtraLimits map[string][]Limit
+	// AggregateLimits are windows every request counts against regardless of user, across HTTP and gRPC
+	AggregateLimits []Limit
+	// HTTPMethodAggregateLimits is a map of HTTP method+path to windows shared by all users of the endpoint
+	HTTPMethodAggregateLimits map[string][]Limit
+	// GRPCMethodAggregateLimits is a map of gRPC method to windows shared by all users of the method
+	GRPCMethodAggregateLimits map[string][]Limit
+	// HTTPMethodStrict is the set of HTTP method+path whose limits are enforced exactly with a sliding log
+	HTTPMethodStrict map[string]bool
+	// GRPCMethodStrict is the set of gRPC methods whose limits are enforced exactly with a sliding log
+	GRPCMethodStrict map[string]bool
+	// MaxConcurrent is the maximum number of requests a user may have in flight at once; zero means unlimited
+	MaxConcurrent int
+	// HTTPMaxConcurrent is the maximum number of HTTP requests a user may have in flight; zero means unlimited
+	HTTPMaxConcurrent int
+	// GRPCMaxConcurrent is the maximum number of gRPC calls a user may have in flight; zero means unlimited
+	GRPCMaxConcurrent int
+	// HTTPMethodMaxConcurrent is a map of HTTP method+path to its maximum in-flight requests per user
+	HTTPMethodMaxConcurrent map[string]int
+	// GRPCMethodMaxConcurrent is a map of gRPC method to its maximum in-flight calls per user
+	GRPCMethodMaxConcurrent map[string]int
+	// AdaptiveConcurrency enables the process-wide in-flight limit that adapts to handler latency
+	AdaptiveConcurrency bool
+	// AdaptiveInitialLimit is the in-flight limit the adaptive limiter starts from
+	AdaptiveInitialLimit int
+	// AdaptiveMinLimit is the lowest in-flight limit the adaptive limiter shrinks to
+	AdaptiveMinLimit int
+	// AdaptiveMaxLimit is the highest in-flight limit the adaptive limiter grows to
+	AdaptiveMaxLimit int
+	// Quotas are calendar-aligned per-user quotas enforced across HTTP and gRPC, e.g. 100000 per month
+	Quotas []Quota
+	// QuotaLocation is the timezone quota periods start in; nil means UTC
+	QuotaLocation *time.Location
+	// QuotaFile is the file quota counters persist to when Memcache is not configured
+	QuotaFile string
+	// QuotaFlushInterval is how often quota counters are written to QuotaFile; zero means five seconds
+	QuotaFlushInterval time.Duration
+	// ChargeCredits draws every request down from the user's prepaid credit balance; with plans, it
+	// is set on the configuration of each plan listed in CreditPlans
+	ChargeCredits bool
+	// CreditPlans are the plans whose users are charged credits; empty charges everyone if ChargeCredits
+	CreditPlans []string
+	// CreditFile is the file credit balances persist to when Memcache is not configured
+	CreditFile string
+	// CreditFlushInterval is how often credit balances are written to CreditFile; zero means five seconds
+	CreditFlushInterval time.Duration
+	// PenaltyThreshold is the number of rejections within PenaltyWindow that bans a user; zero disables bans
+	PenaltyThreshold int
+	// PenaltyWindow is the sliding window rejections are counted in
+	PenaltyWindow time.Duration
+	// PenaltyBan is the duration of a user's first ban; each repeated offense doubles it
+	PenaltyBan time.Duration
+	// PenaltyMaxBan caps the duration of repeated bans
+	PenaltyMaxBan time.Duration
+	// PenaltyResetAfter is how long after their last ban a user's offenses are forgotten
+	PenaltyResetAfter time.Duration
+	// PenaltyTarpit delays the rejection of requests from banned users; zero rejects them immediately
+	PenaltyTarpit time.Duration
+	// PriorityClasses are the request priority classes from highest to lowest; empty disables priorities
+	PriorityClasses []PriorityClass
+	// PriorityHeader is the HTTP header clients name their request's priority class in; empty ignores it
+	PriorityHeader string
+	// PriorityMetadataKey is the gRPC metadata key clients name their call's priority class in; empty ignores it
+	PriorityMetadataKey string
+	// DefaultPriority is the class of requests that name no known class; empty means the lowest class
+	DefaultPriority string
+	// HTTPMethodPriorities is a map of HTTP method+path to its priority class, overriding the header
+	HTTPMethodPriorities map[string]string
+	// GRPCMethodPriorities is a map of gRPC method to its priority class, overriding the metadata
+	GRPCMethodPriorities map[string]string
+	// IdentityLevels is the identity hierarchy from the outermost level to the innermost, e.g. org,
+	// user and API key; empty means requests are identified by user only
+	IdentityLevels []IdentityLevel
+	// Plans maps plan names to the configuration of users on that plan: this configuration with
+	// the plan's rate limits applied
+	Plans map[string]Config
+	// DefaultPlan is the plan of users assigned no known plan; empty means the top-level limits
+	DefaultPlan string
+	// PlanUsers maps user IDs to the name of their plan
+	PlanUsers map[string]string
 	// MemcacheServers is the list of Memcache server addresses
 	MemcacheServers []string
 	// MemcacheTimeout is the timeout for Memcache operations
@@ -52,6 +166,29 @@ type Config struct {
 	MemcacheFailureMode FailureMode
 	// MemcacheKeyPrefix is the prefix for Memcache keys
 	MemcacheKeyPrefix string
+	// DistributedAlgorithm selects the algorithm used by Memcache-backed limiters
+	DistributedAlgorithm Algorithm
+	// GlobalAlgorithm selects the algorithm for the global tier; if empty, the tier uses a token
+	// bucket, or DistributedAlgorithm when Memcache is configured
+	GlobalAlgorithm Algorithm
+	// HTTPAlgorithm selects the algorithm for the HTTP-only tier
+	HTTPAlgorithm Algorithm
+	// GRPCAlgorithm selects the algorithm for the gRPC-only tier
+	GRPCAlgorithm Algorithm
+	// HTTPMethodAlgorithm selects the algorithm for HTTP per-method limits
+	HTTPMethodAlgorithm Algorithm
+	// GRPCMethodAlgorithm selects the algorithm for gRPC per-method limits
+	GRPCMethodAlgorithm Algorithm
+	// GlobalStart controls the initial fill and warm-up of new global token buckets
+	GlobalStart BucketStart
+	// HTTPStart controls the initial fill and warm-up of new HTTP-only token buckets
+	HTTPStart BucketStart
+	// GRPCStart controls the initial fill and warm-up of new gRPC-only token buckets
+	GRPCStart BucketStart
+	// HTTPMethodStart controls the initial fill and warm-up of new HTTP per-method token buckets
+	HTTPMethodStart BucketStart
+	// GRPCMethodStart controls the initial fill and warm-up of new gRPC per-method token buckets
+	GRPCMethodStart BucketStart
 }
 
 // FailureMode defines the behavior when Memcache is unavailable
@@ -64,39 +201,307 @@ const (
 	FailureModeDeny FailureMode = "deny"
 )
 
+// Algorithm identifies a rate limiting algorithm
+type Algorithm string
+
+const (
+	// AlgorithmFixedWindow counts requests in fixed windows (Memcache counters)
+	AlgorithmFixedWindow Algorithm = "fixed_window"
+	// AlgorithmGCRA uses the Generic Cell Rate Algorithm, honoring burst sizes
+	AlgorithmGCRA Algorithm = "gcra"
+	// AlgorithmSlidingWindow weights the previous window's counter to approximate a sliding window
+	AlgorithmSlidingWindow Algorithm = "sliding_window"
+	// AlgorithmTokenBucket rejects requests once the in-memory token bucket is empty
+	AlgorithmTokenBucket Algorithm = "token_bucket"
+	// AlgorithmLeakyBucket delays requests to a constant outflow and rejects only when the queue is full
+	AlgorithmLeakyBucket Algorithm = "leaky_bucket"
+	// AlgorithmSlidingLog records the time of every request, admitting no more than rate in any period;
+	// it is selected for strict methods rather than for whole tiers
+	AlgorithmSlidingLog Algorithm = "sliding_log"
+)
+
+// parseDistributedAlgorithm validates an algorithm name for Memcache-backed limiters
+func parseDistributedAlgorithm(value string) (Algorithm, error) {
+	switch Algorithm(value) {
+	case AlgorithmFixedWindow, AlgorithmGCRA, AlgorithmSlidingWindow:
+		return Algorithm(value), nil
+	default:
+		return "", fmt.Errorf("invalid distributed algorithm %q, must be one of: %s, %s, %s",
+			value, AlgorithmFixedWindow, AlgorithmGCRA, AlgorithmSlidingWindow)
+	}
+}
+
+// parseTierAlgorithm validates an algorithm name for a rate limiting tier
+// An empty value selects the token bucket, or the distributed algorithm when Memcache is configured
+func parseTierAlgorithm(value string) (Algorithm, error) {
+	switch Algorithm(value) {
+	case "", AlgorithmTokenBucket, AlgorithmLeakyBucket, AlgorithmFixedWindow, AlgorithmGCRA, AlgorithmSlidingWindow:
+		return Algorithm(value), nil
+	default:
+		return "", fmt.Errorf("invalid algorithm %q, must be one of: %s, %s, %s, %s, %s", value,
+			AlgorithmTokenBucket, AlgorithmLeakyBucket, AlgorithmFixedWindow, AlgorithmGCRA, AlgorithmSlidingWindow)
+	}
+}
+
+// IsDistributed reports whether the algorithm keeps its state in Memcache, shared by all instances
+// Token and leaky buckets are kept in memory on each instance
+func (a Algorithm) IsDistributed() bool {
+	switch a {
+	case AlgorithmFixedWindow, AlgorithmGCRA, AlgorithmSlidingWindow:
+		return true
+	default:
+		return false
+	}
+}
+
 // FileConfig represents the structure of the configuration file
 type FileConfig struct {
 	RateLimits struct {
 		Global struct {
-			Rate  int `json:"rate" yaml:"rate"`
-			Burst int `json:"burst" yaml:"burst"`
+			Rate          RateValue    `json:"rate" yaml:"rate"`
+			Period        string       `json:"period" yaml:"period"`
+			Burst         int          `json:"burst" yaml:"burst"`
+			Limits        []LimitValue `json:"limits" yaml:"limits"`
+			MaxConcurrent int          `json:"max_concurrent" yaml:"max_concurrent"`
+			Algorithm     string       `json:"algorithm" yaml:"algorithm"`
+			InitialFill   string       `json:"initial_fill" yaml:"initial_fill"`
+			WarmUp        string       `json:"warm_up" yaml:"warm_up"`
 		} `json:"global" yaml:"global"`
 		HTTP struct {
-			Rate              int            `json:"rate" yaml:"rate"`
-			Burst             int            `json:"burst" yaml:"burst"`
-			DefaultMethodRate int            `json:"default_method_rate" yaml:"default_method_rate"`
-			Methods           map[string]int `json:"methods" yaml:"methods"`
+			Rate                RateValue              `json:"rate" yaml:"rate"`
+			Period              string                 `json:"period" yaml:"period"`
+			Burst               int                    `json:"burst" yaml:"burst"`
+			Limits              []LimitValue           `json:"limits" yaml:"limits"`
+			MaxConcurrent       int                    `json:"max_concurrent" yaml:"max_concurrent"`
+			DefaultMethodRate   RateValue              `json:"default_method_rate" yaml:"default_method_rate"`
+			DefaultMethodPeriod string                 `json:"default_method_period" yaml:"default_method_period"`
+			Methods             map[string]MethodLimit `json:"methods" yaml:"methods"`
+			Algorithm           string                 `json:"algorithm" yaml:"algorithm"`
+			MethodAlgorithm     string                 `json:"method_algorithm" yaml:"method_algorithm"`
+			InitialFill         string                 `json:"initial_fill" yaml:"initial_fill"`
+			WarmUp              string                 `json:"warm_up" yaml:"warm_up"`
+			MethodInitialFill   string                 `json:"method_initial_fill" yaml:"method_initial_fill"`
+			MethodWarmUp        string                 `json:"method_warm_up" yaml:"method_warm_up"`
 		} `json:"http" yaml:"http"`
 		GRPC struct {
-			Rate              int            `json:"rate" yaml:"rate"`
-			Burst             int            `json:"burst" yaml:"burst"`
-			DefaultMethodRate int            `json:"default_method_rate" yaml:"default_method_rate"`
-			Methods           map[string]int `json:"methods" yaml:"methods"`
+			Rate                RateValue              `json:"rate" yaml:"rate"`
+			Period              string                 `json:"period" yaml:"period"`
+			Burst               int                    `json:"burst" yaml:"burst"`
+			Limits              []LimitValue           `json:"limits" yaml:"limits"`
+			MaxConcurrent       int                    `json:"max_concurrent" yaml:"max_concurrent"`
+			DefaultMethodRate   RateValue              `json:"default_method_rate" yaml:"default_method_rate"`
+			DefaultMethodPeriod string                 `json:"default_method_period" yaml:"default_method_period"`
+			Methods             map[string]MethodLimit `json:"methods" yaml:"methods"`
+			Algorithm           string                 `json:"algorithm" yaml:"algorithm"`
+			MethodAlgorithm     string                 `json:"method_algorithm" yaml:"method_algorithm"`
+			InitialFill         string                 `json:"initial_fill" yaml:"initial_fill"`
+			WarmUp              string                 `json:"warm_up" yaml:"warm_up"`
+			MethodInitialFill   string                 `json:"method_initial_fill" yaml:"method_initial_fill"`
+			MethodWarmUp        string                 `json:"method_warm_up" yaml:"method_warm_up"`
 		} `json:"grpc" yaml:"grpc"`
+		Aggregate struct {
+			Limits []LimitValue `json:"limits" yaml:"limits"`
+		} `json:"aggregate" yaml:"aggregate"`
+		AdaptiveConcurrency struct {
+			Enabled      bool `json:"enabled" yaml:"enabled"`
+			InitialLimit int  `json:"initial_limit" yaml:"initial_limit"`
+			MinLimit     int  `json:"min_limit" yaml:"min_limit"`
+			MaxLimit     int  `json:"max_limit" yaml:"max_limit"`
+		} `json:"adaptive_concurrency" yaml:"adaptive_concurrency"`
+		Quotas struct {
+			Limits        []QuotaValue `json:"limits" yaml:"limits"`
+			Timezone      string       `json:"timezone" yaml:"timezone"`
+			File          string       `json:"file" yaml:"file"`
+			FlushInterval string       `json:"flush_interval" yaml:"flush_interval"`
+		} `json:"quotas" yaml:"quotas"`
+		Credits CreditsValue `json:"credits" yaml:"credits"`
+		Penalty struct {
+			Threshold  int    `json:"threshold" yaml:"threshold"`
+			Window     string `json:"window" yaml:"window"`
+			Ban        string `json:"ban" yaml:"ban"`
+			MaxBan     string `json:"max_ban" yaml:"max_ban"`
+			ResetAfter string `json:"reset_after" yaml:"reset_after"`
+			Tarpit     string `json:"tarpit" yaml:"tarpit"`
+		} `json:"penalty" yaml:"penalty"`
+		Priorities struct {
+			Classes     []PriorityClassValue `json:"classes" yaml:"classes"`
+			Header      string               `json:"header" yaml:"header"`
+			MetadataKey string               `json:"metadata_key" yaml:"metadata_key"`
+			Default     string               `json:"default" yaml:"default"`
+		} `json:"priorities" yaml:"priorities"`
+		Hierarchy []IdentityLevelValue `json:"hierarchy" yaml:"hierarchy"`
+		Plans     struct {
+			Default     string               `json:"default" yaml:"default"`
+			Users       map[string]string    `json:"users" yaml:"users"`
+			Definitions map[string]PlanValue `json:"definitions" yaml:"definitions"`
+		} `json:"plans" yaml:"plans"`
 	} `json:"rate_limits" yaml:"rate_limits"`
 	UserIdentification struct {
-		HTTPHeader     string `json:"http_header" yaml:"http_header"`
-		GRPCMetadataKey string `json:"grpc_metadata_key" yaml:"grpc_metadata_key"`
+		HTTPHeader      string              `json:"http_header" yaml:"http_header"`
+		GRPCMetadataKey string              `json:"grpc_metadata_key" yaml:"grpc_metadata_key"`
+		Extractors      []KeyExtractorValue `json:"extractors" yaml:"extractors"`
+		AnonymousKey    string              `json:"anonymous_key" yaml:"anonymous_key"`
 	} `json:"user_identification" yaml:"user_identification"`
 	Memcache struct {
-		Servers          []string `json:"servers" yaml:"servers"`
-		Timeout          string   `json:"timeout" yaml:"timeout"`
-		MaxIdleConns     int      `json:"max_idle_connections" yaml:"max_idle_connections"`
-		FailureMode      string   `json:"failure_mode" yaml:"failure_mode"`
-		KeyPrefix        string   `json:"key_prefix" yaml:"key_prefix"`
+		Servers      []string `json:"servers" yaml:"servers"`
+		Timeout      string   `json:"timeout" yaml:"timeout"`
+		MaxIdleConns int      `json:"max_idle_connections" yaml:"max_idle_connections"`
+		FailureMode  string   `json:"failure_mode" yaml:"failure_mode"`
+		KeyPrefix    string   `json:"key_prefix" yaml:"key_prefix"`
+		Algorithm    string   `json:"algorithm" yaml:"algorithm"`
 	} `json:"memcache" yaml:"memcache"`
 }
 
+// MethodLimit is a per-method entry of the http.methods or grpc.methods config section
+// It is written either as a plain rate (`"GET /api/users": 20` or `"300/m"`) or as an object
+// with a rate, period, cost, additional limits, a concurrency ceiling, a priority class and
+// limits shared by all users (`"POST /api/users/batch": {"rate": 5, "cost": 10}`)
+type MethodLimit struct {
+	// Rate is the per-method rate; zero falls back to the default method rate
+	Rate RateValue `json:"rate" yaml:"rate"`
+	// Period is the period of the rate when it is not part of the rate itself
+	Period string `json:"period" yaml:"period"`
+	// Cost is the number of tokens one request consumes; zero means 1
+	Cost int `json:"cost" yaml:"cost"`
+	// Limits are windows enforced in addition to the rate, e.g. ["500/m", "20000/d"]
+	Limits []LimitValue `json:"limits" yaml:"limits"`
+	// MaxConcurrent is the maximum number of requests per user in flight at once; zero means unlimited
+	MaxConcurrent int `json:"max_concurrent" yaml:"max_concurrent"`
+	// Priority is the priority class of the method's requests; empty leaves it to the client
+	Priority string `json:"priority" yaml:"priority"`
+	// Aggregate are windows shared by all users of the method, e.g. ["200/s"]
+	Aggregate []LimitValue `json:"aggregate" yaml:"aggregate"`
+	// Strict enforces the method's limits exactly with a sliding log instead of the tier's algorithm
+	Strict bool `json:"strict" yaml:"strict"`
+}
+
+// UnmarshalJSON accepts either a plain rate or a
+// {"rate", "period", "cost", "limits", "max_concurrent", "priority", "aggregate", "strict"} object
+func (ml *MethodLimit) UnmarshalJSON(data []byte) error {
+	if trimmed := strings.TrimSpace(string(data)); !strings.HasPrefix(trimmed, "{") {
+		*ml = MethodLimit{}
+		return json.Unmarshal(data, &ml.Rate)
+	}
+
+	type plain MethodLimit
+	var value plain
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*ml = MethodLimit(value)
+	return nil
+}
+
+// UnmarshalYAML accepts either a plain rate or a
+// {rate, period, cost, limits, max_concurrent, priority, aggregate, strict} mapping
+func (ml *MethodLimit) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*ml = MethodLimit{}
+		return node.Decode(&ml.Rate)
+	}
+
+	type plain MethodLimit
+	var value plain
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+	*ml = MethodLimit(value)
+	return nil
+}
+
+// convertedMethods holds the per-method settings of one protocol
+type convertedMethods struct {
+	rates         map[string]int
+	periods       map[string]time.Duration
+	costs         map[string]int
+	limits        map[string][]Limit
+	maxConcurrent map[string]int
+	priorities    map[string]string
+	aggregate     map[string][]Limit
+	strict        map[string]bool
+}
+
+// convertMethodLimits validates per-method entries and splits them into rate, period, cost,
+// limits, concurrency, priority, aggregate limit and strictness maps
+// Methods without an explicit rate use the default method rate, so they are left out of rates
+func convertMethodLimits(protocol string, methods map[string]MethodLimit) (convertedMethods, error) {
+	var converted convertedMethods
+	for method, limit := range methods {
+		if limit.Rate.Count < 0 {
+			return convertedMethods{}, fmt.Errorf("%s method %q rate must not be negative, got %g",
+				protocol, method, limit.Rate.Count)
+		}
+		if limit.Cost < 0 {
+			return convertedMethods{}, fmt.Errorf("%s method %q cost must not be negative, got %d",
+				protocol, method, limit.Cost)
+		}
+		if limit.MaxConcurrent < 0 {
+			return convertedMethods{}, fmt.Errorf("%s method %q max_concurrent must not be negative, got %d",
+				protocol, method, limit.MaxConcurrent)
+		}
+
+		if limit.Rate.Count > 0 {
+			rate, period, err := limit.Rate.resolve(limit.Period)
+			if err != nil {
+				return convertedMethods{}, fmt.Errorf("%s method %q: %w", protocol, method, err)
+			}
+			if converted.rates == nil {
+				converted.rates = make(map[string]int)
+				converted.periods = make(map[string]time.Duration)
+			}
+			converted.rates[method] = rate
+			converted.periods[method] = period
+		}
+		if limit.Cost > 0 {
+			if converted.costs == nil {
+				converted.costs = make(map[string]int)
+			}
+			converted.costs[method] = limit.Cost
+		}
+
+		limits, err := convertLimits(fmt.Sprintf("%s method %q", protocol, method), limit.Limits)
+		if err != nil {
+			return convertedMethods{}, err
+		}
+		if len(limits) > 0 {
+			if converted.limits == nil {
+				converted.limits = make(map[string][]Limit)
+			}
+			converted.limits[method] = limits
+		}
+		if limit.MaxConcurrent > 0 {
+			if converted.maxConcurrent == nil {
+				converted.maxConcurrent = make(map[string]int)
+			}
+			converted.maxConcurrent[method] = limit.MaxConcurrent
+		}
+		if limit.Priority != "" {
+			if converted.priorities == nil {
+				converted.priorities = make(map[string]string)
+			}
+			converted.priorities[method] = limit.Priority
+		}
+
+		aggregate, err := convertLimits(fmt.Sprintf("%s method %q aggregate", protocol, method), limit.Aggregate)
+		if err != nil {
+			return convertedMethods{}, err
+		}
+		if len(aggregate) > 0 {
+			if converted.aggregate == nil {
+				converted.aggregate = make(map[string][]Limit)
+			}
+			converted.aggregate[method] = aggregate
+		}
+		if limit.Strict {
+			if converted.strict == nil {
+				converted.strict = make(map[string]bool)
+			}
+			converted.strict[method] = true
+		}
+	}
+	return converted, nil
+}
+
 // DefaultConfig returns the default configuration values
 func DefaultConfig() Config {
 	return Config{
@@ -117,6 +522,14 @@ func DefaultConfig() Config {
 		MemcacheMaxIdleConns:  100,
 		MemcacheFailureMode:   FailureModeAllow,
 		MemcacheKeyPrefix:     "rate_limit",
+		DistributedAlgorithm:  AlgorithmFixedWindow,
+		AdaptiveInitialLimit:  20,
+		AdaptiveMinLimit:      1,
+		AdaptiveMaxLimit:      1000,
+		PenaltyWindow:         time.Minute,
+		PenaltyBan:            time.Minute,
+		PenaltyMaxBan:         time.Hour,
+		PenaltyResetAfter:     24 * time.Hour,
 	}
 }
 
@@ -141,11 +554,19 @@ func loadBasicEnvConfig(config *Config) error {
 
 	config.UserHeader = loadEnvString("RATE_LIMIT_USER_HEADER", config.UserHeader)
 
-	if config.PerEndpointRate, err = loadEnvInt("RATE_LIMIT_PER_ENDPOINT", config.PerEndpointRate); err != nil {
+	if config.PerEndpointRate, config.PerEndpointPeriod, err = loadEnvRate(
+		"RATE_LIMIT_PER_ENDPOINT",
+		config.PerEndpointRate,
+		config.PerEndpointPeriod,
+	); err != nil {
 		return err
 	}
 
-	if config.GlobalRate, err = loadEnvInt("RATE_LIMIT_GLOBAL", config.GlobalRate); err != nil {
+	if config.GlobalRate, config.GlobalPeriod, err = loadEnvRate(
+		"RATE_LIMIT_GLOBAL",
+		config.GlobalRate,
+		config.GlobalPeriod,
+	); err != nil {
 		return err
 	}
 
@@ -174,7 +595,11 @@ func loadBasicEnvConfig(config *Config) error {
 func loadAdvancedEnvConfig(config *Config) error {
 	var err error
 
-	if config.HTTPRate, err = loadEnvInt("RATE_LIMIT_HTTP_RATE", config.HTTPRate); err != nil {
+	if config.HTTPRate, config.HTTPPeriod, err = loadEnvRate(
+		"RATE_LIMIT_HTTP_RATE",
+		config.HTTPRate,
+		config.HTTPPeriod,
+	); err != nil {
 		return err
 	}
 
@@ -182,7 +607,11 @@ func loadAdvancedEnvConfig(config *Config) error {
 		return err
 	}
 
-	if config.GRPCRate, err = loadEnvInt("RATE_LIMIT_GRPC_RATE", config.GRPCRate); err != nil {
+	if config.GRPCRate, config.GRPCPeriod, err = loadEnvRate(
+		"RATE_LIMIT_GRPC_RATE",
+		config.GRPCRate,
+		config.GRPCPeriod,
+	); err != nil {
 		return err
 	}
 
@@ -192,7 +621,47 @@ func loadAdvancedEnvConfig(config *Config) error {
 
 	config.GrpcMetadataKey = loadEnvString("RATE_LIMIT_GRPC_METADATA_KEY", config.GrpcMetadataKey)
 
-	return nil
+	if config.MaxConcurrent, err = loadEnvInt("RATE_LIMIT_MAX_CONCURRENT", config.MaxConcurrent); err != nil {
+		return err
+	}
+
+	if config.HTTPMaxConcurrent, err = loadEnvInt("RATE_LIMIT_HTTP_MAX_CONCURRENT", config.HTTPMaxConcurrent); err != nil {
+		return err
+	}
+
+	if config.GRPCMaxConcurrent, err = loadEnvInt("RATE_LIMIT_GRPC_MAX_CONCURRENT", config.GRPCMaxConcurrent); err != nil {
+		return err
+	}
+
+	return loadAdaptiveEnvConfig(config)
+}
+
+// loadAdaptiveEnvConfig loads the adaptive concurrency limit from environment variables
+func loadAdaptiveEnvConfig(config *Config) error {
+	var err error
+
+	if enabled := os.Getenv("RATE_LIMIT_ADAPTIVE_CONCURRENCY"); enabled != "" {
+		if config.AdaptiveConcurrency, err = strconv.ParseBool(enabled); err != nil {
+			return fmt.Errorf("invalid RATE_LIMIT_ADAPTIVE_CONCURRENCY value %q: %w", enabled, err)
+		}
+	}
+
+	if config.AdaptiveInitialLimit, err = loadEnvInt(
+		"RATE_LIMIT_ADAPTIVE_INITIAL_LIMIT",
+		config.AdaptiveInitialLimit,
+	); err != nil {
+		return err
+	}
+
+	if config.AdaptiveMinLimit, err = loadEnvInt("RATE_LIMIT_ADAPTIVE_MIN_LIMIT", config.AdaptiveMinLimit); err != nil {
+		return err
+	}
+
+	if config.AdaptiveMaxLimit, err = loadEnvInt("RATE_LIMIT_ADAPTIVE_MAX_LIMIT", config.AdaptiveMaxLimit); err != nil {
+		return err
+	}
+
+	return validateAdaptiveLimits(config)
 }
 
 // loadMemcacheEnvConfig loads Memcache configuration from environment variables
@@ -235,6 +704,13 @@ func loadMemcacheEnvConfig(config *Config) error {
 	// Load Memcache key prefix
 	config.MemcacheKeyPrefix = loadEnvString("MEMCACHE_KEY_PREFIX", config.MemcacheKeyPrefix)
 
+	// Load distributed algorithm
+	if algorithm := os.Getenv("MEMCACHE_ALGORITHM"); algorithm != "" {
+		if config.DistributedAlgorithm, err = parseDistributedAlgorithm(algorithm); err != nil {
+			return fmt.Errorf("invalid MEMCACHE_ALGORITHM: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -274,18 +750,19 @@ func LoadFromEnv() (Config, error) {
 		return config, err
 	}
 
-	// Load new three-tier rate limiting fields
-	if httpRate := os.Getenv("RATE_LIMIT_HTTP_RATE"); httpRate != "" {
-		rate, err := strconv.Atoi(httpRate)
-		if err != nil {
-			return config, fmt.Errorf("invalid RATE_LIMIT_HTTP_RATE value %q: %w", httpRate, err)
-		}
-		if rate <= 0 {
-			return config, fmt.Errorf("RATE_LIMIT_HTTP_RATE must be positive, got %d", rate)
-		}
-		config.HTTPRate = rate
+	if err := loadQuotaEnvConfig(&config); err != nil {
+		return config, err
+	}
+
+	if err := loadCreditEnvConfig(&config); err != nil {
+		return config, err
+	}
+
+	if err := loadPenaltyEnvConfig(&config); err != nil {
+		return config, err
 	}
 
+	// Load new three-tier rate limiting fields
 	if httpBurstSize := os.Getenv("RATE_LIMIT_HTTP_BURST_SIZE"); httpBurstSize != "" {
 		size, err := strconv.Atoi(httpBurstSize)
 		if err != nil {
@@ -297,17 +774,6 @@ func LoadFromEnv() (Config, error) {
 		config.HTTPBurstSize = size
 	}
 
-	if grpcRate := os.Getenv("RATE_LIMIT_GRPC_RATE"); grpcRate != "" {
-		rate, err := strconv.Atoi(grpcRate)
-		if err != nil {
-			return config, fmt.Errorf("invalid RATE_LIMIT_GRPC_RATE value %q: %w", grpcRate, err)
-		}
-		if rate <= 0 {
-			return config, fmt.Errorf("RATE_LIMIT_GRPC_RATE must be positive, got %d", rate)
-		}
-		config.GRPCRate = rate
-	}
-
 	if grpcBurstSize := os.Getenv("RATE_LIMIT_GRPC_BURST_SIZE"); grpcBurstSize != "" {
 		size, err := strconv.Atoi(grpcBurstSize)
 		if err != nil {
@@ -324,9 +790,10 @@ func LoadFromEnv() (Config, error) {
 	}
 
 	// Validate that per-endpoint rate doesn't exceed global rate
-	if config.PerEndpointRate > config.GlobalRate {
-		return config, fmt.Errorf("per-endpoint rate (%d) cannot exceed global rate (%d)",
-			config.PerEndpointRate, config.GlobalRate)
+	perEndpointRate := ratePerSecond(config.PerEndpointRate, config.PerEndpointPeriod)
+	if perEndpointRate > ratePerSecond(config.GlobalRate, config.GlobalPeriod) {
+		return config, fmt.Errorf("per-endpoint rate (%s) cannot exceed global rate (%s)",
+			formatRate(config.PerEndpointRate, config.PerEndpointPeriod), formatRate(config.GlobalRate, config.GlobalPeriod))
 	}
 
 	return config, nil
@@ -373,51 +840,129 @@ func validateAndConvertFileConfig(config *Config, fileConfig *FileConfig) error
 	// User identification
 	config.UserHeader = fileConfig.UserIdentification.HTTPHeader
 	config.GrpcMetadataKey = fileConfig.UserIdentification.GRPCMetadataKey
+	if err := convertKeyExtractors(config, fileConfig); err != nil {
+		return err
+	}
 
 	// Global rate limits
-	if fileConfig.RateLimits.Global.Rate <= 0 {
-		return fmt.Errorf("global rate must be positive, got %d", fileConfig.RateLimits.Global.Rate)
+	var err error
+	rl := &fileConfig.RateLimits
+	if config.GlobalRate, config.GlobalPeriod, err = rl.Global.Rate.resolve(rl.Global.Period); err != nil {
+		return fmt.Errorf("global rate: %w", err)
+	}
+	if rl.Global.Burst <= 0 {
+		return fmt.Errorf("global burst must be positive, got %d", rl.Global.Burst)
 	}
-	if fileConfig.RateLimits.Global.Burst <= 0 {
-		return fmt.Errorf("global burst must be positive, got %d", fileConfig.RateLimits.Global.Burst)
+	config.GlobalBurstSize = rl.Global.Burst
+	if config.GlobalExtraLimits, err = convertLimits("global", rl.Global.Limits); err != nil {
+		return err
 	}
-	config.GlobalRate = fileConfig.RateLimits.Global.Rate
-	config.GlobalBurstSize = fileConfig.RateLimits.Global.Burst
 
 	// HTTP rate limits
-	if fileConfig.RateLimits.HTTP.Rate <= 0 {
-		return fmt.Errorf("HTTP rate must be positive, got %d", fileConfig.RateLimits.HTTP.Rate)
+	if config.HTTPRate, config.HTTPPeriod, err = rl.HTTP.Rate.resolve(rl.HTTP.Period); err != nil {
+		return fmt.Errorf("HTTP rate: %w", err)
 	}
-	if fileConfig.RateLimits.HTTP.Burst <= 0 {
-		return fmt.Errorf("HTTP burst must be positive, got %d", fileConfig.RateLimits.HTTP.Burst)
+	if rl.HTTP.Burst <= 0 {
+		return fmt.Errorf("HTTP burst must be positive, got %d", rl.HTTP.Burst)
 	}
-	if fileConfig.RateLimits.HTTP.DefaultMethodRate <= 0 {
-		return fmt.Errorf("HTTP default method rate must be positive, got %d", fileConfig.RateLimits.HTTP.DefaultMethodRate)
+	config.HTTPBurstSize = rl.HTTP.Burst
+	if config.HTTPExtraLimits, err = convertLimits("HTTP", rl.HTTP.Limits); err != nil {
+		return err
+	}
+	if config.HTTPDefaultMethodRate, config.HTTPDefaultMethodPeriod, err = rl.HTTP.DefaultMethodRate.resolve(
+		rl.HTTP.DefaultMethodPeriod,
+	); err != nil {
+		return fmt.Errorf("HTTP default method rate: %w", err)
 	}
-	config.HTTPRate = fileConfig.RateLimits.HTTP.Rate
-	config.HTTPBurstSize = fileConfig.RateLimits.HTTP.Burst
-	config.HTTPDefaultMethodRate = fileConfig.RateLimits.HTTP.DefaultMethodRate
-	config.HTTPMethods = fileConfig.RateLimits.HTTP.Methods
+
+	httpMethods, err := convertMethodLimits("HTTP", rl.HTTP.Methods)
+	if err != nil {
+		return err
+	}
+	config.HTTPMethods = httpMethods.rates
+	config.HTTPMethodPeriods = httpMethods.periods
+	config.HTTPMethodCosts = httpMethods.costs
+	config.HTTPMethodExtraLimits = httpMethods.limits
+	config.HTTPMethodMaxConcurrent = httpMethods.maxConcurrent
+	config.HTTPMethodPriorities = httpMethods.priorities
+	config.HTTPMethodAggregateLimits = httpMethods.aggregate
+	config.HTTPMethodStrict = httpMethods.strict
 
 	// gRPC rate limits
-	if fileConfig.RateLimits.GRPC.Rate <= 0 {
-		return fmt.Errorf("gRPC rate must be positive, got %d", fileConfig.RateLimits.GRPC.Rate)
+	if config.GRPCRate, config.GRPCPeriod, err = rl.GRPC.Rate.resolve(rl.GRPC.Period); err != nil {
+		return fmt.Errorf("gRPC rate: %w", err)
+	}
+	if rl.GRPC.Burst <= 0 {
+		return fmt.Errorf("gRPC burst must be positive, got %d", rl.GRPC.Burst)
 	}
-	if fileConfig.RateLimits.GRPC.Burst <= 0 {
-		return fmt.Errorf("gRPC burst must be positive, got %d", fileConfig.RateLimits.GRPC.Burst)
+	config.GRPCBurstSize = rl.GRPC.Burst
+	if config.GRPCExtraLimits, err = convertLimits("gRPC", rl.GRPC.Limits); err != nil {
+		return err
+	}
+	if config.GRPCDefaultMethodRate, config.GRPCDefaultMethodPeriod, err = rl.GRPC.DefaultMethodRate.resolve(
+		rl.GRPC.DefaultMethodPeriod,
+	); err != nil {
+		return fmt.Errorf("gRPC default method rate: %w", err)
 	}
-	if fileConfig.RateLimits.GRPC.DefaultMethodRate <= 0 {
-		return fmt.Errorf("gRPC default method rate must be positive, got %d", fileConfig.RateLimits.GRPC.DefaultMethodRate)
+
+	grpcMethods, err := convertMethodLimits("gRPC", rl.GRPC.Methods)
+	if err != nil {
+		return err
 	}
-	config.GRPCRate = fileConfig.RateLimits.GRPC.Rate
-	config.GRPCBurstSize = fileConfig.RateLimits.GRPC.Burst
-	config.GRPCDefaultMethodRate = fileConfig.RateLimits.GRPC.DefaultMethodRate
-	config.GRPCMethods = fileConfig.RateLimits.GRPC.Methods
+	config.GRPCMethods = grpcMethods.rates
+	config.GRPCMethodPeriods = grpcMethods.periods
+	config.GRPCMethodCosts = grpcMethods.costs
+	config.GRPCMethodExtraLimits = grpcMethods.limits
+	config.GRPCMethodMaxConcurrent = grpcMethods.maxConcurrent
+	config.GRPCMethodPriorities = grpcMethods.priorities
+	config.GRPCMethodAggregateLimits = grpcMethods.aggregate
+	config.GRPCMethodStrict = grpcMethods.strict
 
 	// Set per-endpoint to HTTP default for backward compatibility
 	config.PerEndpointRate = config.HTTPDefaultMethodRate
+	config.PerEndpointPeriod = config.HTTPDefaultMethodPeriod
 	config.PerEndpointBurstSize = config.HTTPBurstSize
 
+	// Limits shared by all users
+	if config.AggregateLimits, err = convertLimits("aggregate", rl.Aggregate.Limits); err != nil {
+		return err
+	}
+
+	// Concurrency ceilings
+	if err := convertMaxConcurrent(config, fileConfig); err != nil {
+		return err
+	}
+
+	// Adaptive concurrency limit
+	if err := convertAdaptiveConcurrency(config, fileConfig); err != nil {
+		return err
+	}
+
+	// Calendar quotas
+	if err := convertQuotas(config, fileConfig); err != nil {
+		return err
+	}
+
+	// Prepaid credits
+	if err := convertCredits(config, fileConfig); err != nil {
+		return err
+	}
+
+	// Penalty box
+	if err := convertPenalty(config, fileConfig); err != nil {
+		return err
+	}
+
+	// Priority classes
+	if err := convertPriorities(config, fileConfig); err != nil {
+		return err
+	}
+
+	// Identity hierarchy
+	if err := convertHierarchy(config, fileConfig); err != nil {
+		return err
+	}
+
 	// Memcache configuration
 	if len(fileConfig.Memcache.Servers) > 0 {
 		config.MemcacheServers = fileConfig.Memcache.Servers
@@ -446,8 +991,126 @@ func validateAndConvertFileConfig(config *Config, fileConfig *FileConfig) error
 		if fileConfig.Memcache.KeyPrefix != "" {
 			config.MemcacheKeyPrefix = fileConfig.Memcache.KeyPrefix
 		}
+
+		if fileConfig.Memcache.Algorithm != "" {
+			algorithm, err := parseDistributedAlgorithm(fileConfig.Memcache.Algorithm)
+			if err != nil {
+				return fmt.Errorf("invalid memcache algorithm: %w", err)
+			}
+			config.DistributedAlgorithm = algorithm
+		}
+	}
+
+	// Per-tier algorithms, which may depend on Memcache being configured
+	if err := convertTierAlgorithms(config, fileConfig); err != nil {
+		return err
+	}
+	if err := convertBucketStarts(config, fileConfig); err != nil {
+		return err
+	}
+	if err := validateExtraLimits(config); err != nil {
+		return err
+	}
+	if err := validateStrictMethods(config); err != nil {
+		return err
+	}
+
+	// Plans, each converted from the settings above with its overrides applied
+	if err := convertPlans(config, fileConfig); err != nil {
+		return err
+	}
+	if err := validateCreditFile(config); err != nil {
+		return err
+	}
+	return validateCreditPlans(config)
+}
+
+// convertMaxConcurrent validates and copies the per-user and per-protocol concurrency ceilings
+func convertMaxConcurrent(config *Config, fileConfig *FileConfig) error {
+	tiers := []struct {
+		name  string
+		value int
+		dest  *int
+	}{
+		{"global", fileConfig.RateLimits.Global.MaxConcurrent, &config.MaxConcurrent},
+		{"HTTP", fileConfig.RateLimits.HTTP.MaxConcurrent, &config.HTTPMaxConcurrent},
+		{"gRPC", fileConfig.RateLimits.GRPC.MaxConcurrent, &config.GRPCMaxConcurrent},
+	}
+
+	for _, tier := range tiers {
+		if tier.value < 0 {
+			return fmt.Errorf("%s max_concurrent must not be negative, got %d", tier.name, tier.value)
+		}
+		*tier.dest = tier.value
+	}
+	return nil
+}
+
+// convertAdaptiveConcurrency validates and copies the adaptive concurrency limit settings
+// Limits left out of the file keep their defaults
+func convertAdaptiveConcurrency(config *Config, fileConfig *FileConfig) error {
+	adaptive := fileConfig.RateLimits.AdaptiveConcurrency
+	config.AdaptiveConcurrency = adaptive.Enabled
+
+	limits := []struct {
+		name  string
+		value int
+		dest  *int
+	}{
+		{"initial_limit", adaptive.InitialLimit, &config.AdaptiveInitialLimit},
+		{"min_limit", adaptive.MinLimit, &config.AdaptiveMinLimit},
+		{"max_limit", adaptive.MaxLimit, &config.AdaptiveMaxLimit},
+	}
+
+	for _, limit := range limits {
+		if limit.value < 0 {
+			return fmt.Errorf("adaptive concurrency %s must not be negative, got %d", limit.name, limit.value)
+		}
+		if limit.value > 0 {
+			*limit.dest = limit.value
+		}
 	}
+	return validateAdaptiveLimits(config)
+}
 
+// validateAdaptiveLimits checks that the initial adaptive limit lies between the minimum and maximum
+func validateAdaptiveLimits(config *Config) error {
+	if config.AdaptiveMinLimit > config.AdaptiveMaxLimit {
+		return fmt.Errorf("adaptive concurrency min limit (%d) cannot exceed max limit (%d)",
+			config.AdaptiveMinLimit, config.AdaptiveMaxLimit)
+	}
+	if config.AdaptiveInitialLimit < config.AdaptiveMinLimit || config.AdaptiveInitialLimit > config.AdaptiveMaxLimit {
+		return fmt.Errorf("adaptive concurrency initial limit (%d) must be between %d and %d",
+			config.AdaptiveInitialLimit, config.AdaptiveMinLimit, config.AdaptiveMaxLimit)
+	}
+	return nil
+}
+
+// convertTierAlgorithms validates and copies the per-tier algorithm selections
+// Algorithms kept in Memcache need Memcache servers
+func convertTierAlgorithms(config *Config, fileConfig *FileConfig) error {
+	tiers := []struct {
+		name  string
+		value string
+		dest  *Algorithm
+	}{
+		{"global", fileConfig.RateLimits.Global.Algorithm, &config.GlobalAlgorithm},
+		{"HTTP", fileConfig.RateLimits.HTTP.Algorithm, &config.HTTPAlgorithm},
+		{"HTTP method", fileConfig.RateLimits.HTTP.MethodAlgorithm, &config.HTTPMethodAlgorithm},
+		{"gRPC", fileConfig.RateLimits.GRPC.Algorithm, &config.GRPCAlgorithm},
+		{"gRPC method", fileConfig.RateLimits.GRPC.MethodAlgorithm, &config.GRPCMethodAlgorithm},
+	}
+
+	for _, tier := range tiers {
+		algorithm, err := parseTierAlgorithm(tier.value)
+		if err != nil {
+			return fmt.Errorf("%s algorithm: %w", tier.name, err)
+		}
+		if algorithm.IsDistributed() && !config.IsDistributedEnabled() {
+			return fmt.Errorf("%s algorithm %s requires memcache servers", tier.name, algorithm)
+		}
+		*tier.dest = algorithm
+	}
 	return nil
 }
 
@@ -463,12 +1126,126 @@ func Load() (Config, error) {
 	return LoadFromEnv()
 }
 
-// GetRefillInterval returns the time interval for refilling tokens based on the rate
+// GetRefillInterval returns the time interval for refilling tokens based on a rate per second
 func (c Config) GetRefillInterval(rate int) time.Duration {
-	// Calculate how often to add one token (in nanoseconds)
-	// rate tokens per second = rate tokens / 1000000000 nanoseconds
-	refillInterval := int64(time.Second) / int64(rate)
-	return time.Duration(refillInterval)
+	return c.GetRefillIntervalFor(rate, time.Second)
+}
+
+// GetRefillIntervalFor calculates the time between adding one token for a rate per period
+// A zero period means one second and a non-positive rate is treated as one request per period
+func (c Config) GetRefillIntervalFor(rate int, period time.Duration) time.Duration {
+	if rate <= 0 {
+		rate = 1
+	}
+	return effectivePeriod(period) / time.Duration(rate)
+}
+
+// GetGlobalPeriod returns the period GlobalRate applies to
+func (c Config) GetGlobalPeriod() time.Duration {
+	return effectivePeriod(c.GlobalPeriod)
+}
+
+// GetPerEndpointPeriod returns the period PerEndpointRate applies to
+func (c Config) GetPerEndpointPeriod() time.Duration {
+	return effectivePeriod(c.PerEndpointPeriod)
+}
+
+// GetHTTPPeriod returns the period HTTPRate applies to
+func (c Config) GetHTTPPeriod() time.Duration {
+	return effectivePeriod(c.HTTPPeriod)
+}
+
+// GetGRPCPeriod returns the period GRPCRate applies to
+func (c Config) GetGRPCPeriod() time.Duration {
+	return effectivePeriod(c.GRPCPeriod)
+}
+
+// HTTPEndpointKey returns the key identifying an HTTP endpoint in limiters and Memcache
+func HTTPEndpointKey(method, path string) string {
+	return fmt.Sprintf("%s:%s", method, path)
+}
+
+// lookupHTTPMethod finds an HTTP endpoint in a per-method map
+// Endpoints may be configured as "GET:/api/users" or, as in the config file examples, "GET /api/users"
+func lookupHTTPMethod[V any](methods map[string]V, endpointKey string) (V, bool) {
+	if value, ok := methods[endpointKey]; ok {
+		return value, true
+	}
+	if method, path, found := strings.Cut(endpointKey, ":"); found {
+		value, ok := methods[method+" "+path]
+		return value, ok
+	}
+	var zero V
+	return zero, false
+}
+
+// GetHTTPMethodRate returns the rate for an HTTP endpoint key, falling back to HTTPDefaultMethodRate
+func (c Config) GetHTTPMethodRate(endpointKey string) int {
+	if rate, ok := lookupHTTPMethod(c.HTTPMethods, endpointKey); ok {
+		return rate
+	}
+	return c.HTTPDefaultMethodRate
+}
+
+// GetHTTPMethodPeriod returns the period of an HTTP endpoint's rate, falling back to HTTPDefaultMethodPeriod
+// Only endpoints with their own rate have their own period
+func (c Config) GetHTTPMethodPeriod(endpointKey string) time.Duration {
+	if period, ok := lookupHTTPMethod(c.HTTPMethodPeriods, endpointKey); ok {
+		return effectivePeriod(period)
+	}
+	if _, ok := lookupHTTPMethod(c.HTTPMethods, endpointKey); ok {
+		return time.Second
+	}
+	return effectivePeriod(c.HTTPDefaultMethodPeriod)
+}
+
+// GetHTTPMethodCost returns the number of tokens one request to an HTTP endpoint consumes
+func (c Config) GetHTTPMethodCost(endpointKey string) int {
+	if cost, ok := lookupHTTPMethod(c.HTTPMethodCosts, endpointKey); ok && cost > 0 {
+		return cost
+	}
+	return 1
+}
+
+// GetGRPCMethodRate returns the rate for a gRPC method, falling back to GRPCDefaultMethodRate
+func (c Config) GetGRPCMethodRate(method string) int {
+	if rate, ok := c.GRPCMethods[method]; ok {
+		return rate
+	}
+	return c.GRPCDefaultMethodRate
+}
+
+// GetGRPCMethodPeriod returns the period of a gRPC method's rate, falling back to GRPCDefaultMethodPeriod
+// Only methods with their own rate have their own period
+func (c Config) GetGRPCMethodPeriod(method string) time.Duration {
+	if period, ok := c.GRPCMethodPeriods[method]; ok {
+		return effectivePeriod(period)
+	}
+	if _, ok := c.GRPCMethods[method]; ok {
+		return time.Second
+	}
+	return effectivePeriod(c.GRPCDefaultMethodPeriod)
+}
+
+// GetGRPCMethodCost returns the number of tokens one call to a gRPC method consumes
+func (c Config) GetGRPCMethodCost(method string) int {
+	if cost, ok := c.GRPCMethodCosts[method]; ok && cost > 0 {
+		return cost
+	}
+	return 1
+}
+
+// GetHTTPMethodMaxConcurrent returns the maximum in-flight requests per user for an HTTP endpoint key
+// Zero means the endpoint has no concurrency ceiling of its own
+func (c Config) GetHTTPMethodMaxConcurrent(endpointKey string) int {
+	maxConcurrent, _ := lookupHTTPMethod(c.HTTPMethodMaxConcurrent, endpointKey)
+	return maxConcurrent
+}
+
+// GetGRPCMethodMaxConcurrent returns the maximum in-flight calls per user for a gRPC method
+// Zero means the method has no concurrency ceiling of its own
+func (c Config) GetGRPCMethodMaxConcurrent(method string) int {
+	return c.GRPCMethodMaxConcurrent[method]
 }
 
 // IsDistributedEnabled returns true if distributed rate limiting is enabled
@@ -484,4 +1261,11 @@ func (c Config) GetMemcacheKey(scope, userID, identifier string) string {
 		key = fmt.Sprintf("%s:%s", key, identifier)
 	}
 	return key
-}
\ No newline at end of file
+}
+
+// GetWindowMemcacheKey generates a Memcache key for a fixed rate limiting window
+// Key format: {prefix}:{scope}:{user_id}:{identifier}:{window}
+// window is the index of the window since the Unix epoch, so all instances agree on its boundaries
+func (c Config) GetWindowMemcacheKey(scope, userID, identifier string, window int64) string {
+	return fmt.Sprintf("%s:%d", c.GetMemcacheKey(scope, userID, identifier), window)
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
@@ -25,6 +26,43 @@ func configsEqual(a, b Config) bool {
 		reflect.DeepEqual(a.GRPCMethods, b.GRPCMethods)
 }
 
+// clearEnv unsets every environment variable read by LoadFromEnv
+func clearEnv() {
+	for _, envVar := range []string{
+		"RATE_LIMIT_USER_HEADER",
+		"RATE_LIMIT_PER_ENDPOINT",
+		"RATE_LIMIT_GLOBAL",
+		"RATE_LIMIT_BURST_SIZE",
+		"RATE_LIMIT_GLOBAL_BURST_SIZE",
+		"RATE_LIMIT_PER_ENDPOINT_BURST_SIZE",
+		"RATE_LIMIT_HTTP_RATE",
+		"RATE_LIMIT_HTTP_BURST_SIZE",
+		"RATE_LIMIT_GRPC_RATE",
+		"RATE_LIMIT_GRPC_BURST_SIZE",
+		"RATE_LIMIT_GRPC_METADATA_KEY",
+		"RATE_LIMIT_MAX_CONCURRENT",
+		"RATE_LIMIT_HTTP_MAX_CONCURRENT",
+		"RATE_LIMIT_GRPC_MAX_CONCURRENT",
+		"RATE_LIMIT_ADAPTIVE_CONCURRENCY",
+		"RATE_LIMIT_ADAPTIVE_INITIAL_LIMIT",
+		"RATE_LIMIT_ADAPTIVE_MIN_LIMIT",
+		"RATE_LIMIT_ADAPTIVE_MAX_LIMIT",
+		"RATE_LIMIT_DAILY_QUOTA",
+		"RATE_LIMIT_MONTHLY_QUOTA",
+		"RATE_LIMIT_QUOTA_TIMEZONE",
+		"RATE_LIMIT_QUOTA_FILE",
+		"RATE_LIMIT_PENALTY_THRESHOLD",
+		"RATE_LIMIT_PENALTY_WINDOW",
+		"RATE_LIMIT_PENALTY_BAN",
+		"RATE_LIMIT_PENALTY_MAX_BAN",
+		"RATE_LIMIT_PENALTY_TARPIT",
+		"RATE_LIMIT_CONFIG_PATH",
+		"MEMCACHE_ALGORITHM",
+	} {
+		_ = os.Unsetenv(envVar)
+	}
+}
+
 func TestDefaultConfig(t *testing.T) {
 	config := DefaultConfig()
 
@@ -163,10 +201,10 @@ func TestLoadFromEnv(t *testing.T) {
 		{
 			name: "all custom values",
 			env: map[string]string{
-				"RATE_LIMIT_USER_HEADER":    "Authorization",
-				"RATE_LIMIT_PER_ENDPOINT":   "5",
-				"RATE_LIMIT_GLOBAL":         "50",
-				"RATE_LIMIT_BURST_SIZE":     "5",
+				"RATE_LIMIT_USER_HEADER":  "Authorization",
+				"RATE_LIMIT_PER_ENDPOINT": "5",
+				"RATE_LIMIT_GLOBAL":       "50",
+				"RATE_LIMIT_BURST_SIZE":   "5",
 			},
 			expected: Config{
 				UserHeader:            "Authorization",
@@ -267,18 +305,7 @@ func TestLoadFromEnv(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Clear all environment variables first
-			_ = os.Unsetenv("RATE_LIMIT_USER_HEADER")
-			_ = os.Unsetenv("RATE_LIMIT_PER_ENDPOINT")
-			_ = os.Unsetenv("RATE_LIMIT_GLOBAL")
-			_ = os.Unsetenv("RATE_LIMIT_BURST_SIZE")
-			_ = os.Unsetenv("RATE_LIMIT_GLOBAL_BURST_SIZE")
-			_ = os.Unsetenv("RATE_LIMIT_PER_ENDPOINT_BURST_SIZE")
-			_ = os.Unsetenv("RATE_LIMIT_HTTP_RATE")
-			_ = os.Unsetenv("RATE_LIMIT_HTTP_BURST_SIZE")
-			_ = os.Unsetenv("RATE_LIMIT_GRPC_RATE")
-			_ = os.Unsetenv("RATE_LIMIT_GRPC_BURST_SIZE")
-			_ = os.Unsetenv("RATE_LIMIT_GRPC_METADATA_KEY")
-			_ = os.Unsetenv("RATE_LIMIT_CONFIG_PATH")
+			clearEnv()
 
 			// Set test environment variables
 			for key, value := range tt.env {
@@ -425,4 +452,438 @@ func TestLoadFromFile(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestDistributedAlgorithm(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      string
+		expected Algorithm
+		hasError bool
+	}{
+		{name: "default", env: "", expected: AlgorithmFixedWindow},
+		{name: "fixed window", env: "fixed_window", expected: AlgorithmFixedWindow},
+		{name: "gcra", env: "gcra", expected: AlgorithmGCRA},
+		{name: "sliding window", env: "sliding_window", expected: AlgorithmSlidingWindow},
+		{name: "unknown algorithm", env: "leaky", hasError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv()
+			t.Setenv("MEMCACHE_ALGORITHM", tt.env)
+
+			config, err := LoadFromEnv()
+			if tt.hasError {
+				if err == nil {
+					t.Error("LoadFromEnv() expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadFromEnv() unexpected error: %v", err)
+			}
+			if config.DistributedAlgorithm != tt.expected {
+				t.Errorf("DistributedAlgorithm = %q, want %q", config.DistributedAlgorithm, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetWindowMemcacheKey(t *testing.T) {
+	config := DefaultConfig()
+
+	tests := []struct {
+		name       string
+		scope      string
+		identifier string
+		window     int64
+		expected   string
+	}{
+		{
+			name:     "without identifier",
+			scope:    "global",
+			window:   1700000000,
+			expected: "rate_limit:global:user123:1700000000",
+		},
+		{
+			name:       "with identifier",
+			scope:      "endpoint",
+			identifier: "GET:/api/users",
+			window:     42,
+			expected:   "rate_limit:endpoint:user123:GET:/api/users:42",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := config.GetWindowMemcacheKey(tt.scope, "user123", tt.identifier, tt.window)
+			if result != tt.expected {
+				t.Errorf("GetWindowMemcacheKey() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadFromFile_TierAlgorithms(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected Config
+		hasError bool
+	}{
+		{
+			name: "leaky bucket tiers",
+			content: `
+rate_limits:
+  global: {rate: 100, burst: 10}
+  http: {rate: 50, burst: 5, default_method_rate: 10, method_algorithm: leaky_bucket}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5, algorithm: leaky_bucket}
+`,
+			expected: Config{
+				HTTPMethodAlgorithm: AlgorithmLeakyBucket,
+				GRPCAlgorithm:       AlgorithmLeakyBucket,
+			},
+		},
+		{
+			name: "memcache algorithms per tier",
+			content: `
+rate_limits:
+  global: {rate: 100, burst: 10, algorithm: sliding_window}
+  http: {rate: 50, burst: 5, default_method_rate: 10, algorithm: gcra, method_algorithm: token_bucket}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5, algorithm: fixed_window}
+memcache:
+  servers: [localhost:11211]
+`,
+			expected: Config{
+				GlobalAlgorithm:     AlgorithmSlidingWindow,
+				HTTPAlgorithm:       AlgorithmGCRA,
+				HTTPMethodAlgorithm: AlgorithmTokenBucket,
+				GRPCAlgorithm:       AlgorithmFixedWindow,
+			},
+		},
+		{
+			name: "memcache algorithm without memcache",
+			content: `
+rate_limits:
+  global: {rate: 100, burst: 10, algorithm: sliding_window}
+  http: {rate: 50, burst: 5, default_method_rate: 10}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+`,
+			hasError: true,
+		},
+		{
+			name: "memcache algorithm for gRPC methods",
+			content: `
+rate_limits:
+  global: {rate: 100, burst: 10}
+  http: {rate: 50, burst: 5, default_method_rate: 10}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5, method_algorithm: gcra}
+memcache:
+  servers: [localhost:11211]
+`,
+			expected: Config{
+				GRPCMethodAlgorithm: AlgorithmGCRA,
+			},
+		},
+		{
+			name: "unknown tier algorithm",
+			content: `
+rate_limits:
+  global: {rate: 100, burst: 10, algorithm: fifo}
+  http: {rate: 50, burst: 5, default_method_rate: 10}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+`,
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(filePath, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			config, err := LoadFromFile(filePath)
+			if tt.hasError {
+				if err == nil {
+					t.Error("LoadFromFile() expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadFromFile() unexpected error: %v", err)
+			}
+
+			if config.GlobalAlgorithm != tt.expected.GlobalAlgorithm ||
+				config.HTTPAlgorithm != tt.expected.HTTPAlgorithm ||
+				config.HTTPMethodAlgorithm != tt.expected.HTTPMethodAlgorithm ||
+				config.GRPCAlgorithm != tt.expected.GRPCAlgorithm ||
+				config.GRPCMethodAlgorithm != tt.expected.GRPCMethodAlgorithm {
+				t.Errorf("tier algorithms = %q/%q/%q/%q/%q, want %q/%q/%q/%q/%q",
+					config.GlobalAlgorithm, config.HTTPAlgorithm, config.HTTPMethodAlgorithm,
+					config.GRPCAlgorithm, config.GRPCMethodAlgorithm,
+					tt.expected.GlobalAlgorithm, tt.expected.HTTPAlgorithm, tt.expected.HTTPMethodAlgorithm,
+					tt.expected.GRPCAlgorithm, tt.expected.GRPCMethodAlgorithm)
+			}
+		})
+	}
+}
+
+func TestLoadFromFile_MethodCosts(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		content  string
+		hasError bool
+	}{
+		{
+			name:     "JSON",
+			fileName: "config.json",
+			content: `{
+				"rate_limits": {
+					"global": {"rate": 100, "burst": 10},
+					"http": {"rate": 50, "burst": 5, "default_method_rate": 10, "methods": {
+						"GET /api/users": 20,
+						"POST /api/users/batch": {"rate": 5, "cost": 10}
+					}},
+					"grpc": {"rate": 30, "burst": 3, "default_method_rate": 5, "methods": {
+						"/ExportService/Export": {"cost": 50}
+					}}
+				}
+			}`,
+		},
+		{
+			name:     "YAML",
+			fileName: "config.yaml",
+			content: `
+rate_limits:
+  global: {rate: 100, burst: 10}
+  http:
+    rate: 50
+    burst: 5
+    default_method_rate: 10
+    methods:
+      GET /api/users: 20
+      POST /api/users/batch: {rate: 5, cost: 10}
+  grpc:
+    rate: 30
+    burst: 3
+    default_method_rate: 5
+    methods:
+      /ExportService/Export: {cost: 50}
+`,
+		},
+		{
+			name:     "negative cost",
+			fileName: "config.yaml",
+			content: `
+rate_limits:
+  global: {rate: 100, burst: 10}
+  http: {rate: 50, burst: 5, default_method_rate: 10, methods: {"POST /x": {cost: -1}}}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+`,
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), tt.fileName)
+			if err := os.WriteFile(filePath, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			config, err := LoadFromFile(filePath)
+			if tt.hasError {
+				if err == nil {
+					t.Error("LoadFromFile() expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadFromFile() unexpected error: %v", err)
+			}
+
+			expectedMethods := map[string]int{"GET /api/users": 20, "POST /api/users/batch": 5}
+			if !reflect.DeepEqual(config.HTTPMethods, expectedMethods) {
+				t.Errorf("HTTPMethods = %v, want %v", config.HTTPMethods, expectedMethods)
+			}
+			if cost := config.GetHTTPMethodCost(HTTPEndpointKey("POST", "/api/users/batch")); cost != 10 {
+				t.Errorf("HTTP batch cost = %d, want 10", cost)
+			}
+			if cost := config.GetHTTPMethodCost(HTTPEndpointKey("GET", "/api/users")); cost != 1 {
+				t.Errorf("HTTP default cost = %d, want 1", cost)
+			}
+			if rate := config.GetHTTPMethodRate(HTTPEndpointKey("GET", "/api/users")); rate != 20 {
+				t.Errorf("HTTP method rate = %d, want 20", rate)
+			}
+			if rate := config.GetGRPCMethodRate("/ExportService/Export"); rate != 5 {
+				t.Errorf("gRPC method without rate should use the default, got %d", rate)
+			}
+			if cost := config.GetGRPCMethodCost("/ExportService/Export"); cost != 50 {
+				t.Errorf("gRPC export cost = %d, want 50", cost)
+			}
+		})
+	}
+}
+
+func TestLoadFromFile_MaxConcurrent(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		hasError bool
+	}{
+		{
+			name: "ceilings",
+			content: `
+rate_limits:
+  global: {rate: 100, burst: 10, max_concurrent: 10}
+  http:
+    rate: 50
+    burst: 5
+    default_method_rate: 10
+    max_concurrent: 5
+    methods:
+      GET /api/reports: {rate: 1, max_concurrent: 3}
+  grpc:
+    rate: 30
+    burst: 3
+    default_method_rate: 5
+    methods:
+      /ReportService/Generate: {max_concurrent: 2}
+`,
+		},
+		{
+			name: "negative ceiling",
+			content: `
+rate_limits:
+  global: {rate: 100, burst: 10}
+  http: {rate: 50, burst: 5, default_method_rate: 10, max_concurrent: -1}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+`,
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(filePath, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			config, err := LoadFromFile(filePath)
+			if (err != nil) != tt.hasError {
+				t.Fatalf("LoadFromFile() error = %v, hasError %v", err, tt.hasError)
+			}
+			if tt.hasError {
+				return
+			}
+
+			if config.MaxConcurrent != 10 || config.HTTPMaxConcurrent != 5 || config.GRPCMaxConcurrent != 0 {
+				t.Errorf("ceilings = %d/%d/%d, want 10/5/0",
+					config.MaxConcurrent, config.HTTPMaxConcurrent, config.GRPCMaxConcurrent)
+			}
+			if ceiling := config.GetHTTPMethodMaxConcurrent("GET:/api/reports"); ceiling != 3 {
+				t.Errorf("GET /api/reports ceiling = %d, want 3", ceiling)
+			}
+			if ceiling := config.GetHTTPMethodMaxConcurrent("GET:/api/users"); ceiling != 0 {
+				t.Errorf("GET /api/users ceiling = %d, want 0", ceiling)
+			}
+			if ceiling := config.GetGRPCMethodMaxConcurrent("/ReportService/Generate"); ceiling != 2 {
+				t.Errorf("/ReportService/Generate ceiling = %d, want 2", ceiling)
+			}
+		})
+	}
+}
+
+func TestLoadFromFile_AdaptiveConcurrency(t *testing.T) {
+	tests := []struct {
+		name     string
+		section  string
+		expected Config
+		hasError bool
+	}{
+		{
+			name:     "defaults",
+			section:  "",
+			expected: Config{AdaptiveInitialLimit: 20, AdaptiveMinLimit: 1, AdaptiveMaxLimit: 1000},
+		},
+		{
+			name:    "enabled",
+			section: "  adaptive_concurrency: {enabled: true, initial_limit: 50, min_limit: 10, max_limit: 200}",
+			expected: Config{
+				AdaptiveConcurrency:  true,
+				AdaptiveInitialLimit: 50,
+				AdaptiveMinLimit:     10,
+				AdaptiveMaxLimit:     200,
+			},
+		},
+		{
+			name:     "initial limit above max",
+			section:  "  adaptive_concurrency: {enabled: true, initial_limit: 50, max_limit: 40}",
+			hasError: true,
+		},
+		{
+			name:     "negative limit",
+			section:  "  adaptive_concurrency: {enabled: true, min_limit: -1}",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := `
+rate_limits:
+  global: {rate: 100, burst: 10}
+  http: {rate: 50, burst: 5, default_method_rate: 10}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+` + tt.section + "\n"
+			filePath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(filePath, []byte(content), 0600); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			config, err := LoadFromFile(filePath)
+			if (err != nil) != tt.hasError {
+				t.Fatalf("LoadFromFile() error = %v, hasError %v", err, tt.hasError)
+			}
+			if tt.hasError {
+				return
+			}
+
+			if config.AdaptiveConcurrency != tt.expected.AdaptiveConcurrency ||
+				config.AdaptiveInitialLimit != tt.expected.AdaptiveInitialLimit ||
+				config.AdaptiveMinLimit != tt.expected.AdaptiveMinLimit ||
+				config.AdaptiveMaxLimit != tt.expected.AdaptiveMaxLimit {
+				t.Errorf("adaptive concurrency = %v %d/%d/%d, want %v %d/%d/%d",
+					config.AdaptiveConcurrency, config.AdaptiveInitialLimit, config.AdaptiveMinLimit,
+					config.AdaptiveMaxLimit, tt.expected.AdaptiveConcurrency, tt.expected.AdaptiveInitialLimit,
+					tt.expected.AdaptiveMinLimit, tt.expected.AdaptiveMaxLimit)
+			}
+		})
+	}
+}
+
+func TestLoadFromEnv_AdaptiveConcurrency(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	_ = os.Setenv("RATE_LIMIT_ADAPTIVE_CONCURRENCY", "true")
+	_ = os.Setenv("RATE_LIMIT_ADAPTIVE_MAX_LIMIT", "100")
+
+	config, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv() error = %v", err)
+	}
+	if !config.AdaptiveConcurrency || config.AdaptiveInitialLimit != 20 || config.AdaptiveMaxLimit != 100 {
+		t.Errorf("adaptive concurrency = %v %d/%d, want true 20/100",
+			config.AdaptiveConcurrency, config.AdaptiveInitialLimit, config.AdaptiveMaxLimit)
+	}
+
+	_ = os.Setenv("RATE_LIMIT_ADAPTIVE_MAX_LIMIT", "10")
+	if _, err := LoadFromEnv(); err == nil {
+		t.Error("LoadFromEnv() should reject an initial limit above the max limit")
+	}
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// CreditsValue is the credits section of a config file, e.g.
+// {"enabled": true, "plans": ["metered"], "file": "credits.json"}
+type CreditsValue struct {
+	// Enabled charges every user's requests to their prepaid balance, unless Plans narrows it down
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// Plans are the plans whose users are charged; listing plans enables credits for them
+	Plans []string `json:"plans" yaml:"plans"`
+	// File is the file balances persist to when Memcache is not configured
+	File string `json:"file" yaml:"file"`
+	// FlushInterval is how often balances are written to File, e.g. "5s"
+	FlushInterval string `json:"flush_interval" yaml:"flush_interval"`
+}
+
+// convertCredits validates and copies the prepaid credit settings
+// The plans listed are checked by validateCreditPlans once the plans have been converted
+func convertCredits(config *Config, fileConfig *FileConfig) error {
+	credits := fileConfig.RateLimits.Credits
+
+	config.CreditPlans = credits.Plans
+	config.ChargeCredits = credits.Enabled && len(credits.Plans) == 0
+	config.CreditFile = credits.File
+	if credits.FlushInterval != "" {
+		interval, err := time.ParseDuration(credits.FlushInterval)
+		if err != nil {
+			return fmt.Errorf("invalid credit flush interval %q: %w", credits.FlushInterval, err)
+		}
+		if interval <= 0 {
+			return fmt.Errorf("credit flush interval must be positive, got %s", interval)
+		}
+		config.CreditFlushInterval = interval
+	}
+	return nil
+}
+
+// validateCreditPlans checks that every plan charged credits is defined
+func validateCreditPlans(config *Config) error {
+	for _, plan := range config.CreditPlans {
+		if _, ok := config.Plans[plan]; !ok {
+			return fmt.Errorf("credit plan %q is not defined", plan)
+		}
+	}
+	return nil
+}
+
+// validateCreditFile rejects a credit file when Memcache is configured, since balances are then kept
+// in Memcache and the file would be silently ignored
+func validateCreditFile(config *Config) error {
+	if config.CreditFile != "" && config.IsDistributedEnabled() {
+		return fmt.Errorf("credit file %q cannot be used with memcache, which keeps the balances", config.CreditFile)
+	}
+	return nil
+}
+
+// loadCreditEnvConfig loads the prepaid credit settings from environment variables
+func loadCreditEnvConfig(config *Config) error {
+	if enabled := os.Getenv("RATE_LIMIT_CREDITS_ENABLED"); enabled != "" {
+		var err error
+		if config.ChargeCredits, err = strconv.ParseBool(enabled); err != nil {
+			return fmt.Errorf("invalid RATE_LIMIT_CREDITS_ENABLED value %q: %w", enabled, err)
+		}
+	}
+
+	config.CreditFile = loadEnvString("RATE_LIMIT_CREDIT_FILE", config.CreditFile)
+	return validateCreditFile(config)
+}
+
+// chargesPlanCredits reports whether users on the named plan are charged credits: those on the
+// listed credit plans, or every user if credits are enabled without listing plans
+func (c Config) chargesPlanCredits(plan string) bool {
+	if len(c.CreditPlans) == 0 {
+		return c.ChargeCredits
+	}
+	return slices.Contains(c.CreditPlans, plan)
+}
+
+// HasCredits reports whether the requests of any user are charged to a prepaid credit balance
+func (c Config) HasCredits() bool {
+	return c.ChargeCredits || len(c.CreditPlans) > 0
+}
+
+// GetCreditFlushInterval returns how often file-backed credit balances are written to disk
+func (c Config) GetCreditFlushInterval() time.Duration {
+	if c.CreditFlushInterval <= 0 {
+		return 5 * time.Second
+	}
+	return c.CreditFlushInterval
+}
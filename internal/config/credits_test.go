@@ -0,0 +1,105 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadFromFile_Credits(t *testing.T) {
+	tests := []struct {
+		name          string
+		credits       string
+		charged       bool
+		freeCharged   bool
+		meteredCharge bool
+		memcache      string
+		flushInterval time.Duration
+		hasError      bool
+	}{
+		{
+			name:          "disabled by default",
+			flushInterval: 5 * time.Second,
+		},
+		{
+			name:          "enabled for every user",
+			credits:       "credits: {enabled: true, file: credits.json, flush_interval: 1m}",
+			charged:       true,
+			freeCharged:   true,
+			meteredCharge: true,
+			flushInterval: time.Minute,
+		},
+		{
+			name:          "enabled for one plan",
+			credits:       "credits: {plans: [metered]}",
+			meteredCharge: true,
+			flushInterval: 5 * time.Second,
+		},
+		{
+			name:     "undefined plan",
+			credits:  "credits: {plans: [gold]}",
+			hasError: true,
+		},
+		{
+			name:          "balances in memcache",
+			credits:       "credits: {enabled: true}",
+			memcache:      "memcache: {servers: [localhost:11211]}",
+			charged:       true,
+			freeCharged:   true,
+			meteredCharge: true,
+			flushInterval: 5 * time.Second,
+		},
+		{
+			name:     "file ignored with memcache",
+			credits:  "credits: {enabled: true, file: credits.json}",
+			memcache: "memcache: {servers: [localhost:11211]}",
+			hasError: true,
+		},
+		{
+			name:     "invalid flush interval",
+			credits:  "credits: {enabled: true, flush_interval: soon}",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := `
+rate_limits:
+  global: {rate: 100, burst: 10}
+  http: {rate: 50, burst: 5, default_method_rate: 10}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+  plans: {definitions: {free: {}, metered: {global: {rate: 1000}}}}
+  ` + tt.credits + "\n" + tt.memcache + "\n"
+			filePath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(filePath, []byte(content), 0600); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			config, err := LoadFromFile(filePath)
+			if (err != nil) != tt.hasError {
+				t.Fatalf("LoadFromFile() error = %v, hasError %v", err, tt.hasError)
+			}
+			if tt.hasError {
+				return
+			}
+
+			if config.ChargeCredits != tt.charged {
+				t.Errorf("ChargeCredits = %v, want %v", config.ChargeCredits, tt.charged)
+			}
+			if config.Plans["free"].ChargeCredits != tt.freeCharged {
+				t.Errorf("free plan ChargeCredits = %v, want %v", config.Plans["free"].ChargeCredits, tt.freeCharged)
+			}
+			if charged := config.Plans["metered"].ChargeCredits; charged != tt.meteredCharge {
+				t.Errorf("metered plan ChargeCredits = %v, want %v", charged, tt.meteredCharge)
+			}
+			if config.HasCredits() != (tt.charged || tt.meteredCharge) {
+				t.Errorf("HasCredits() = %v", config.HasCredits())
+			}
+			if interval := config.GetCreditFlushInterval(); interval != tt.flushInterval {
+				t.Errorf("GetCreditFlushInterval() = %v, want %v", interval, tt.flushInterval)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UserLevel is the name of the identity hierarchy level of the user identified by KeyExtractors
+// or UserHeader and GrpcMetadataKey; its limits are the global, protocol and per-method tiers
+const UserLevel = "user"
+
+// IdentityLevel is a level of the identity hierarchy, such as an organization above the user
+// or an API key below it
+type IdentityLevel struct {
+	// Name identifies the level in rejections and Memcache keys
+	Name string
+	// Header is the HTTP header identifying the level; empty ignores the level on HTTP
+	Header string
+	// MetadataKey is the gRPC metadata key identifying the level; empty ignores the level on gRPC
+	MetadataKey string
+	// Limits are the windows each identity at this level is held to
+	Limits []Limit
+}
+
+// IdentityLevelValue is an entry of the hierarchy list in a config file,
+// e.g. {"name": "org", "header": "X-Org-ID", "metadata_key": "org-id", "limits": ["1000/s"]}
+type IdentityLevelValue struct {
+	// Name identifies the level; "user" places the user in the hierarchy
+	Name string `json:"name" yaml:"name"`
+	// Header is the HTTP header identifying the level
+	Header string `json:"header" yaml:"header"`
+	// MetadataKey is the gRPC metadata key identifying the level
+	MetadataKey string `json:"metadata_key" yaml:"metadata_key"`
+	// Limits are the windows each identity at this level is held to
+	Limits []LimitValue `json:"limits" yaml:"limits"`
+}
+
+// convertHierarchy validates and converts the identity hierarchy, listed from the outermost level
+// to the innermost
+func convertHierarchy(config *Config, fileConfig *FileConfig) error {
+	config.IdentityLevels = nil
+	for i, value := range fileConfig.RateLimits.Hierarchy {
+		if value.Name == "" {
+			return fmt.Errorf("hierarchy level %d must have a name", i+1)
+		}
+		limits, err := convertLimits(fmt.Sprintf("hierarchy level %q", value.Name), value.Limits)
+		if err != nil {
+			return err
+		}
+		config.IdentityLevels = append(config.IdentityLevels, IdentityLevel{
+			Name:        value.Name,
+			Header:      value.Header,
+			MetadataKey: value.MetadataKey,
+			Limits:      limits,
+		})
+	}
+	return validateHierarchy(config)
+}
+
+// validateHierarchy checks that level names are unique, that the user has a place in the hierarchy
+// and that every other level can be identified and has limits
+func validateHierarchy(config *Config) error {
+	levels := config.IdentityLevels
+	if len(levels) == 0 {
+		return nil
+	}
+	if config.GetUserLevel() < 0 {
+		return fmt.Errorf("hierarchy must include the %q level", UserLevel)
+	}
+
+	for i, level := range levels {
+		if config.GetIdentityLevel(level.Name) != i {
+			return fmt.Errorf("hierarchy level %q is defined twice", level.Name)
+		}
+		if level.Name == UserLevel {
+			if level.Header != "" || level.MetadataKey != "" || len(level.Limits) > 0 {
+				return fmt.Errorf("hierarchy level %q is identified and limited by the user settings", UserLevel)
+			}
+			continue
+		}
+		if level.Header == "" && level.MetadataKey == "" {
+			return fmt.Errorf("hierarchy level %q needs a header or a metadata key", level.Name)
+		}
+		if len(level.Limits) == 0 {
+			return fmt.Errorf("hierarchy level %q needs at least one limit", level.Name)
+		}
+	}
+	return nil
+}
+
+// GetIdentityLevel returns the index of the named hierarchy level, 0 being the outermost, or -1
+func (c Config) GetIdentityLevel(name string) int {
+	for i, level := range c.IdentityLevels {
+		if level.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetUserLevel returns the index of the user in the identity hierarchy, or -1 if there is no hierarchy
+func (c Config) GetUserLevel() int {
+	return c.GetIdentityLevel(UserLevel)
+}
+
+// GetLevelIdentity returns the identity a request has at a hierarchy level, given its identity at
+// every level: the identities from the outermost level down to that one, joined with "/", so the
+// same API key under two users counts separately, e.g. "acme/user123/key1"
+// Levels the request is not identified at are left out
+func (c Config) GetLevelIdentity(identities []string, level int) string {
+	path := make([]string, 0, level+1)
+	for _, identity := range identities[:level+1] {
+		if identity != "" {
+			path = append(path, identity)
+		}
+	}
+	return strings.Join(path, "/")
+}
+
+// HasIdentityHierarchy reports whether requests are identified at levels other than the user
+func (c Config) HasIdentityHierarchy() bool {
+	return len(c.IdentityLevels) > 0
+}
+
+// GetLevelLimits returns the limits of the named hierarchy level, or nil
+func (c Config) GetLevelLimits(name string) []Limit {
+	if i := c.GetIdentityLevel(name); i >= 0 {
+		return c.IdentityLevels[i].Limits
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadFromFile_Hierarchy(t *testing.T) {
+	tests := []struct {
+		name     string
+		section  string
+		expected []IdentityLevel
+		hasError bool
+	}{
+		{
+			name: "organization, user and API key",
+			section: `  hierarchy:
+    - {name: org, header: X-Org-ID, metadata_key: org-id, limits: [1000/s, 1000000/d]}
+    - {name: user}
+    - {name: key, header: X-API-Key, limits: [10/s]}`,
+			expected: []IdentityLevel{
+				{
+					Name:        "org",
+					Header:      "X-Org-ID",
+					MetadataKey: "org-id",
+					Limits: []Limit{
+						{Rate: 1000, Period: time.Second, Burst: 1000},
+						{Rate: 1000000, Period: 24 * time.Hour, Burst: 1000000},
+					},
+				},
+				{Name: "user"},
+				{Name: "key", Header: "X-API-Key", Limits: []Limit{{Rate: 10, Period: time.Second, Burst: 10}}},
+			},
+		},
+		{
+			name:     "no hierarchy",
+			section:  "",
+			expected: nil,
+		},
+		{
+			name:     "missing user level",
+			section:  "  hierarchy: [{name: org, header: X-Org-ID, limits: [1000/s]}]",
+			hasError: true,
+		},
+		{
+			name: "duplicate level",
+			section: `  hierarchy:
+    - {name: org, header: X-Org-ID, limits: [1000/s]}
+    - {name: user}
+    - {name: org, header: X-Team-ID, limits: [10/s]}`,
+			hasError: true,
+		},
+		{
+			name:     "unnamed level",
+			section:  "  hierarchy: [{header: X-Org-ID, limits: [1000/s]}, {name: user}]",
+			hasError: true,
+		},
+		{
+			name:     "level without header or metadata key",
+			section:  "  hierarchy: [{name: org, limits: [1000/s]}, {name: user}]",
+			hasError: true,
+		},
+		{
+			name:     "level without limits",
+			section:  "  hierarchy: [{name: org, header: X-Org-ID}, {name: user}]",
+			hasError: true,
+		},
+		{
+			name:     "user level with limits",
+			section:  "  hierarchy: [{name: org, header: X-Org-ID, limits: [1000/s]}, {name: user, limits: [10/s]}]",
+			hasError: true,
+		},
+		{
+			name:     "invalid limit",
+			section:  "  hierarchy: [{name: org, header: X-Org-ID, limits: [1000/week]}, {name: user}]",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := `
+rate_limits:
+  global: {rate: 100, burst: 10}
+  http: {rate: 50, burst: 5, default_method_rate: 10}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+` + tt.section + "\n"
+			filePath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(filePath, []byte(content), 0600); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			config, err := LoadFromFile(filePath)
+			if (err != nil) != tt.hasError {
+				t.Fatalf("LoadFromFile() error = %v, hasError %v", err, tt.hasError)
+			}
+			if tt.hasError {
+				return
+			}
+
+			if !reflect.DeepEqual(config.IdentityLevels, tt.expected) {
+				t.Errorf("IdentityLevels = %v, want %v", config.IdentityLevels, tt.expected)
+			}
+			if has := config.HasIdentityHierarchy(); has != (tt.expected != nil) {
+				t.Errorf("HasIdentityHierarchy() = %v, want %v", has, tt.expected != nil)
+			}
+		})
+	}
+}
+
+func TestConfig_GetLevelIdentity(t *testing.T) {
+	config := Config{IdentityLevels: []IdentityLevel{{Name: "org"}, {Name: UserLevel}, {Name: "key"}}}
+
+	tests := []struct {
+		name       string
+		identities []string
+		level      int
+		expected   string
+	}{
+		{"outermost level", []string{"acme", "user123", "key1"}, 0, "acme"},
+		{"user level", []string{"acme", "user123", "key1"}, 1, "acme/user123"},
+		{"innermost level", []string{"acme", "user123", "key1"}, 2, "acme/user123/key1"},
+		{"missing outer level", []string{"", "user123", "key1"}, 2, "user123/key1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if identity := config.GetLevelIdentity(tt.identities, tt.level); identity != tt.expected {
+				t.Errorf("GetLevelIdentity(%v, %d) = %q, want %q", tt.identities, tt.level, identity, tt.expected)
+			}
+		})
+	}
+
+	if level := config.GetUserLevel(); level != 1 {
+		t.Errorf("GetUserLevel() = %d, want 1", level)
+	}
+	if limits := config.GetLevelLimits("team"); limits != nil {
+		t.Errorf("GetLevelLimits(team) = %v, want nil", limits)
+	}
+}
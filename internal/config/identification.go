@@ -0,0 +1,237 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// DefaultIPv6PrefixLength is the prefix IPv6 clients are grouped by when an ip extractor sets none,
+// the size of the network usually assigned to a single host or site
+const DefaultIPv6PrefixLength = 64
+
+// ForwardedHeader names the forwarding header the trusted proxies of an ip extractor write the
+// client address to
+type ForwardedHeader string
+
+const (
+	// ForwardedHeaderForwarded is the RFC 7239 Forwarded header
+	ForwardedHeaderForwarded ForwardedHeader = "forwarded"
+	// ForwardedHeaderXForwardedFor is the X-Forwarded-For header, the default
+	ForwardedHeaderXForwardedFor ForwardedHeader = "x-forwarded-for"
+	// ForwardedHeaderXRealIP is the X-Real-IP header
+	ForwardedHeaderXRealIP ForwardedHeader = "x-real-ip"
+)
+
+// KeyExtractorType names a built-in way of reading the key a request is rate limited under
+type KeyExtractorType string
+
+const (
+	// KeyExtractorHeader reads one HTTP header or gRPC metadata key
+	KeyExtractorHeader KeyExtractorType = "header"
+	// KeyExtractorHeaders reads the first of several HTTP headers or gRPC metadata keys that is set
+	KeyExtractorHeaders KeyExtractorType = "headers"
+	// KeyExtractorCookie reads an HTTP cookie; it never identifies gRPC calls
+	KeyExtractorCookie KeyExtractorType = "cookie"
+	// KeyExtractorQuery reads an HTTP query parameter; it never identifies gRPC calls
+	KeyExtractorQuery KeyExtractorType = "query"
+	// KeyExtractorContext reads the key an upstream authentication middleware or interceptor stored
+	// in the request context
+	KeyExtractorContext KeyExtractorType = "context"
+	// KeyExtractorIP reads the client IP address, trusting forwarding headers only from trusted proxies
+	KeyExtractorIP KeyExtractorType = "ip"
+	// KeyExtractorJWT reads a claim of a verified bearer token
+	KeyExtractorJWT KeyExtractorType = "jwt"
+	// KeyExtractorAPIKey looks up an API key of an HTTP header, query parameter or gRPC metadata key
+	// in a keys file
+	KeyExtractorAPIKey KeyExtractorType = "api_key"
+	// KeyExtractorClientCert reads the identity of the verified client certificate of a mutual TLS
+	// connection
+	KeyExtractorClientCert KeyExtractorType = "client_cert"
+)
+
+// KeyExtractor is an entry of the chain of extractors identifying users
+type KeyExtractor struct {
+	// Type selects the built-in extractor
+	Type KeyExtractorType
+	// Headers are the HTTP headers read by header, headers and api_key extractors, in order
+	Headers []string
+	// MetadataKeys are the gRPC metadata keys read by header, headers and api_key extractors, in order
+	MetadataKeys []string
+	// Name is the cookie or query parameter read by cookie, query and api_key extractors
+	Name string
+	// TrustedProxies are the networks whose forwarding headers ip extractors believe
+	TrustedProxies []netip.Prefix
+	// IPv6PrefixLength is the prefix ip extractors group IPv6 clients by; 128 keeps every address apart
+	IPv6PrefixLength int
+	// ForwardedHeader is the only forwarding header ip extractors read
+	ForwardedHeader ForwardedHeader
+	// JWTKeys are the keys jwt extractors verify token signatures with
+	JWTKeys []JWTKey
+	// Claim is the claim jwt extractors use as the key, e.g. "sub" or "org_id"
+	Claim string
+	// PlanClaim is the claim jwt extractors read the user's plan from; empty leaves the plan to the
+	// plan resolver
+	PlanClaim string
+	// Leeway is the clock skew jwt extractors tolerate when checking exp and nbf
+	Leeway time.Duration
+	// OnInvalid is what jwt extractors do with tokens they cannot verify, and api_key extractors
+	// with unknown keys
+	OnInvalid InvalidTokenTreatment
+	// KeysFile is the API keys file api_key extractors reload their keys from
+	KeysFile string
+	// APIKeys are the keys api_key extractors start with, by the SHA-256 hash of the API key
+	APIKeys map[string]APIKey
+	// ReloadInterval is how often api_key extractors check KeysFile for changes; zero never reloads it
+	ReloadInterval time.Duration
+	// CertSources are the certificate fields client_cert extractors derive the key from, in order
+	CertSources []ClientCertSource
+	// TrustDomain is the only SPIFFE trust domain client_cert extractors accept; empty accepts any
+	TrustDomain string
+}
+
+// KeyExtractorValue is an entry of the user_identification.extractors list in a config file,
+// e.g. {"type": "header", "header": "X-User-ID", "metadata_key": "user-id"} or
+// {"type": "cookie", "name": "session_user"}
+type KeyExtractorValue struct {
+	// Type is header, headers, cookie, query, context, ip, jwt, api_key or client_cert
+	Type string `json:"type" yaml:"type"`
+	// Header is the HTTP header read by a header or api_key extractor
+	Header string `json:"header" yaml:"header"`
+	// MetadataKey is the gRPC metadata key read by a header or api_key extractor
+	MetadataKey string `json:"metadata_key" yaml:"metadata_key"`
+	// Headers are the HTTP headers read in order by a headers extractor
+	Headers []string `json:"headers" yaml:"headers"`
+	// MetadataKeys are the gRPC metadata keys read in order by a headers extractor
+	MetadataKeys []string `json:"metadata_keys" yaml:"metadata_keys"`
+	// Name is the cookie or query parameter read by a cookie, query or api_key extractor
+	Name string `json:"name" yaml:"name"`
+	// TrustedProxies are the CIDRs or addresses of the proxies whose forwarding headers an ip
+	// extractor believes, e.g. ["10.0.0.0/8"]
+	TrustedProxies []string `json:"trusted_proxies" yaml:"trusted_proxies"`
+	// IPv6PrefixLength is the prefix an ip extractor groups IPv6 clients by; zero means 64
+	IPv6PrefixLength int `json:"ipv6_prefix_length" yaml:"ipv6_prefix_length"`
+	// ForwardedHeader is the forwarding header the trusted proxies of an ip extractor write: forwarded,
+	// x-forwarded-for (the default) or x-real-ip
+	ForwardedHeader string `json:"forwarded_header" yaml:"forwarded_header"`
+	// KeysFile is the JWKS, PEM or HS256 secret file a jwt extractor verifies tokens with, or the
+	// JSON or YAML file of the keys an api_key extractor accepts
+	KeysFile string `json:"keys_file" yaml:"keys_file"`
+	// Claim is the claim a jwt extractor uses as the key; empty means "sub"
+	Claim string `json:"claim" yaml:"claim"`
+	// PlanClaim is the claim a jwt extractor reads the user's plan from
+	PlanClaim string `json:"plan_claim" yaml:"plan_claim"`
+	// Leeway is the clock skew a jwt extractor tolerates, e.g. "30s"
+	Leeway string `json:"leeway" yaml:"leeway"`
+	// OnInvalid is reject (the default) or ignore
+	OnInvalid string `json:"on_invalid" yaml:"on_invalid"`
+	// ReloadInterval is how often an api_key extractor checks its keys file for changes, e.g. "30s"
+	ReloadInterval string `json:"reload_interval" yaml:"reload_interval"`
+	// Sources are the certificate fields a client_cert extractor tries in order: spiffe, dns and cn
+	Sources []string `json:"sources" yaml:"sources"`
+	// TrustDomain is the only SPIFFE trust domain a client_cert extractor accepts, e.g. "example.org"
+	TrustDomain string `json:"trust_domain" yaml:"trust_domain"`
+}
+
+// convertKeyExtractors validates and converts the chain of extractors identifying users
+func convertKeyExtractors(config *Config, fileConfig *FileConfig) error {
+	identification := fileConfig.UserIdentification
+	config.AnonymousKey = identification.AnonymousKey
+
+	config.KeyExtractors = nil
+	for i, value := range identification.Extractors {
+		extractor := KeyExtractor{Type: KeyExtractorType(value.Type), Name: value.Name}
+		switch extractor.Type {
+		case KeyExtractorHeader:
+			if value.Header == "" && value.MetadataKey == "" {
+				return fmt.Errorf("key extractor %d needs a header or a metadata key", i+1)
+			}
+			extractor.Headers = []string{value.Header}
+			extractor.MetadataKeys = []string{value.MetadataKey}
+		case KeyExtractorHeaders:
+			if len(value.Headers) == 0 && len(value.MetadataKeys) == 0 {
+				return fmt.Errorf("key extractor %d needs headers or metadata keys", i+1)
+			}
+			extractor.Headers = value.Headers
+			extractor.MetadataKeys = value.MetadataKeys
+		case KeyExtractorCookie, KeyExtractorQuery:
+			if value.Name == "" {
+				return fmt.Errorf("key extractor %d needs the name of the %s to read", i+1, value.Type)
+			}
+		case KeyExtractorContext:
+		case KeyExtractorIP:
+			var err error
+			if extractor.TrustedProxies, err = parseTrustedProxies(value.TrustedProxies); err != nil {
+				return fmt.Errorf("key extractor %d: %w", i+1, err)
+			}
+			extractor.IPv6PrefixLength = value.IPv6PrefixLength
+			if extractor.IPv6PrefixLength == 0 {
+				extractor.IPv6PrefixLength = DefaultIPv6PrefixLength
+			}
+			if extractor.IPv6PrefixLength < 1 || extractor.IPv6PrefixLength > 128 {
+				return fmt.Errorf("key extractor %d: IPv6 prefix length must be between 1 and 128, got %d",
+					i+1, value.IPv6PrefixLength)
+			}
+			switch header := ForwardedHeader(strings.ToLower(value.ForwardedHeader)); header {
+			case "":
+				extractor.ForwardedHeader = ForwardedHeaderXForwardedFor
+			case ForwardedHeaderForwarded, ForwardedHeaderXForwardedFor, ForwardedHeaderXRealIP:
+				extractor.ForwardedHeader = header
+			default:
+				return fmt.Errorf("key extractor %d has invalid forwarded header %q: must be %s, %s or %s", i+1,
+					value.ForwardedHeader, ForwardedHeaderForwarded, ForwardedHeaderXForwardedFor,
+					ForwardedHeaderXRealIP)
+			}
+		case KeyExtractorJWT:
+			if err := convertJWTExtractor(&extractor, value); err != nil {
+				return fmt.Errorf("key extractor %d: %w", i+1, err)
+			}
+		case KeyExtractorAPIKey:
+			if err := convertAPIKeyExtractor(&extractor, value); err != nil {
+				return fmt.Errorf("key extractor %d: %w", i+1, err)
+			}
+		case KeyExtractorClientCert:
+			if err := convertClientCertExtractor(&extractor, value); err != nil {
+				return fmt.Errorf("key extractor %d: %w", i+1, err)
+			}
+		default:
+			return fmt.Errorf("key extractor %d has invalid type %q: must be %s, %s, %s, %s, %s, %s, %s, %s or %s",
+				i+1, value.Type, KeyExtractorHeader, KeyExtractorHeaders, KeyExtractorCookie, KeyExtractorQuery,
+				KeyExtractorContext, KeyExtractorIP, KeyExtractorJWT, KeyExtractorAPIKey, KeyExtractorClientCert)
+		}
+		config.KeyExtractors = append(config.KeyExtractors, extractor)
+	}
+	return nil
+}
+
+// parseTrustedProxies parses CIDRs such as "10.0.0.0/8"; a bare address trusts that address only
+func parseTrustedProxies(values []string) ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+			}
+			addr = addr.Unmap()
+			proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// GetAnonymousKey returns the key requests that no extractor identifies are rate limited under
+func (c Config) GetAnonymousKey() string {
+	if c.AnonymousKey == "" {
+		return "anonymous"
+	}
+	return c.AnonymousKey
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadFromFile_KeyExtractors(t *testing.T) {
+	tests := []struct {
+		name           string
+		identification string
+		extractors     []KeyExtractor
+		anonymousKey   string
+		hasError       bool
+	}{
+		{
+			name:           "header only",
+			identification: "{http_header: X-User-ID, grpc_metadata_key: user-id}",
+			anonymousKey:   "anonymous",
+		},
+		{
+			name: "chain",
+			identification: `
+  anonymous_key: guest
+  extractors:
+    - {type: context}
+    - {type: header, header: X-User-ID}
+    - {type: headers, headers: [X-User-ID, X-Client-ID], metadata_keys: [user-id]}
+    - {type: cookie, name: session_user}
+    - {type: query, name: user_id}
+    - {type: ip, trusted_proxies: [10.0.0.0/8, "2001:db8::1"], ipv6_prefix_length: 56, forwarded_header: Forwarded}
+    - {type: ip}
+    - {type: client_cert, sources: [dns, cn], trust_domain: example.org}
+    - {type: client_cert}`,
+			extractors: []KeyExtractor{
+				{Type: KeyExtractorContext},
+				{Type: KeyExtractorHeader, Headers: []string{"X-User-ID"}, MetadataKeys: []string{""}},
+				{
+					Type:         KeyExtractorHeaders,
+					Headers:      []string{"X-User-ID", "X-Client-ID"},
+					MetadataKeys: []string{"user-id"},
+				},
+				{Type: KeyExtractorCookie, Name: "session_user"},
+				{Type: KeyExtractorQuery, Name: "user_id"},
+				{
+					Type: KeyExtractorIP,
+					TrustedProxies: []netip.Prefix{
+						netip.MustParsePrefix("10.0.0.0/8"),
+						netip.MustParsePrefix("2001:db8::1/128"),
+					},
+					IPv6PrefixLength: 56,
+					ForwardedHeader:  ForwardedHeaderForwarded,
+				},
+				{
+					Type:             KeyExtractorIP,
+					IPv6PrefixLength: DefaultIPv6PrefixLength,
+					ForwardedHeader:  ForwardedHeaderXForwardedFor,
+				},
+				{
+					Type:        KeyExtractorClientCert,
+					CertSources: []ClientCertSource{ClientCertDNS, ClientCertCN},
+					TrustDomain: "example.org",
+				},
+				{Type: KeyExtractorClientCert, CertSources: DefaultClientCertSources},
+			},
+			anonymousKey: "guest",
+		},
+		{
+			name:           "unknown type",
+			identification: "{extractors: [{type: saml}]}",
+			hasError:       true,
+		},
+		{
+			name:           "header without a name",
+			identification: "{extractors: [{type: header}]}",
+			hasError:       true,
+		},
+		{
+			name:           "invalid trusted proxy",
+			identification: "{extractors: [{type: ip, trusted_proxies: [10.0.0.0/33]}]}",
+			hasError:       true,
+		},
+		{
+			name:           "invalid forwarded header",
+			identification: "{extractors: [{type: ip, forwarded_header: x-client-ip}]}",
+			hasError:       true,
+		},
+		{
+			name:           "invalid IPv6 prefix length",
+			identification: "{extractors: [{type: ip, ipv6_prefix_length: 129}]}",
+			hasError:       true,
+		},
+		{
+			name:           "invalid certificate source",
+			identification: "{extractors: [{type: client_cert, sources: [email]}]}",
+			hasError:       true,
+		},
+		{
+			name:           "SPIFFE ID as trust domain",
+			identification: "{extractors: [{type: client_cert, trust_domain: \"spiffe://example.org\"}]}",
+			hasError:       true,
+		},
+		{
+			name:           "cookie without a name",
+			identification: "{extractors: [{type: cookie}]}",
+			hasError:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := `
+rate_limits:
+  global: {rate: 100, burst: 10}
+  http: {rate: 50, burst: 5, default_method_rate: 10}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+user_identification: ` + tt.identification + "\n"
+			filePath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(filePath, []byte(content), 0600); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			config, err := LoadFromFile(filePath)
+			if (err != nil) != tt.hasError {
+				t.Fatalf("LoadFromFile() error = %v, hasError %v", err, tt.hasError)
+			}
+			if tt.hasError {
+				return
+			}
+
+			if !reflect.DeepEqual(config.KeyExtractors, tt.extractors) {
+				t.Errorf("KeyExtractors = %+v, want %+v", config.KeyExtractors, tt.extractors)
+			}
+			if key := config.GetAnonymousKey(); key != tt.anonymousKey {
+				t.Errorf("GetAnonymousKey() = %q, want %q", key, tt.anonymousKey)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package config
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+)
+
+// JWT signature algorithms accepted by jwt extractors
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmRS256 = "RS256"
+	JWTAlgorithmES256 = "ES256"
+)
+
+// minHMACKeySize is the shortest HS256 secret accepted, the size of the hash as RFC 7518 requires
+const minHMACKeySize = 32
+
+// InvalidTokenTreatment is what a jwt extractor does with a bearer token it cannot verify, such as
+// a forged, expired or malformed one, and what an api_key extractor does with an unknown API key
+type InvalidTokenTreatment string
+
+const (
+	// InvalidTokenReject rejects the request as unauthenticated
+	InvalidTokenReject InvalidTokenTreatment = "reject"
+	// InvalidTokenIgnore treats the request as if it carried no credentials, leaving it to the next
+	// extractor of the chain or to the anonymous key
+	InvalidTokenIgnore InvalidTokenTreatment = "ignore"
+)
+
+// JWTKey is a key verifying the signatures of bearer tokens
+type JWTKey struct {
+	// ID is matched against the kid header of tokens; empty matches any token
+	ID string
+	// Algorithm is the signature algorithm the key verifies: HS256, RS256 or ES256
+	Algorithm string
+	// Key is the HMAC secret ([]byte), *rsa.PublicKey or *ecdsa.PublicKey
+	Key any
+}
+
+// convertJWTExtractor validates and copies the settings of a jwt extractor, loading its keys
+func convertJWTExtractor(extractor *KeyExtractor, value KeyExtractorValue) error {
+	if value.KeysFile == "" {
+		return fmt.Errorf("jwt extractor needs a keys file")
+	}
+	var err error
+	if extractor.JWTKeys, err = loadJWTKeys(value.KeysFile); err != nil {
+		return err
+	}
+
+	extractor.Claim = value.Claim
+	if extractor.Claim == "" {
+		extractor.Claim = "sub"
+	}
+	extractor.PlanClaim = value.PlanClaim
+
+	if value.Leeway != "" {
+		if extractor.Leeway, err = time.ParseDuration(value.Leeway); err != nil {
+			return fmt.Errorf("invalid leeway %q: %w", value.Leeway, err)
+		}
+		if extractor.Leeway < 0 {
+			return fmt.Errorf("leeway %q must not be negative", value.Leeway)
+		}
+	}
+
+	return convertInvalidTokenTreatment(extractor, value)
+}
+
+// convertInvalidTokenTreatment validates and copies what an extractor does with invalid credentials
+func convertInvalidTokenTreatment(extractor *KeyExtractor, value KeyExtractorValue) error {
+	switch treatment := InvalidTokenTreatment(value.OnInvalid); treatment {
+	case "":
+		extractor.OnInvalid = InvalidTokenReject
+	case InvalidTokenReject, InvalidTokenIgnore:
+		extractor.OnInvalid = treatment
+	default:
+		return fmt.Errorf("invalid on_invalid %q: must be %s or %s", value.OnInvalid, InvalidTokenReject,
+			InvalidTokenIgnore)
+	}
+	return nil
+}
+
+// loadJWTKeys loads the keys verifying bearer tokens from a file, which holds either a JWKS, PEM
+// encoded public keys or certificates, or a raw HS256 secret
+func loadJWTKeys(path string) ([]JWTKey, error) {
+	// #nosec G304 - the keys file path comes from the service configuration
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT keys file %q: %w", path, err)
+	}
+
+	var keys []JWTKey
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(data, []byte("{")):
+		keys, err = parseJWKS(data)
+	case bytes.HasPrefix(data, []byte("-----BEGIN")):
+		keys, err = parsePEMKeys(data)
+	default:
+		var key JWTKey
+		key, err = hmacKey("", data)
+		keys = []JWTKey{key}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT keys file %q: %w", path, err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWT keys file %q holds no signing keys", path)
+	}
+	return keys, nil
+}
+
+// jwk is a key of a JSON Web Key Set as defined by RFC 7517
+type jwk struct {
+	KeyType   string `json:"kty"`
+	ID        string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// N and E are the modulus and exponent of an RSA key
+	N string `json:"n"`
+	E string `json:"e"`
+	// Curve, X and Y are the curve and coordinates of an EC key
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+	// K is the secret of a symmetric key
+	K string `json:"k"`
+}
+
+// parseJWKS parses a JSON Web Key Set, skipping encryption keys
+func parseJWKS(data []byte) ([]JWTKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	keys := make([]JWTKey, 0, len(set.Keys))
+	for i, value := range set.Keys {
+		if value.Use != "" && value.Use != "sig" {
+			continue
+		}
+		key, err := value.toKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i+1, err)
+		}
+		if value.Algorithm != "" && value.Algorithm != key.Algorithm {
+			return nil, fmt.Errorf("key %d: algorithm %q is not supported for %s keys", i+1, value.Algorithm,
+				value.KeyType)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// toKey converts the JWK to a key verifying tokens
+func (k jwk) toKey() (JWTKey, error) {
+	switch k.KeyType {
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil {
+			return JWTKey{}, fmt.Errorf("invalid secret: %w", err)
+		}
+		return hmacKey(k.ID, secret)
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return JWTKey{}, fmt.Errorf("invalid RSA modulus or exponent")
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return rsaKey(k.ID, key)
+	case "EC":
+		if k.Curve != "P-256" {
+			return JWTKey{}, fmt.Errorf("curve %q is not supported, only P-256", k.Curve)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+			return JWTKey{}, fmt.Errorf("invalid EC coordinates")
+		}
+		key, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append(append([]byte{4}, x...), y...))
+		if err != nil {
+			return JWTKey{}, fmt.Errorf("invalid EC key: %w", err)
+		}
+		return JWTKey{ID: k.ID, Algorithm: JWTAlgorithmES256, Key: key}, nil
+	default:
+		return JWTKey{}, fmt.Errorf("key type %q is not supported", k.KeyType)
+	}
+}
+
+// parsePEMKeys parses PEM encoded public keys and certificates
+func parsePEMKeys(data []byte) ([]JWTKey, error) {
+	var keys []JWTKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		var public any
+		var err error
+		switch block.Type {
+		case "PUBLIC KEY":
+			public, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			public, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+				public = cert.PublicKey
+			}
+		default:
+			return nil, fmt.Errorf("PEM block %q is not a public key or certificate", block.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PEM block %q: %w", block.Type, err)
+		}
+
+		key, err := publicKey(public)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if len(bytes.TrimSpace(data)) > 0 {
+		return nil, fmt.Errorf("trailing data after the PEM blocks")
+	}
+	return keys, nil
+}
+
+// publicKey wraps an RSA or P-256 ECDSA public key
+func publicKey(public any) (JWTKey, error) {
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		return rsaKey("", key)
+	case *ecdsa.PublicKey:
+		if key.Curve != elliptic.P256() {
+			return JWTKey{}, fmt.Errorf("curve %s is not supported, only P-256", key.Curve.Params().Name)
+		}
+		return JWTKey{Algorithm: JWTAlgorithmES256, Key: key}, nil
+	default:
+		return JWTKey{}, fmt.Errorf("public key type %T is not supported", public)
+	}
+}
+
+// rsaKey wraps an RSA public key, rejecting keys too short to be safe
+func rsaKey(id string, key *rsa.PublicKey) (JWTKey, error) {
+	if key.N.BitLen() < 2048 {
+		return JWTKey{}, fmt.Errorf("RSA key of %d bits is too short, at least 2048 are required", key.N.BitLen())
+	}
+	if key.E < 3 || key.E%2 == 0 {
+		return JWTKey{}, fmt.Errorf("invalid RSA exponent %d", key.E)
+	}
+	return JWTKey{ID: id, Algorithm: JWTAlgorithmRS256, Key: key}, nil
+}
+
+// hmacKey wraps an HS256 secret, rejecting secrets shorter than the hash
+func hmacKey(id string, secret []byte) (JWTKey, error) {
+	if len(secret) < minHMACKeySize {
+		return JWTKey{}, fmt.Errorf("HMAC secret of %d bytes is too short, at least %d are required", len(secret),
+			minHMACKeySize)
+	}
+	return JWTKey{ID: id, Algorithm: JWTAlgorithmHS256, Key: secret}, nil
+}
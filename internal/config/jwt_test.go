@@ -0,0 +1,204 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadJWTKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %v", err)
+	}
+	rsaDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to encode RSA key: %v", err)
+	}
+	ecDER, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to encode EC key: %v", err)
+	}
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	coordinate := func(n *big.Int) string { return b64(n.FillBytes(make([]byte, 32))) }
+	jwks := fmt.Sprintf(`{"keys": [
+		{"kty": "RSA", "kid": "rsa-1", "alg": "RS256", "use": "sig", "n": %q, "e": "AQAB"},
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": %q, "y": %q},
+		{"kty": "oct", "kid": "hmac-1", "k": %q},
+		{"kty": "RSA", "use": "enc", "n": "AQAB", "e": "AQAB"}
+	]}`, b64(rsaKey.N.Bytes()), coordinate(ecKey.X), coordinate(ecKey.Y),
+		b64([]byte("0123456789abcdef0123456789abcdef")))
+
+	tests := []struct {
+		name       string
+		content    string
+		algorithms []string
+		ids        []string
+		hasError   bool
+	}{
+		{
+			name:       "JWKS",
+			content:    jwks,
+			algorithms: []string{JWTAlgorithmRS256, JWTAlgorithmES256, JWTAlgorithmHS256},
+			ids:        []string{"rsa-1", "ec-1", "hmac-1"},
+		},
+		{
+			name: "PEM",
+			content: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rsaDER})) +
+				string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: ecDER})),
+			algorithms: []string{JWTAlgorithmRS256, JWTAlgorithmES256},
+			ids:        []string{"", ""},
+		},
+		{
+			name:       "HMAC secret",
+			content:    "0123456789abcdef0123456789abcdef\n",
+			algorithms: []string{JWTAlgorithmHS256},
+			ids:        []string{""},
+		},
+		{
+			name:     "short HMAC secret",
+			content:  "secret",
+			hasError: true,
+		},
+		{
+			name:     "JWKS algorithm not matching the key",
+			content:  fmt.Sprintf(`{"keys": [{"kty": "oct", "alg": "RS256", "k": %q}]}`, b64(make([]byte, 32))),
+			hasError: true,
+		},
+		{
+			name:     "unsupported curve",
+			content:  `{"keys": [{"kty": "EC", "crv": "P-384", "x": "AA", "y": "AA"}]}`,
+			hasError: true,
+		},
+		{
+			name:     "private key",
+			content:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte{1}})),
+			hasError: true,
+		},
+		{
+			name:     "no signing keys",
+			content:  `{"keys": []}`,
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "keys")
+			if err := os.WriteFile(filePath, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			keys, err := loadJWTKeys(filePath)
+			if (err != nil) != tt.hasError {
+				t.Fatalf("loadJWTKeys() error = %v, hasError %v", err, tt.hasError)
+			}
+			if tt.hasError {
+				return
+			}
+
+			if len(keys) != len(tt.algorithms) {
+				t.Fatalf("loadJWTKeys() returned %d keys, want %d", len(keys), len(tt.algorithms))
+			}
+			for i, key := range keys {
+				if key.Algorithm != tt.algorithms[i] || key.ID != tt.ids[i] {
+					t.Errorf("key %d = %s %q, want %s %q", i, key.Algorithm, key.ID, tt.algorithms[i], tt.ids[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFromFile_JWTExtractor(t *testing.T) {
+	keysFile := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(keysFile, []byte("0123456789abcdef0123456789abcdef"), 0600); err != nil {
+		t.Fatalf("Failed to write keys file: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		extractor string
+		claim     string
+		leeway    time.Duration
+		onInvalid InvalidTokenTreatment
+		hasError  bool
+	}{
+		{
+			name:      "defaults",
+			extractor: "{type: jwt, keys_file: " + keysFile + "}",
+			claim:     "sub",
+			onInvalid: InvalidTokenReject,
+		},
+		{
+			name:      "organization claim",
+			extractor: "{type: jwt, keys_file: " + keysFile + ", claim: org_id, leeway: 30s, on_invalid: ignore}",
+			claim:     "org_id",
+			leeway:    30 * time.Second,
+			onInvalid: InvalidTokenIgnore,
+		},
+		{
+			name:      "missing keys file",
+			extractor: "{type: jwt}",
+			hasError:  true,
+		},
+		{
+			name:      "unreadable keys file",
+			extractor: "{type: jwt, keys_file: " + keysFile + ".missing}",
+			hasError:  true,
+		},
+		{
+			name:      "invalid treatment",
+			extractor: "{type: jwt, keys_file: " + keysFile + ", on_invalid: allow}",
+			hasError:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := `
+rate_limits:
+  global: {rate: 100, burst: 10}
+  http: {rate: 50, burst: 5, default_method_rate: 10}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+user_identification:
+  extractors: [` + tt.extractor + `]
+`
+			filePath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(filePath, []byte(content), 0600); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			config, err := LoadFromFile(filePath)
+			if (err != nil) != tt.hasError {
+				t.Fatalf("LoadFromFile() error = %v, hasError %v", err, tt.hasError)
+			}
+			if tt.hasError {
+				return
+			}
+
+			extractor := config.KeyExtractors[0]
+			if len(extractor.JWTKeys) != 1 || extractor.JWTKeys[0].Algorithm != JWTAlgorithmHS256 {
+				t.Errorf("JWTKeys = %+v, want one HS256 key", extractor.JWTKeys)
+			}
+			if extractor.Claim != tt.claim || extractor.Leeway != tt.leeway || extractor.OnInvalid != tt.onInvalid {
+				t.Errorf("extractor = %+v, want claim %q, leeway %v and on_invalid %q", extractor, tt.claim,
+					tt.leeway, tt.onInvalid)
+			}
+		})
+	}
+}
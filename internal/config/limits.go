@@ -0,0 +1,202 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Limit is one window of a rate limiting rule: Rate requests per Period, with bursts of up to Burst
+// A rule made of several limits (10/s and 500/m and 20000/d) admits a request only if every limit does
+type Limit struct {
+	// Rate is the number of requests allowed per period
+	Rate int
+	// Period is the window the rate applies to; zero means one second
+	Period time.Duration
+	// Burst is the token bucket capacity or GCRA burst for this limit
+	Burst int
+}
+
+// String formats the limit as it is written in config files, e.g. "10/s", "500/m" or "1/2s"
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Rate, formatPeriod(effectivePeriod(l.Period)))
+}
+
+// formatPeriod formats a period with the shortest unit shorthand parsePeriod accepts
+func formatPeriod(period time.Duration) string {
+	units := []struct {
+		unit     string
+		duration time.Duration
+	}{
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+	}
+	for _, u := range units {
+		if period%u.duration != 0 {
+			continue
+		}
+		if n := period / u.duration; n != 1 {
+			return fmt.Sprintf("%d%s", n, u.unit)
+		}
+		return u.unit
+	}
+	return period.String()
+}
+
+// LimitValue is an entry of a limits list in a config file
+// It is written either as a plain rate (`"500/m"`) or as an object with a rate, period
+// and burst (`{"rate": 20000, "period": "1d", "burst": 1000}`); the burst defaults to the rate
+type LimitValue struct {
+	// Rate is the rate of this limit
+	Rate RateValue `json:"rate" yaml:"rate"`
+	// Period is the period of the rate when it is not part of the rate itself
+	Period string `json:"period" yaml:"period"`
+	// Burst is the burst size of this limit; zero means the rate
+	Burst int `json:"burst" yaml:"burst"`
+}
+
+// UnmarshalJSON accepts either a plain rate or a {"rate", "period", "burst"} object
+func (lv *LimitValue) UnmarshalJSON(data []byte) error {
+	if trimmed := strings.TrimSpace(string(data)); !strings.HasPrefix(trimmed, "{") {
+		*lv = LimitValue{}
+		return json.Unmarshal(data, &lv.Rate)
+	}
+
+	type plain LimitValue
+	var value plain
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*lv = LimitValue(value)
+	return nil
+}
+
+// UnmarshalYAML accepts either a plain rate or a {rate, period, burst} mapping
+func (lv *LimitValue) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*lv = LimitValue{}
+		return node.Decode(&lv.Rate)
+	}
+
+	type plain LimitValue
+	var value plain
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+	*lv = LimitValue(value)
+	return nil
+}
+
+// convertLimits validates a limits list and converts it to whole-count limits
+func convertLimits(name string, values []LimitValue) ([]Limit, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	limits := make([]Limit, 0, len(values))
+	for i, value := range values {
+		rate, period, err := value.Rate.resolve(value.Period)
+		if err != nil {
+			return nil, fmt.Errorf("%s limit %d: %w", name, i+1, err)
+		}
+		if value.Burst < 0 {
+			return nil, fmt.Errorf("%s limit %d burst must not be negative, got %d", name, i+1, value.Burst)
+		}
+
+		burst := value.Burst
+		if burst == 0 {
+			burst = rate
+		}
+		limits = append(limits, Limit{Rate: rate, Period: period, Burst: burst})
+	}
+	return limits, nil
+}
+
+// validateExtraLimits rejects additional limits on tiers whose algorithm cannot combine windows
+// A leaky bucket delays requests instead of rejecting them, so it cannot be ANDed with other windows
+func validateExtraLimits(config *Config) error {
+	tiers := []struct {
+		name      string
+		algorithm Algorithm
+		extra     int
+	}{
+		{"global", config.GlobalAlgorithm, len(config.GlobalExtraLimits)},
+		{"HTTP", config.HTTPAlgorithm, len(config.HTTPExtraLimits)},
+		{"HTTP method", config.HTTPMethodAlgorithm, len(config.HTTPMethodExtraLimits)},
+		{"gRPC", config.GRPCAlgorithm, len(config.GRPCExtraLimits)},
+		{"gRPC method", config.GRPCMethodAlgorithm, len(config.GRPCMethodExtraLimits)},
+	}
+
+	for _, tier := range tiers {
+		if tier.algorithm == AlgorithmLeakyBucket && tier.extra > 0 {
+			return fmt.Errorf("%s limits: %s does not support multiple limits", tier.name, AlgorithmLeakyBucket)
+		}
+	}
+	return nil
+}
+
+// withExtraLimits returns the primary limit followed by the extra limits of a rule
+func withExtraLimits(primary Limit, extra []Limit) []Limit {
+	limits := make([]Limit, 0, 1+len(extra))
+	return append(append(limits, primary), extra...)
+}
+
+// GetGlobalLimits returns every limit of the global tier, starting with GlobalRate
+func (c Config) GetGlobalLimits() []Limit {
+	primary := Limit{Rate: c.GlobalRate, Period: c.GetGlobalPeriod(), Burst: c.GlobalBurstSize}
+	return withExtraLimits(primary, c.GlobalExtraLimits)
+}
+
+// GetHTTPLimits returns every limit of the HTTP-only tier, starting with HTTPRate
+func (c Config) GetHTTPLimits() []Limit {
+	primary := Limit{Rate: c.HTTPRate, Period: c.GetHTTPPeriod(), Burst: c.HTTPBurstSize}
+	return withExtraLimits(primary, c.HTTPExtraLimits)
+}
+
+// GetGRPCLimits returns every limit of the gRPC-only tier, starting with GRPCRate
+func (c Config) GetGRPCLimits() []Limit {
+	primary := Limit{Rate: c.GRPCRate, Period: c.GetGRPCPeriod(), Burst: c.GRPCBurstSize}
+	return withExtraLimits(primary, c.GRPCExtraLimits)
+}
+
+// GetHTTPMethodLimits returns every limit of an HTTP endpoint, starting with its per-method rate
+func (c Config) GetHTTPMethodLimits(endpointKey string) []Limit {
+	primary := Limit{
+		Rate:   c.GetHTTPMethodRate(endpointKey),
+		Period: c.GetHTTPMethodPeriod(endpointKey),
+		Burst:  c.PerEndpointBurstSize,
+	}
+	extra, _ := lookupHTTPMethod(c.HTTPMethodExtraLimits, endpointKey)
+	return withExtraLimits(primary, extra)
+}
+
+// GetGRPCMethodLimits returns every limit of a gRPC method, starting with its per-method rate
+func (c Config) GetGRPCMethodLimits(method string) []Limit {
+	primary := Limit{
+		Rate:   c.GetGRPCMethodRate(method),
+		Period: c.GetGRPCMethodPeriod(method),
+		Burst:  c.GRPCBurstSize,
+	}
+	return withExtraLimits(primary, c.GRPCMethodExtraLimits[method])
+}
+
+// HasAggregateLimits reports whether any limit is shared by all users, service-wide or per method
+func (c Config) HasAggregateLimits() bool {
+	return len(c.AggregateLimits) > 0 || len(c.HTTPMethodAggregateLimits) > 0 || len(c.GRPCMethodAggregateLimits) > 0
+}
+
+// GetHTTPMethodAggregateLimits returns the limits all users of an HTTP endpoint share, or nil
+func (c Config) GetHTTPMethodAggregateLimits(endpointKey string) []Limit {
+	limits, _ := lookupHTTPMethod(c.HTTPMethodAggregateLimits, endpointKey)
+	return limits
+}
+
+// GetGRPCMethodAggregateLimits returns the limits all users of a gRPC method share, or nil
+func (c Config) GetGRPCMethodAggregateLimits(method string) []Limit {
+	return c.GRPCMethodAggregateLimits[method]
+}
@@ -0,0 +1,243 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLimit_String(t *testing.T) {
+	tests := []struct {
+		limit    Limit
+		expected string
+	}{
+		{limit: Limit{Rate: 10, Period: time.Second}, expected: "10/s"},
+		{limit: Limit{Rate: 10}, expected: "10/s"},
+		{limit: Limit{Rate: 500, Period: time.Minute}, expected: "500/m"},
+		{limit: Limit{Rate: 20000, Period: 24 * time.Hour}, expected: "20000/d"},
+		{limit: Limit{Rate: 1, Period: 2 * time.Second}, expected: "1/2s"},
+		{limit: Limit{Rate: 100, Period: 7 * 24 * time.Hour}, expected: "100/7d"},
+		{limit: Limit{Rate: 5, Period: 1500 * time.Millisecond}, expected: "5/1.5s"},
+	}
+
+	for _, tt := range tests {
+		if result := tt.limit.String(); result != tt.expected {
+			t.Errorf("%#v.String() = %q, want %q", tt.limit, result, tt.expected)
+		}
+	}
+}
+
+func TestLoadFromFile_Limits(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		content  string
+		hasError bool
+	}{
+		{
+			name:     "JSON",
+			fileName: "config.json",
+			content: `{
+				"rate_limits": {
+					"global": {"rate": 10, "burst": 10, "limits": ["500/m", {"rate": 20000, "period": "1d", "burst": 1000}]},
+					"http": {"rate": 50, "burst": 5, "default_method_rate": 10, "methods": {
+						"GET /api/search": {"rate": 5, "limits": ["100/h"]}
+					}},
+					"grpc": {"rate": 30, "burst": 3, "default_method_rate": 5, "limits": ["1000/m"]}
+				}
+			}`,
+		},
+		{
+			name:     "YAML",
+			fileName: "config.yaml",
+			content: `
+rate_limits:
+  global:
+    rate: 10
+    burst: 10
+    limits:
+      - 500/m
+      - {rate: 20000, period: 1d, burst: 1000}
+  http:
+    rate: 50
+    burst: 5
+    default_method_rate: 10
+    methods:
+      GET /api/search: {rate: 5, limits: [100/h]}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5, limits: [1000/m]}
+`,
+		},
+		{
+			name:     "invalid limit",
+			fileName: "config.yaml",
+			content: `
+rate_limits:
+  global: {rate: 10, burst: 10, limits: [500/week]}
+  http: {rate: 50, burst: 5, default_method_rate: 10}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+`,
+			hasError: true,
+		},
+		{
+			name:     "leaky bucket with several limits",
+			fileName: "config.yaml",
+			content: `
+rate_limits:
+  global: {rate: 10, burst: 10, limits: [500/m], algorithm: leaky_bucket}
+  http: {rate: 50, burst: 5, default_method_rate: 10}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+`,
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), tt.fileName)
+			if err := os.WriteFile(filePath, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("failed to write config file: %v", err)
+			}
+
+			config, err := LoadFromFile(filePath)
+			if (err != nil) != tt.hasError {
+				t.Fatalf("LoadFromFile() error = %v, hasError %v", err, tt.hasError)
+			}
+			if tt.hasError {
+				return
+			}
+
+			expected := []Limit{
+				{Rate: 10, Period: time.Second, Burst: 10},
+				{Rate: 500, Period: time.Minute, Burst: 500},
+				{Rate: 20000, Period: 24 * time.Hour, Burst: 1000},
+			}
+			if limits := config.GetGlobalLimits(); !reflect.DeepEqual(limits, expected) {
+				t.Errorf("GetGlobalLimits() = %v, want %v", limits, expected)
+			}
+
+			if limits := config.GetHTTPLimits(); len(limits) != 1 {
+				t.Errorf("GetHTTPLimits() = %v, want only the HTTP rate", limits)
+			}
+
+			expected = []Limit{
+				{Rate: 5, Period: time.Second, Burst: 5},
+				{Rate: 100, Period: time.Hour, Burst: 100},
+			}
+			if limits := config.GetHTTPMethodLimits("GET:/api/search"); !reflect.DeepEqual(limits, expected) {
+				t.Errorf("GetHTTPMethodLimits() = %v, want %v", limits, expected)
+			}
+
+			expected = []Limit{
+				{Rate: 30, Period: time.Second, Burst: 3},
+				{Rate: 1000, Period: time.Minute, Burst: 1000},
+			}
+			if limits := config.GetGRPCLimits(); !reflect.DeepEqual(limits, expected) {
+				t.Errorf("GetGRPCLimits() = %v, want %v", limits, expected)
+			}
+		})
+	}
+}
+
+func TestLoadFromFile_Aggregate(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		content  string
+		hasError bool
+	}{
+		{
+			name:     "JSON",
+			fileName: "config.json",
+			content: `{
+				"rate_limits": {
+					"global": {"rate": 10, "burst": 10},
+					"http": {"rate": 50, "burst": 5, "default_method_rate": 10, "methods": {
+						"POST /api/users": {"rate": 5, "aggregate": ["200/s"]}
+					}},
+					"grpc": {"rate": 30, "burst": 3, "default_method_rate": 5, "methods": {
+						"/UserService/CreateUser": {"aggregate": [{"rate": 6000, "period": "1m", "burst": 100}]}
+					}},
+					"aggregate": {"limits": ["5000/s"]}
+				}
+			}`,
+		},
+		{
+			name:     "YAML",
+			fileName: "config.yaml",
+			content: `
+rate_limits:
+  global: {rate: 10, burst: 10}
+  http:
+    rate: 50
+    burst: 5
+    default_method_rate: 10
+    methods:
+      POST /api/users: {rate: 5, aggregate: [200/s]}
+  grpc:
+    rate: 30
+    burst: 3
+    default_method_rate: 5
+    methods:
+      /UserService/CreateUser: {aggregate: [{rate: 6000, period: 1m, burst: 100}]}
+  aggregate:
+    limits: [5000/s]
+`,
+		},
+		{
+			name:     "invalid aggregate limit",
+			fileName: "config.yaml",
+			content: `
+rate_limits:
+  global: {rate: 10, burst: 10}
+  http: {rate: 50, burst: 5, default_method_rate: 10, methods: {POST /api/users: {aggregate: [200/week]}}}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+`,
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), tt.fileName)
+			if err := os.WriteFile(filePath, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("failed to write config file: %v", err)
+			}
+
+			config, err := LoadFromFile(filePath)
+			if (err != nil) != tt.hasError {
+				t.Fatalf("LoadFromFile() error = %v, hasError %v", err, tt.hasError)
+			}
+			if tt.hasError {
+				return
+			}
+
+			if !config.HasAggregateLimits() {
+				t.Error("HasAggregateLimits() = false, want true")
+			}
+			expected := []Limit{{Rate: 5000, Period: time.Second, Burst: 5000}}
+			if !reflect.DeepEqual(config.AggregateLimits, expected) {
+				t.Errorf("AggregateLimits = %v, want %v", config.AggregateLimits, expected)
+			}
+
+			expected = []Limit{{Rate: 200, Period: time.Second, Burst: 200}}
+			if limits := config.GetHTTPMethodAggregateLimits("POST:/api/users"); !reflect.DeepEqual(limits, expected) {
+				t.Errorf("GetHTTPMethodAggregateLimits() = %v, want %v", limits, expected)
+			}
+			if limits := config.GetHTTPMethodAggregateLimits("GET:/api/users"); limits != nil {
+				t.Errorf("GetHTTPMethodAggregateLimits() = %v for an endpoint without aggregate limits", limits)
+			}
+
+			expected = []Limit{{Rate: 6000, Period: time.Minute, Burst: 100}}
+			limits := config.GetGRPCMethodAggregateLimits("/UserService/CreateUser")
+			if !reflect.DeepEqual(limits, expected) {
+				t.Errorf("GetGRPCMethodAggregateLimits() = %v, want %v", limits, expected)
+			}
+			// A method with only aggregate limits keeps the default per-user rate
+			if rate := config.GetGRPCMethodRate("/UserService/CreateUser"); rate != 5 {
+				t.Errorf("GetGRPCMethodRate() = %d, want the default of 5", rate)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// convertPenalty validates and copies the penalty box settings
+// Durations left out of the file keep their defaults
+func convertPenalty(config *Config, fileConfig *FileConfig) error {
+	penalty := fileConfig.RateLimits.Penalty
+	if penalty.Threshold < 0 {
+		return fmt.Errorf("penalty threshold must not be negative, got %d", penalty.Threshold)
+	}
+	config.PenaltyThreshold = penalty.Threshold
+
+	durations := []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"window", penalty.Window, &config.PenaltyWindow},
+		{"ban", penalty.Ban, &config.PenaltyBan},
+		{"max_ban", penalty.MaxBan, &config.PenaltyMaxBan},
+		{"reset_after", penalty.ResetAfter, &config.PenaltyResetAfter},
+		{"tarpit", penalty.Tarpit, &config.PenaltyTarpit},
+	}
+
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return fmt.Errorf("invalid penalty %s %q: %w", d.name, d.value, err)
+		}
+		if duration < 0 {
+			return fmt.Errorf("penalty %s must not be negative, got %s", d.name, duration)
+		}
+		*d.dest = duration
+	}
+	return validatePenalty(config)
+}
+
+// loadPenaltyEnvConfig loads the penalty box settings from environment variables
+func loadPenaltyEnvConfig(config *Config) error {
+	var err error
+
+	if config.PenaltyThreshold, err = loadEnvInt("RATE_LIMIT_PENALTY_THRESHOLD", config.PenaltyThreshold); err != nil {
+		return err
+	}
+
+	durations := []struct {
+		envVar string
+		dest   *time.Duration
+	}{
+		{"RATE_LIMIT_PENALTY_WINDOW", &config.PenaltyWindow},
+		{"RATE_LIMIT_PENALTY_BAN", &config.PenaltyBan},
+		{"RATE_LIMIT_PENALTY_MAX_BAN", &config.PenaltyMaxBan},
+		{"RATE_LIMIT_PENALTY_TARPIT", &config.PenaltyTarpit},
+	}
+
+	for _, d := range durations {
+		value := os.Getenv(d.envVar)
+		if value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s value %q: %w", d.envVar, value, err)
+		}
+		if duration < 0 {
+			return fmt.Errorf("%s must not be negative, got %s", d.envVar, duration)
+		}
+		*d.dest = duration
+	}
+	return validatePenalty(config)
+}
+
+// validatePenalty checks that an enabled penalty box has a window and bans that can escalate
+func validatePenalty(config *Config) error {
+	if config.PenaltyThreshold == 0 {
+		return nil
+	}
+	if config.PenaltyWindow <= 0 || config.PenaltyBan <= 0 {
+		return fmt.Errorf("penalty window and ban must be positive, got %s and %s",
+			config.PenaltyWindow, config.PenaltyBan)
+	}
+	if config.PenaltyMaxBan < config.PenaltyBan {
+		return fmt.Errorf("penalty max ban (%s) cannot be shorter than the ban (%s)",
+			config.PenaltyMaxBan, config.PenaltyBan)
+	}
+	return nil
+}
+
+// GetPenaltyBan returns how long a user is banned for their offense-th offense, starting at 1
+// Each repeated offense doubles the ban, up to PenaltyMaxBan
+func (c Config) GetPenaltyBan(offense int) time.Duration {
+	ban := c.PenaltyBan
+	for i := 1; i < offense && ban < c.PenaltyMaxBan; i++ {
+		ban *= 2
+	}
+	return min(ban, c.PenaltyMaxBan)
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetPenaltyBan(t *testing.T) {
+	config := Config{PenaltyBan: time.Minute, PenaltyMaxBan: 5 * time.Minute}
+
+	tests := []struct {
+		offense  int
+		expected time.Duration
+	}{
+		{offense: 1, expected: time.Minute},
+		{offense: 2, expected: 2 * time.Minute},
+		{offense: 3, expected: 4 * time.Minute},
+		{offense: 4, expected: 5 * time.Minute},
+		{offense: 100, expected: 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if ban := config.GetPenaltyBan(tt.offense); ban != tt.expected {
+			t.Errorf("GetPenaltyBan(%d) = %v, want %v", tt.offense, ban, tt.expected)
+		}
+	}
+}
+
+func TestLoadFromFile_Penalty(t *testing.T) {
+	tests := []struct {
+		name      string
+		section   string
+		threshold int
+		window    time.Duration
+		ban       time.Duration
+		maxBan    time.Duration
+		tarpit    time.Duration
+		hasError  bool
+	}{
+		{
+			name: "all settings",
+			section: `  penalty:
+    threshold: 20
+    window: 30s
+    ban: 2m
+    max_ban: 2h
+    reset_after: 12h
+    tarpit: 1s`,
+			threshold: 20,
+			window:    30 * time.Second,
+			ban:       2 * time.Minute,
+			maxBan:    2 * time.Hour,
+			tarpit:    time.Second,
+		},
+		{
+			name:      "defaults",
+			section:   "  penalty: {threshold: 10}",
+			threshold: 10,
+			window:    time.Minute,
+			ban:       time.Minute,
+			maxBan:    time.Hour,
+		},
+		{
+			name:     "invalid duration",
+			section:  "  penalty: {threshold: 10, ban: forever}",
+			hasError: true,
+		},
+		{
+			name:     "negative threshold",
+			section:  "  penalty: {threshold: -1}",
+			hasError: true,
+		},
+		{
+			name:     "max ban shorter than ban",
+			section:  "  penalty: {threshold: 10, ban: 10m, max_ban: 5m}",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := `
+rate_limits:
+  global: {rate: 100, burst: 10}
+  http: {rate: 50, burst: 5, default_method_rate: 10}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+` + tt.section + "\n"
+			filePath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(filePath, []byte(content), 0600); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			config, err := LoadFromFile(filePath)
+			if (err != nil) != tt.hasError {
+				t.Fatalf("LoadFromFile() error = %v, hasError %v", err, tt.hasError)
+			}
+			if tt.hasError {
+				return
+			}
+
+			if config.PenaltyThreshold != tt.threshold || config.PenaltyWindow != tt.window {
+				t.Errorf("threshold, window = %d, %v, want %d, %v",
+					config.PenaltyThreshold, config.PenaltyWindow, tt.threshold, tt.window)
+			}
+			if config.PenaltyBan != tt.ban || config.PenaltyMaxBan != tt.maxBan || config.PenaltyTarpit != tt.tarpit {
+				t.Errorf("ban, max ban, tarpit = %v, %v, %v, want %v, %v, %v",
+					config.PenaltyBan, config.PenaltyMaxBan, config.PenaltyTarpit, tt.ban, tt.maxBan, tt.tarpit)
+			}
+		})
+	}
+}
+
+func TestLoadFromEnv_Penalty(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	_ = os.Setenv("RATE_LIMIT_PENALTY_THRESHOLD", "50")
+	_ = os.Setenv("RATE_LIMIT_PENALTY_BAN", "30s")
+	_ = os.Setenv("RATE_LIMIT_PENALTY_TARPIT", "500ms")
+
+	config, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv() error = %v", err)
+	}
+
+	if config.PenaltyThreshold != 50 || config.PenaltyBan != 30*time.Second ||
+		config.PenaltyTarpit != 500*time.Millisecond {
+		t.Errorf("penalty = %d, %v, %v, want 50, 30s, 500ms",
+			config.PenaltyThreshold, config.PenaltyBan, config.PenaltyTarpit)
+	}
+	if config.PenaltyWindow != time.Minute || config.PenaltyMaxBan != time.Hour {
+		t.Errorf("window, max ban = %v, %v, want the 1m and 1h defaults", config.PenaltyWindow, config.PenaltyMaxBan)
+	}
+
+	_ = os.Setenv("RATE_LIMIT_PENALTY_MAX_BAN", "10s")
+	if _, err := LoadFromEnv(); err == nil {
+		t.Error("LoadFromEnv() should reject a max ban shorter than the ban")
+	}
+}
@@ -0,0 +1,197 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+)
+
+// PlanValue is an entry of the plans.definitions config section: the rate limits of one plan,
+// e.g. {"global": {"rate": 1000, "burst": 100}, "http": {"methods": {"GET /api/search": 50}}}
+// Anything a plan leaves out is taken from the top-level global, http and grpc sections
+type PlanValue struct {
+	// Global overrides the global tier
+	Global PlanTierValue `json:"global" yaml:"global"`
+	// HTTP overrides the HTTP-only tier and HTTP methods
+	HTTP PlanTierValue `json:"http" yaml:"http"`
+	// GRPC overrides the gRPC-only tier and gRPC methods
+	GRPC PlanTierValue `json:"grpc" yaml:"grpc"`
+}
+
+// PlanTierValue is one tier of a plan
+// Only the fields that are set override the top-level tier; methods are merged into the
+// top-level methods, a plan's entry replacing the top-level entry of the same method
+type PlanTierValue struct {
+	Rate                RateValue              `json:"rate" yaml:"rate"`
+	Period              string                 `json:"period" yaml:"period"`
+	Burst               int                    `json:"burst" yaml:"burst"`
+	Limits              []LimitValue           `json:"limits" yaml:"limits"`
+	DefaultMethodRate   RateValue              `json:"default_method_rate" yaml:"default_method_rate"`
+	DefaultMethodPeriod string                 `json:"default_method_period" yaml:"default_method_period"`
+	Methods             map[string]MethodLimit `json:"methods" yaml:"methods"`
+}
+
+// convertPlans converts every plan into a copy of config with the plan's overrides applied
+// It must run last, once config holds the converted top-level settings
+func convertPlans(config *Config, fileConfig *FileConfig) error {
+	plans := fileConfig.RateLimits.Plans
+
+	config.Plans = nil
+	for _, name := range sortedKeys(plans.Definitions) {
+		plan := plans.Definitions[name]
+		if err := validatePlanValue(plan); err != nil {
+			return fmt.Errorf("plan %q: %w", name, err)
+		}
+
+		planFile := applyPlanValue(*fileConfig, plan)
+		planConfig := *config
+		if err := validateAndConvertFileConfig(&planConfig, &planFile); err != nil {
+			return fmt.Errorf("plan %q: %w", name, err)
+		}
+
+		planConfig.ChargeCredits = config.chargesPlanCredits(name)
+
+		if config.Plans == nil {
+			config.Plans = make(map[string]Config)
+		}
+		config.Plans[name] = planConfig
+	}
+
+	config.DefaultPlan = plans.Default
+	config.PlanUsers = plans.Users
+	return validatePlans(config)
+}
+
+// validatePlanValue rejects settings a plan cannot override
+// Concurrency ceilings, priorities, aggregate limits and strictness are not per plan, so a plan's methods
+// may only set rates, periods, costs and limits
+func validatePlanValue(plan PlanValue) error {
+	global := plan.Global
+	if global.DefaultMethodRate.Count != 0 || global.DefaultMethodPeriod != "" || len(global.Methods) > 0 {
+		return fmt.Errorf("global section cannot set methods or a default method rate")
+	}
+
+	protocols := []struct {
+		name    string
+		methods map[string]MethodLimit
+	}{
+		{"HTTP", plan.HTTP.Methods},
+		{"gRPC", plan.GRPC.Methods},
+	}
+	for _, protocol := range protocols {
+		for _, method := range sortedKeys(protocol.methods) {
+			limit := protocol.methods[method]
+			if limit.MaxConcurrent != 0 || limit.Priority != "" || len(limit.Aggregate) > 0 || limit.Strict {
+				return fmt.Errorf("%s method %q can only set rate, period, cost and limits", protocol.name, method)
+			}
+		}
+	}
+	return nil
+}
+
+// applyPlanValue returns a copy of fileConfig whose global, http and grpc sections have the plan's
+// overrides applied and which defines no plans of its own
+func applyPlanValue(fileConfig FileConfig, plan PlanValue) FileConfig {
+	rl := &fileConfig.RateLimits
+	rl.Plans.Definitions = nil
+	rl.Plans.Default = ""
+	rl.Plans.Users = nil
+	rl.Credits.Plans = nil
+	// Users are identified before their plan is known, by the top-level extractors only
+	fileConfig.UserIdentification.Extractors = nil
+
+	applyPlanTier(&rl.Global.Rate, &rl.Global.Period, &rl.Global.Burst, &rl.Global.Limits, plan.Global)
+	applyPlanTier(&rl.HTTP.Rate, &rl.HTTP.Period, &rl.HTTP.Burst, &rl.HTTP.Limits, plan.HTTP)
+	applyPlanTier(&rl.GRPC.Rate, &rl.GRPC.Period, &rl.GRPC.Burst, &rl.GRPC.Limits, plan.GRPC)
+
+	if plan.HTTP.DefaultMethodRate.Count != 0 {
+		rl.HTTP.DefaultMethodRate = plan.HTTP.DefaultMethodRate
+		rl.HTTP.DefaultMethodPeriod = plan.HTTP.DefaultMethodPeriod
+	}
+	if plan.GRPC.DefaultMethodRate.Count != 0 {
+		rl.GRPC.DefaultMethodRate = plan.GRPC.DefaultMethodRate
+		rl.GRPC.DefaultMethodPeriod = plan.GRPC.DefaultMethodPeriod
+	}
+	rl.HTTP.Methods = mergeMethods(rl.HTTP.Methods, plan.HTTP.Methods)
+	rl.GRPC.Methods = mergeMethods(rl.GRPC.Methods, plan.GRPC.Methods)
+	return fileConfig
+}
+
+// applyPlanTier overrides the rate, burst and limits of a tier with those the plan sets
+// A plan's rate comes with its own period, so a top-level period never applies to it
+func applyPlanTier(rate *RateValue, period *string, burst *int, limits *[]LimitValue, tier PlanTierValue) {
+	if tier.Rate.Count != 0 {
+		*rate = tier.Rate
+		*period = tier.Period
+	}
+	if tier.Burst != 0 {
+		*burst = tier.Burst
+	}
+	if tier.Limits != nil {
+		*limits = tier.Limits
+	}
+}
+
+// mergeMethods returns the top-level methods with the plan's entries replacing those of the same method
+// A strict method stays strict under every plan
+func mergeMethods(methods, overrides map[string]MethodLimit) map[string]MethodLimit {
+	if len(overrides) == 0 {
+		return methods
+	}
+	merged := maps.Clone(methods)
+	if merged == nil {
+		merged = make(map[string]MethodLimit, len(overrides))
+	}
+	for method, override := range overrides {
+		override.Strict = methods[method].Strict
+		merged[method] = override
+	}
+	return merged
+}
+
+// validatePlans checks that the default plan and every user's plan are defined
+func validatePlans(config *Config) error {
+	if config.DefaultPlan != "" {
+		if _, ok := config.Plans[config.DefaultPlan]; !ok {
+			return fmt.Errorf("default plan %q is not defined", config.DefaultPlan)
+		}
+	}
+	for _, userID := range sortedKeys(config.PlanUsers) {
+		if _, ok := config.Plans[config.PlanUsers[userID]]; !ok {
+			return fmt.Errorf("user %q plan %q is not defined", userID, config.PlanUsers[userID])
+		}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of m in order, so the same invalid config always reports the same entry
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// GetUserPlan returns the plan assigned to a user in the plans.users config section, or ""
+func (c Config) GetUserPlan(userID string) string {
+	return c.PlanUsers[userID]
+}
+
+// ResolvePlan returns the name of the plan to apply for the given plan name: the plan itself if
+// it is defined, else DefaultPlan, which is "" when users on no plan get the top-level limits
+func (c Config) ResolvePlan(name string) string {
+	if _, ok := c.Plans[name]; ok {
+		return name
+	}
+	return c.DefaultPlan
+}
+
+// ForPlan returns the configuration with the limits of the given plan, resolved like ResolvePlan
+func (c Config) ForPlan(name string) Config {
+	if plan, ok := c.Plans[c.ResolvePlan(name)]; ok {
+		return plan
+	}
+	return c
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadFromFile_Plans(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		content  string
+		hasError bool
+	}{
+		{
+			name:     "JSON",
+			fileName: "config.json",
+			content: `{
+				"rate_limits": {
+					"global": {"rate": 10, "burst": 10},
+					"http": {"rate": 50, "burst": 5, "default_method_rate": 10, "methods": {
+						"GET /api/users": 20, "POST /api/users": {"rate": 5, "cost": 2}
+					}},
+					"grpc": {"rate": 30, "burst": 3, "default_method_rate": 5},
+					"plans": {
+						"default": "free",
+						"users": {"user123": "pro"},
+						"definitions": {
+							"free": {},
+							"pro": {
+								"global": {"rate": "6000/m", "burst": 100},
+								"http": {"default_method_rate": 50, "methods": {"GET /api/users": 200}}
+							}
+						}
+					}
+				}
+			}`,
+		},
+		{
+			name:     "YAML",
+			fileName: "config.yaml",
+			content: `
+rate_limits:
+  global: {rate: 10, burst: 10}
+  http:
+    rate: 50
+    burst: 5
+    default_method_rate: 10
+    methods:
+      GET /api/users: 20
+      POST /api/users: {rate: 5, cost: 2}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+  plans:
+    default: free
+    users: {user123: pro}
+    definitions:
+      free: {}
+      pro:
+        global: {rate: 6000/m, burst: 100}
+        http:
+          default_method_rate: 50
+          methods:
+            GET /api/users: 200
+`,
+		},
+		{
+			name:     "undefined default plan",
+			fileName: "config.yaml",
+			content: `
+rate_limits:
+  global: {rate: 10, burst: 10}
+  http: {rate: 50, burst: 5, default_method_rate: 10}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+  plans: {default: gold, definitions: {free: {}}}
+`,
+			hasError: true,
+		},
+		{
+			name:     "undefined user plan",
+			fileName: "config.yaml",
+			content: `
+rate_limits:
+  global: {rate: 10, burst: 10}
+  http: {rate: 50, burst: 5, default_method_rate: 10}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+  plans: {users: {user123: gold}}
+`,
+			hasError: true,
+		},
+		{
+			name:     "invalid plan rate",
+			fileName: "config.yaml",
+			content: `
+rate_limits:
+  global: {rate: 10, burst: 10}
+  http: {rate: 50, burst: 5, default_method_rate: 10}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+  plans: {definitions: {pro: {global: {rate: 10/week}}}}
+`,
+			hasError: true,
+		},
+		{
+			name:     "plan method with a concurrency ceiling",
+			fileName: "config.yaml",
+			content: `
+rate_limits:
+  global: {rate: 10, burst: 10}
+  http: {rate: 50, burst: 5, default_method_rate: 10}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+  plans: {definitions: {pro: {http: {methods: {GET /api/reports: {max_concurrent: 2}}}}}}
+`,
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), tt.fileName)
+			if err := os.WriteFile(filePath, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("failed to write config file: %v", err)
+			}
+
+			config, err := LoadFromFile(filePath)
+			if (err != nil) != tt.hasError {
+				t.Fatalf("LoadFromFile() error = %v, hasError %v", err, tt.hasError)
+			}
+			if tt.hasError {
+				return
+			}
+
+			if len(config.Plans) != 2 || config.DefaultPlan != "free" || config.GetUserPlan("user123") != "pro" {
+				t.Fatalf("Plans = %v, default %q, user123 on %q", config.Plans, config.DefaultPlan,
+					config.GetUserPlan("user123"))
+			}
+
+			// A plan without overrides has the top-level limits
+			free := config.ForPlan("free")
+			if free.GlobalRate != 10 || free.GetHTTPMethodRate("GET:/api/users") != 20 || len(free.Plans) != 0 {
+				t.Errorf("free plan should inherit the top-level limits, got global %d and GET /api/users %d",
+					free.GlobalRate, free.GetHTTPMethodRate("GET:/api/users"))
+			}
+
+			pro := config.ForPlan("pro")
+			if pro.GlobalRate != 6000 || pro.GlobalPeriod != time.Minute || pro.GlobalBurstSize != 100 {
+				t.Errorf("pro global = %d per %s, burst %d, want 6000 per 1m, burst 100",
+					pro.GlobalRate, pro.GlobalPeriod, pro.GlobalBurstSize)
+			}
+			if pro.HTTPRate != 50 || pro.GRPCRate != 30 {
+				t.Errorf("pro should inherit the protocol tiers, got HTTP %d and gRPC %d", pro.HTTPRate, pro.GRPCRate)
+			}
+
+			methods := []struct {
+				endpointKey string
+				rate        int
+				cost        int
+			}{
+				{"GET:/api/users", 200, 1},
+				{"POST:/api/users", 5, 2},
+				{"DELETE:/api/users", 50, 1},
+			}
+			for _, m := range methods {
+				if rate := pro.GetHTTPMethodRate(m.endpointKey); rate != m.rate {
+					t.Errorf("pro GetHTTPMethodRate(%q) = %d, want %d", m.endpointKey, rate, m.rate)
+				}
+				if cost := pro.GetHTTPMethodCost(m.endpointKey); cost != m.cost {
+					t.Errorf("pro GetHTTPMethodCost(%q) = %d, want %d", m.endpointKey, cost, m.cost)
+				}
+			}
+		})
+	}
+}
+
+func TestConfig_ForPlan(t *testing.T) {
+	config := Config{
+		GlobalRate: 10,
+		Plans: map[string]Config{
+			"free": {GlobalRate: 5},
+			"pro":  {GlobalRate: 100},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		defaultPlan string
+		plan        string
+		expected    int
+	}{
+		{"defined plan", "", "pro", 100},
+		{"no plan without default", "", "", 10},
+		{"undefined plan without default", "", "gold", 10},
+		{"no plan with default", "free", "", 5},
+		{"undefined plan with default", "free", "gold", 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.DefaultPlan = tt.defaultPlan
+			if rate := config.ForPlan(tt.plan).GlobalRate; rate != tt.expected {
+				t.Errorf("ForPlan(%q).GlobalRate = %d, want %d", tt.plan, rate, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// PriorityClass is a class of requests, such as "critical" or "analytics", that shares the global
+// and protocol buckets with the other classes
+// Classes are ordered from highest to lowest priority; each one holds back Reserve of every bucket
+// from the classes below it, so lower classes are shed first when capacity runs low
+type PriorityClass struct {
+	// Name identifies the class in headers, metadata and per-method settings
+	Name string
+	// Reserve is the share of each bucket, between 0 and 1, kept for this class and those above it
+	Reserve float64
+}
+
+// PriorityClassValue is an entry of the priorities.classes list in a config file,
+// e.g. {"name": "critical", "reserve": 0.2}
+type PriorityClassValue struct {
+	// Name identifies the class
+	Name string `json:"name" yaml:"name"`
+	// Reserve is the share of each bucket kept for this class and those above it
+	Reserve float64 `json:"reserve" yaml:"reserve"`
+}
+
+// convertPriorities validates and copies the priority classes and the per-method priorities
+// The per-method priorities must already have been converted from the methods sections
+func convertPriorities(config *Config, fileConfig *FileConfig) error {
+	priorities := fileConfig.RateLimits.Priorities
+
+	config.PriorityClasses = nil
+	for i, value := range priorities.Classes {
+		config.PriorityClasses = append(config.PriorityClasses, PriorityClass{Name: value.Name, Reserve: value.Reserve})
+		if value.Name == "" {
+			return fmt.Errorf("priority class %d must have a name", i+1)
+		}
+		if config.GetPriorityClass(value.Name) != i {
+			return fmt.Errorf("priority class %q is defined twice", value.Name)
+		}
+		if value.Reserve < 0 || value.Reserve >= 1 {
+			return fmt.Errorf("priority class %q reserve must be at least 0 and below 1, got %g", value.Name, value.Reserve)
+		}
+	}
+
+	config.PriorityHeader = priorities.Header
+	config.PriorityMetadataKey = priorities.MetadataKey
+	config.DefaultPriority = priorities.Default
+	return validatePriorities(config)
+}
+
+// validatePriorities checks that reserves leave room for the lowest class and that the default
+// and per-method priorities name configured classes
+func validatePriorities(config *Config) error {
+	classes := config.PriorityClasses
+	if len(classes) == 0 {
+		if config.DefaultPriority != "" || len(config.HTTPMethodPriorities) > 0 || len(config.GRPCMethodPriorities) > 0 {
+			return fmt.Errorf("priorities are assigned but no priority classes are configured")
+		}
+		return nil
+	}
+
+	lowest := classes[len(classes)-1]
+	if lowest.Reserve != 0 {
+		return fmt.Errorf("lowest priority class %q cannot reserve a share, it uses what the others leave", lowest.Name)
+	}
+	if reserved := config.GetPriorityReserve(lowest.Name); reserved >= 1 {
+		return fmt.Errorf("priority classes reserve %g of each bucket, leaving nothing for class %q",
+			reserved, lowest.Name)
+	}
+
+	if config.DefaultPriority != "" && config.GetPriorityClass(config.DefaultPriority) < 0 {
+		return fmt.Errorf("default priority %q is not a configured priority class", config.DefaultPriority)
+	}
+	for _, methods := range []map[string]string{config.HTTPMethodPriorities, config.GRPCMethodPriorities} {
+		// Sort so the same invalid config always reports the same method
+		names := make([]string, 0, len(methods))
+		for method := range methods {
+			names = append(names, method)
+		}
+		sort.Strings(names)
+
+		for _, method := range names {
+			if config.GetPriorityClass(methods[method]) < 0 {
+				return fmt.Errorf("method %q priority %q is not a configured priority class", method, methods[method])
+			}
+		}
+	}
+	return nil
+}
+
+// GetPriorityClass returns the index of the named priority class, 0 being the highest, or -1 if
+// no class has that name
+func (c Config) GetPriorityClass(name string) int {
+	for i, class := range c.PriorityClasses {
+		if class.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// ResolvePriority returns the priority class a request belongs to
+// A priority configured for the method wins over the one the client requested; requests naming no
+// known class fall back to DefaultPriority, or to the lowest class if no default is set
+// It returns "" if no priority classes are configured
+func (c Config) ResolvePriority(methodPriority, requested string) string {
+	if len(c.PriorityClasses) == 0 {
+		return ""
+	}
+	for _, name := range []string{methodPriority, requested, c.DefaultPriority} {
+		if name != "" && c.GetPriorityClass(name) >= 0 {
+			return name
+		}
+	}
+	return c.PriorityClasses[len(c.PriorityClasses)-1].Name
+}
+
+// GetPriorityReserve returns the share of each global and protocol bucket a request of the given
+// priority class must leave untouched: the reserves of every class above it
+// A name that is not a configured class counts as the default class
+func (c Config) GetPriorityReserve(class string) float64 {
+	index := c.GetPriorityClass(c.ResolvePriority("", class))
+	reserved := 0.0
+	for i := 0; i < index; i++ {
+		reserved += c.PriorityClasses[i].Reserve
+	}
+	return reserved
+}
+
+// GetHTTPMethodPriority returns the priority class configured for an HTTP endpoint key, or ""
+func (c Config) GetHTTPMethodPriority(endpointKey string) string {
+	priority, _ := lookupHTTPMethod(c.HTTPMethodPriorities, endpointKey)
+	return priority
+}
+
+// GetGRPCMethodPriority returns the priority class configured for a gRPC method, or ""
+func (c Config) GetGRPCMethodPriority(method string) string {
+	return c.GRPCMethodPriorities[method]
+}
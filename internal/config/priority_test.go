@@ -0,0 +1,149 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadFromFile_Priorities(t *testing.T) {
+	tests := []struct {
+		name     string
+		section  string
+		expected []PriorityClass
+		hasError bool
+	}{
+		{
+			name: "classes with method priorities",
+			section: `  priorities:
+    header: X-Priority
+    metadata_key: priority
+    default: normal
+    classes:
+      - {name: critical, reserve: 0.2}
+      - {name: normal, reserve: 0.3}
+      - {name: analytics}`,
+			expected: []PriorityClass{{"critical", 0.2}, {"normal", 0.3}, {"analytics", 0}},
+		},
+		{
+			name:     "duplicate class",
+			section:  "  priorities: {classes: [{name: critical, reserve: 0.2}, {name: critical}]}",
+			hasError: true,
+		},
+		{
+			name:     "reserve out of range",
+			section:  "  priorities: {classes: [{name: critical, reserve: 1}, {name: normal}]}",
+			hasError: true,
+		},
+		{
+			name:     "reserves leave nothing",
+			section:  "  priorities: {classes: [{name: critical, reserve: 0.5}, {name: high, reserve: 0.5}, {name: low}]}",
+			hasError: true,
+		},
+		{
+			name:     "lowest class reserves a share",
+			section:  "  priorities: {classes: [{name: critical, reserve: 0.2}, {name: low, reserve: 0.1}]}",
+			hasError: true,
+		},
+		{
+			name:     "unknown default",
+			section:  "  priorities: {default: urgent, classes: [{name: critical, reserve: 0.2}, {name: low}]}",
+			hasError: true,
+		},
+		{
+			name:     "method priority without classes",
+			section:  "",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := `
+rate_limits:
+  global: {rate: 100, burst: 10}
+  http:
+    rate: 50
+    burst: 5
+    default_method_rate: 10
+    methods:
+      "GET /health": {rate: 10, priority: critical}
+      "POST /api/events": {priority: analytics}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+` + tt.section + "\n"
+			filePath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(filePath, []byte(content), 0600); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			config, err := LoadFromFile(filePath)
+			if (err != nil) != tt.hasError {
+				t.Fatalf("LoadFromFile() error = %v, hasError %v", err, tt.hasError)
+			}
+			if tt.hasError {
+				return
+			}
+
+			if !reflect.DeepEqual(config.PriorityClasses, tt.expected) {
+				t.Errorf("PriorityClasses = %v, want %v", config.PriorityClasses, tt.expected)
+			}
+			if config.PriorityHeader != "X-Priority" || config.PriorityMetadataKey != "priority" {
+				t.Errorf("priority keys = %q, %q, want X-Priority, priority",
+					config.PriorityHeader, config.PriorityMetadataKey)
+			}
+			if priority := config.GetHTTPMethodPriority("GET:/health"); priority != "critical" {
+				t.Errorf("GetHTTPMethodPriority(GET:/health) = %q, want critical", priority)
+			}
+			if priority := config.GetHTTPMethodPriority("POST:/api/events"); priority != "analytics" {
+				t.Errorf("GetHTTPMethodPriority(POST:/api/events) = %q, want analytics", priority)
+			}
+			// A method with only a priority keeps the default method rate
+			if rate := config.GetHTTPMethodRate("POST:/api/events"); rate != 10 {
+				t.Errorf("GetHTTPMethodRate(POST:/api/events) = %d, want the default 10", rate)
+			}
+		})
+	}
+}
+
+func TestConfig_ResolvePriority(t *testing.T) {
+	config := Config{
+		PriorityClasses: []PriorityClass{{"critical", 0.2}, {"normal", 0.3}, {"analytics", 0}},
+		DefaultPriority: "normal",
+	}
+
+	tests := []struct {
+		name           string
+		methodPriority string
+		requested      string
+		class          string
+		reserve        float64
+	}{
+		{name: "method wins", methodPriority: "analytics", requested: "critical", class: "analytics", reserve: 0.5},
+		{name: "requested class", requested: "critical", class: "critical", reserve: 0},
+		{name: "unknown class falls back to default", requested: "urgent", class: "normal", reserve: 0.2},
+		{name: "nothing requested", class: "normal", reserve: 0.2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			class := config.ResolvePriority(tt.methodPriority, tt.requested)
+			if class != tt.class {
+				t.Errorf("ResolvePriority(%q, %q) = %q, want %q", tt.methodPriority, tt.requested, class, tt.class)
+			}
+			if reserve := config.GetPriorityReserve(class); reserve != tt.reserve {
+				t.Errorf("GetPriorityReserve(%q) = %g, want %g", class, reserve, tt.reserve)
+			}
+		})
+	}
+
+	// Without a default, unknown classes get the lowest priority
+	config.DefaultPriority = ""
+	if class := config.ResolvePriority("", "urgent"); class != "analytics" {
+		t.Errorf("ResolvePriority() = %q, want the lowest class analytics", class)
+	}
+	// Without classes, nothing is reserved
+	if reserve := (Config{}).GetPriorityReserve("critical"); reserve != 0 {
+		t.Errorf("GetPriorityReserve() without classes = %g, want 0", reserve)
+	}
+}
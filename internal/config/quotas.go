@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// QuotaPeriod is the calendar period a quota resets on
+type QuotaPeriod string
+
+const (
+	// QuotaPeriodDay resets quotas at midnight
+	QuotaPeriodDay QuotaPeriod = "day"
+	// QuotaPeriodMonth resets quotas at midnight on the first day of each month
+	QuotaPeriodMonth QuotaPeriod = "month"
+)
+
+// parseQuotaPeriod validates a quota period name
+func parseQuotaPeriod(value string) (QuotaPeriod, error) {
+	switch QuotaPeriod(value) {
+	case QuotaPeriodDay, QuotaPeriodMonth:
+		return QuotaPeriod(value), nil
+	default:
+		return "", fmt.Errorf("invalid quota period %q, must be one of: %s, %s", value, QuotaPeriodDay, QuotaPeriodMonth)
+	}
+}
+
+// Quota caps how many requests a user may make per calendar period, e.g. 100000 per month
+// Unlike a Limit it does not refill gradually: the whole quota becomes available again at the
+// start of the next period
+type Quota struct {
+	// Limit is the number of requests allowed per period
+	Limit int
+	// Period is the calendar period the quota resets on
+	Period QuotaPeriod
+}
+
+// String formats the quota, e.g. "100000/month"
+func (q Quota) String() string {
+	return fmt.Sprintf("%d/%s", q.Limit, q.Period)
+}
+
+// Window returns an identifier for the calendar period containing t, e.g. "month:2026-10",
+// and the time that period ends
+// Periods start at midnight in loc, so a quota may reset at a timezone boundary other than UTC
+func (q Quota) Window(t time.Time, loc *time.Location) (string, time.Time) {
+	t = t.In(loc)
+	year, month, day := t.Date()
+
+	if q.Period == QuotaPeriodMonth {
+		start := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+		return fmt.Sprintf("%s:%s", q.Period, start.Format("2006-01")), start.AddDate(0, 1, 0)
+	}
+	start := time.Date(year, month, day, 0, 0, 0, 0, loc)
+	return fmt.Sprintf("%s:%s", q.Period, start.Format("2006-01-02")), start.AddDate(0, 0, 1)
+}
+
+// QuotaValue is an entry of the quotas.limits list in a config file, e.g. {"limit": 100000, "period": "month"}
+type QuotaValue struct {
+	// Limit is the number of requests allowed per period
+	Limit int `json:"limit" yaml:"limit"`
+	// Period is "day" or "month"
+	Period string `json:"period" yaml:"period"`
+}
+
+// convertQuotas validates and copies the calendar quota settings
+func convertQuotas(config *Config, fileConfig *FileConfig) error {
+	quotas := fileConfig.RateLimits.Quotas
+
+	config.Quotas = nil
+	for i, value := range quotas.Limits {
+		if value.Limit <= 0 {
+			return fmt.Errorf("quota %d limit must be positive, got %d", i+1, value.Limit)
+		}
+		period, err := parseQuotaPeriod(value.Period)
+		if err != nil {
+			return fmt.Errorf("quota %d: %w", i+1, err)
+		}
+		config.Quotas = append(config.Quotas, Quota{Limit: value.Limit, Period: period})
+	}
+
+	if quotas.Timezone != "" {
+		location, err := time.LoadLocation(quotas.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid quota timezone %q: %w", quotas.Timezone, err)
+		}
+		config.QuotaLocation = location
+	}
+
+	config.QuotaFile = quotas.File
+	if quotas.FlushInterval != "" {
+		interval, err := time.ParseDuration(quotas.FlushInterval)
+		if err != nil {
+			return fmt.Errorf("invalid quota flush interval %q: %w", quotas.FlushInterval, err)
+		}
+		if interval <= 0 {
+			return fmt.Errorf("quota flush interval must be positive, got %s", interval)
+		}
+		config.QuotaFlushInterval = interval
+	}
+	return nil
+}
+
+// loadQuotaEnvConfig loads the daily and monthly quotas and their storage from environment variables
+func loadQuotaEnvConfig(config *Config) error {
+	quotas := []struct {
+		envVar string
+		period QuotaPeriod
+	}{
+		{"RATE_LIMIT_DAILY_QUOTA", QuotaPeriodDay},
+		{"RATE_LIMIT_MONTHLY_QUOTA", QuotaPeriodMonth},
+	}
+
+	for _, quota := range quotas {
+		limit, err := loadEnvInt(quota.envVar, 0)
+		if err != nil {
+			return err
+		}
+		if limit > 0 {
+			config.Quotas = append(config.Quotas, Quota{Limit: limit, Period: quota.period})
+		}
+	}
+
+	if timezone := loadEnvString("RATE_LIMIT_QUOTA_TIMEZONE", ""); timezone != "" {
+		location, err := time.LoadLocation(timezone)
+		if err != nil {
+			return fmt.Errorf("invalid RATE_LIMIT_QUOTA_TIMEZONE value %q: %w", timezone, err)
+		}
+		config.QuotaLocation = location
+	}
+
+	config.QuotaFile = loadEnvString("RATE_LIMIT_QUOTA_FILE", config.QuotaFile)
+	return nil
+}
+
+// GetQuotaLocation returns the timezone quota periods are aligned to, UTC by default
+func (c Config) GetQuotaLocation() *time.Location {
+	if c.QuotaLocation == nil {
+		return time.UTC
+	}
+	return c.QuotaLocation
+}
+
+// GetQuotaFlushInterval returns how often file-backed quota counters are written to disk
+func (c Config) GetQuotaFlushInterval() time.Duration {
+	if c.QuotaFlushInterval <= 0 {
+		return 5 * time.Second
+	}
+	return c.QuotaFlushInterval
+}
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQuota_Window(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		quota    Quota
+		now      time.Time
+		location *time.Location
+		window   string
+		end      time.Time
+	}{
+		{
+			name:     "day in UTC",
+			quota:    Quota{Limit: 100, Period: QuotaPeriodDay},
+			now:      time.Date(2026, 10, 17, 23, 59, 0, 0, time.UTC),
+			location: time.UTC,
+			window:   "day:2026-10-17",
+			end:      time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "month across the year end",
+			quota:    Quota{Limit: 100000, Period: QuotaPeriodMonth},
+			now:      time.Date(2026, 12, 31, 12, 0, 0, 0, time.UTC),
+			location: time.UTC,
+			window:   "month:2026-12",
+			end:      time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "day in another timezone",
+			quota:    Quota{Limit: 100, Period: QuotaPeriodDay},
+			now:      time.Date(2026, 10, 18, 2, 0, 0, 0, time.UTC),
+			location: newYork,
+			window:   "day:2026-10-17",
+			end:      time.Date(2026, 10, 18, 4, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "month in another timezone",
+			quota:    Quota{Limit: 100000, Period: QuotaPeriodMonth},
+			now:      time.Date(2026, 11, 1, 3, 0, 0, 0, time.UTC),
+			location: newYork,
+			window:   "month:2026-10",
+			end:      time.Date(2026, 11, 1, 4, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window, end := tt.quota.Window(tt.now, tt.location)
+			if window != tt.window || !end.Equal(tt.end) {
+				t.Errorf("Window() = %q, %v, want %q, %v", window, end, tt.window, tt.end)
+			}
+		})
+	}
+}
+
+func TestLoadFromFile_Quotas(t *testing.T) {
+	tests := []struct {
+		name     string
+		section  string
+		expected []Quota
+		hasError bool
+	}{
+		{
+			name: "daily and monthly",
+			section: `  quotas:
+    timezone: UTC
+    file: quotas.json
+    flush_interval: 10s
+    limits:
+      - {limit: 100000, period: month}
+      - {limit: 5000, period: day}`,
+			expected: []Quota{{Limit: 100000, Period: QuotaPeriodMonth}, {Limit: 5000, Period: QuotaPeriodDay}},
+		},
+		{
+			name:     "invalid period",
+			section:  "  quotas: {limits: [{limit: 100, period: week}]}",
+			hasError: true,
+		},
+		{
+			name:     "non-positive limit",
+			section:  "  quotas: {limits: [{limit: 0, period: day}]}",
+			hasError: true,
+		},
+		{
+			name:     "invalid timezone",
+			section:  "  quotas: {timezone: Mars/Olympus_Mons, limits: [{limit: 100, period: day}]}",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := `
+rate_limits:
+  global: {rate: 100, burst: 10}
+  http: {rate: 50, burst: 5, default_method_rate: 10}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+` + tt.section + "\n"
+			filePath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(filePath, []byte(content), 0600); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			config, err := LoadFromFile(filePath)
+			if (err != nil) != tt.hasError {
+				t.Fatalf("LoadFromFile() error = %v, hasError %v", err, tt.hasError)
+			}
+			if tt.hasError {
+				return
+			}
+
+			if !reflect.DeepEqual(config.Quotas, tt.expected) {
+				t.Errorf("Quotas = %v, want %v", config.Quotas, tt.expected)
+			}
+			if config.GetQuotaLocation() != time.UTC || config.QuotaFile != "quotas.json" {
+				t.Errorf("quota storage = %v %q, want UTC \"quotas.json\"", config.GetQuotaLocation(), config.QuotaFile)
+			}
+			if interval := config.GetQuotaFlushInterval(); interval != 10*time.Second {
+				t.Errorf("GetQuotaFlushInterval() = %v, want 10s", interval)
+			}
+		})
+	}
+}
+
+func TestLoadFromEnv_Quotas(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	_ = os.Setenv("RATE_LIMIT_DAILY_QUOTA", "5000")
+	_ = os.Setenv("RATE_LIMIT_MONTHLY_QUOTA", "100000")
+	_ = os.Setenv("RATE_LIMIT_QUOTA_FILE", "/var/lib/rate-limiter/quotas.json")
+
+	config, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv() error = %v", err)
+	}
+
+	expected := []Quota{{Limit: 5000, Period: QuotaPeriodDay}, {Limit: 100000, Period: QuotaPeriodMonth}}
+	if !reflect.DeepEqual(config.Quotas, expected) {
+		t.Errorf("Quotas = %v, want %v", config.Quotas, expected)
+	}
+	if config.QuotaFile != "/var/lib/rate-limiter/quotas.json" {
+		t.Errorf("QuotaFile = %q, want /var/lib/rate-limiter/quotas.json", config.QuotaFile)
+	}
+	if interval := config.GetQuotaFlushInterval(); interval != 5*time.Second {
+		t.Errorf("GetQuotaFlushInterval() = %v, want the 5s default", interval)
+	}
+}
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// maxRateScale bounds how far a fractional rate is scaled up to reach a whole count,
+	// so rates are accurate to three decimal places
+	maxRateScale = 1000
+)
+
+// periodUnits maps the unit shorthands accepted after the slash of a rate like "300/m"
+var periodUnits = map[string]time.Duration{
+	"s":      time.Second,
+	"sec":    time.Second,
+	"second": time.Second,
+	"m":      time.Minute,
+	"min":    time.Minute,
+	"minute": time.Minute,
+	"h":      time.Hour,
+	"hour":   time.Hour,
+	"d":      24 * time.Hour,
+	"day":    24 * time.Hour,
+}
+
+// RateValue is a rate as written in a config file
+// It is either a number of requests per second (`100`, `0.5`) or a count per period
+// (`"300/m"`, `"1000/1h"`); a zero Period means none was given
+type RateValue struct {
+	// Count is the number of requests allowed per period, possibly fractional
+	Count float64
+	// Period is the period given after the slash, zero if none was given
+	Period time.Duration
+}
+
+// UnmarshalJSON accepts either a number or a "count/period" string
+func (rv *RateValue) UnmarshalJSON(data []byte) error {
+	var count float64
+	if err := json.Unmarshal(data, &count); err == nil {
+		*rv = RateValue{Count: count}
+		return nil
+	}
+
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("rate must be a number or a string like \"300/m\": %w", err)
+	}
+	parsed, err := parseRateValue(value)
+	if err != nil {
+		return err
+	}
+	*rv = parsed
+	return nil
+}
+
+// UnmarshalYAML accepts either a number or a "count/period" string
+func (rv *RateValue) UnmarshalYAML(node *yaml.Node) error {
+	var value string
+	if err := node.Decode(&value); err != nil {
+		return fmt.Errorf("rate must be a number or a string like \"300/m\": %w", err)
+	}
+	parsed, err := parseRateValue(value)
+	if err != nil {
+		return err
+	}
+	*rv = parsed
+	return nil
+}
+
+// parseRateValue parses "count" or "count/period" without normalizing the count
+func parseRateValue(value string) (RateValue, error) {
+	countPart, periodPart, hasPeriod := strings.Cut(strings.TrimSpace(value), "/")
+
+	count, err := strconv.ParseFloat(strings.TrimSpace(countPart), 64)
+	if err != nil {
+		return RateValue{}, fmt.Errorf("invalid rate %q: %w", value, err)
+	}
+
+	rv := RateValue{Count: count}
+	if hasPeriod {
+		if rv.Period, err = parsePeriod(periodPart); err != nil {
+			return RateValue{}, fmt.Errorf("invalid rate %q: %w", value, err)
+		}
+	}
+	return rv, nil
+}
+
+// parsePeriod parses a unit shorthand ("s", "m", "hour"), a number of days ("7d")
+// or a Go duration ("90s", "1h30m")
+func parsePeriod(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if period, ok := periodUnits[value]; ok {
+		return period, nil
+	}
+
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+
+	period, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid period %q", value)
+	}
+	if period <= 0 {
+		return 0, fmt.Errorf("period must be positive, got %q", value)
+	}
+	return period, nil
+}
+
+// ParseRate parses a rate like "100", "0.5", "300/m" or "1000/1h" into a whole number
+// of requests per period; see NormalizeRate
+func ParseRate(value string) (int, time.Duration, error) {
+	rv, err := parseRateValue(value)
+	if err != nil {
+		return 0, 0, err
+	}
+	return rv.resolve("")
+}
+
+// NormalizeRate converts a possibly fractional count per period into a whole count
+// by stretching the period: 0.5 per second becomes 1 per 2 seconds
+// A zero period means one second
+func NormalizeRate(count float64, period time.Duration) (int, time.Duration, error) {
+	if period <= 0 {
+		period = time.Second
+	}
+	if count <= 0 || math.IsNaN(count) || math.IsInf(count, 0) {
+		return 0, 0, fmt.Errorf("rate must be positive, got %g", count)
+	}
+
+	for scale := 1; scale <= maxRateScale; scale++ {
+		scaled := count * float64(scale)
+		whole := math.Round(scaled)
+		if whole >= 1 && math.Abs(scaled-whole) < 1e-9*math.Max(1, scaled) {
+			return int(whole), period * time.Duration(scale), nil
+		}
+	}
+	return 0, 0, fmt.Errorf("rate %g has too many decimal places", count)
+}
+
+// resolve combines the rate with a separately configured period, as in {rate: 1000, period: "1h"},
+// and normalizes it to a whole count per period
+func (rv RateValue) resolve(period string) (int, time.Duration, error) {
+	p := rv.Period
+	if period != "" {
+		if p != 0 {
+			return 0, 0, fmt.Errorf("rate already has a period, remove %q", period)
+		}
+		var err error
+		if p, err = parsePeriod(period); err != nil {
+			return 0, 0, err
+		}
+	}
+	return NormalizeRate(rv.Count, p)
+}
+
+// loadEnvRate loads a rate like "100" or "300/m" from an environment variable
+func loadEnvRate(envVar string, defaultRate int, defaultPeriod time.Duration) (int, time.Duration, error) {
+	value := os.Getenv(envVar)
+	if value == "" {
+		return defaultRate, defaultPeriod, nil
+	}
+
+	rate, period, err := ParseRate(value)
+	if err != nil {
+		return defaultRate, defaultPeriod, fmt.Errorf("invalid %s value %q: %w", envVar, value, err)
+	}
+	return rate, period, nil
+}
+
+// effectivePeriod returns the period a rate applies to, defaulting to one second
+func effectivePeriod(period time.Duration) time.Duration {
+	if period <= 0 {
+		return time.Second
+	}
+	return period
+}
+
+// ratePerSecond returns the average number of requests per second a rate allows
+func ratePerSecond(rate int, period time.Duration) float64 {
+	return float64(rate) / effectivePeriod(period).Seconds()
+}
+
+// formatRate formats a rate for error messages, e.g. "300/m"
+func formatRate(rate int, period time.Duration) string {
+	return Limit{Rate: rate, Period: period}.String()
+}
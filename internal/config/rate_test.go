@@ -0,0 +1,239 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		name           string
+		value          string
+		expectedRate   int
+		expectedPeriod time.Duration
+		hasError       bool
+	}{
+		{name: "plain integer per second", value: "100", expectedRate: 100, expectedPeriod: time.Second},
+		{name: "per minute", value: "300/m", expectedRate: 300, expectedPeriod: time.Minute},
+		{name: "per hour word", value: "1000/hour", expectedRate: 1000, expectedPeriod: time.Hour},
+		{name: "per day", value: "5000/d", expectedRate: 5000, expectedPeriod: 24 * time.Hour},
+		{name: "several days", value: "100/7d", expectedRate: 100, expectedPeriod: 7 * 24 * time.Hour},
+		{name: "Go duration", value: "10/90s", expectedRate: 10, expectedPeriod: 90 * time.Second},
+		{name: "fractional per second", value: "0.5", expectedRate: 1, expectedPeriod: 2 * time.Second},
+		{name: "fractional per minute", value: "2.5/m", expectedRate: 5, expectedPeriod: 2 * time.Minute},
+		{name: "spaces", value: " 20 / s ", expectedRate: 20, expectedPeriod: time.Second},
+		{name: "zero", value: "0/m", hasError: true},
+		{name: "negative", value: "-1", hasError: true},
+		{name: "not a number", value: "fast", hasError: true},
+		{name: "unknown unit", value: "10/fortnight", hasError: true},
+		{name: "too precise", value: "0.0001", hasError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, period, err := ParseRate(tt.value)
+			if (err != nil) != tt.hasError {
+				t.Fatalf("ParseRate(%q) error = %v, hasError %v", tt.value, err, tt.hasError)
+			}
+			if tt.hasError {
+				return
+			}
+			if rate != tt.expectedRate || period != tt.expectedPeriod {
+				t.Errorf("ParseRate(%q) = %d/%v, want %d/%v", tt.value, rate, period, tt.expectedRate, tt.expectedPeriod)
+			}
+		})
+	}
+}
+
+func TestGetRefillIntervalFor(t *testing.T) {
+	config := DefaultConfig()
+
+	tests := []struct {
+		rate     int
+		period   time.Duration
+		expected time.Duration
+	}{
+		{rate: 10, period: time.Second, expected: 100 * time.Millisecond},
+		{rate: 300, period: time.Minute, expected: 200 * time.Millisecond},
+		{rate: 1, period: 2 * time.Second, expected: 2 * time.Second},
+		{rate: 5, period: 0, expected: 200 * time.Millisecond},
+		{rate: 0, period: time.Hour, expected: time.Hour},
+	}
+
+	for _, tt := range tests {
+		if result := config.GetRefillIntervalFor(tt.rate, tt.period); result != tt.expected {
+			t.Errorf("GetRefillIntervalFor(%d, %v) = %v, want %v", tt.rate, tt.period, result, tt.expected)
+		}
+	}
+}
+
+func TestLoadFromFile_Periods(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		content  string
+		hasError bool
+	}{
+		{
+			name:     "JSON",
+			fileName: "config.json",
+			content: `{
+				"rate_limits": {
+					"global": {"rate": 1000, "period": "1h", "burst": 10},
+					"http": {"rate": "300/m", "burst": 5, "default_method_rate": 0.5, "methods": {
+						"GET /api/reports": "10/m",
+						"POST /api/users/batch": {"rate": 2, "period": "1d", "cost": 2}
+					}},
+					"grpc": {"rate": 30, "burst": 3, "default_method_rate": "5/s", "methods": {
+						"/ExportService/Export": {"rate": "1/h"}
+					}}
+				}
+			}`,
+		},
+		{
+			name:     "YAML",
+			fileName: "config.yaml",
+			content: `
+rate_limits:
+  global: {rate: 1000, period: 1h, burst: 10}
+  http:
+    rate: 300/m
+    burst: 5
+    default_method_rate: 0.5
+    methods:
+      GET /api/reports: 10/m
+      POST /api/users/batch: {rate: 2, period: 1d, cost: 2}
+  grpc:
+    rate: 30
+    burst: 3
+    default_method_rate: 5/s
+    methods:
+      /ExportService/Export: {rate: 1/h}
+`,
+		},
+		{
+			name:     "period given twice",
+			fileName: "config.yaml",
+			content: `
+rate_limits:
+  global: {rate: 300/m, period: 1h, burst: 10}
+  http: {rate: 50, burst: 5, default_method_rate: 10}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+`,
+			hasError: true,
+		},
+		{
+			name:     "invalid period",
+			fileName: "config.yaml",
+			content: `
+rate_limits:
+  global: {rate: 100, burst: 10}
+  http: {rate: 50, burst: 5, default_method_rate: 10, methods: {"GET /x": 10/week}}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+`,
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), tt.fileName)
+			if err := os.WriteFile(filePath, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("failed to write config file: %v", err)
+			}
+
+			config, err := LoadFromFile(filePath)
+			if (err != nil) != tt.hasError {
+				t.Fatalf("LoadFromFile() error = %v, hasError %v", err, tt.hasError)
+			}
+			if tt.hasError {
+				return
+			}
+
+			if config.GlobalRate != 1000 || config.GetGlobalPeriod() != time.Hour {
+				t.Errorf("global = %d/%v, want 1000/1h", config.GlobalRate, config.GlobalPeriod)
+			}
+			if config.HTTPRate != 300 || config.GetHTTPPeriod() != time.Minute {
+				t.Errorf("HTTP = %d/%v, want 300/1m", config.HTTPRate, config.HTTPPeriod)
+			}
+			if config.GRPCRate != 30 || config.GetGRPCPeriod() != time.Second {
+				t.Errorf("gRPC = %d/%v, want 30/1s", config.GRPCRate, config.GRPCPeriod)
+			}
+
+			httpMethods := []struct {
+				endpointKey string
+				rate        int
+				period      time.Duration
+			}{
+				{"GET:/api/other", 1, 2 * time.Second}, // 0.5/s is stored as 1 per 2 seconds
+				{"GET:/api/reports", 10, time.Minute},
+				{"POST:/api/users/batch", 2, 24 * time.Hour},
+			}
+			for _, m := range httpMethods {
+				rate, period := config.GetHTTPMethodRate(m.endpointKey), config.GetHTTPMethodPeriod(m.endpointKey)
+				if rate != m.rate || period != m.period {
+					t.Errorf("%s = %d/%v, want %d/%v", m.endpointKey, rate, period, m.rate, m.period)
+				}
+			}
+			if config.PerEndpointRate != 1 || config.GetPerEndpointPeriod() != 2*time.Second {
+				t.Errorf("per-endpoint = %d/%v, want 1/2s", config.PerEndpointRate, config.PerEndpointPeriod)
+			}
+			if cost := config.GetHTTPMethodCost("POST:/api/users/batch"); cost != 2 {
+				t.Errorf("POST /api/users/batch cost = %d, want 2", cost)
+			}
+
+			grpcMethods := []struct {
+				method string
+				rate   int
+				period time.Duration
+			}{
+				{"/ExportService/Export", 1, time.Hour},
+				{"/Other/Method", 5, time.Second},
+			}
+			for _, m := range grpcMethods {
+				rate, period := config.GetGRPCMethodRate(m.method), config.GetGRPCMethodPeriod(m.method)
+				if rate != m.rate || period != m.period {
+					t.Errorf("%s = %d/%v, want %d/%v", m.method, rate, period, m.rate, m.period)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFromEnv_Periods(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	_ = os.Setenv("RATE_LIMIT_GLOBAL", "6000/m")
+	_ = os.Setenv("RATE_LIMIT_PER_ENDPOINT", "0.5")
+	_ = os.Setenv("RATE_LIMIT_HTTP_RATE", "100/1h")
+
+	config, err := LoadFromEnv()
+	if err != nil {
+		t.Fatalf("LoadFromEnv() error = %v", err)
+	}
+
+	if config.GlobalRate != 6000 || config.GlobalPeriod != time.Minute {
+		t.Errorf("global = %d/%v, want 6000/1m", config.GlobalRate, config.GlobalPeriod)
+	}
+	if config.PerEndpointRate != 1 || config.PerEndpointPeriod != 2*time.Second {
+		t.Errorf("per-endpoint = %d/%v, want 1/2s", config.PerEndpointRate, config.PerEndpointPeriod)
+	}
+	if config.HTTPRate != 100 || config.HTTPPeriod != time.Hour {
+		t.Errorf("HTTP = %d/%v, want 100/1h", config.HTTPRate, config.HTTPPeriod)
+	}
+
+	// The per-endpoint rate is compared with the global rate per second, not by count
+	_ = os.Setenv("RATE_LIMIT_GLOBAL", "60/m")
+	_ = os.Setenv("RATE_LIMIT_PER_ENDPOINT", "2")
+	if _, err := LoadFromEnv(); err == nil {
+		t.Error("LoadFromEnv() should reject a per-endpoint rate of 2/s above a global rate of 60/m")
+	}
+
+	_ = os.Setenv("RATE_LIMIT_GLOBAL", "5/fortnight")
+	if _, err := LoadFromEnv(); err == nil {
+		t.Error("LoadFromEnv() should reject an unknown period")
+	}
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BucketStart controls how a new in-memory token bucket starts, so that the buckets created for
+// every user after a deploy or a restart do not all hand out a full burst at once
+type BucketStart struct {
+	// InitialFill is the fraction of the capacity a new bucket starts with; nil starts it full
+	InitialFill *float64
+	// WarmUp is how long the refill rate of a new bucket takes to ramp up linearly from zero to
+	// the configured rate; zero refills at the configured rate right away
+	WarmUp time.Duration
+}
+
+// IsDefault reports whether new buckets start full and refill at the configured rate right away
+func (s BucketStart) IsDefault() bool {
+	return s.InitialFill == nil && s.WarmUp == 0
+}
+
+// InitialTokens returns the number of tokens a new bucket of the given capacity starts with
+func (s BucketStart) InitialTokens(capacity int) int {
+	if s.InitialFill == nil {
+		return capacity
+	}
+	return int(*s.InitialFill * float64(capacity))
+}
+
+// parseInitialFill parses "full", "empty", a percentage such as "25%" or a fraction such as 0.25
+// An empty value starts buckets full
+func parseInitialFill(value string) (*float64, error) {
+	value = strings.TrimSpace(value)
+	var fill float64
+	switch {
+	case value == "" || value == "full":
+		return nil, nil
+	case value == "empty":
+		fill = 0
+	case strings.HasSuffix(value, "%"):
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid initial fill %q: %w", value, err)
+		}
+		fill = percent / 100
+	default:
+		var err error
+		if fill, err = strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("invalid initial fill %q: must be full, empty, a percentage or a fraction", value)
+		}
+	}
+	if fill < 0 || fill > 1 {
+		return nil, fmt.Errorf("initial fill %q must be between empty and full", value)
+	}
+	return &fill, nil
+}
+
+// convertBucketStarts validates and copies the per-tier initial fill and warm-up settings
+// They only apply to tiers kept in in-memory token buckets, so they are rejected for every other
+// algorithm, such as leaky buckets, sliding logs and the algorithms counted in Memcache
+func convertBucketStarts(config *Config, fileConfig *FileConfig) error {
+	rl := &fileConfig.RateLimits
+	tiers := []struct {
+		name        string
+		initialFill string
+		warmUp      string
+		algorithm   Algorithm
+		// strict holds the methods of the tier kept in sliding logs instead of token buckets
+		strict map[string]bool
+		dest   *BucketStart
+	}{
+		{"global", rl.Global.InitialFill, rl.Global.WarmUp, config.GlobalAlgorithm, nil, &config.GlobalStart},
+		{"HTTP", rl.HTTP.InitialFill, rl.HTTP.WarmUp, config.HTTPAlgorithm, nil, &config.HTTPStart},
+		{"HTTP method", rl.HTTP.MethodInitialFill, rl.HTTP.MethodWarmUp, config.HTTPMethodAlgorithm,
+			config.HTTPMethodStrict, &config.HTTPMethodStart},
+		{"gRPC", rl.GRPC.InitialFill, rl.GRPC.WarmUp, config.GRPCAlgorithm, nil, &config.GRPCStart},
+		{"gRPC method", rl.GRPC.MethodInitialFill, rl.GRPC.MethodWarmUp, config.GRPCMethodAlgorithm,
+			config.GRPCMethodStrict, &config.GRPCMethodStart},
+	}
+
+	for _, tier := range tiers {
+		var start BucketStart
+		var err error
+		if start.InitialFill, err = parseInitialFill(tier.initialFill); err != nil {
+			return fmt.Errorf("%s: %w", tier.name, err)
+		}
+		if tier.warmUp != "" {
+			if start.WarmUp, err = time.ParseDuration(tier.warmUp); err != nil {
+				return fmt.Errorf("%s: invalid warm up %q: %w", tier.name, tier.warmUp, err)
+			}
+			if start.WarmUp < 0 {
+				return fmt.Errorf("%s: warm up %q must not be negative", tier.name, tier.warmUp)
+			}
+		}
+
+		if !start.IsDefault() {
+			tokenBucket := tier.algorithm == AlgorithmTokenBucket ||
+				(tier.algorithm == "" && !config.IsDistributedEnabled())
+			if !tokenBucket {
+				return fmt.Errorf("%s: initial fill and warm up only apply to in-memory token buckets", tier.name)
+			}
+			for _, method := range sortedKeys(tier.strict) {
+				if tier.strict[method] {
+					return fmt.Errorf("%s: initial fill and warm up do not apply to strict method %q, which uses a "+
+						"sliding log", tier.name, method)
+				}
+			}
+		}
+		*tier.dest = start
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseInitialFill(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected float64
+		full     bool
+		hasError bool
+	}{
+		{value: "", full: true},
+		{value: "full", full: true},
+		{value: "empty", expected: 0},
+		{value: "25%", expected: 0.25},
+		{value: "0.5", expected: 0.5},
+		{value: "1", expected: 1},
+		{value: "150%", hasError: true},
+		{value: "-0.1", hasError: true},
+		{value: "half", hasError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			fill, err := parseInitialFill(tt.value)
+			if (err != nil) != tt.hasError {
+				t.Fatalf("parseInitialFill(%q) error = %v, hasError %v", tt.value, err, tt.hasError)
+			}
+			if tt.hasError {
+				return
+			}
+			if (fill == nil) != tt.full {
+				t.Fatalf("parseInitialFill(%q) = %v, want full %v", tt.value, fill, tt.full)
+			}
+			if fill != nil && *fill != tt.expected {
+				t.Errorf("parseInitialFill(%q) = %v, want %v", tt.value, *fill, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadFromFile_BucketStart(t *testing.T) {
+	tests := []struct {
+		name       string
+		global     string
+		http       string
+		memcache   string
+		globalFill int
+		httpWarmUp time.Duration
+		hasError   bool
+	}{
+		{
+			name:       "defaults start full",
+			globalFill: 10,
+		},
+		{
+			name:       "empty global buckets and warming HTTP method buckets",
+			global:     ", initial_fill: empty",
+			http:       ", method_initial_fill: 50%, method_warm_up: 30s",
+			globalFill: 0,
+			httpWarmUp: 30 * time.Second,
+		},
+		{
+			name:       "explicit token bucket with memcache",
+			global:     ", algorithm: token_bucket, initial_fill: 0.2",
+			memcache:   "memcache: {servers: [localhost:11211]}",
+			globalFill: 2,
+		},
+		{
+			name:     "invalid initial fill",
+			global:   ", initial_fill: 2",
+			hasError: true,
+		},
+		{
+			name:     "invalid warm up",
+			http:     ", warm_up: soon",
+			hasError: true,
+		},
+		{
+			name:     "leaky bucket",
+			global:   ", algorithm: leaky_bucket, warm_up: 1m",
+			hasError: true,
+		},
+		{
+			name:     "strict method kept in a sliding log",
+			http:     `, method_initial_fill: empty, methods: {"POST /api/payments": {rate: 5/m, strict: true}}`,
+			hasError: true,
+		},
+		{
+			name:     "tier counted in memcache",
+			global:   ", initial_fill: empty",
+			memcache: "memcache: {servers: [localhost:11211]}",
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := `
+rate_limits:
+  global: {rate: 100, burst: 10` + tt.global + `}
+  http: {rate: 50, burst: 5, default_method_rate: 10` + tt.http + `}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5}
+` + tt.memcache + "\n"
+			filePath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(filePath, []byte(content), 0600); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			config, err := LoadFromFile(filePath)
+			if (err != nil) != tt.hasError {
+				t.Fatalf("LoadFromFile() error = %v, hasError %v", err, tt.hasError)
+			}
+			if tt.hasError {
+				return
+			}
+
+			if tokens := config.GlobalStart.InitialTokens(config.GlobalBurstSize); tokens != tt.globalFill {
+				t.Errorf("GlobalStart.InitialTokens() = %d, want %d", tokens, tt.globalFill)
+			}
+			if config.HTTPMethodStart.WarmUp != tt.httpWarmUp {
+				t.Errorf("HTTPMethodStart.WarmUp = %v, want %v", config.HTTPMethodStart.WarmUp, tt.httpWarmUp)
+			}
+		})
+	}
+}
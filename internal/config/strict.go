@@ -0,0 +1,60 @@
+package config
+
+import "fmt"
+
+// MaxStrictRate is the largest rate a limit of a strict method may have
+// A sliding log keeps the time of every request within the period, so the rate bounds its memory
+const MaxStrictRate = 10000
+
+// validateStrictMethods checks that every limit of a strict method is small enough to be logged
+func validateStrictMethods(config *Config) error {
+	protocols := []struct {
+		name    string
+		methods map[string]bool
+		limits  func(method string) []Limit
+	}{
+		{"HTTP", config.HTTPMethodStrict, config.GetHTTPMethodLimits},
+		{"gRPC", config.GRPCMethodStrict, config.GetGRPCMethodLimits},
+	}
+
+	for _, protocol := range protocols {
+		for _, method := range sortedKeys(protocol.methods) {
+			for _, limit := range protocol.limits(method) {
+				if limit.Rate > MaxStrictRate {
+					return fmt.Errorf("%s method %q is strict, so its limit %s must allow at most %d requests",
+						protocol.name, method, limit, MaxStrictRate)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// IsHTTPMethodStrict reports whether an HTTP endpoint key's limits are enforced with a sliding log
+func (c Config) IsHTTPMethodStrict(endpointKey string) bool {
+	strict, _ := lookupHTTPMethod(c.HTTPMethodStrict, endpointKey)
+	return strict
+}
+
+// IsGRPCMethodStrict reports whether a gRPC method's limits are enforced with a sliding log
+func (c Config) IsGRPCMethodStrict(method string) bool {
+	return c.GRPCMethodStrict[method]
+}
+
+// GetHTTPMethodAlgorithm returns the in-memory algorithm of an HTTP endpoint's limits: the sliding
+// log for strict endpoints, else HTTPMethodAlgorithm
+func (c Config) GetHTTPMethodAlgorithm(endpointKey string) Algorithm {
+	if c.IsHTTPMethodStrict(endpointKey) {
+		return AlgorithmSlidingLog
+	}
+	return c.HTTPMethodAlgorithm
+}
+
+// GetGRPCMethodAlgorithm returns the in-memory algorithm of a gRPC method's limits: the sliding
+// log for strict methods, else GRPCMethodAlgorithm
+func (c Config) GetGRPCMethodAlgorithm(method string) Algorithm {
+	if c.IsGRPCMethodStrict(method) {
+		return AlgorithmSlidingLog
+	}
+	return c.GRPCMethodAlgorithm
+}
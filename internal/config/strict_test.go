@@ -0,0 +1,119 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadFromFile_StrictMethods(t *testing.T) {
+	tests := []struct {
+		name         string
+		httpMethods  string
+		grpcMethods  string
+		plans        string
+		expectedHTTP map[string]bool
+		expectedGRPC map[string]bool
+		hasError     bool
+	}{
+		{
+			name:         "strict HTTP and gRPC methods",
+			httpMethods:  `{"POST /api/payments": {rate: 5/m, strict: true}, "GET /api/users": 100}`,
+			grpcMethods:  `{"/payments.Service/Charge": {limits: [5/m, 100/d], strict: true}}`,
+			expectedHTTP: map[string]bool{"POST /api/payments": true},
+			expectedGRPC: map[string]bool{"/payments.Service/Charge": true},
+		},
+		{
+			name:        "no strict methods",
+			httpMethods: `{"GET /api/users": 100}`,
+			grpcMethods: "{}",
+		},
+		{
+			name:        "strict method above the maximum rate",
+			httpMethods: `{"POST /api/payments": {rate: 10001/s, strict: true}}`,
+			grpcMethods: "{}",
+			hasError:    true,
+		},
+		{
+			name:        "strict method with one limit above the maximum rate",
+			httpMethods: "{}",
+			grpcMethods: `{"/payments.Service/Charge": {limits: [5/m, 20000/h], strict: true}}`,
+			hasError:    true,
+		},
+		{
+			name:         "strict method stays strict under a plan",
+			httpMethods:  `{"POST /api/payments": {rate: 5/m, strict: true}}`,
+			grpcMethods:  "{}",
+			plans:        `{definitions: {pro: {http: {methods: {"POST /api/payments": 50/m}}}}}`,
+			expectedHTTP: map[string]bool{"POST /api/payments": true},
+		},
+		{
+			name:        "plan cannot mark a method strict",
+			httpMethods: `{"POST /api/payments": 5/m}`,
+			grpcMethods: "{}",
+			plans:       `{definitions: {pro: {http: {methods: {"POST /api/payments": {rate: 50/m, strict: true}}}}}}`,
+			hasError:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := `
+rate_limits:
+  global: {rate: 100, burst: 10}
+  http: {rate: 50, burst: 5, default_method_rate: 10, methods: ` + tt.httpMethods + `}
+  grpc: {rate: 30, burst: 3, default_method_rate: 5, methods: ` + tt.grpcMethods + `}
+`
+			if tt.plans != "" {
+				content += "  plans: " + tt.plans + "\n"
+			}
+			filePath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(filePath, []byte(content), 0600); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			config, err := LoadFromFile(filePath)
+			if (err != nil) != tt.hasError {
+				t.Fatalf("LoadFromFile() error = %v, hasError %v", err, tt.hasError)
+			}
+			if tt.hasError {
+				return
+			}
+
+			if !reflect.DeepEqual(config.HTTPMethodStrict, tt.expectedHTTP) {
+				t.Errorf("HTTPMethodStrict = %v, want %v", config.HTTPMethodStrict, tt.expectedHTTP)
+			}
+			if !reflect.DeepEqual(config.GRPCMethodStrict, tt.expectedGRPC) {
+				t.Errorf("GRPCMethodStrict = %v, want %v", config.GRPCMethodStrict, tt.expectedGRPC)
+			}
+			for name, plan := range config.Plans {
+				if !reflect.DeepEqual(plan.HTTPMethodStrict, tt.expectedHTTP) {
+					t.Errorf("plan %q HTTPMethodStrict = %v, want %v", name, plan.HTTPMethodStrict, tt.expectedHTTP)
+				}
+			}
+		})
+	}
+}
+
+func TestConfig_GetMethodAlgorithm(t *testing.T) {
+	config := Config{
+		HTTPMethodAlgorithm: AlgorithmLeakyBucket,
+		GRPCMethodAlgorithm: AlgorithmTokenBucket,
+		HTTPMethodStrict:    map[string]bool{"POST /api/payments": true},
+		GRPCMethodStrict:    map[string]bool{"/payments.Service/Charge": true},
+	}
+
+	if algorithm := config.GetHTTPMethodAlgorithm("POST:/api/payments"); algorithm != AlgorithmSlidingLog {
+		t.Errorf("GetHTTPMethodAlgorithm(strict) = %q, want %q", algorithm, AlgorithmSlidingLog)
+	}
+	if algorithm := config.GetHTTPMethodAlgorithm("GET:/api/users"); algorithm != AlgorithmLeakyBucket {
+		t.Errorf("GetHTTPMethodAlgorithm(other) = %q, want %q", algorithm, AlgorithmLeakyBucket)
+	}
+	if algorithm := config.GetGRPCMethodAlgorithm("/payments.Service/Charge"); algorithm != AlgorithmSlidingLog {
+		t.Errorf("GetGRPCMethodAlgorithm(strict) = %q, want %q", algorithm, AlgorithmSlidingLog)
+	}
+	if algorithm := config.GetGRPCMethodAlgorithm("/users.Service/Get"); algorithm != AlgorithmTokenBucket {
+		t.Errorf("GetGRPCMethodAlgorithm(other) = %q, want %q", algorithm, AlgorithmTokenBucket)
+	}
+}
@@ -2,7 +2,11 @@ package grpc
 
 import (
 	"context"
+	"errors"
+	"math"
 	"strings"
+	"sync"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -11,6 +15,7 @@ import (
 
 	"rate_limiter_service/internal/config"
 	"rate_limiter_service/pkg/middleware"
+	"rate_limiter_service/pkg/ratelimit"
 )
 
 // Interceptor provides gRPC rate limiting functionality
@@ -19,65 +24,265 @@ type Interceptor struct {
 	globalLimiter      middleware.GlobalLimiterInterface
 	grpcLimiter        middleware.GRPCLimiterInterface
 	perMethodLimiter   GRPCMethodLimiterInterface
+	concurrencyLimiter *middleware.ConcurrencyLimiter
+	adaptiveLimiter    *middleware.AdaptiveLimiter
+	quotaLimiter       middleware.QuotaLimiterInterface
+	creditLimiter      middleware.CreditLimiterInterface
+	keyExtractor       middleware.KeyExtractor
+	penaltyBox         middleware.PenaltyBoxInterface
+	aggregateLimiter   middleware.AggregateLimiterInterface
+	levelLimiter       middleware.LevelLimiterInterface
+	planResolver       middleware.PlanResolver
+	// plans holds the rate limiters of each plan; users on no plan use the limiters above
+	plans map[string]rateLimiters
+}
+
+// rateLimiters are the per-user rate limiters of the interceptor, built with one plan's numbers
+type rateLimiters struct {
+	config           config.Config
+	globalLimiter    middleware.GlobalLimiterInterface
+	grpcLimiter      middleware.GRPCLimiterInterface
+	perMethodLimiter GRPCMethodLimiterInterface
+}
+
+// newRateLimiters creates the interceptor's rate limiters for the given configuration
+func newRateLimiters(cfg config.Config) rateLimiters {
+	factory := middleware.NewLimiterFactory(cfg)
+	return rateLimiters{
+		config:           cfg,
+		globalLimiter:    factory.CreateGlobalLimiter(),
+		grpcLimiter:      factory.CreateGRPCLimiter(),
+		perMethodLimiter: newGRPCMethodLimiter(factory, cfg),
+	}
+}
+
+// InterceptorOption configures optional behavior of an Interceptor
+type InterceptorOption func(*Interceptor)
+
+// WithConcurrencyLimiter makes the interceptor count in-flight calls in the given limiter,
+// for example one shared with the HTTP middleware so per-user ceilings span both protocols
+func WithConcurrencyLimiter(cl *middleware.ConcurrencyLimiter) InterceptorOption {
+	return func(i *Interceptor) {
+		i.concurrencyLimiter = cl
+	}
+}
+
+// WithAdaptiveLimiter makes the interceptor shed load with the given adaptive limiter,
+// for example one shared with the HTTP middleware so the in-flight limit covers the whole process
+func WithAdaptiveLimiter(al *middleware.AdaptiveLimiter) InterceptorOption {
+	return func(i *Interceptor) {
+		i.adaptiveLimiter = al
+	}
+}
+
+// WithQuotaLimiter makes the interceptor charge calendar quotas to the given limiter,
+// for example one shared with the HTTP middleware so quotas count both protocols
+func WithQuotaLimiter(ql middleware.QuotaLimiterInterface) InterceptorOption {
+	return func(i *Interceptor) {
+		i.quotaLimiter = ql
+	}
+}
+
+// WithKeyExtractor makes the interceptor identify users with the given extractor instead of the
+// extractors in the config, for example the one the HTTP middleware uses
+func WithKeyExtractor(ke middleware.KeyExtractor) InterceptorOption {
+	return func(i *Interceptor) {
+		i.keyExtractor = ke
+	}
+}
+
+// WithCreditLimiter makes the interceptor charge prepaid credits to the given limiter,
+// for example one shared with the HTTP middleware so both protocols draw from the same balances
+func WithCreditLimiter(cl middleware.CreditLimiterInterface) InterceptorOption {
+	return func(i *Interceptor) {
+		i.creditLimiter = cl
+	}
+}
+
+// WithPenaltyBox makes the interceptor ban users through the given penalty box,
+// for example one shared with the HTTP middleware so rejections on both protocols count
+func WithPenaltyBox(pb middleware.PenaltyBoxInterface) InterceptorOption {
+	return func(i *Interceptor) {
+		i.penaltyBox = pb
+	}
+}
+
+// WithAggregateLimiter makes the interceptor charge limits shared by all users to the given limiter,
+// for example one shared with the HTTP middleware so service-wide limits count both protocols
+func WithAggregateLimiter(al middleware.AggregateLimiterInterface) InterceptorOption {
+	return func(i *Interceptor) {
+		i.aggregateLimiter = al
+	}
+}
+
+// WithLevelLimiter makes the interceptor charge the identity hierarchy levels to the given limiter,
+// for example one shared with the HTTP middleware so organization limits count both protocols
+func WithLevelLimiter(ll middleware.LevelLimiterInterface) InterceptorOption {
+	return func(i *Interceptor) {
+		i.levelLimiter = ll
+	}
+}
+
+// reset clears the state of every limiter for testing
+func (rl rateLimiters) reset() {
+	rl.globalLimiter.Reset()
+	rl.grpcLimiter.Reset()
+	rl.perMethodLimiter.Reset()
+}
+
+// WithPlanResolver makes the interceptor look up each user's plan with the given resolver
+// instead of the plans.users map of the configuration
+func WithPlanResolver(pr middleware.PlanResolver) InterceptorOption {
+	return func(i *Interceptor) {
+		i.planResolver = pr
+	}
 }
 
 // GRPCMethodLimiterInterface defines the interface for gRPC per-method limiters
-type GRPCMethodLimiterInterface interface {
-	Allow(userID, method string) bool
-	Reset()
+type GRPCMethodLimiterInterface = middleware.GRPCMethodLimiterInterface
+
+// newGRPCMethodLimiter creates the gRPC per-method limiter of the tier algorithm
+// Strict methods always use an in-memory sliding log, even when the other methods are distributed
+func newGRPCMethodLimiter(factory *middleware.LimiterFactory, cfg config.Config) GRPCMethodLimiterInterface {
+	limiter := factory.CreateGRPCMethodLimiter()
+	if limiter == nil {
+		return NewInMemoryGRPCMethodLimiter(cfg)
+	}
+	if len(cfg.GRPCMethodStrict) == 0 {
+		return limiter
+	}
+	return &strictMethodLimiter{
+		config: cfg,
+		strict: NewInMemoryGRPCMethodLimiter(cfg),
+		other:  limiter,
+	}
+}
+
+// strictMethodLimiter keeps the limits of strict methods in memory while the other methods use a
+// distributed limiter
+type strictMethodLimiter struct {
+	config config.Config
+
+	// strict handles the strict methods with in-memory sliding logs
+	strict GRPCMethodLimiterInterface
+
+	// other handles every other method
+	other GRPCMethodLimiterInterface
+}
+
+// limiterFor returns the limiter responsible for the method
+func (sml *strictMethodLimiter) limiterFor(method string) GRPCMethodLimiterInterface {
+	if sml.config.IsGRPCMethodStrict(method) {
+		return sml.strict
+	}
+	return sml.other
+}
+
+// Allow checks if the gRPC request for the given user and method is allowed
+func (sml *strictMethodLimiter) Allow(userID, method string) bool {
+	return sml.AllowN(userID, method, 1)
+}
+
+// AllowN checks if a gRPC request costing n tokens for the given user and method is allowed
+func (sml *strictMethodLimiter) AllowN(userID, method string, n int) bool {
+	return ratelimit.Admitted(sml.Decide(userID, method, n))
+}
+
+// Decide checks a gRPC request costing n tokens against every limit of the method
+func (sml *strictMethodLimiter) Decide(userID, method string, n int) ratelimit.Decision {
+	return sml.limiterFor(method).Decide(userID, method, n)
+}
+
+// Reset clears all rate limiting state for testing purposes
+func (sml *strictMethodLimiter) Reset() {
+	sml.strict.Reset()
+	sml.other.Reset()
 }
 
 // InMemoryGRPCMethodLimiter enforces per-method rate limits for gRPC using in-memory storage
 type InMemoryGRPCMethodLimiter struct {
 	config config.Config
-	// buckets stores token buckets keyed by "userID:method"
-	buckets map[string]*middleware.TokenBucket
+	// mu protects buckets; it is not held while a leaky bucket delays a request
+	mu sync.Mutex
+	// buckets stores token or leaky buckets keyed by "userID:method"
+	buckets map[string]middleware.Bucket
 }
 
 // NewInMemoryGRPCMethodLimiter creates a new in-memory gRPC per-method rate limiter
 func NewInMemoryGRPCMethodLimiter(cfg config.Config) *InMemoryGRPCMethodLimiter {
 	return &InMemoryGRPCMethodLimiter{
-		config: cfg,
-		buckets: make(map[string]*middleware.TokenBucket),
+		config:  cfg,
+		buckets: make(map[string]middleware.Bucket),
 	}
 }
 
 // Allow checks if the gRPC request for the given user and method is allowed
 func (gml *InMemoryGRPCMethodLimiter) Allow(userID, method string) bool {
+	return gml.AllowN(userID, method, 1)
+}
+
+// AllowN checks if a gRPC request costing n tokens for the given user and method is allowed
+func (gml *InMemoryGRPCMethodLimiter) AllowN(userID, method string, n int) bool {
+	return ratelimit.Admitted(gml.Decide(userID, method, n))
+}
+
+// Decide checks a gRPC request costing n tokens against every limit of the method
+// When the request is rejected, the decision names the limit that tripped
+func (gml *InMemoryGRPCMethodLimiter) Decide(userID, method string, n int) ratelimit.Decision {
 	key := userID + ":" + method
+
+	gml.mu.Lock()
 	bucket, exists := gml.buckets[key]
 	if !exists {
-		// Determine rate for this method
-		rate := gml.getRateForMethod(method)
-		burstSize := gml.config.GRPCBurstSize
-		bucket = middleware.NewTokenBucket(burstSize, rate)
+		algorithm := gml.config.GetGRPCMethodAlgorithm(method)
+		limits := gml.config.GetGRPCMethodLimits(method)
+		bucket = middleware.NewBucketForTier(algorithm, limits, gml.config.GRPCMethodStart)
 		gml.buckets[key] = bucket
 	}
-	return bucket.Allow()
-}
+	gml.mu.Unlock()
 
-// getRateForMethod returns the rate limit for a specific gRPC method
-func (gml *InMemoryGRPCMethodLimiter) getRateForMethod(method string) int {
-	if rate, ok := gml.config.GRPCMethods[method]; ok {
-		return rate
-	}
-	return gml.config.GRPCDefaultMethodRate
+	return middleware.DecideBucket(bucket, n, func() []config.Limit {
+		return gml.config.GetGRPCMethodLimits(method)
+	})
 }
 
 // Reset clears all rate limiting state for testing
 func (gml *InMemoryGRPCMethodLimiter) Reset() {
-	gml.buckets = make(map[string]*middleware.TokenBucket)
+	gml.mu.Lock()
+	defer gml.mu.Unlock()
+	gml.buckets = make(map[string]middleware.Bucket)
 }
 
 // NewInterceptor creates a new gRPC rate limiting interceptor
-func NewInterceptor(cfg config.Config) *Interceptor {
+func NewInterceptor(cfg config.Config, opts ...InterceptorOption) *Interceptor {
 	factory := middleware.NewLimiterFactory(cfg)
-	return &Interceptor{
-		config:           cfg,
-		globalLimiter:    factory.CreateGlobalLimiter(),
-		grpcLimiter:      factory.CreateGRPCLimiter(),
-		perMethodLimiter: NewInMemoryGRPCMethodLimiter(cfg),
+	i := &Interceptor{
+		config:             cfg,
+		globalLimiter:      factory.CreateGlobalLimiter(),
+		grpcLimiter:        factory.CreateGRPCLimiter(),
+		perMethodLimiter:   newGRPCMethodLimiter(factory, cfg),
+		concurrencyLimiter: middleware.NewConcurrencyLimiter(cfg),
+		quotaLimiter:       factory.CreateQuotaLimiter(),
+		creditLimiter:      factory.CreateCreditLimiter(),
+		keyExtractor:       middleware.NewKeyExtractor(cfg),
+		penaltyBox:         factory.CreatePenaltyBox(),
+		aggregateLimiter:   factory.CreateAggregateLimiter(),
+		levelLimiter:       factory.CreateLevelLimiter(),
+		planResolver:       middleware.StaticPlanResolver(cfg.PlanUsers),
+	}
+	for name, plan := range cfg.Plans {
+		if i.plans == nil {
+			i.plans = make(map[string]rateLimiters, len(cfg.Plans))
+		}
+		i.plans[name] = newRateLimiters(plan)
+	}
+	if cfg.AdaptiveConcurrency {
+		i.adaptiveLimiter = middleware.NewAdaptiveLimiter(cfg)
 	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
 }
 
 // UnaryInterceptor returns a gRPC unary interceptor for rate limiting
@@ -88,46 +293,292 @@ func (i *Interceptor) UnaryInterceptor() grpc.UnaryServerInterceptor {
 		info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler,
 	) (interface{}, error) {
-		userID := i.extractUserID(ctx)
+		identity, err := i.extractIdentity(ctx)
+		if err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "invalid credentials: %v", err)
+		}
+		userID := identity.Key
+
+		// Reject banned users before any limiter is evaluated, optionally holding them in a tarpit
+		if i.penaltyBox != nil {
+			if bannedUntil, banned := i.penaltyBox.Banned(userID); banned {
+				middleware.Tarpit(ctx, i.config.PenaltyTarpit, bannedUntil)
+				return nil, status.Errorf(codes.ResourceExhausted, "temporarily banned until %s",
+					bannedUntil.UTC().Format(time.RFC3339))
+			}
+		}
+
+		// Shed load before any per-user limiter is charged
+		slot, ok := i.adaptiveLimiter.Acquire()
+		if !ok {
+			return nil, status.Error(codes.Unavailable, "server overloaded")
+		}
+		// Calls that are rejected below or panic give the slot back without a latency sample
+		defer slot.Ignore()
+
+		// Hold a concurrency slot until the handler returns, even if it panics
+		release, full := i.concurrencyLimiter.Acquire(i.concurrencyLimiter.GRPCCeilings(userID, info.FullMethod)...)
+		if full != nil {
+			i.penalize(userID)
+			return nil, status.Error(codes.ResourceExhausted, "concurrency limit exceeded: "+full.Scope)
+		}
+		defer release()
+
+		// Rates, costs and per-method limits come from the user's plan
+		limiters := i.limitersFor(identity)
+
+		// Bulk methods may consume several tokens per call
+		cost := limiters.config.GetGRPCMethodCost(info.FullMethod)
+
+		// Lower priority classes leave a share of the global and gRPC buckets to the classes above them
+		reserved := limiters.config.GetPriorityReserve(i.priority(ctx, info.FullMethod))
+
+		// Check the levels below the user, such as API keys, before the user's own limits
+		identities := i.extractIdentities(ctx, userID)
+		if d, level := i.decideLevels(identities, false, cost); !d.Allowed {
+			i.penalize(userID)
+			return nil, levelLimitError(level, d)
+		}
+
+		// Traffic shaping tiers schedule the call's departure instead of delaying it; it waits once
+		// every rate limit has admitted it, and gives the departures back if a check rejects it
+		var departures middleware.Departures
+		defer departures.Cancel()
 
 		// Check global limit first
-		if !i.globalLimiter.Allow(userID) {
-			return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded: global")
+		d := departures.Add("global", limiters.globalLimiter.DecideWithReserve(userID, cost, reserved))
+		if !d.Allowed {
+			i.penalize(userID)
+			return nil, rateLimitError("global", d, len(limiters.config.GlobalExtraLimits) > 0)
 		}
 
 		// Check gRPC-only limit
-		if !i.grpcLimiter.Allow(userID) {
-			return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded: grpc")
+		d = departures.Add("grpc", limiters.grpcLimiter.DecideWithReserve(userID, cost, reserved))
+		if !d.Allowed {
+			i.penalize(userID)
+			return nil, rateLimitError("grpc", d, len(limiters.config.GRPCExtraLimits) > 0)
 		}
 
 		// Check per-method limit
-		if !i.perMethodLimiter.Allow(userID, info.FullMethod) {
-			return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded: per-method")
+		d = departures.Add("per-method", limiters.perMethodLimiter.Decide(userID, info.FullMethod, cost))
+		if !d.Allowed {
+			i.penalize(userID)
+			multipleLimits := len(limiters.config.GRPCMethodExtraLimits[info.FullMethod]) > 0
+			return nil, rateLimitError("per-method", d, multipleLimits)
+		}
+
+		// Check the levels above the user, such as organizations, once the user's own limits admit the
+		// call; the user is not penalized for the traffic of the rest of the organization
+		if d, level := i.decideLevels(identities, true, cost); !d.Allowed {
+			return nil, levelLimitError(level, d)
+		}
+
+		// Check the limits shared by all users once the user's own limits admit the call, so one
+		// user's rejected calls do not use them up; the user is not penalized for others' traffic
+		if i.aggregateLimiter != nil {
+			if d := i.aggregateLimiter.DecideGRPC(info.FullMethod, cost); !d.Allowed {
+				return nil, rateLimitError("aggregate", d, true)
+			}
+		}
+
+		// Wait for the departures once every rate limit has admitted the call, and before quotas and
+		// credits are charged; a call that is cancelled or whose deadline comes first leaves the queue
+		// instead of holding its place, and has not used up its quota or paid for a response
+		// A queued call gives its adaptive slot back while it waits, so the queue is not counted as load
+		// on the backend, and is shed again if the process is at its limit once it leaves
+		queued := departures.Pending()
+		if queued {
+			slot.Ignore()
+		}
+		if tier, d, err := departures.Wait(ctx); err != nil {
+			return nil, departureError(tier, d, err)
+		}
+		if queued {
+			if slot, ok = i.adaptiveLimiter.Acquire(); !ok {
+				return nil, status.Error(codes.Unavailable, "server overloaded")
+			}
+			defer slot.Ignore()
 		}
 
-		// Request allowed, call handler
-		return handler(ctx, req)
+		// Check calendar quotas last, so calls rejected by a rate limit do not use them up
+		if i.quotaLimiter != nil {
+			if d := i.quotaLimiter.Decide(userID, cost); !d.Allowed {
+				i.penalize(userID)
+				return nil, status.Errorf(codes.ResourceExhausted, "quota exceeded: %s (resets %s)",
+					d.Quota, d.ResetAt.UTC().Format(time.RFC3339))
+			}
+		}
+
+		// Charge prepaid credits after every limit, so rejected calls cost nothing; a call the balance
+		// cannot cover gives back the quota charged above
+		if i.creditLimiter != nil && limiters.config.ChargeCredits {
+			if d := i.creditLimiter.Charge(userID, cost); !d.Allowed {
+				if i.quotaLimiter != nil {
+					i.quotaLimiter.Refund(userID, cost)
+				}
+				return nil, status.Errorf(codes.ResourceExhausted, "insufficient credits: balance %d, cost %d",
+					d.Balance, d.Cost)
+			}
+		}
+
+		// Request allowed, call handler; its latency alone is the adaptive limiter's RTT sample
+		slot.Start()
+		resp, err := handler(ctx, req)
+		slot.Done()
+		return resp, err
+	}
+}
+
+// limitersFor returns the rate limiters of the user's plan, or the top-level ones if the user is
+// on no defined plan and no default plan is configured
+// A plan carried by the identity, such as a token claim, takes precedence over the plan resolver
+func (i *Interceptor) limitersFor(identity middleware.Identity) rateLimiters {
+	plan := identity.Plan
+	if plan == "" {
+		plan = i.planResolver.ResolvePlan(identity.Key)
+	}
+	if limiters, ok := i.plans[i.config.ResolvePlan(plan)]; ok {
+		return limiters
+	}
+	return rateLimiters{
+		config:           i.config,
+		globalLimiter:    i.globalLimiter,
+		grpcLimiter:      i.grpcLimiter,
+		perMethodLimiter: i.perMethodLimiter,
+	}
+}
+
+// penalize counts a rejection against the user in the penalty box, if one is configured
+func (i *Interceptor) penalize(userID string) {
+	if i.penaltyBox != nil {
+		i.penaltyBox.Penalize(userID)
 	}
 }
 
-// extractUserID extracts the user ID from gRPC metadata
-func (i *Interceptor) extractUserID(ctx context.Context) string {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		return "anonymous"
+// rateLimitError returns the ResourceExhausted error for a rejected call
+// Rules with several limits name the window that tripped, e.g. "rate limit exceeded: global (500/m)"
+func rateLimitError(limitType string, d ratelimit.Decision, multipleLimits bool) error {
+	if multipleLimits {
+		return status.Errorf(codes.ResourceExhausted, "rate limit exceeded: %s (%s)", limitType, d.Limit)
+	}
+	return status.Error(codes.ResourceExhausted, "rate limit exceeded: "+limitType)
+}
+
+// departureError returns the ResourceExhausted error for a call that left a traffic shaping queue
+// before its departure, with the seconds until it would have departed as a retry hint, e.g.
+// "rate limit exceeded: global (context deadline exceeded, retry after 2s)"
+func departureError(tier string, d ratelimit.Decision, err error) error {
+	retryAfter := max(int(math.Ceil(time.Until(d.RetryAt).Seconds())), 1)
+	return status.Errorf(codes.ResourceExhausted, "rate limit exceeded: %s (%v, retry after %ds)", tier, err,
+		retryAfter)
+}
+
+// levelLimitError returns the ResourceExhausted error for a call rejected by a level of the identity
+// hierarchy, e.g. "rate limit exceeded: level org (1000/s)"
+func levelLimitError(level string, d ratelimit.Decision) error {
+	return status.Errorf(codes.ResourceExhausted, "rate limit exceeded: level %s (%s)", level, d.Limit)
+}
+
+// extractIdentity extracts the user's identity with the key extractor, falling back to the
+// anonymous key
+func (i *Interceptor) extractIdentity(ctx context.Context) (middleware.Identity, error) {
+	identity, err := i.keyExtractor.ExtractGRPC(ctx)
+	if err != nil {
+		return middleware.Identity{}, err
+	}
+	if identity.Key == "" {
+		identity.Key = i.config.GetAnonymousKey()
 	}
+	return identity, nil
+}
 
-	values := md.Get(i.config.GrpcMetadataKey)
-	if len(values) == 0 || strings.TrimSpace(values[0]) == "" {
-		return "anonymous"
+// extractIdentities returns the call's identity at every level of the identity hierarchy, read
+// from the levels' metadata keys, or nil if no hierarchy is configured
+// The user level holds userID; levels whose metadata key is missing are left empty
+func (i *Interceptor) extractIdentities(ctx context.Context, userID string) []string {
+	if !i.config.HasIdentityHierarchy() {
+		return nil
 	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	identities := make([]string, len(i.config.IdentityLevels))
+	for index, level := range i.config.IdentityLevels {
+		switch {
+		case level.Name == config.UserLevel:
+			identities[index] = userID
+		case level.MetadataKey != "":
+			if values := md.Get(level.MetadataKey); len(values) > 0 {
+				identities[index] = strings.TrimSpace(values[0])
+			}
+		}
+	}
+	return identities
+}
 
-	return strings.TrimSpace(values[0])
+// decideLevels charges a call to the hierarchy levels above or below the user, see middleware.DecideLevels
+func (i *Interceptor) decideLevels(identities []string, outer bool, cost int) (ratelimit.Decision, string) {
+	if i.levelLimiter == nil {
+		return ratelimit.Allowed(), ""
+	}
+	return middleware.DecideLevels(i.levelLimiter, i.config, identities, outer, cost)
+}
+
+// priority returns the priority class of a call: the class configured for the method,
+// else the one named in the priority metadata key, else the default class
+func (i *Interceptor) priority(ctx context.Context, method string) string {
+	requested := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok && i.config.PriorityMetadataKey != "" {
+		if values := md.Get(i.config.PriorityMetadataKey); len(values) > 0 {
+			requested = strings.TrimSpace(values[0])
+		}
+	}
+	return i.config.ResolvePriority(i.config.GetGRPCMethodPriority(method), requested)
+}
+
+// AdaptiveLimiter returns the limiter shedding load for this interceptor, or nil if adaptive
+// concurrency is disabled; its Stats expose the current limit and measured RTT
+func (i *Interceptor) AdaptiveLimiter() *middleware.AdaptiveLimiter {
+	return i.adaptiveLimiter
+}
+
+// CreditLimiter returns the limiter holding prepaid credit balances, for example to top them up,
+// or nil if no user is charged credits
+func (i *Interceptor) CreditLimiter() middleware.CreditLimiterInterface {
+	return i.creditLimiter
 }
 
 // Reset clears all rate limiting state for testing
+// Prepaid credit balances are kept, as they are paid for rather than rate limiting state
 func (i *Interceptor) Reset() {
 	i.globalLimiter.Reset()
 	i.grpcLimiter.Reset()
 	i.perMethodLimiter.Reset()
-}
\ No newline at end of file
+	for _, limiters := range i.plans {
+		limiters.reset()
+	}
+	i.concurrencyLimiter.Reset()
+	i.adaptiveLimiter.Reset()
+	if i.quotaLimiter != nil {
+		i.quotaLimiter.Reset()
+	}
+	if i.penaltyBox != nil {
+		i.penaltyBox.Reset()
+	}
+	if i.aggregateLimiter != nil {
+		i.aggregateLimiter.Reset()
+	}
+	if i.levelLimiter != nil {
+		i.levelLimiter.Reset()
+	}
+}
+
+// Close persists quota counters and credit balances and stops background work
+func (i *Interceptor) Close() error {
+	var errs []error
+	if i.quotaLimiter != nil {
+		errs = append(errs, i.quotaLimiter.Close())
+	}
+	if i.creditLimiter != nil {
+		errs = append(errs, i.creditLimiter.Close())
+	}
+	return errors.Join(errs...)
+}
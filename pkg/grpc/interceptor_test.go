@@ -2,7 +2,11 @@ package grpc
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -10,6 +14,7 @@ import (
 	"google.golang.org/grpc/status"
 
 	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/middleware"
 )
 
 const testSuccessResponse = "success"
@@ -61,11 +66,11 @@ func testRateLimitHelper(
 
 func TestNewInterceptor(t *testing.T) {
 	cfg := config.Config{
-		GrpcMetadataKey:     "user-id",
-		GlobalRate:          100,
-		GlobalBurstSize:     10,
-		GRPCRate:            50,
-		GRPCBurstSize:       5,
+		GrpcMetadataKey:       "user-id",
+		GlobalRate:            100,
+		GlobalBurstSize:       10,
+		GRPCRate:              50,
+		GRPCBurstSize:         5,
 		GRPCDefaultMethodRate: 10,
 	}
 
@@ -129,14 +134,150 @@ func TestInterceptor_ExtractUserID(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ctx := metadata.NewIncomingContext(context.Background(), tt.metadata)
-			result := interceptor.extractUserID(ctx)
-			if result != tt.expected {
-				t.Errorf("extractUserID() = %q, want %q", result, tt.expected)
+			identity, err := interceptor.extractIdentity(ctx)
+			if err != nil || identity.Key != tt.expected {
+				t.Errorf("extractIdentity() = %+v, %v, want key %q", identity, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestInterceptor_ExtractIdentity_KeyExtractor(t *testing.T) {
+	cfg := config.Config{
+		GrpcMetadataKey: "user-id",
+		KeyExtractors: []config.KeyExtractor{
+			{Type: config.KeyExtractorContext},
+			{Type: config.KeyExtractorHeaders, MetadataKeys: []string{"user-id", "client-id"}},
+		},
+	}
+
+	interceptor := NewInterceptor(cfg)
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		expected string
+	}{
+		{
+			name:     "fallback metadata key",
+			ctx:      metadata.NewIncomingContext(context.Background(), metadata.Pairs("client-id", "client1")),
+			expected: "client1",
+		},
+		{
+			name: "context key",
+			ctx: middleware.ContextWithKey(
+				metadata.NewIncomingContext(context.Background(), metadata.Pairs("user-id", "user123")), "auth-user"),
+			expected: "auth-user",
+		},
+		{
+			name:     "no key",
+			ctx:      context.Background(),
+			expected: "anonymous",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if identity, _ := interceptor.extractIdentity(tt.ctx); identity.Key != tt.expected {
+				t.Errorf("extractIdentity() = %q, want %q", identity.Key, tt.expected)
 			}
 		})
 	}
 }
 
+// tokenExtractor accepts the "valid" token of the authorization metadata key, asserting its plan
+type tokenExtractor struct {
+	middleware.HeaderExtractor
+}
+
+func (tokenExtractor) ExtractGRPC(ctx context.Context) (middleware.Identity, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if token := md.Get("authorization"); len(token) == 0 || token[0] != "valid" {
+		return middleware.Identity{}, errors.New("invalid token")
+	}
+	return middleware.Identity{Key: "user123", Plan: "pro"}, nil
+}
+
+func TestInterceptor_UnaryInterceptor_Unauthenticated(t *testing.T) {
+	base := config.Config{
+		GlobalRate:            100,
+		GlobalBurstSize:       100,
+		GRPCRate:              100,
+		GRPCBurstSize:         100,
+		GRPCDefaultMethodRate: 100,
+	}
+	free := base
+	free.GRPCRate = 1
+	free.GRPCPeriod = time.Minute
+	free.GRPCBurstSize = 1
+	cfg := base
+	cfg.Plans = map[string]config.Config{"free": free, "pro": base}
+	cfg.DefaultPlan = "free"
+
+	interceptor := NewInterceptor(cfg, WithKeyExtractor(tokenExtractor{}))
+	info := &grpc.UnaryServerInfo{FullMethod: "/UserService/GetUser"}
+	success := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return testSuccessResponse, nil
+	}
+
+	// The plan asserted by the identity wins over the default plan
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "valid"))
+	for j := 0; j < 3; j++ {
+		if _, err := interceptor.UnaryInterceptor()(ctx, "request", info, success); err != nil {
+			t.Fatalf("Call %d on the pro plan should be allowed, got error: %v", j+1, err)
+		}
+	}
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "forged"))
+	_, err := interceptor.UnaryInterceptor()(ctx, "request", info, success)
+	if st, _ := status.FromError(err); st.Code() != codes.Unauthenticated {
+		t.Errorf("Call with an invalid token should be unauthenticated, got %v", err)
+	}
+}
+
+func TestNewInterceptor_GRPCMethodAlgorithm(t *testing.T) {
+	cfg := config.Config{
+		GRPCBurstSize:         5,
+		GRPCDefaultMethodRate: 10,
+		MemcacheServers:       []string{"localhost:11211"},
+		MemcacheTimeout:       100 * time.Millisecond,
+		DistributedAlgorithm:  config.AlgorithmFixedWindow,
+	}
+
+	// Per-method limits share Memcache like the other tiers
+	if got := fmt.Sprintf("%T", NewInterceptor(cfg).perMethodLimiter); got != "*distributed.GRPCMethodLimiter" {
+		t.Errorf("perMethodLimiter = %s, want *distributed.GRPCMethodLimiter", got)
+	}
+
+	// Strict methods stay in memory while the others share Memcache
+	cfg.GRPCMethods = map[string]int{"/payments.Service/Charge": 1}
+	cfg.GRPCMethodStrict = map[string]bool{"/payments.Service/Charge": true}
+	limiter, ok := NewInterceptor(cfg).perMethodLimiter.(*strictMethodLimiter)
+	if !ok {
+		t.Fatal("perMethodLimiter should route strict methods to an in-memory limiter")
+	}
+	strict := fmt.Sprintf("%T", limiter.limiterFor("/payments.Service/Charge"))
+	if strict != "*grpc.InMemoryGRPCMethodLimiter" {
+		t.Errorf("strict method limiter = %s, want *grpc.InMemoryGRPCMethodLimiter", strict)
+	}
+	if got := fmt.Sprintf("%T", limiter.limiterFor("/users.Service/Get")); got != "*distributed.GRPCMethodLimiter" {
+		t.Errorf("other method limiter = %s, want *distributed.GRPCMethodLimiter", got)
+	}
+
+	if !limiter.Allow("user123", "/payments.Service/Charge") {
+		t.Fatal("First strict call should be allowed")
+	}
+	if limiter.Allow("user123", "/payments.Service/Charge") {
+		t.Error("Second strict call should be rejected")
+	}
+
+	// Without Memcache the in-memory limiter handles strict methods itself
+	cfg.MemcacheServers = nil
+	if got := fmt.Sprintf("%T", NewInterceptor(cfg).perMethodLimiter); got != "*grpc.InMemoryGRPCMethodLimiter" {
+		t.Errorf("perMethodLimiter = %s, want *grpc.InMemoryGRPCMethodLimiter", got)
+	}
+}
+
 func TestInMemoryGRPCMethodLimiter_Allow(t *testing.T) {
 	cfg := config.Config{
 		GRPCBurstSize:         2,
@@ -232,4 +373,598 @@ func TestInterceptor_UnaryInterceptor_GRPCLimitExceeded(t *testing.T) {
 	}
 
 	testRateLimitHelper(t, cfg, "rate limit exceeded: grpc")
-}
\ No newline at end of file
+}
+func TestInterceptor_UnaryInterceptor_LeakyBucket(t *testing.T) {
+	cfg := config.Config{
+		GrpcMetadataKey:       "user-id",
+		GlobalRate:            100,
+		GlobalBurstSize:       10,
+		GRPCRate:              20, // one request every 50ms
+		GRPCBurstSize:         1,  // no queueing
+		GRPCDefaultMethodRate: 100,
+		GRPCAlgorithm:         config.AlgorithmLeakyBucket,
+	}
+
+	testRateLimitHelper(t, cfg, "rate limit exceeded: grpc")
+
+	// With room in the queue, the second request is delayed instead of rejected
+	cfg.GRPCBurstSize = 2
+	interceptor := NewInterceptor(cfg)
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return testSuccessResponse, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/TestService/TestMethod"}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user-id": "user123"}))
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if _, err := interceptor.UnaryInterceptor()(ctx, "request", info, handler); err != nil {
+			t.Errorf("Request %d should be allowed, got error: %v", i+1, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Second request departed after %v, want about 50ms", elapsed)
+	}
+}
+
+func TestInterceptor_UnaryInterceptor_LeakyBucketDeadline(t *testing.T) {
+	cfg := config.Config{
+		GrpcMetadataKey:       "user-id",
+		GlobalRate:            100,
+		GlobalBurstSize:       10,
+		GRPCRate:              1, // one request per second
+		GRPCBurstSize:         2, // up to 2 requests queued
+		GRPCDefaultMethodRate: 100,
+		GRPCAlgorithm:         config.AlgorithmLeakyBucket,
+	}
+
+	interceptor := NewInterceptor(cfg)
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return testSuccessResponse, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/TestService/TestMethod"}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user-id": "user123"}))
+
+	if _, err := interceptor.UnaryInterceptor()(ctx, "request", info, handler); err != nil {
+		t.Fatalf("First request should be allowed, got error: %v", err)
+	}
+
+	// A call whose deadline comes before its departure is rejected at once and leaves the queue
+	deadlineCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := interceptor.UnaryInterceptor()(deadlineCtx, "request", info, handler)
+	if status.Code(err) != codes.ResourceExhausted || !strings.Contains(err.Error(), "rate limit exceeded: grpc") {
+		t.Errorf("Call past its deadline should be rate limited by the grpc tier, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Call past its deadline took %v, want it rejected without waiting", elapsed)
+	}
+	if !strings.Contains(err.Error(), "retry after 1s") {
+		t.Errorf("Call past its deadline should carry the time until its departure as a retry hint, got: %v", err)
+	}
+	if remaining := interceptor.grpcLimiter.GetRemainingTokens("user123"); remaining != 1 {
+		t.Errorf("gRPC queue should have 1 free slot after the deadline, got %d", remaining)
+	}
+}
+
+func TestInterceptor_UnaryInterceptor_LeakyBucketCancelKeepsQuotaAndCredits(t *testing.T) {
+	cfg := config.Config{
+		GrpcMetadataKey:       "user-id",
+		GlobalRate:            100,
+		GlobalBurstSize:       10,
+		GRPCRate:              1, // one request per second
+		GRPCBurstSize:         2, // up to 2 requests queued
+		GRPCDefaultMethodRate: 100,
+		GRPCAlgorithm:         config.AlgorithmLeakyBucket,
+		Quotas:                []config.Quota{{Limit: 10, Period: config.QuotaPeriodMonth}},
+		ChargeCredits:         true,
+	}
+
+	interceptor := NewInterceptor(cfg)
+	defer func() { _ = interceptor.Close() }()
+	if _, err := interceptor.creditLimiter.TopUp("user123", 10); err != nil {
+		t.Fatalf("TopUp() error = %v", err)
+	}
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return testSuccessResponse, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/TestService/TestMethod"}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user-id": "user123"}))
+
+	if _, err := interceptor.UnaryInterceptor()(ctx, "request", info, handler); err != nil {
+		t.Fatalf("First request should be allowed, got error: %v", err)
+	}
+
+	// The second call is queued for a second and cancelled while it waits
+	cancelCtx, cancel := context.WithCancel(ctx)
+	time.AfterFunc(20*time.Millisecond, cancel)
+	_, err := interceptor.UnaryInterceptor()(cancelCtx, "request", info, handler)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Call cancelled while queued should be rate limited, got: %v", err)
+	}
+
+	if remaining := interceptor.quotaLimiter.GetRemainingQuota("user123"); remaining != 9 {
+		t.Errorf("GetRemainingQuota() = %d, want 9, a call cancelled while queued must not use the quota", remaining)
+	}
+	if balance := interceptor.creditLimiter.GetBalance("user123"); balance != 9 {
+		t.Errorf("GetBalance() = %d, want 9, a call cancelled while queued must not be charged", balance)
+	}
+}
+
+func TestInterceptor_UnaryInterceptor_MethodCost(t *testing.T) {
+	cfg := config.Config{
+		GrpcMetadataKey:       "user-id",
+		GlobalRate:            100,
+		GlobalBurstSize:       100,
+		GRPCRate:              100,
+		GRPCBurstSize:         60,
+		GRPCDefaultMethodRate: 100,
+		GRPCMethodCosts:       map[string]int{"/ExportService/Export": 50},
+	}
+
+	interceptor := NewInterceptor(cfg)
+
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return testSuccessResponse, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/ExportService/Export"}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user-id": "user123"}))
+
+	if _, err := interceptor.UnaryInterceptor()(ctx, "request", info, handler); err != nil {
+		t.Errorf("First export should be allowed, got error: %v", err)
+	}
+
+	_, err := interceptor.UnaryInterceptor()(ctx, "request", info, handler)
+	if st, _ := status.FromError(err); st.Code() != codes.ResourceExhausted || st.Message() != "rate limit exceeded: grpc" {
+		t.Errorf("Second export should exceed the gRPC limit, got %v", err)
+	}
+}
+
+func TestInterceptor_UnaryInterceptor_MultipleLimits(t *testing.T) {
+	cfg := config.Config{
+		GrpcMetadataKey:       "user-id",
+		GlobalRate:            10,
+		GlobalBurstSize:       10,
+		GlobalExtraLimits:     []config.Limit{{Rate: 1, Period: time.Hour, Burst: 1}},
+		GRPCRate:              10,
+		GRPCBurstSize:         10,
+		GRPCDefaultMethodRate: 10,
+	}
+
+	testRateLimitHelper(t, cfg, "rate limit exceeded: global (1/h)")
+}
+
+func TestInterceptor_UnaryInterceptor_ConcurrencyLimit(t *testing.T) {
+	cfg := config.Config{
+		GrpcMetadataKey:       "user-id",
+		GlobalRate:            100,
+		GlobalBurstSize:       100,
+		GRPCRate:              100,
+		GRPCBurstSize:         100,
+		GRPCDefaultMethodRate: 100,
+		GRPCMaxConcurrent:     1,
+	}
+
+	interceptor := NewInterceptor(cfg)
+	info := &grpc.UnaryServerInfo{FullMethod: "/ReportService/Generate"}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user-id": "user123"}))
+
+	success := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return testSuccessResponse, nil
+	}
+
+	// A second call while the first one is in flight is rejected
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		_, err := interceptor.UnaryInterceptor()(ctx, "request", info, success)
+		if st, _ := status.FromError(err); st.Code() != codes.ResourceExhausted ||
+			st.Message() != "concurrency limit exceeded: grpc" {
+			t.Errorf("Nested call should exceed the gRPC concurrency limit, got %v", err)
+		}
+		return testSuccessResponse, nil
+	}
+	if _, err := interceptor.UnaryInterceptor()(ctx, "request", info, handler); err != nil {
+		t.Fatalf("First call should be allowed, got error: %v", err)
+	}
+
+	// A panicking handler still gives its slot back
+	panicking := func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("report generator failed")
+	}
+	func() {
+		defer func() { _ = recover() }()
+		_, _ = interceptor.UnaryInterceptor()(ctx, "request", info, panicking)
+	}()
+
+	if _, err := interceptor.UnaryInterceptor()(ctx, "request", info, success); err != nil {
+		t.Errorf("Call after the panic should be allowed, got error: %v", err)
+	}
+}
+
+func TestInterceptor_UnaryInterceptor_AdaptiveConcurrency(t *testing.T) {
+	cfg := config.Config{
+		GrpcMetadataKey:       "user-id",
+		GlobalRate:            100,
+		GlobalBurstSize:       100,
+		GRPCRate:              100,
+		GRPCBurstSize:         100,
+		GRPCDefaultMethodRate: 100,
+		AdaptiveInitialLimit:  1,
+		AdaptiveMinLimit:      1,
+		AdaptiveMaxLimit:      1,
+	}
+
+	limiter := middleware.NewAdaptiveLimiter(cfg)
+	interceptor := NewInterceptor(cfg, WithAdaptiveLimiter(limiter))
+	info := &grpc.UnaryServerInfo{FullMethod: "/ReportService/Generate"}
+
+	success := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return testSuccessResponse, nil
+	}
+
+	// A call from another user while the process is at its limit is shed
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		other := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user-id": "user456"}))
+		_, err := interceptor.UnaryInterceptor()(other, "request", info, success)
+		if st, _ := status.FromError(err); st.Code() != codes.Unavailable || st.Message() != "server overloaded" {
+			t.Errorf("Nested call should be shed by the adaptive limit, got %v", err)
+		}
+		return testSuccessResponse, nil
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user-id": "user123"}))
+	if _, err := interceptor.UnaryInterceptor()(ctx, "request", info, handler); err != nil {
+		t.Fatalf("First call should be allowed, got error: %v", err)
+	}
+
+	if interceptor.AdaptiveLimiter() != limiter {
+		t.Error("AdaptiveLimiter() should return the limiter passed in")
+	}
+	if stats := limiter.Stats(); stats.InFlight != 0 || stats.Limit != 1 {
+		t.Errorf("Stats() = %+v, want nothing in flight and a limit of 1", stats)
+	}
+}
+
+func TestInterceptor_UnaryInterceptor_QuotaExceeded(t *testing.T) {
+	cfg := config.Config{
+		GrpcMetadataKey:       "user-id",
+		GlobalRate:            100,
+		GlobalBurstSize:       100,
+		GRPCRate:              100,
+		GRPCBurstSize:         100,
+		GRPCDefaultMethodRate: 100,
+		Quotas:                []config.Quota{{Limit: 3, Period: config.QuotaPeriodDay}},
+	}
+
+	// HTTP and gRPC share one quota
+	quotas, err := middleware.NewQuotaLimiter(cfg)
+	if err != nil {
+		t.Fatalf("NewQuotaLimiter() error = %v", err)
+	}
+	quotas.Decide("user123", 2)
+
+	interceptor := NewInterceptor(cfg, WithQuotaLimiter(quotas))
+	defer func() { _ = interceptor.Close() }()
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/UserService/GetUser"}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user-id": "user123"}))
+	success := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return testSuccessResponse, nil
+	}
+
+	if _, err := interceptor.UnaryInterceptor()(ctx, "request", info, success); err != nil {
+		t.Fatalf("Call within the quota should be allowed, got error: %v", err)
+	}
+
+	_, err = interceptor.UnaryInterceptor()(ctx, "request", info, success)
+	st, _ := status.FromError(err)
+	if st.Code() != codes.ResourceExhausted || !strings.HasPrefix(st.Message(), "quota exceeded: 3/day (resets ") {
+		t.Errorf("Call over the quota should be rejected, got %v", err)
+	}
+}
+
+func TestInterceptor_UnaryInterceptor_InsufficientCredits(t *testing.T) {
+	cfg := config.Config{
+		GrpcMetadataKey:       "user-id",
+		GlobalRate:            100,
+		GlobalBurstSize:       100,
+		GRPCRate:              100,
+		GRPCBurstSize:         100,
+		GRPCDefaultMethodRate: 100,
+		ChargeCredits:         true,
+	}
+
+	// HTTP and gRPC draw from one balance
+	credits, err := middleware.NewCreditLimiter(cfg)
+	if err != nil {
+		t.Fatalf("NewCreditLimiter() error = %v", err)
+	}
+	if _, err := credits.TopUp("user123", 1); err != nil {
+		t.Fatalf("TopUp() error = %v", err)
+	}
+
+	interceptor := NewInterceptor(cfg, WithCreditLimiter(credits))
+	defer func() { _ = interceptor.Close() }()
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/UserService/GetUser"}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user-id": "user123"}))
+	success := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return testSuccessResponse, nil
+	}
+
+	if _, err := interceptor.UnaryInterceptor()(ctx, "request", info, success); err != nil {
+		t.Fatalf("Call covered by the balance should be allowed, got error: %v", err)
+	}
+
+	_, err = interceptor.UnaryInterceptor()(ctx, "request", info, success)
+	st, _ := status.FromError(err)
+	if st.Code() != codes.ResourceExhausted || st.Message() != "insufficient credits: balance 0, cost 1" {
+		t.Errorf("Call over the balance should be rejected, got %v", err)
+	}
+}
+
+func TestInterceptor_UnaryInterceptor_InsufficientCreditsKeepQuota(t *testing.T) {
+	cfg := config.Config{
+		GrpcMetadataKey:       "user-id",
+		GlobalRate:            100,
+		GlobalBurstSize:       100,
+		GRPCRate:              100,
+		GRPCBurstSize:         100,
+		GRPCDefaultMethodRate: 100,
+		Quotas:                []config.Quota{{Limit: 10, Period: config.QuotaPeriodDay}},
+		ChargeCredits:         true,
+	}
+
+	quotas, err := middleware.NewQuotaLimiter(cfg)
+	if err != nil {
+		t.Fatalf("NewQuotaLimiter() error = %v", err)
+	}
+	interceptor := NewInterceptor(cfg, WithQuotaLimiter(quotas))
+	defer func() { _ = interceptor.Close() }()
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/UserService/GetUser"}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user-id": "user123"}))
+	success := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return testSuccessResponse, nil
+	}
+
+	_, err = interceptor.UnaryInterceptor()(ctx, "request", info, success)
+	if st, _ := status.FromError(err); !strings.HasPrefix(st.Message(), "insufficient credits") {
+		t.Fatalf("Call without credits should be rejected, got %v", err)
+	}
+	if remaining := quotas.GetRemainingQuota("user123"); remaining != 10 {
+		t.Errorf("GetRemainingQuota() = %d, want 10, calls rejected for credits must not use the quota", remaining)
+	}
+}
+
+func TestInterceptor_UnaryInterceptor_PenaltyBox(t *testing.T) {
+	cfg := config.Config{
+		GrpcMetadataKey:       "user-id",
+		GlobalRate:            100,
+		GlobalBurstSize:       100,
+		GRPCRate:              1,
+		GRPCBurstSize:         1,
+		GRPCDefaultMethodRate: 100,
+		PenaltyThreshold:      1,
+		PenaltyWindow:         time.Minute,
+		PenaltyBan:            time.Minute,
+		PenaltyMaxBan:         time.Hour,
+		PenaltyResetAfter:     time.Hour,
+	}
+
+	// HTTP and gRPC share one penalty box
+	penalties := middleware.NewPenaltyBox(cfg)
+	interceptor := NewInterceptor(cfg, WithPenaltyBox(penalties))
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/UserService/GetUser"}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{"user-id": "user123"}))
+	success := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return testSuccessResponse, nil
+	}
+
+	if _, err := interceptor.UnaryInterceptor()(ctx, "request", info, success); err != nil {
+		t.Fatalf("First call should be allowed, got error: %v", err)
+	}
+	if _, err := interceptor.UnaryInterceptor()(ctx, "request", info, success); err == nil {
+		t.Fatal("Second call should hit the gRPC limit")
+	}
+	if _, banned := penalties.Banned("user123"); !banned {
+		t.Fatal("Rejected user should be banned")
+	}
+
+	_, err := interceptor.UnaryInterceptor()(ctx, "request", info, success)
+	st, _ := status.FromError(err)
+	if st.Code() != codes.ResourceExhausted || !strings.HasPrefix(st.Message(), "temporarily banned until ") {
+		t.Errorf("Banned user should be rejected, got %v", err)
+	}
+}
+
+func TestInterceptor_UnaryInterceptor_PriorityClasses(t *testing.T) {
+	cfg := config.Config{
+		GrpcMetadataKey:       "user-id",
+		GlobalRate:            100,
+		GlobalBurstSize:       100,
+		GRPCRate:              1,
+		GRPCPeriod:            time.Minute,
+		GRPCBurstSize:         4,
+		GRPCDefaultMethodRate: 100,
+		PriorityClasses:       []config.PriorityClass{{Name: "critical", Reserve: 0.5}, {Name: "analytics"}},
+		PriorityMetadataKey:   "priority",
+		GRPCMethodPriorities:  map[string]string{"/PaymentService/Charge": "critical"},
+	}
+
+	interceptor := NewInterceptor(cfg)
+	success := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return testSuccessResponse, nil
+	}
+	call := func(method, priority string) error {
+		md := metadata.New(map[string]string{"user-id": "user123", "priority": priority})
+		ctx := metadata.NewIncomingContext(context.Background(), md)
+		_, err := interceptor.UnaryInterceptor()(ctx, "request", &grpc.UnaryServerInfo{FullMethod: method}, success)
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := call("/AnalyticsService/Track", "analytics"); err != nil {
+			t.Fatalf("Analytics call %d should be allowed, got error: %v", i+1, err)
+		}
+	}
+	err := call("/AnalyticsService/Track", "analytics")
+	if st, _ := status.FromError(err); st.Code() != codes.ResourceExhausted {
+		t.Fatalf("Analytics call beyond its share should be shed, got %v", err)
+	}
+
+	// The configured method priority applies whatever the metadata says
+	for i := 0; i < 2; i++ {
+		if err := call("/PaymentService/Charge", "analytics"); err != nil {
+			t.Errorf("Payment call %d should use the reserved share, got error: %v", i+1, err)
+		}
+	}
+}
+
+func TestInterceptor_UnaryInterceptor_AggregateLimits(t *testing.T) {
+	cfg := config.Config{
+		GrpcMetadataKey:       "user-id",
+		GlobalRate:            100,
+		GlobalBurstSize:       100,
+		GRPCRate:              100,
+		GRPCBurstSize:         100,
+		GRPCDefaultMethodRate: 100,
+		AggregateLimits:       []config.Limit{{Rate: 3, Period: time.Minute, Burst: 3}},
+		GRPCMethodAggregateLimits: map[string][]config.Limit{
+			"/UserService/CreateUser": {{Rate: 1, Period: time.Minute, Burst: 1}},
+		},
+	}
+
+	interceptor := NewInterceptor(cfg)
+	success := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return testSuccessResponse, nil
+	}
+	call := func(method, userID string) error {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("user-id", userID))
+		_, err := interceptor.UnaryInterceptor()(ctx, "request", &grpc.UnaryServerInfo{FullMethod: method}, success)
+		return err
+	}
+
+	if err := call("/UserService/CreateUser", "user1"); err != nil {
+		t.Fatalf("First call should be allowed, got error: %v", err)
+	}
+	err := call("/UserService/CreateUser", "user2")
+	st, _ := status.FromError(err)
+	if st.Code() != codes.ResourceExhausted || !strings.Contains(st.Message(), "aggregate") {
+		t.Fatalf("Second user should hit the method's aggregate limit, got %v", err)
+	}
+
+	// The service-wide limit spans every method and user
+	for _, userID := range []string{"user2", "user3"} {
+		if err := call("/UserService/GetUser", userID); err != nil {
+			t.Fatalf("Call from %s should be allowed, got error: %v", userID, err)
+		}
+	}
+	if err := call("/UserService/GetUser", "user4"); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Call beyond the service-wide limit should be rejected, got %v", err)
+	}
+}
+
+func TestInterceptor_UnaryInterceptor_Plans(t *testing.T) {
+	base := config.Config{
+		GrpcMetadataKey:       "user-id",
+		GlobalRate:            100,
+		GlobalBurstSize:       100,
+		GRPCRate:              1,
+		GRPCPeriod:            time.Minute,
+		GRPCBurstSize:         1,
+		GRPCDefaultMethodRate: 100,
+	}
+	pro := base
+	pro.GRPCRate = 3
+	pro.GRPCBurstSize = 3
+
+	cfg := base
+	cfg.Plans = map[string]config.Config{"pro": pro}
+
+	success := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return testSuccessResponse, nil
+	}
+	resolver := middleware.PlanResolverFunc(func(userID string) string {
+		if userID == "acme" {
+			return "pro"
+		}
+		return ""
+	})
+	interceptor := NewInterceptor(cfg, WithPlanResolver(resolver))
+
+	// admitted counts the calls from a user that get through before the first rejection
+	admitted := func(userID string) int {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("user-id", userID))
+		info := &grpc.UnaryServerInfo{FullMethod: "/UserService/CreateUser"}
+		for i := 0; i < 10; i++ {
+			if _, err := interceptor.UnaryInterceptor()(ctx, "request", info, success); err != nil {
+				return i
+			}
+		}
+		return 10
+	}
+
+	if n := admitted("acme"); n != 3 {
+		t.Errorf("User on the pro plan got %d calls, want 3", n)
+	}
+	// Without a default plan, users on no plan get the top-level limits
+	if n := admitted("user123"); n != 1 {
+		t.Errorf("User on no plan got %d calls, want 1", n)
+	}
+
+	interceptor.Reset()
+	if n := admitted("acme"); n != 3 {
+		t.Errorf("After Reset() the pro user got %d calls, want 3", n)
+	}
+}
+
+func TestInterceptor_UnaryInterceptor_Hierarchy(t *testing.T) {
+	cfg := config.Config{
+		GrpcMetadataKey:       "user-id",
+		GlobalRate:            100,
+		GlobalBurstSize:       100,
+		GRPCRate:              100,
+		GRPCBurstSize:         100,
+		GRPCDefaultMethodRate: 100,
+		IdentityLevels: []config.IdentityLevel{
+			{Name: "org", MetadataKey: "org-id", Limits: []config.Limit{{Rate: 2, Period: time.Minute, Burst: 2}}},
+			{Name: config.UserLevel},
+			{Name: "key", MetadataKey: "api-key", Limits: []config.Limit{{Rate: 1, Period: time.Minute, Burst: 1}}},
+		},
+	}
+
+	interceptor := NewInterceptor(cfg)
+	success := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return testSuccessResponse, nil
+	}
+	call := func(pairs ...string) error {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(pairs...))
+		info := &grpc.UnaryServerInfo{FullMethod: "/UserService/GetUser"}
+		_, err := interceptor.UnaryInterceptor()(ctx, "request", info, success)
+		return err
+	}
+
+	if err := call("org-id", "acme", "user-id", "user1", "api-key", "key1"); err != nil {
+		t.Fatalf("First call should be allowed, got error: %v", err)
+	}
+	err := call("org-id", "acme", "user-id", "user1", "api-key", "key1")
+	if status.Code(err) != codes.ResourceExhausted || status.Convert(err).Message() != "rate limit exceeded: level key (1/m)" {
+		t.Fatalf("Second call with the same API key should hit the key level, got %v", err)
+	}
+
+	// The organization's limit is shared by all of its users
+	if err := call("org-id", "acme", "user-id", "user2"); err != nil {
+		t.Fatalf("Call from user2 should be allowed, got error: %v", err)
+	}
+	err = call("org-id", "acme", "user-id", "user3")
+	if status.Code(err) != codes.ResourceExhausted || status.Convert(err).Message() != "rate limit exceeded: level org (2/m)" {
+		t.Fatalf("Call beyond the org limit should hit the org level, got %v", err)
+	}
+	if err := call("org-id", "globex", "user-id", "user3"); err != nil {
+		t.Errorf("Call from another org should be allowed, got error: %v", err)
+	}
+}
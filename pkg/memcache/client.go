@@ -8,6 +8,19 @@ import (
 	"github.com/bradfitz/gomemcache/memcache"
 )
 
+// maxRelativeExpiration is the longest expiration Memcache reads as seconds from now;
+// larger values are read as a Unix timestamp
+const maxRelativeExpiration = 30 * 24 * time.Hour
+
+// expirationSeconds converts an expiration into the value Memcache expects
+// Expirations beyond 30 days, such as those of monthly quota counters, are sent as absolute times
+func expirationSeconds(expiration time.Duration) int32 {
+	if expiration > maxRelativeExpiration {
+		return int32(time.Now().Add(expiration).Unix())
+	}
+	return int32(expiration.Seconds())
+}
+
 // Client wraps the gomemcache client with additional functionality
 type Client struct {
 	client *memcache.Client
@@ -41,16 +54,74 @@ func (c *Client) Get(key string) (uint64, error) {
 	return value, nil
 }
 
+// Gets retrieves a value from Memcache together with its CAS token
+// Returns ErrCacheMiss if the key does not exist
+func (c *Client) Gets(key string) (*Item, error) {
+	item, err := c.client.Get(key)
+	if err != nil {
+		if err == memcache.ErrCacheMiss {
+			return nil, ErrCacheMiss
+		}
+		return nil, fmt.Errorf("failed to get key %q: %w", key, err)
+	}
+
+	value, err := strconv.ParseUint(string(item.Value), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse value for key %q: %w", key, err)
+	}
+
+	return &Item{Key: key, Value: value, raw: item}, nil
+}
+
 // Set sets a value in Memcache with expiration
 func (c *Client) Set(key string, value uint64, expiration time.Duration) error {
 	item := &memcache.Item{
 		Key:        key,
 		Value:      []byte(strconv.FormatUint(value, 10)),
-		Expiration: int32(expiration.Seconds()),
+		Expiration: expirationSeconds(expiration),
 	}
 	return c.client.Set(item)
 }
 
+// Add sets a value in Memcache only if the key does not already exist
+// Returns ErrNotStored if the key is already present
+func (c *Client) Add(key string, value uint64, expiration time.Duration) error {
+	item := &memcache.Item{
+		Key:        key,
+		Value:      []byte(strconv.FormatUint(value, 10)),
+		Expiration: expirationSeconds(expiration),
+	}
+	if err := c.client.Add(item); err != nil {
+		if err == memcache.ErrNotStored {
+			return ErrNotStored
+		}
+		return fmt.Errorf("failed to add key %q: %w", key, err)
+	}
+	return nil
+}
+
+// CompareAndSwap stores item.Value if the item has not been modified since it was read with Gets
+// Returns ErrCASConflict if it was modified and ErrCacheMiss if it was evicted in between
+func (c *Client) CompareAndSwap(item *Item, expiration time.Duration) error {
+	if item.raw == nil {
+		return fmt.Errorf("item for key %q was not obtained with Gets", item.Key)
+	}
+
+	item.raw.Value = []byte(strconv.FormatUint(item.Value, 10))
+	item.raw.Expiration = expirationSeconds(expiration)
+
+	switch err := c.client.CompareAndSwap(item.raw); err {
+	case nil:
+		return nil
+	case memcache.ErrCASConflict:
+		return ErrCASConflict
+	case memcache.ErrNotStored, memcache.ErrCacheMiss:
+		return ErrCacheMiss
+	default:
+		return fmt.Errorf("failed to compare-and-swap key %q: %w", item.Key, err)
+	}
+}
+
 // IncrementWithExpiration atomically increments a counter and sets expiration if key doesn't exist
 // Returns the new value after increment
 func (c *Client) IncrementWithExpiration(key string, delta uint64, expiration time.Duration) (uint64, error) {
@@ -72,6 +143,19 @@ func (c *Client) IncrementWithExpiration(key string, delta uint64, expiration ti
 	return 0, fmt.Errorf("failed to increment key %q: %w", key, err)
 }
 
+// Decrement atomically decrements a counter; Memcache never lets counters drop below zero
+// Returns the new value after decrement
+func (c *Client) Decrement(key string, delta uint64) (uint64, error) {
+	newValue, err := c.client.Decrement(key, delta)
+	if err == memcache.ErrCacheMiss {
+		return 0, ErrCacheMiss
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to decrement key %q: %w", key, err)
+	}
+	return newValue, nil
+}
+
 // Delete removes a key from Memcache
 func (c *Client) Delete(key string) error {
 	return c.client.Delete(key)
@@ -193,3 +193,101 @@ func TestMockClient_Clear(t *testing.T) {
 		t.Errorf("key3 should be cleared, got %d", value)
 	}
 }
+
+func TestMockClient_Add(t *testing.T) {
+	mock := NewMockClient()
+
+	// Adding a new key should succeed
+	if err := mock.Add("test_key", 7, time.Minute); err != nil {
+		t.Fatalf("Add() error = %v, want nil", err)
+	}
+
+	// Adding an existing key should fail with ErrNotStored
+	if err := mock.Add("test_key", 9, time.Minute); err != ErrNotStored {
+		t.Errorf("Add() error = %v, want %v", err, ErrNotStored)
+	}
+
+	if value, _ := mock.Get("test_key"); value != 7 {
+		t.Errorf("Get() = %d, want 7", value)
+	}
+}
+
+func TestMockClient_CompareAndSwap(t *testing.T) {
+	mock := NewMockClient()
+
+	// Gets on a missing key should return ErrCacheMiss
+	if _, err := mock.Gets("test_key"); err != ErrCacheMiss {
+		t.Errorf("Gets() error = %v, want %v", err, ErrCacheMiss)
+	}
+
+	if err := mock.Set("test_key", 1, time.Minute); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	first, err := mock.Gets("test_key")
+	if err != nil {
+		t.Fatalf("Gets() error = %v", err)
+	}
+	stale, err := mock.Gets("test_key")
+	if err != nil {
+		t.Fatalf("Gets() error = %v", err)
+	}
+
+	// First writer wins
+	first.Value = 2
+	if err := mock.CompareAndSwap(first, time.Minute); err != nil {
+		t.Errorf("CompareAndSwap() error = %v, want nil", err)
+	}
+
+	// Second writer holds a stale CAS token
+	stale.Value = 3
+	if err := mock.CompareAndSwap(stale, time.Minute); err != ErrCASConflict {
+		t.Errorf("CompareAndSwap() error = %v, want %v", err, ErrCASConflict)
+	}
+
+	if value, _ := mock.Get("test_key"); value != 2 {
+		t.Errorf("Get() = %d, want 2", value)
+	}
+
+	// Swapping a deleted key should return ErrCacheMiss
+	current, _ := mock.Gets("test_key")
+	_ = mock.Delete("test_key")
+	if err := mock.CompareAndSwap(current, time.Minute); err != ErrCacheMiss {
+		t.Errorf("CompareAndSwap() error = %v, want %v", err, ErrCacheMiss)
+	}
+}
+
+func TestMockClient_Decrement(t *testing.T) {
+	mock := NewMockClient()
+
+	// Decrementing a missing key should return ErrCacheMiss
+	if _, err := mock.Decrement("counter", 1); err != ErrCacheMiss {
+		t.Errorf("Decrement() error = %v, want %v", err, ErrCacheMiss)
+	}
+
+	if _, err := mock.IncrementWithExpiration("counter", 5, time.Minute); err != nil {
+		t.Fatalf("IncrementWithExpiration() error = %v", err)
+	}
+
+	if value, err := mock.Decrement("counter", 2); err != nil || value != 3 {
+		t.Errorf("Decrement() = %d, %v, want 3, nil", value, err)
+	}
+
+	// Counters stop at zero
+	if value, err := mock.Decrement("counter", 10); err != nil || value != 0 {
+		t.Errorf("Decrement() = %d, %v, want 0, nil", value, err)
+	}
+}
+
+func TestExpirationSeconds(t *testing.T) {
+	if got := expirationSeconds(time.Minute); got != 60 {
+		t.Errorf("expirationSeconds(1m) = %d, want 60", got)
+	}
+
+	// Monthly quota counters outlive the relative range and must be sent as a Unix timestamp
+	expiration := 32 * 24 * time.Hour
+	want := time.Now().Add(expiration).Unix()
+	if got := int64(expirationSeconds(expiration)); got < want-1 || got > want+1 {
+		t.Errorf("expirationSeconds(32d) = %d, want about %d", got, want)
+	}
+}
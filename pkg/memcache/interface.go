@@ -1,16 +1,51 @@
 package memcache
 
-import "time"
+import (
+	"errors"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+var (
+	// ErrCacheMiss is returned by Gets and CompareAndSwap when the key does not exist
+	ErrCacheMiss = errors.New("memcache: cache miss")
+	// ErrNotStored is returned by Add when the key already exists
+	ErrNotStored = errors.New("memcache: item not stored")
+	// ErrCASConflict is returned by CompareAndSwap when the value was modified since Gets
+	ErrCASConflict = errors.New("memcache: compare-and-swap conflict")
+)
+
+// Item is a value read from Memcache together with the CAS token needed to update it
+type Item struct {
+	// Key is the Memcache key of the item
+	Key string
+	// Value is the numeric value stored under the key
+	Value uint64
+
+	// casID identifies the version of the item in the mock client
+	casID uint64
+	// raw is the underlying gomemcache item carrying the CAS token
+	raw *memcache.Item
+}
 
 // ClientInterface defines the interface for Memcache operations
 // This allows for mock implementations in tests
 type ClientInterface interface {
 	// Get retrieves a value from Memcache
 	Get(key string) (uint64, error)
+	// Gets retrieves a value from Memcache together with its CAS token
+	Gets(key string) (*Item, error)
 	// Set sets a value in Memcache with expiration
 	Set(key string, value uint64, expiration time.Duration) error
+	// Add sets a value in Memcache only if the key does not already exist
+	Add(key string, value uint64, expiration time.Duration) error
+	// CompareAndSwap stores item.Value if the item has not been modified since it was read with Gets
+	CompareAndSwap(item *Item, expiration time.Duration) error
 	// IncrementWithExpiration atomically increments a counter and sets expiration if key doesn't exist
 	IncrementWithExpiration(key string, delta uint64, expiration time.Duration) (uint64, error)
+	// Decrement atomically decrements a counter, stopping at zero; returns ErrCacheMiss if the key does not exist
+	Decrement(key string, delta uint64) (uint64, error)
 	// Delete removes a key from Memcache
 	Delete(key string) error
 	// HealthCheck checks if Memcache is accessible
@@ -11,11 +11,34 @@ type MockClient struct {
 	mu     sync.RWMutex
 	data   map[string]mockItem
 	closed bool
+	// nextCAS is the CAS token assigned to the next write
+	nextCAS uint64
 }
 
 type mockItem struct {
 	value     uint64
 	expiresAt time.Time
+	casID     uint64
+}
+
+// isExpired reports whether the item has passed its expiration time
+func (i mockItem) isExpired() bool {
+	return !i.expiresAt.IsZero() && time.Now().After(i.expiresAt)
+}
+
+// store writes an item and assigns it a new CAS token; callers must hold m.mu
+func (m *MockClient) store(key string, value uint64, expiration time.Duration) {
+	var expiresAt time.Time
+	if expiration > 0 {
+		expiresAt = time.Now().Add(expiration)
+	}
+
+	m.nextCAS++
+	m.data[key] = mockItem{
+		value:     value,
+		expiresAt: expiresAt,
+		casID:     m.nextCAS,
+	}
 }
 
 // NewMockClient creates a new mock Memcache client
@@ -40,13 +63,30 @@ func (m *MockClient) Get(key string) (uint64, error) {
 	}
 
 	// Check expiration
-	if !item.expiresAt.IsZero() && time.Now().After(item.expiresAt) {
+	if item.isExpired() {
 		return 0, nil // Expired
 	}
 
 	return item.value, nil
 }
 
+// Gets retrieves a value from the mock Memcache together with its CAS token
+func (m *MockClient) Gets(key string) (*Item, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return nil, fmt.Errorf("client is closed")
+	}
+
+	item, exists := m.data[key]
+	if !exists || item.isExpired() {
+		return nil, ErrCacheMiss
+	}
+
+	return &Item{Key: key, Value: item.value, casID: item.casID}, nil
+}
+
 // Set sets a value in the mock Memcache with expiration
 func (m *MockClient) Set(key string, value uint64, expiration time.Duration) error {
 	m.mu.Lock()
@@ -56,16 +96,45 @@ func (m *MockClient) Set(key string, value uint64, expiration time.Duration) err
 		return fmt.Errorf("client is closed")
 	}
 
-	var expiresAt time.Time
-	if expiration > 0 {
-		expiresAt = time.Now().Add(expiration)
+	m.store(key, value, expiration)
+	return nil
+}
+
+// Add sets a value in the mock Memcache only if the key does not already exist
+func (m *MockClient) Add(key string, value uint64, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return fmt.Errorf("client is closed")
 	}
 
-	m.data[key] = mockItem{
-		value:     value,
-		expiresAt: expiresAt,
+	if item, exists := m.data[key]; exists && !item.isExpired() {
+		return ErrNotStored
 	}
 
+	m.store(key, value, expiration)
+	return nil
+}
+
+// CompareAndSwap stores item.Value if the item has not been modified since it was read with Gets
+func (m *MockClient) CompareAndSwap(item *Item, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return fmt.Errorf("client is closed")
+	}
+
+	current, exists := m.data[item.Key]
+	if !exists || current.isExpired() {
+		return ErrCacheMiss
+	}
+	if current.casID != item.casID {
+		return ErrCASConflict
+	}
+
+	m.store(item.Key, item.Value, expiration)
 	return nil
 }
 
@@ -79,23 +148,42 @@ func (m *MockClient) IncrementWithExpiration(key string, delta uint64, expiratio
 	}
 
 	item, exists := m.data[key]
-	isExpired := exists && !item.expiresAt.IsZero() && time.Now().After(item.expiresAt)
 
-	if !exists || isExpired {
+	if !exists || item.isExpired() {
 		// Key doesn't exist or is expired, initialize it
-		var expiresAt time.Time
-		if expiration > 0 {
-			expiresAt = time.Now().Add(expiration)
-		}
-		m.data[key] = mockItem{
-			value:     delta,
-			expiresAt: expiresAt,
-		}
+		m.store(key, delta, expiration)
 		return delta, nil
 	}
 
 	// Increment existing value
+	m.nextCAS++
 	item.value += delta
+	item.casID = m.nextCAS
+	m.data[key] = item
+	return item.value, nil
+}
+
+// Decrement atomically decrements a counter, stopping at zero like Memcache does
+func (m *MockClient) Decrement(key string, delta uint64) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return 0, fmt.Errorf("client is closed")
+	}
+
+	item, exists := m.data[key]
+	if !exists || item.isExpired() {
+		return 0, ErrCacheMiss
+	}
+
+	m.nextCAS++
+	if delta > item.value {
+		item.value = 0
+	} else {
+		item.value -= delta
+	}
+	item.casID = m.nextCAS
 	m.data[key] = item
 	return item.value, nil
 }
@@ -0,0 +1,195 @@
+package middleware
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"rate_limiter_service/internal/config"
+)
+
+const (
+	// adaptiveShortWindow is the number of samples the recent RTT average spans
+	adaptiveShortWindow = 10
+	// adaptiveLongWindow is the number of samples the baseline RTT average spans
+	adaptiveLongWindow = 600
+	// adaptiveTolerance is how much the recent RTT may exceed the baseline before the limit shrinks
+	adaptiveTolerance = 1.5
+	// adaptiveSmoothing is the weight of each new limit estimate against the current limit
+	adaptiveSmoothing = 0.2
+)
+
+// AdaptiveStats is a snapshot of an AdaptiveLimiter for monitoring
+type AdaptiveStats struct {
+	// Limit is the current process-wide in-flight limit
+	Limit int
+	// InFlight is the number of requests currently holding a slot
+	InFlight int
+	// RTT is the recent average handler latency
+	RTT time.Duration
+	// BaselineRTT is the long-term average handler latency the recent average is compared against
+	BaselineRTT time.Duration
+}
+
+// AdaptiveLimiter caps the number of requests in flight across the whole process and adapts the cap
+// to handler latency with a gradient algorithm: while recent latency stays close to the long-term
+// baseline the limit grows, and when latency rises because the backend slows down the limit shrinks
+// A nil *AdaptiveLimiter admits every request
+type AdaptiveLimiter struct {
+	// mu protects every field below
+	mu sync.Mutex
+
+	// limit is the current in-flight limit; it is fractional so small adjustments accumulate
+	limit        float64
+	initialLimit float64
+	minLimit     float64
+	maxLimit     float64
+
+	// inFlight counts the requests holding a slot
+	inFlight int
+
+	// shortRTT and longRTT are exponential moving averages of the latency in nanoseconds
+	shortRTT float64
+	longRTT  float64
+	samples  int
+}
+
+// NewAdaptiveLimiter creates a new adaptive limiter starting at the configured initial limit
+// Share one limiter between the HTTP middleware and the gRPC interceptor so the limit covers the process
+func NewAdaptiveLimiter(cfg config.Config) *AdaptiveLimiter {
+	minLimit := float64(max(cfg.AdaptiveMinLimit, 1))
+	maxLimit := float64(max(cfg.AdaptiveMaxLimit, cfg.AdaptiveMinLimit, 1))
+	initialLimit := max(minLimit, min(maxLimit, float64(cfg.AdaptiveInitialLimit)))
+	return &AdaptiveLimiter{
+		limit:        initialLimit,
+		initialLimit: initialLimit,
+		minLimit:     minLimit,
+		maxLimit:     maxLimit,
+	}
+}
+
+// AdaptiveSlot is the in-flight slot of a request admitted by an AdaptiveLimiter
+type AdaptiveSlot struct {
+	limiter *AdaptiveLimiter
+	start   time.Time
+	once    sync.Once
+}
+
+// Acquire takes a slot if fewer requests than the current limit are in flight
+// It returns false when the process is at its limit and the request should be shed
+func (al *AdaptiveLimiter) Acquire() (*AdaptiveSlot, bool) {
+	if al == nil {
+		return nil, true
+	}
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	if al.inFlight >= al.currentLimit() {
+		return nil, false
+	}
+	al.inFlight++
+	return &AdaptiveSlot{limiter: al, start: time.Now()}, true
+}
+
+// Start restarts the slot's latency clock right before the handler is called, so the RTT sample
+// measures the handler rather than the rate limit checks, Memcache round trips and queueing before it
+func (s *AdaptiveSlot) Start() {
+	if s == nil {
+		return
+	}
+	s.start = time.Now()
+}
+
+// Done releases the slot and records the request's latency as an RTT sample
+func (s *AdaptiveSlot) Done() {
+	if s == nil {
+		return
+	}
+	s.once.Do(func() { s.limiter.release(time.Since(s.start), true) })
+}
+
+// Ignore releases the slot without recording a sample, for requests that never reached the handler
+// or did not complete normally; calling it after Done has no effect
+func (s *AdaptiveSlot) Ignore() {
+	if s == nil {
+		return
+	}
+	s.once.Do(func() { s.limiter.release(0, false) })
+}
+
+// release gives back a slot and, if sampled, updates the limit from the request's latency
+func (al *AdaptiveLimiter) release(rtt time.Duration, sampled bool) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	if sampled {
+		al.update(rtt)
+	}
+	// Slots taken before a Reset are not counted any more
+	al.inFlight = max(al.inFlight-1, 0)
+}
+
+// update feeds one latency sample into the RTT averages and adjusts the limit
+// It must be called with mu held and before the sampled request leaves inFlight
+func (al *AdaptiveLimiter) update(rtt time.Duration) {
+	sample := float64(max(rtt, time.Microsecond))
+	if al.samples == 0 {
+		al.shortRTT, al.longRTT = sample, sample
+	} else {
+		al.shortRTT += (sample - al.shortRTT) / adaptiveShortWindow
+		al.longRTT += (sample - al.longRTT) / min(float64(al.samples+1), adaptiveLongWindow)
+	}
+	al.samples++
+
+	// Once latency recovers, pull the baseline down faster than its window would
+	if al.longRTT/al.shortRTT > 2 {
+		al.longRTT *= 0.95
+	}
+
+	// Latency measured far below the limit says nothing about how much more load the backend takes
+	if float64(al.inFlight) < al.limit/2 {
+		return
+	}
+
+	gradient := max(0.5, min(1.0, adaptiveTolerance*al.longRTT/al.shortRTT))
+	estimate := al.limit*gradient + math.Sqrt(al.limit)
+	limit := al.limit*(1-adaptiveSmoothing) + estimate*adaptiveSmoothing
+	al.limit = max(al.minLimit, min(al.maxLimit, limit))
+}
+
+// currentLimit returns the whole number of requests allowed in flight; it must be called with mu held
+func (al *AdaptiveLimiter) currentLimit() int {
+	return max(int(al.limit), 1)
+}
+
+// Stats returns the current limit, in-flight count and measured RTTs
+func (al *AdaptiveLimiter) Stats() AdaptiveStats {
+	if al == nil {
+		return AdaptiveStats{}
+	}
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	return AdaptiveStats{
+		Limit:       al.currentLimit(),
+		InFlight:    al.inFlight,
+		RTT:         time.Duration(al.shortRTT),
+		BaselineRTT: time.Duration(al.longRTT),
+	}
+}
+
+// Reset restores the initial limit and forgets all samples and in-flight requests for testing purposes
+func (al *AdaptiveLimiter) Reset() {
+	if al == nil {
+		return
+	}
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	al.limit = al.initialLimit
+	al.inFlight = 0
+	al.shortRTT, al.longRTT, al.samples = 0, 0, 0
+}
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"rate_limiter_service/internal/config"
+)
+
+func TestAdaptiveLimiter_Acquire(t *testing.T) {
+	al := NewAdaptiveLimiter(config.Config{AdaptiveInitialLimit: 2, AdaptiveMinLimit: 1, AdaptiveMaxLimit: 10})
+
+	first, ok := al.Acquire()
+	if !ok {
+		t.Fatal("First request should get a slot")
+	}
+	second, ok := al.Acquire()
+	if !ok {
+		t.Fatal("Second request should get a slot")
+	}
+	if _, ok := al.Acquire(); ok {
+		t.Fatal("Third request should be shed at the limit of 2")
+	}
+
+	// Ignoring a slot records no sample; releasing it twice gives back only one slot
+	first.Ignore()
+	first.Done()
+	if stats := al.Stats(); stats.InFlight != 1 || stats.RTT != 0 {
+		t.Errorf("Stats() = %+v, want 1 in flight and no RTT sample", stats)
+	}
+
+	second.Done()
+	if stats := al.Stats(); stats.InFlight != 0 || stats.RTT <= 0 {
+		t.Errorf("Stats() = %+v, want nothing in flight and an RTT sample", stats)
+	}
+}
+
+func TestAdaptiveLimiter_Nil(t *testing.T) {
+	var al *AdaptiveLimiter
+
+	slot, ok := al.Acquire()
+	if !ok {
+		t.Fatal("A nil limiter should admit every request")
+	}
+	slot.Start()
+	slot.Done()
+	slot.Ignore()
+	al.Reset()
+	if stats := al.Stats(); stats != (AdaptiveStats{}) {
+		t.Errorf("Stats() = %+v, want zero stats", stats)
+	}
+}
+
+func TestAdaptiveLimiter_Gradient(t *testing.T) {
+	tests := []struct {
+		name string
+		// rtts are the latencies fed to the limiter in order
+		rtts []time.Duration
+		// inFlight is the number of requests in flight while each sample is recorded
+		inFlight int
+		check    func(t *testing.T, limit int)
+	}{
+		{
+			name:     "steady latency grows the limit",
+			rtts:     repeatRTT(10*time.Millisecond, 50),
+			inFlight: 20,
+			check: func(t *testing.T, limit int) {
+				if limit <= 20 {
+					t.Errorf("Limit = %d, want more than the initial 20", limit)
+				}
+			},
+		},
+		{
+			name:     "rising latency shrinks the limit",
+			rtts:     append(repeatRTT(10*time.Millisecond, 100), repeatRTT(100*time.Millisecond, 50)...),
+			inFlight: 20,
+			check: func(t *testing.T, limit int) {
+				if limit >= 20 {
+					t.Errorf("Limit = %d, want less than the initial 20", limit)
+				}
+			},
+		},
+		{
+			name:     "limit grows up to the maximum",
+			rtts:     repeatRTT(10*time.Millisecond, 200),
+			inFlight: 40,
+			check: func(t *testing.T, limit int) {
+				if limit != 40 {
+					t.Errorf("Limit = %d, want the maximum of 40", limit)
+				}
+			},
+		},
+		{
+			name:     "limit shrinks down to the minimum",
+			rtts:     append(repeatRTT(10*time.Millisecond, 100), repeatRTT(time.Second, 60)...),
+			inFlight: 20,
+			check: func(t *testing.T, limit int) {
+				if limit != 5 {
+					t.Errorf("Limit = %d, want the minimum of 5", limit)
+				}
+			},
+		},
+		{
+			name:     "app-limited samples leave the limit alone",
+			rtts:     append(repeatRTT(10*time.Millisecond, 100), repeatRTT(100*time.Millisecond, 50)...),
+			inFlight: 2,
+			check: func(t *testing.T, limit int) {
+				if limit != 20 {
+					t.Errorf("Limit = %d, want the initial 20", limit)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			al := NewAdaptiveLimiter(config.Config{AdaptiveInitialLimit: 20, AdaptiveMinLimit: 5, AdaptiveMaxLimit: 40})
+			al.inFlight = tt.inFlight
+			for _, rtt := range tt.rtts {
+				al.update(rtt)
+			}
+			tt.check(t, al.Stats().Limit)
+		})
+	}
+}
+
+// repeatRTT returns n copies of the same latency sample
+func repeatRTT(rtt time.Duration, n int) []time.Duration {
+	rtts := make([]time.Duration, n)
+	for i := range rtts {
+		rtts[i] = rtt
+	}
+	return rtts
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"sync"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/ratelimit"
+)
+
+const (
+	// aggregateServiceKey is the key of the service-wide aggregate limits
+	aggregateServiceKey = "service"
+)
+
+// AggregateLimiterInterface defines the interface for limiters shared by all users
+type AggregateLimiterInterface interface {
+	// DecideHTTP charges an HTTP request costing n to the service-wide limits and those of its endpoint
+	DecideHTTP(endpointKey string, n int) ratelimit.Decision
+	// DecideGRPC charges a gRPC call costing n to the service-wide limits and those of its method
+	DecideGRPC(method string, n int) ratelimit.Decision
+	// Reset clears all aggregate state for testing purposes
+	Reset()
+}
+
+// AggregateLimiter enforces limits shared by all users in memory, with one token bucket per limit
+// Every request counts against the service-wide limits and against those of its HTTP endpoint or
+// gRPC method, regardless of who sent it
+type AggregateLimiter struct {
+	config config.Config
+
+	// mu serializes decisions so a request is charged to the service-wide and method limits or neither
+	mu sync.Mutex
+	// buckets are keyed by "service", "http:{endpoint key}" or "grpc:{method}"
+	buckets map[string]*MultiBucket
+}
+
+// NewAggregateLimiter creates a new in-memory aggregate limiter
+func NewAggregateLimiter(cfg config.Config) *AggregateLimiter {
+	return &AggregateLimiter{
+		config:  cfg,
+		buckets: make(map[string]*MultiBucket),
+	}
+}
+
+// DecideHTTP charges an HTTP request costing n to the service-wide limits and those of its endpoint
+// When the request is rejected, the decision names the limit that tripped
+func (al *AggregateLimiter) DecideHTTP(endpointKey string, n int) ratelimit.Decision {
+	return al.decide("http:"+endpointKey, al.config.GetHTTPMethodAggregateLimits(endpointKey), n)
+}
+
+// DecideGRPC charges a gRPC call costing n to the service-wide limits and those of its method
+// When the call is rejected, the decision names the limit that tripped
+func (al *AggregateLimiter) DecideGRPC(method string, n int) ratelimit.Decision {
+	return al.decide("grpc:"+method, al.config.GetGRPCMethodAggregateLimits(method), n)
+}
+
+// decide charges a request to the service-wide limits, then to the method limits stored under key
+// If the method limits reject it, the tokens taken from the service-wide limits are given back
+func (al *AggregateLimiter) decide(key string, limits []config.Limit, n int) ratelimit.Decision {
+	n = max(n, 1)
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	service := al.bucket(aggregateServiceKey, al.config.AggregateLimits)
+	if service != nil {
+		if d := service.DecideN(n); !d.Allowed {
+			return d
+		}
+	}
+
+	if method := al.bucket(key, limits); method != nil {
+		if d := method.DecideN(n); !d.Allowed {
+			if service != nil {
+				service.refund(n)
+			}
+			return d
+		}
+	}
+	return ratelimit.Allowed()
+}
+
+// bucket returns the bucket enforcing limits under key, creating it on first use
+// It returns nil if there are no limits; al.mu must be held
+func (al *AggregateLimiter) bucket(key string, limits []config.Limit) *MultiBucket {
+	if len(limits) == 0 {
+		return nil
+	}
+	bucket, exists := al.buckets[key]
+	if !exists {
+		bucket = NewMultiBucket(limits)
+		al.buckets[key] = bucket
+	}
+	return bucket
+}
+
+// Reset clears all aggregate state for testing purposes
+func (al *AggregateLimiter) Reset() {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	al.buckets = make(map[string]*MultiBucket)
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"rate_limiter_service/internal/config"
+)
+
+func TestAggregateLimiter_Decide(t *testing.T) {
+	cfg := config.Config{
+		AggregateLimits: []config.Limit{{Rate: 5, Period: time.Minute, Burst: 5}},
+		HTTPMethodAggregateLimits: map[string][]config.Limit{
+			"POST /api/users": {{Rate: 2, Period: time.Minute, Burst: 2}},
+		},
+		GRPCMethodAggregateLimits: map[string][]config.Limit{
+			"/UserService/CreateUser": {{Rate: 1, Period: time.Minute, Burst: 1}},
+		},
+	}
+	limiter := NewAggregateLimiter(cfg)
+
+	for i := 0; i < 2; i++ {
+		if d := limiter.DecideHTTP("POST:/api/users", 1); !d.Allowed {
+			t.Fatalf("Request %d should be allowed", i+1)
+		}
+	}
+	d := limiter.DecideHTTP("POST:/api/users", 1)
+	if d.Allowed || d.Limit.Rate != 2 {
+		t.Fatalf("Third request should trip the endpoint limit, got %+v", d)
+	}
+
+	// The rejected request gave its service-wide token back, so 3 remain for other methods
+	if d := limiter.DecideGRPC("/UserService/CreateUser", 1); !d.Allowed {
+		t.Fatal("gRPC call should be allowed")
+	}
+	for i := 0; i < 2; i++ {
+		if d := limiter.DecideHTTP("GET:/api/users", 1); !d.Allowed {
+			t.Fatalf("Unlimited endpoint request %d should be allowed", i+1)
+		}
+	}
+	d = limiter.DecideHTTP("GET:/api/users", 1)
+	if d.Allowed || d.Limit.Rate != 5 {
+		t.Errorf("Request beyond the service-wide limit should be rejected by it, got %+v", d)
+	}
+
+	limiter.Reset()
+	if d := limiter.DecideHTTP("POST:/api/users", 1); !d.Allowed {
+		t.Error("Request after Reset() should be allowed")
+	}
+}
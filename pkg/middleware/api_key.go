@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"rate_limiter_service/internal/config"
+)
+
+// errUnknownAPIKey is returned for API keys the store does not hold
+var errUnknownAPIKey = errors.New("unknown API key")
+
+// APIKeyStore holds the API keys of a keys file, see config.LoadAPIKeys
+// With a reload interval, the file is checked for changes at most once per interval as keys are
+// looked up, so keys can be issued and revoked without a restart; Reload reloads it on demand
+type APIKeyStore struct {
+	path           string
+	reloadInterval time.Duration
+
+	// mu protects keys
+	mu sync.RWMutex
+	// keys are keyed by the hex encoded SHA-256 hash of the API key
+	keys map[string]config.APIKey
+
+	// checkMu protects checkedAt and modTime
+	checkMu sync.Mutex
+	// checkedAt is when the file was last checked for changes
+	checkedAt time.Time
+	// modTime is the modification time of the file when it was last checked
+	modTime time.Time
+}
+
+// NewAPIKeyStore creates a store holding the given keys, already loaded from the file at path
+// A zero reload interval never reloads the file unless Reload is called
+func NewAPIKeyStore(path string, keys map[string]config.APIKey, reloadInterval time.Duration) *APIKeyStore {
+	return &APIKeyStore{
+		path:           path,
+		reloadInterval: reloadInterval,
+		keys:           keys,
+		checkedAt:      time.Now(),
+	}
+}
+
+// Lookup returns the identity an API key stands for, and false if the store does not hold the key
+func (s *APIKeyStore) Lookup(key string) (config.APIKey, bool) {
+	if s.reloadDue() {
+		if err := s.Reload(); err != nil {
+			log.Printf("api key store: %v", err)
+		}
+	}
+
+	hash := config.HashAPIKey(key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	apiKey, ok := s.keys[hash]
+	return apiKey, ok
+}
+
+// Reload replaces the keys with those of the file
+// If the file cannot be loaded, the keys held so far are kept and the error is returned
+func (s *APIKeyStore) Reload() error {
+	keys, err := config.LoadAPIKeys(s.path)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+	return nil
+}
+
+// reloadDue reports whether the reload interval has passed since the file was last checked and the
+// file has changed since
+func (s *APIKeyStore) reloadDue() bool {
+	if s.reloadInterval <= 0 {
+		return false
+	}
+
+	s.checkMu.Lock()
+	defer s.checkMu.Unlock()
+	now := time.Now()
+	if now.Sub(s.checkedAt) < s.reloadInterval {
+		return false
+	}
+	s.checkedAt = now
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		log.Printf("api key store: %v", err)
+		return false
+	}
+	if info.ModTime().Equal(s.modTime) {
+		return false
+	}
+	s.modTime = info.ModTime()
+	return true
+}
+
+// APIKeyExtractor identifies requests by the identity their API key stands for in Store
+// The key is read from Header, else from the query parameter Param, on HTTP and from MetadataKey
+// on gRPC; requests without a key are left unidentified, and unknown keys are treated as
+// OnInvalid says rather than rate limited as anonymous
+type APIKeyExtractor struct {
+	Store       *APIKeyStore
+	Header      string
+	Param       string
+	MetadataKey string
+	// OnInvalid is what to do with keys the store does not hold; empty rejects them
+	OnInvalid config.InvalidTokenTreatment
+}
+
+// ExtractHTTP returns the identity of the API key in the header or query parameter
+func (e APIKeyExtractor) ExtractHTTP(r *http.Request) (Identity, error) {
+	key := ""
+	if e.Header != "" {
+		key = strings.TrimSpace(r.Header.Get(e.Header))
+	}
+	if key == "" && e.Param != "" {
+		key = strings.TrimSpace(r.URL.Query().Get(e.Param))
+	}
+	return e.identify(key)
+}
+
+// ExtractGRPC returns the identity of the API key in the metadata key
+func (e APIKeyExtractor) ExtractGRPC(ctx context.Context) (Identity, error) {
+	return e.identify(metadataValue(ctx, e.MetadataKey))
+}
+
+// identify looks up an API key in the store
+func (e APIKeyExtractor) identify(key string) (Identity, error) {
+	if key == "" {
+		return Identity{}, nil
+	}
+	apiKey, ok := e.Store.Lookup(key)
+	if !ok {
+		if e.OnInvalid == config.InvalidTokenIgnore {
+			return Identity{}, nil
+		}
+		return Identity{}, errUnknownAPIKey
+	}
+	return Identity{Key: apiKey.Identity, Plan: apiKey.Plan}, nil
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+
+	"rate_limiter_service/internal/config"
+)
+
+func TestAPIKeyExtractor_ExtractHTTP(t *testing.T) {
+	keys := map[string]config.APIKey{
+		config.HashAPIKey("sk_live_acme"): {Identity: "partner-acme", Plan: "pro"},
+	}
+	extractor := APIKeyExtractor{
+		Store:  NewAPIKeyStore("", keys, 0),
+		Header: "X-API-Key",
+		Param:  "api_key",
+	}
+
+	tests := []struct {
+		name      string
+		target    string
+		header    string
+		onInvalid config.InvalidTokenTreatment
+		identity  Identity
+		hasError  bool
+	}{
+		{
+			name:     "header",
+			target:   "/api/users",
+			header:   "sk_live_acme",
+			identity: Identity{Key: "partner-acme", Plan: "pro"},
+		},
+		{
+			name:     "query parameter",
+			target:   "/api/users?api_key=sk_live_acme",
+			identity: Identity{Key: "partner-acme", Plan: "pro"},
+		},
+		{
+			name:     "header before query parameter",
+			target:   "/api/users?api_key=sk_live_unknown",
+			header:   "sk_live_acme",
+			identity: Identity{Key: "partner-acme", Plan: "pro"},
+		},
+		{
+			name:   "no key",
+			target: "/api/users",
+		},
+		{
+			name:     "unknown key",
+			target:   "/api/users",
+			header:   "sk_live_unknown",
+			hasError: true,
+		},
+		{
+			name:      "unknown key ignored",
+			target:    "/api/users",
+			header:    "sk_live_unknown",
+			onInvalid: config.InvalidTokenIgnore,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set("X-API-Key", tt.header)
+			}
+
+			extractor.OnInvalid = tt.onInvalid
+			identity, err := extractor.ExtractHTTP(req)
+			if (err != nil) != tt.hasError {
+				t.Fatalf("ExtractHTTP() error = %v, hasError %v", err, tt.hasError)
+			}
+			if identity != tt.identity {
+				t.Errorf("ExtractHTTP() = %+v, want %+v", identity, tt.identity)
+			}
+		})
+	}
+}
+
+func TestAPIKeyExtractor_ExtractGRPC(t *testing.T) {
+	keys := map[string]config.APIKey{config.HashAPIKey("sk_live_acme"): {Identity: "partner-acme"}}
+	extractor := APIKeyExtractor{Store: NewAPIKeyStore("", keys, 0), MetadataKey: "x-api-key"}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "sk_live_acme"))
+	if identity, err := extractor.ExtractGRPC(ctx); err != nil || identity.Key != "partner-acme" {
+		t.Errorf("ExtractGRPC() = %+v, %v, want partner-acme", identity, err)
+	}
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "sk_live_unknown"))
+	if _, err := extractor.ExtractGRPC(ctx); err == nil {
+		t.Error("ExtractGRPC() should reject an unknown key")
+	}
+}
+
+func TestAPIKeyStore_Reload(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "api_keys.yaml")
+	writeKeys := func(content string, modTime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(filePath, []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write keys file: %v", err)
+		}
+		if err := os.Chtimes(filePath, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set the modification time: %v", err)
+		}
+	}
+
+	start := time.Now().Add(-time.Hour)
+	writeKeys("keys:\n  - {key: sk_live_acme, identity: partner-acme}\n", start)
+	keys, err := config.LoadAPIKeys(filePath)
+	if err != nil {
+		t.Fatalf("Failed to load keys: %v", err)
+	}
+	store := NewAPIKeyStore(filePath, keys, time.Millisecond)
+
+	// Revoking the key and issuing another is picked up once the interval has passed
+	writeKeys("keys:\n  - {key: sk_live_globex, identity: partner-globex}\n", start.Add(time.Minute))
+	time.Sleep(2 * time.Millisecond)
+	if _, ok := store.Lookup("sk_live_acme"); ok {
+		t.Error("Revoked key should be unknown after a reload")
+	}
+	if apiKey, ok := store.Lookup("sk_live_globex"); !ok || apiKey.Identity != "partner-globex" {
+		t.Errorf("Lookup() = %+v, %v, want partner-globex", apiKey, ok)
+	}
+
+	// An invalid file keeps the keys loaded so far
+	writeKeys("keys:\n  - {key: sk_live_initech}\n", start.Add(2*time.Minute))
+	time.Sleep(2 * time.Millisecond)
+	if _, ok := store.Lookup("sk_live_globex"); !ok {
+		t.Error("Keys should be kept when the file cannot be loaded")
+	}
+	if err := store.Reload(); err == nil {
+		t.Error("Reload() should fail for an invalid file")
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"time"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/ratelimit"
+)
+
+// Bucket is the per-key state of an in-memory limiter
+// TokenBucket rejects requests when empty, LeakyBucket delays them to a constant outflow
+type Bucket interface {
+	// Allow admits one request, returning false if it is rate limited
+	Allow() bool
+	// AllowN admits a request costing n tokens, returning false if it is rate limited
+	AllowN(n int) bool
+	// AllowNWithReserve admits a request costing n tokens only if the reserved share of the
+	// capacity stays available for higher priority classes
+	AllowNWithReserve(n int, reserved float64) bool
+	// ReserveN grants n tokens ahead of time without blocking
+	ReserveN(n int) *ratelimit.Reservation
+	// GetTokens returns how many more requests can currently be admitted
+	GetTokens() int
+	// GetCapacity returns the maximum burst or queue size
+	GetCapacity() int
+	// Reset restores the bucket to its initial state
+	Reset()
+}
+
+// Ensure buckets implement Bucket
+var _ Bucket = (*TokenBucket)(nil)
+var _ Bucket = (*LeakyBucket)(nil)
+
+// NewBucket creates a bucket for the given tier algorithm allowing rate requests per period
+// An empty or unknown algorithm selects the token bucket
+func NewBucket(algorithm config.Algorithm, capacity int, rate int, period time.Duration) Bucket {
+	if algorithm == config.AlgorithmLeakyBucket {
+		return NewLeakyBucketWithPeriod(capacity, rate, period)
+	}
+	return NewTokenBucketWithPeriod(capacity, rate, period)
+}
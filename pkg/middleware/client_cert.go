@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	"rate_limiter_service/internal/config"
+)
+
+// ClientCertExtractor identifies the callers of mutual TLS connections by their client certificate,
+// so that internal services are limited by who they are rather than by a header they could set
+// Only certificates the TLS handshake verified are read; plain connections and connections whose
+// client certificate was not verified are left unidentified
+type ClientCertExtractor struct {
+	// Sources are the certificate fields tried in order; empty means config.DefaultClientCertSources
+	Sources []config.ClientCertSource
+	// TrustDomain is the only SPIFFE trust domain accepted, e.g. "example.org"; empty accepts any
+	TrustDomain string
+}
+
+// ExtractHTTP returns the identity of the client certificate of the request's connection
+func (e ClientCertExtractor) ExtractHTTP(r *http.Request) (Identity, error) {
+	return Identity{Key: e.certKey(r.TLS)}, nil
+}
+
+// ExtractGRPC returns the identity of the client certificate of the call's connection
+func (e ClientCertExtractor) ExtractGRPC(ctx context.Context) (Identity, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return Identity{}, nil
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return Identity{}, nil
+	}
+	return Identity{Key: e.certKey(&tlsInfo.State)}, nil
+}
+
+// certKey returns the key of the verified client certificate of a connection, or ""
+func (e ClientCertExtractor) certKey(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+	cert := state.PeerCertificates[0]
+
+	sources := e.Sources
+	if len(sources) == 0 {
+		sources = config.DefaultClientCertSources
+	}
+	for _, source := range sources {
+		if key := e.sourceKey(cert, source); key != "" {
+			return key
+		}
+	}
+	return ""
+}
+
+// sourceKey returns a field of the certificate, or "" if the certificate does not have it
+func (e ClientCertExtractor) sourceKey(cert *x509.Certificate, source config.ClientCertSource) string {
+	switch source {
+	case config.ClientCertSPIFFE:
+		for _, uri := range cert.URIs {
+			if !strings.EqualFold(uri.Scheme, "spiffe") || uri.Host == "" {
+				continue
+			}
+			if e.TrustDomain != "" && !strings.EqualFold(uri.Host, e.TrustDomain) {
+				continue
+			}
+			return uri.String()
+		}
+	case config.ClientCertDNS:
+		if len(cert.DNSNames) > 0 {
+			return strings.ToLower(cert.DNSNames[0])
+		}
+	case config.ClientCertCN:
+		return strings.TrimSpace(cert.Subject.CommonName)
+	}
+	return ""
+}
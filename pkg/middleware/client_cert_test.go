@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	"rate_limiter_service/internal/config"
+)
+
+// verifiedState returns the state of a mutual TLS connection whose client presented cert
+func verifiedState(cert *x509.Certificate) *tls.ConnectionState {
+	return &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+}
+
+func TestClientCertExtractor_ExtractHTTP(t *testing.T) {
+	billing := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "billing"},
+		DNSNames: []string{"Billing.Internal.Example.org", "billing"},
+		URIs: []*url.URL{
+			{Scheme: "https", Host: "example.org"},
+			{Scheme: "spiffe", Host: "example.org", Path: "/ns/prod/sa/billing"},
+		},
+	}
+	legacy := &x509.Certificate{Subject: pkix.Name{CommonName: "legacy-batch"}}
+
+	tests := []struct {
+		name      string
+		extractor ClientCertExtractor
+		state     *tls.ConnectionState
+		expected  string
+	}{
+		{
+			name:     "SPIFFE ID by default",
+			state:    verifiedState(billing),
+			expected: "spiffe://example.org/ns/prod/sa/billing",
+		},
+		{
+			name:      "DNS SAN",
+			extractor: ClientCertExtractor{Sources: []config.ClientCertSource{config.ClientCertDNS}},
+			state:     verifiedState(billing),
+			expected:  "billing.internal.example.org",
+		},
+		{
+			name:      "common name",
+			extractor: ClientCertExtractor{Sources: []config.ClientCertSource{config.ClientCertCN}},
+			state:     verifiedState(billing),
+			expected:  "billing",
+		},
+		{
+			name:     "falling back to the common name",
+			state:    verifiedState(legacy),
+			expected: "legacy-batch",
+		},
+		{
+			name: "SPIFFE ID of another trust domain",
+			extractor: ClientCertExtractor{
+				Sources:     []config.ClientCertSource{config.ClientCertSPIFFE},
+				TrustDomain: "partner.example",
+			},
+			state:    verifiedState(billing),
+			expected: "",
+		},
+		{
+			name:     "unverified certificate",
+			state:    &tls.ConnectionState{PeerCertificates: []*x509.Certificate{billing}},
+			expected: "",
+		},
+		{
+			name:     "plain connection",
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/users", nil)
+			req.TLS = tt.state
+
+			identity, err := tt.extractor.ExtractHTTP(req)
+			if err != nil || identity.Key != tt.expected {
+				t.Errorf("ExtractHTTP() = %+v, %v, want %q", identity, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClientCertExtractor_ExtractGRPC(t *testing.T) {
+	cert := &x509.Certificate{
+		URIs: []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/ns/prod/sa/billing"}},
+	}
+	remote := &net.TCPAddr{IP: net.ParseIP("10.0.0.7"), Port: 50051}
+	extractor := ClientCertExtractor{TrustDomain: "example.org"}
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr:     remote,
+		AuthInfo: credentials.TLSInfo{State: *verifiedState(cert)},
+	})
+	identity, err := extractor.ExtractGRPC(ctx)
+	if err != nil || identity.Key != "spiffe://example.org/ns/prod/sa/billing" {
+		t.Errorf("ExtractGRPC() = %+v, %v, want the SPIFFE ID", identity, err)
+	}
+
+	// Calls over plain connections are left unidentified
+	ctx = peer.NewContext(context.Background(), &peer.Peer{Addr: remote})
+	if identity, err := extractor.ExtractGRPC(ctx); err != nil || identity.Key != "" {
+		t.Errorf("ExtractGRPC() = %+v, %v, want an empty identity", identity, err)
+	}
+}
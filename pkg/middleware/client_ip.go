@@ -0,0 +1,192 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"rate_limiter_service/internal/config"
+)
+
+// ClientIPExtractor identifies requests by the IP address of the client, so that unauthenticated
+// callers are limited one by one rather than sharing the anonymous key
+// The address comes from RemoteAddr for HTTP and from the peer for gRPC; only when that address
+// belongs to a trusted proxy is the forwarding header the proxies write (or the metadata key of
+// the same name) believed, walking the proxy chain from the nearest hop until an untrusted address
+// Other forwarding headers are ignored, as the client may have set them
+// IPv6 addresses are grouped by IPv6PrefixLength, so a host cannot evade its limits by rotating
+// through the addresses of its network
+type ClientIPExtractor struct {
+	// TrustedProxies are the networks whose forwarding headers are believed
+	TrustedProxies []netip.Prefix
+	// Header is the forwarding header the trusted proxies write; empty means X-Forwarded-For
+	Header config.ForwardedHeader
+	// IPv6PrefixLength is the prefix IPv6 clients are grouped by; zero means /64 and 128 keeps every
+	// address apart
+	IPv6PrefixLength int
+}
+
+// ExtractHTTP returns the client address of the request
+func (e ClientIPExtractor) ExtractHTTP(r *http.Request) (Identity, error) {
+	key := e.clientKey(parseHostAddr(r.RemoteAddr), func(name string) []string {
+		return r.Header.Values(name)
+	})
+	return Identity{Key: key}, nil
+}
+
+// ExtractGRPC returns the client address of the call
+func (e ClientIPExtractor) ExtractGRPC(ctx context.Context) (Identity, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return Identity{}, nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	return Identity{Key: e.clientKey(parseHostAddr(p.Addr.String()), md.Get)}, nil
+}
+
+// clientKey returns the key of the client behind the directly connected remote address, reading
+// forwarding headers through header
+func (e ClientIPExtractor) clientKey(remote netip.Addr, header func(name string) []string) string {
+	if !remote.IsValid() {
+		return ""
+	}
+
+	client := remote
+	if e.isTrusted(remote) {
+		client = e.forwardedClient(remote, header)
+	}
+	return e.key(client)
+}
+
+// forwardedClient returns the client address given by the forwarding header of the trusted
+// proxies, or the remote address if the header is not set or its nearest hop cannot be parsed
+func (e ClientIPExtractor) forwardedClient(remote netip.Addr, header func(name string) []string) netip.Addr {
+	var hops []netip.Addr
+	switch e.Header {
+	case config.ForwardedHeaderForwarded:
+		hops = parseForwarded(header("Forwarded"))
+	case config.ForwardedHeaderXRealIP:
+		hops = parseRealIP(header("X-Real-IP"))
+	default:
+		hops = parseForwardedFor(header("X-Forwarded-For"))
+	}
+	if len(hops) == 0 {
+		return remote
+	}
+	return e.lastUntrusted(hops)
+}
+
+// lastUntrusted walks the hops a request went through from the nearest to the client, and
+// returns the first one that is not a trusted proxy, or the farthest hop if all of them are
+// Hops nearer than the first untrusted one were added by trusted proxies; farther ones were sent by
+// the client and may be forged
+func (e ClientIPExtractor) lastUntrusted(hops []netip.Addr) netip.Addr {
+	for i := len(hops) - 1; i > 0; i-- {
+		if !e.isTrusted(hops[i]) {
+			return hops[i]
+		}
+	}
+	return hops[0]
+}
+
+// isTrusted reports whether addr belongs to a trusted proxy
+func (e ClientIPExtractor) isTrusted(addr netip.Addr) bool {
+	for _, proxy := range e.TrustedProxies {
+		if proxy.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// key formats the client address, grouping IPv6 addresses by their prefix, e.g. "2001:db8:1:2::/64"
+func (e ClientIPExtractor) key(addr netip.Addr) string {
+	prefixLength := e.IPv6PrefixLength
+	if prefixLength == 0 {
+		prefixLength = config.DefaultIPv6PrefixLength
+	}
+	if addr.Is6() && prefixLength < 128 {
+		if prefix, err := addr.Prefix(prefixLength); err == nil {
+			return prefix.String()
+		}
+	}
+	return addr.String()
+}
+
+// parseForwarded parses the for parameters of RFC 7239 Forwarded headers, e.g.
+// `for=192.0.2.60;proto=http, for="[2001:db8::1]:4711"`, see validHops
+// Elements without a usable for parameter, such as obfuscated or unknown ones, cannot be parsed
+func parseForwarded(values []string) []netip.Addr {
+	return validHops(values, func(element string) netip.Addr {
+		var hop netip.Addr
+		for _, pair := range strings.Split(element, ";") {
+			name, node, found := strings.Cut(strings.TrimSpace(pair), "=")
+			if found && strings.EqualFold(name, "for") {
+				hop = parseHostAddr(strings.Trim(node, `"`))
+			}
+		}
+		return hop
+	})
+}
+
+// parseForwardedFor parses X-Forwarded-For headers, e.g. "203.0.113.7, 10.0.0.2", see validHops
+func parseForwardedFor(values []string) []netip.Addr {
+	return validHops(values, func(node string) netip.Addr {
+		return parseHostAddr(strings.TrimSpace(node))
+	})
+}
+
+// parseRealIP parses the X-Real-IP header, a single address the proxy overwrites; if the header is
+// set more than once, the last value is the one the nearest proxy set
+func parseRealIP(values []string) []netip.Addr {
+	if len(values) == 0 {
+		return nil
+	}
+	if addr := parseHostAddr(strings.TrimSpace(values[len(values)-1])); addr.IsValid() {
+		return []netip.Addr{addr}
+	}
+	return nil
+}
+
+// validHops parses the comma-separated hops of forwarding headers from the nearest to the farthest,
+// stopping at the first hop that cannot be parsed; hops beyond it were not added by the proxies
+// the nearest hops came through, so they are dropped rather than the whole chain
+// The hops parsed are returned from the farthest to the nearest, as they appear in the header
+func validHops(values []string, parse func(node string) netip.Addr) []netip.Addr {
+	var nodes []string
+	for _, value := range values {
+		nodes = append(nodes, strings.Split(value, ",")...)
+	}
+
+	first := len(nodes)
+	hops := make([]netip.Addr, len(nodes))
+	for first > 0 {
+		hop := parse(nodes[first-1])
+		if !hop.IsValid() {
+			break
+		}
+		first--
+		hops[first] = hop
+	}
+	return hops[first:]
+}
+
+// parseHostAddr parses an IP address with or without a port, e.g. "192.0.2.1:1234", "[::1]:80",
+// "[::1]" or "::1"; IPv4-mapped IPv6 addresses are returned as IPv4 and zones are dropped
+// It returns the zero Addr if s holds no IP address
+func parseHostAddr(s string) netip.Addr {
+	host := s
+	if h, _, err := net.SplitHostPort(s); err == nil {
+		host = h
+	}
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"))
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap().WithZone("")
+}
@@ -0,0 +1,203 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"rate_limiter_service/internal/config"
+)
+
+func TestClientIPExtractor_ExtractHTTP(t *testing.T) {
+	extractor := ClientIPExtractor{
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("fd00::/8")},
+	}
+
+	tests := []struct {
+		name       string
+		header     config.ForwardedHeader
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "203.0.113.7:51000",
+			expected:   "203.0.113.7",
+		},
+		{
+			name:       "forwarding headers from an untrusted client",
+			remoteAddr: "203.0.113.7:51000",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Real-IP": "198.51.100.2"},
+			expected:   "203.0.113.7",
+		},
+		{
+			name:       "X-Forwarded-For through trusted proxies",
+			remoteAddr: "10.0.0.1:443",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.7, 10.0.0.2"},
+			expected:   "203.0.113.7",
+		},
+		{
+			name:       "X-Forwarded-For of trusted proxies only",
+			remoteAddr: "10.0.0.1:443",
+			headers:    map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"},
+			expected:   "10.0.0.3",
+		},
+		{
+			name:       "Forwarded set by the client is ignored",
+			remoteAddr: "10.0.0.1:443",
+			headers:    map[string]string{"Forwarded": "for=198.51.100.77", "X-Forwarded-For": "203.0.113.9"},
+			expected:   "203.0.113.9",
+		},
+		{
+			name:       "unparseable hop set by the client",
+			remoteAddr: "10.0.0.1:443",
+			headers:    map[string]string{"X-Forwarded-For": "garbage, 203.0.113.9", "X-Real-IP": "198.51.100.78"},
+			expected:   "203.0.113.9",
+		},
+		{
+			name:       "unparseable hop behind trusted proxies",
+			remoteAddr: "10.0.0.1:443",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1, garbage, 10.0.0.2"},
+			expected:   "10.0.0.2",
+		},
+		{
+			name:       "unparseable nearest hop",
+			remoteAddr: "10.0.0.1:443",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1, garbage"},
+			expected:   "10.0.0.1",
+		},
+		{
+			name:       "Forwarded",
+			header:     config.ForwardedHeaderForwarded,
+			remoteAddr: "10.0.0.1:443",
+			headers: map[string]string{
+				"Forwarded":       `for=192.0.2.60;proto=http, for="[2001:db8:1:2::1]:4711"`,
+				"X-Forwarded-For": "198.51.100.1",
+			},
+			expected: "2001:db8:1:2::/64",
+		},
+		{
+			name:       "obfuscated Forwarded hop set by the client",
+			header:     config.ForwardedHeaderForwarded,
+			remoteAddr: "10.0.0.1:443",
+			headers:    map[string]string{"Forwarded": "for=198.51.100.1, for=_hidden, for=203.0.113.7"},
+			expected:   "203.0.113.7",
+		},
+		{
+			name:       "obfuscated Forwarded does not fall back to X-Forwarded-For",
+			header:     config.ForwardedHeaderForwarded,
+			remoteAddr: "10.0.0.1:443",
+			headers:    map[string]string{"Forwarded": "for=_hidden", "X-Forwarded-For": "198.51.100.1"},
+			expected:   "10.0.0.1",
+		},
+		{
+			name:       "X-Real-IP",
+			header:     config.ForwardedHeaderXRealIP,
+			remoteAddr: "10.0.0.1:443",
+			headers:    map[string]string{"X-Real-IP": "198.51.100.2", "X-Forwarded-For": "198.51.100.1"},
+			expected:   "198.51.100.2",
+		},
+		{
+			name:       "invalid X-Real-IP",
+			header:     config.ForwardedHeaderXRealIP,
+			remoteAddr: "10.0.0.1:443",
+			headers:    map[string]string{"X-Real-IP": "proxy.internal"},
+			expected:   "10.0.0.1",
+		},
+		{
+			name:       "IPv6 client grouped by /64",
+			remoteAddr: "[2001:db8:1:2:aaaa:bbbb:cccc:dddd]:51000",
+			expected:   "2001:db8:1:2::/64",
+		},
+		{
+			name:       "IPv4-mapped IPv6 client",
+			remoteAddr: "[::ffff:203.0.113.7]:51000",
+			expected:   "203.0.113.7",
+		},
+		{
+			name:       "unparseable remote address",
+			remoteAddr: "pipe",
+			expected:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/users", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			extractor.Header = tt.header
+			if identity, err := extractor.ExtractHTTP(req); err != nil || identity.Key != tt.expected {
+				t.Errorf("ExtractHTTP() = %+v, %v, want key %q", identity, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClientIPExtractor_IPv6PrefixLength(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/users", nil)
+	req.RemoteAddr = "[2001:db8:1:2:aaaa:bbbb:cccc:dddd]:51000"
+
+	tests := []struct {
+		prefixLength int
+		expected     string
+	}{
+		{prefixLength: 0, expected: "2001:db8:1:2::/64"},
+		{prefixLength: 48, expected: "2001:db8:1::/48"},
+		{prefixLength: 128, expected: "2001:db8:1:2:aaaa:bbbb:cccc:dddd"},
+	}
+
+	for _, tt := range tests {
+		extractor := ClientIPExtractor{IPv6PrefixLength: tt.prefixLength}
+		if identity, _ := extractor.ExtractHTTP(req); identity.Key != tt.expected {
+			t.Errorf("ExtractHTTP() with prefix length %d = %q, want %q", tt.prefixLength, identity.Key, tt.expected)
+		}
+	}
+}
+
+func TestClientIPExtractor_ExtractGRPC(t *testing.T) {
+	extractor := ClientIPExtractor{TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+	withPeer := func(addr string, md metadata.MD) context.Context {
+		remote := net.TCPAddrFromAddrPort(netip.MustParseAddrPort(addr))
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: remote})
+		return metadata.NewIncomingContext(ctx, md)
+	}
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		expected string
+	}{
+		{
+			name:     "direct client",
+			ctx:      withPeer("203.0.113.7:51000", metadata.Pairs("x-forwarded-for", "198.51.100.1")),
+			expected: "203.0.113.7",
+		},
+		{
+			name:     "trusted proxy",
+			ctx:      withPeer("10.0.0.1:443", metadata.Pairs("x-forwarded-for", "198.51.100.1")),
+			expected: "198.51.100.1",
+		},
+		{
+			name:     "no peer",
+			ctx:      context.Background(),
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if identity, err := extractor.ExtractGRPC(tt.ctx); err != nil || identity.Key != tt.expected {
+				t.Errorf("ExtractGRPC() = %+v, %v, want key %q", identity, err, tt.expected)
+			}
+		})
+	}
+}
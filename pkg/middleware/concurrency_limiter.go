@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"sync"
+
+	"rate_limiter_service/internal/config"
+)
+
+const (
+	// ConcurrencyScopeGlobal is the per-user ceiling across all requests
+	ConcurrencyScopeGlobal = "global"
+	// ConcurrencyScopeHTTP is the per-user ceiling across HTTP requests
+	ConcurrencyScopeHTTP = "http"
+	// ConcurrencyScopeGRPC is the per-user ceiling across gRPC calls
+	ConcurrencyScopeGRPC = "grpc"
+	// ConcurrencyScopeMethod is the per-user ceiling of a single HTTP endpoint or gRPC method
+	ConcurrencyScopeMethod = "per-method"
+)
+
+// Ceiling is the maximum number of requests in flight at once for one key
+type Ceiling struct {
+	// Scope names the ceiling in rejections, e.g. "per-method"
+	Scope string
+	// Key identifies the counter, e.g. "per-method:user123:GET:/api/reports"
+	Key string
+	// Max is the maximum number of requests in flight; zero or less means unlimited
+	Max int
+}
+
+// ConcurrencyLimiter caps the number of requests each user may have in flight at once
+// Unlike rate limiters it counts requests between Acquire and release, so it suits slow
+// endpoints where requests per second is the wrong control
+// State is kept in memory, so ceilings apply per instance
+type ConcurrencyLimiter struct {
+	// config holds the concurrency ceilings
+	config config.Config
+
+	// mu protects inFlight
+	mu sync.Mutex
+
+	// inFlight counts the requests holding a slot, keyed by Ceiling.Key
+	// Keys are removed when their count drops to zero
+	inFlight map[string]int
+}
+
+// NewConcurrencyLimiter creates a new concurrency limiter
+// Share one limiter between the HTTP middleware and the gRPC interceptor to apply
+// the per-user ceiling across both protocols
+func NewConcurrencyLimiter(cfg config.Config) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		config:   cfg,
+		inFlight: make(map[string]int),
+	}
+}
+
+// HTTPCeilings returns the ceilings an HTTP request from the given user must fit under
+func (cl *ConcurrencyLimiter) HTTPCeilings(userID, method, path string) []Ceiling {
+	endpointKey := config.HTTPEndpointKey(method, path)
+	return []Ceiling{
+		{Scope: ConcurrencyScopeGlobal, Key: ConcurrencyScopeGlobal + ":" + userID, Max: cl.config.MaxConcurrent},
+		{Scope: ConcurrencyScopeHTTP, Key: ConcurrencyScopeHTTP + ":" + userID, Max: cl.config.HTTPMaxConcurrent},
+		{
+			Scope: ConcurrencyScopeMethod,
+			Key:   "http-method:" + userID + ":" + endpointKey,
+			Max:   cl.config.GetHTTPMethodMaxConcurrent(endpointKey),
+		},
+	}
+}
+
+// GRPCCeilings returns the ceilings a gRPC call from the given user must fit under
+func (cl *ConcurrencyLimiter) GRPCCeilings(userID, method string) []Ceiling {
+	return []Ceiling{
+		{Scope: ConcurrencyScopeGlobal, Key: ConcurrencyScopeGlobal + ":" + userID, Max: cl.config.MaxConcurrent},
+		{Scope: ConcurrencyScopeGRPC, Key: ConcurrencyScopeGRPC + ":" + userID, Max: cl.config.GRPCMaxConcurrent},
+		{
+			Scope: ConcurrencyScopeMethod,
+			Key:   "grpc-method:" + userID + ":" + method,
+			Max:   cl.config.GetGRPCMethodMaxConcurrent(method),
+		},
+	}
+}
+
+// Acquire takes a slot under every ceiling, or under none of them
+// On success it returns a release function that gives the slots back; calling it more than once
+// has no effect. If a ceiling is full, it returns nil and that ceiling
+func (cl *ConcurrencyLimiter) Acquire(ceilings ...Ceiling) (func(), *Ceiling) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	for i := range ceilings {
+		if c := &ceilings[i]; c.Max > 0 && cl.inFlight[c.Key] >= c.Max {
+			return nil, c
+		}
+	}
+
+	for _, c := range ceilings {
+		if c.Max > 0 {
+			cl.inFlight[c.Key]++
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { cl.release(ceilings) })
+	}, nil
+}
+
+// release gives back the slots taken by Acquire
+func (cl *ConcurrencyLimiter) release(ceilings []Ceiling) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	for _, c := range ceilings {
+		if c.Max <= 0 {
+			continue
+		}
+		if cl.inFlight[c.Key] <= 1 {
+			delete(cl.inFlight, c.Key)
+		} else {
+			cl.inFlight[c.Key]--
+		}
+	}
+}
+
+// InFlight returns the number of requests currently holding a slot under the given key
+func (cl *ConcurrencyLimiter) InFlight(key string) int {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.inFlight[key]
+}
+
+// Reset clears all in-flight counts for testing purposes
+func (cl *ConcurrencyLimiter) Reset() {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.inFlight = make(map[string]int)
+}
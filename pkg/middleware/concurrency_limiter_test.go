@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"testing"
+
+	"rate_limiter_service/internal/config"
+)
+
+func TestConcurrencyLimiter_Acquire(t *testing.T) {
+	cfg := config.Config{
+		MaxConcurrent:           3,
+		HTTPMethodMaxConcurrent: map[string]int{"GET /api/reports": 2},
+	}
+	cl := NewConcurrencyLimiter(cfg)
+
+	// Two report requests fill the per-method ceiling
+	var releases []func()
+	for i := 0; i < 2; i++ {
+		release, full := cl.Acquire(cl.HTTPCeilings("user123", "GET", "/api/reports")...)
+		if full != nil {
+			t.Fatalf("Request %d should get a slot, %s ceiling is full", i+1, full.Scope)
+		}
+		releases = append(releases, release)
+	}
+
+	if _, full := cl.Acquire(cl.HTTPCeilings("user123", "GET", "/api/reports")...); full == nil {
+		t.Fatal("Third report request should be rejected")
+	} else if full.Scope != ConcurrencyScopeMethod || full.Max != 2 {
+		t.Errorf("Rejected by %+v, want the per-method ceiling of 2", *full)
+	}
+
+	// Other endpoints only count against the per-user ceiling
+	release, full := cl.Acquire(cl.HTTPCeilings("user123", "GET", "/api/users")...)
+	if full != nil {
+		t.Fatalf("Request to another endpoint should get a slot, %s ceiling is full", full.Scope)
+	}
+	if _, full := cl.Acquire(cl.HTTPCeilings("user123", "GET", "/api/users")...); full == nil ||
+		full.Scope != ConcurrencyScopeGlobal {
+		t.Errorf("Fourth request should be rejected by the per-user ceiling, got %+v", full)
+	}
+
+	// Other users have their own slots
+	if _, full := cl.Acquire(cl.HTTPCeilings("user456", "GET", "/api/reports")...); full != nil {
+		t.Errorf("Another user should get a slot, %s ceiling is full", full.Scope)
+	}
+
+	// Releasing twice gives back only one slot
+	release()
+	release()
+	if inFlight := cl.InFlight("global:user123"); inFlight != 2 {
+		t.Errorf("InFlight() = %d, want 2", inFlight)
+	}
+
+	for _, release := range releases {
+		release()
+	}
+	if inFlight := cl.InFlight("global:user123"); inFlight != 0 {
+		t.Errorf("InFlight() after releasing all = %d, want 0", inFlight)
+	}
+}
+
+func TestConcurrencyLimiter_Unlimited(t *testing.T) {
+	cl := NewConcurrencyLimiter(config.Config{})
+
+	for i := 0; i < 100; i++ {
+		if _, full := cl.Acquire(cl.GRPCCeilings("user123", "/ReportService/Generate")...); full != nil {
+			t.Fatalf("Request %d should not be limited without ceilings", i+1)
+		}
+	}
+	if inFlight := cl.InFlight("global:user123"); inFlight != 0 {
+		t.Errorf("Unlimited ceilings should not be counted, got %d", inFlight)
+	}
+}
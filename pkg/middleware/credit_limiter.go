@@ -0,0 +1,254 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/ratelimit"
+)
+
+// CreditLimiterInterface defines the interface for prepaid credit limiters
+type CreditLimiterInterface interface {
+	// Charge draws a request costing n credits from the user's balance
+	Charge(userID string, n int) ratelimit.CreditDecision
+	// TopUp adds amount credits to the user's balance and returns the new balance
+	TopUp(userID string, amount int) (int, error)
+	// GetBalance returns the user's balance
+	GetBalance(userID string) int
+	// Reset clears all balances for testing purposes
+	Reset()
+	// Close persists outstanding balances and stops background work
+	Close() error
+}
+
+// CreditLimiter keeps per-user prepaid credit balances in memory
+// Balances never refill on their own; they only grow through TopUp
+// When config.CreditFile is set, balances are loaded from that file on start and written back
+// every config.CreditFlushInterval and on Close, so they survive restarts
+type CreditLimiter struct {
+	config config.Config
+
+	// mu protects balances and dirty
+	mu sync.Mutex
+	// balances are keyed by user ID
+	balances map[string]int
+	// dirty reports whether balances changed since they were last written to the file
+	dirty bool
+	// flushMu serializes writes to the file so an older snapshot never replaces a newer one
+	flushMu sync.Mutex
+
+	// stop ends the flush loop and done is closed once it has returned
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// refs counts the callers of OpenCreditLimiter sharing the limiter; it is protected by creditFilesMu
+	refs int
+}
+
+var (
+	// creditFilesMu protects creditFiles and the refs of the limiters in it
+	creditFilesMu sync.Mutex
+	// creditFiles holds the open credit limiters by credit file, so the HTTP middleware and the gRPC
+	// interceptor draw from the same balances and never overwrite each other's file
+	creditFiles = make(map[string]*CreditLimiter)
+)
+
+// NewCreditLimiter creates a new credit limiter, loading persisted balances from config.CreditFile
+// A missing file starts every balance at zero; a file that cannot be read or parsed is reported as
+// an error together with a limiter whose balances start at zero
+func NewCreditLimiter(cfg config.Config) (*CreditLimiter, error) {
+	cl := &CreditLimiter{
+		config:   cfg,
+		balances: make(map[string]int),
+	}
+	if cfg.CreditFile == "" {
+		return cl, nil
+	}
+
+	err := cl.load()
+	cl.stop = make(chan struct{})
+	cl.done = make(chan struct{})
+	go cl.flushLoop(cfg.GetCreditFlushInterval())
+	return cl, err
+}
+
+// OpenCreditLimiter returns the credit limiter persisting to config.CreditFile, creating it with
+// NewCreditLimiter on first use; later callers share it, and its file, until every caller has closed it
+// A load error is only reported to the caller that created the limiter; without a credit file every
+// call creates a new limiter
+func OpenCreditLimiter(cfg config.Config) (*CreditLimiter, error) {
+	if cfg.CreditFile == "" {
+		return NewCreditLimiter(cfg)
+	}
+
+	creditFilesMu.Lock()
+	defer creditFilesMu.Unlock()
+
+	path := filepath.Clean(cfg.CreditFile)
+	if cl, ok := creditFiles[path]; ok {
+		cl.refs++
+		return cl, nil
+	}
+	cl, err := NewCreditLimiter(cfg)
+	cl.refs = 1
+	creditFiles[path] = cl
+	return cl, err
+}
+
+// Charge draws a request costing n credits from the user's balance
+// A balance short of the cost is left untouched and the request is rejected
+func (cl *CreditLimiter) Charge(userID string, n int) ratelimit.CreditDecision {
+	n = max(n, 1)
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	balance := cl.balances[userID]
+	if balance < n {
+		return ratelimit.CreditInsufficient(balance, n)
+	}
+	cl.balances[userID] = balance - n
+	cl.dirty = true
+	return ratelimit.CreditCharged(balance-n, n)
+}
+
+// TopUp adds amount credits to the user's balance and returns the new balance
+func (cl *CreditLimiter) TopUp(userID string, amount int) (int, error) {
+	if amount <= 0 {
+		return 0, fmt.Errorf("top-up amount must be positive, got %d", amount)
+	}
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cl.balances[userID] += amount
+	cl.dirty = true
+	return cl.balances[userID], nil
+}
+
+// GetBalance returns the user's balance
+func (cl *CreditLimiter) GetBalance(userID string) int {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.balances[userID]
+}
+
+// Flush writes the balances to config.CreditFile if they changed since the last write
+func (cl *CreditLimiter) Flush() error {
+	if cl.config.CreditFile == "" {
+		return nil
+	}
+
+	cl.flushMu.Lock()
+	defer cl.flushMu.Unlock()
+
+	cl.mu.Lock()
+	if !cl.dirty {
+		cl.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(cl.balances)
+	cl.dirty = false
+	cl.mu.Unlock()
+
+	if err == nil {
+		err = writeFileAtomic(cl.config.CreditFile, data)
+	}
+	if err != nil {
+		// Try again on the next flush
+		cl.mu.Lock()
+		cl.dirty = true
+		cl.mu.Unlock()
+		return fmt.Errorf("failed to write credit file %q: %w", cl.config.CreditFile, err)
+	}
+	return nil
+}
+
+// load reads persisted balances from config.CreditFile
+func (cl *CreditLimiter) load() error {
+	// #nosec G304 - the credit file path comes from the service configuration
+	data, err := os.ReadFile(cl.config.CreditFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read credit file %q: %w", cl.config.CreditFile, err)
+	}
+
+	var balances map[string]int
+	if err := json.Unmarshal(data, &balances); err != nil {
+		return fmt.Errorf("failed to parse credit file %q: %w", cl.config.CreditFile, err)
+	}
+	maps.Copy(cl.balances, balances)
+	return nil
+}
+
+// flushLoop writes the balances to the file every interval until Close is called
+func (cl *CreditLimiter) flushLoop(interval time.Duration) {
+	defer close(cl.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := cl.Flush(); err != nil {
+				log.Printf("credit limiter: %v", err)
+			}
+		case <-cl.stop:
+			return
+		}
+	}
+}
+
+// Close stops the flush loop and writes outstanding balances to the file
+// A limiter shared through OpenCreditLimiter only writes them and keeps flushing until its last
+// caller closes it
+func (cl *CreditLimiter) Close() error {
+	if cl.stop == nil {
+		return nil
+	}
+	if !cl.release() {
+		return cl.Flush()
+	}
+	cl.closeOnce.Do(func() {
+		close(cl.stop)
+		<-cl.done
+	})
+	return cl.Flush()
+}
+
+// release drops one caller of a limiter shared through OpenCreditLimiter and reports whether it
+// was the last one, removing the limiter from creditFiles if so
+func (cl *CreditLimiter) release() bool {
+	creditFilesMu.Lock()
+	defer creditFilesMu.Unlock()
+
+	if cl.refs > 1 {
+		cl.refs--
+		return false
+	}
+	cl.refs = 0
+	if path := filepath.Clean(cl.config.CreditFile); creditFiles[path] == cl {
+		delete(creditFiles, path)
+	}
+	return true
+}
+
+// Reset clears all balances for testing purposes
+func (cl *CreditLimiter) Reset() {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.balances = make(map[string]int)
+	cl.dirty = true
+}
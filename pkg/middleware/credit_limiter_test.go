@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"rate_limiter_service/internal/config"
+)
+
+func TestCreditLimiter_Charge(t *testing.T) {
+	cl, err := NewCreditLimiter(config.Config{ChargeCredits: true})
+	if err != nil {
+		t.Fatalf("NewCreditLimiter() error = %v", err)
+	}
+
+	// Users start without credits
+	if d := cl.Charge("user123", 1); d.Allowed || d.Balance != 0 || d.Cost != 1 {
+		t.Fatalf("Charge() without credits should be rejected, got %+v", d)
+	}
+
+	if balance, err := cl.TopUp("user123", 5); err != nil || balance != 5 {
+		t.Fatalf("TopUp() = %d, %v, want 5", balance, err)
+	}
+	if d := cl.Charge("user123", 3); !d.Allowed || d.Balance != 2 {
+		t.Fatalf("Charge(3) should leave 2 credits, got %+v", d)
+	}
+
+	// A request costing more than the balance is rejected without touching it
+	if d := cl.Charge("user123", 3); d.Allowed || d.Balance != 2 || d.Cost != 3 {
+		t.Errorf("Charge(3) over the balance should be rejected, got %+v", d)
+	}
+	if d := cl.Charge("user123", 2); !d.Allowed || d.Balance != 0 {
+		t.Errorf("Charge(2) should use up the balance, got %+v", d)
+	}
+
+	// Other users have their own balances
+	if balance := cl.GetBalance("user456"); balance != 0 {
+		t.Errorf("GetBalance() of another user = %d, want 0", balance)
+	}
+}
+
+func TestCreditLimiter_TopUpInvalidAmount(t *testing.T) {
+	cl, err := NewCreditLimiter(config.Config{ChargeCredits: true})
+	if err != nil {
+		t.Fatalf("NewCreditLimiter() error = %v", err)
+	}
+
+	for _, amount := range []int{0, -5} {
+		if _, err := cl.TopUp("user123", amount); err == nil {
+			t.Errorf("TopUp(%d) should be rejected", amount)
+		}
+	}
+	if balance := cl.GetBalance("user123"); balance != 0 {
+		t.Errorf("GetBalance() = %d, want 0", balance)
+	}
+}
+
+func TestCreditLimiter_Persistence(t *testing.T) {
+	cfg := config.Config{
+		ChargeCredits:       true,
+		CreditFile:          filepath.Join(t.TempDir(), "credits.json"),
+		CreditFlushInterval: time.Hour,
+	}
+
+	cl, err := NewCreditLimiter(cfg)
+	if err != nil {
+		t.Fatalf("NewCreditLimiter() error = %v", err)
+	}
+	if _, err := cl.TopUp("user123", 10); err != nil {
+		t.Fatalf("TopUp() error = %v", err)
+	}
+	cl.Charge("user123", 4)
+	if err := cl.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	data, err := os.ReadFile(cfg.CreditFile)
+	if err != nil {
+		t.Fatalf("Failed to read credit file: %v", err)
+	}
+	if want := `{"user123":6}`; string(data) != want {
+		t.Errorf("credit file = %s, want %s", data, want)
+	}
+
+	// A restarted limiter keeps the balances
+	restarted, err := NewCreditLimiter(cfg)
+	if err != nil {
+		t.Fatalf("NewCreditLimiter() after restart error = %v", err)
+	}
+	defer func() { _ = restarted.Close() }()
+
+	if balance := restarted.GetBalance("user123"); balance != 6 {
+		t.Errorf("GetBalance() after restart = %d, want 6", balance)
+	}
+}
+
+func TestOpenCreditLimiter_SharesFile(t *testing.T) {
+	cfg := config.Config{
+		ChargeCredits:       true,
+		CreditFile:          filepath.Join(t.TempDir(), "credits.json"),
+		CreditFlushInterval: time.Hour,
+	}
+
+	// The HTTP middleware and the gRPC interceptor open the same file and draw from the same balances
+	httpLimiter := NewLimiterFactory(cfg).CreateCreditLimiter()
+	grpcLimiter := NewLimiterFactory(cfg).CreateCreditLimiter()
+	if httpLimiter != grpcLimiter {
+		t.Fatal("CreateCreditLimiter() should share the limiter of a credit file")
+	}
+	if _, err := httpLimiter.TopUp("user123", 5); err != nil {
+		t.Fatalf("TopUp() error = %v", err)
+	}
+	grpcLimiter.Charge("user123", 2)
+
+	// Closing one side writes the balances but keeps the limiter open for the other
+	if err := httpLimiter.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	grpcLimiter.Charge("user123", 1)
+	if err := grpcLimiter.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	data, err := os.ReadFile(cfg.CreditFile)
+	if err != nil {
+		t.Fatalf("Failed to read credit file: %v", err)
+	}
+	if want := `{"user123":2}`; string(data) != want {
+		t.Errorf("credit file = %s, want %s", data, want)
+	}
+
+	// Once every caller has closed it, the next one loads the file afresh
+	reopened, err := OpenCreditLimiter(cfg)
+	if err != nil {
+		t.Fatalf("OpenCreditLimiter() error = %v", err)
+	}
+	defer func() { _ = reopened.Close() }()
+	if reopened == grpcLimiter {
+		t.Error("OpenCreditLimiter() should not return a closed limiter")
+	}
+	if balance := reopened.GetBalance("user123"); balance != 2 {
+		t.Errorf("GetBalance() after reopening = %d, want 2", balance)
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"rate_limiter_service/pkg/ratelimit"
+)
+
+// Departures collects the departures traffic shaping tiers, such as leaky buckets, scheduled an
+// admitted request for, see ratelimit.Decision.Reservation
+// The request waits for them only once every check has admitted it, so a check that rejects it
+// later does not hold it in a queue first; a request that is not let through gives them back
+type Departures struct {
+	tiers     []string
+	decisions []ratelimit.Decision
+	// waited is set once the request has waited for every departure
+	waited bool
+}
+
+// Add records the departure of a tier's decision, if it has one, and returns the decision
+func (d *Departures) Add(tier string, decision ratelimit.Decision) ratelimit.Decision {
+	if decision.Allowed && decision.Reservation != nil {
+		d.tiers = append(d.tiers, tier)
+		d.decisions = append(d.decisions, decision)
+	}
+	return decision
+}
+
+// Pending reports whether the request still has to wait for a departure
+func (d *Departures) Pending() bool {
+	for _, decision := range d.decisions {
+		if decision.Reservation.Delay() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Wait blocks until every recorded departure has come or ctx is done
+// If ctx ends first, or its deadline falls before the last departure, every departure is given
+// back and the tier the request was still waiting for is returned with a rejecting decision
+func (d *Departures) Wait(ctx context.Context) (string, ratelimit.Decision, error) {
+	if len(d.decisions) == 0 {
+		d.waited = true
+		return "", ratelimit.Allowed(), nil
+	}
+
+	// The request is held up by the tier with the latest departure
+	last := 0
+	reservations := make([]*ratelimit.Reservation, len(d.decisions))
+	for i, decision := range d.decisions {
+		reservations[i] = decision.Reservation
+		if decision.Reservation.Delay() > d.decisions[last].Reservation.Delay() {
+			last = i
+		}
+	}
+	retryAt := time.Now().Add(d.decisions[last].Reservation.Delay())
+
+	if err := ratelimit.Wait(ctx, ratelimit.All(reservations...)); err != nil {
+		return d.tiers[last], ratelimit.RejectedUntil(d.decisions[last].Limit, retryAt), err
+	}
+	d.waited = true
+	return "", ratelimit.Allowed(), nil
+}
+
+// Cancel gives every recorded departure back, unless the request has waited for them
+func (d *Departures) Cancel() {
+	if d.waited {
+		return
+	}
+	for _, decision := range d.decisions {
+		decision.Reservation.Cancel()
+	}
+}
@@ -0,0 +1,115 @@
+package distributed
+
+import (
+	"log"
+	"time"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/memcache"
+	"rate_limiter_service/pkg/ratelimit"
+)
+
+const (
+	scopeAggregate = "aggregate"
+
+	// aggregateService is the target of the service-wide aggregate limits
+	aggregateService = "service"
+)
+
+// AggregateLimiter enforces limits shared by all users, counting requests across instances in Memcache
+// Every request counts against the service-wide limits and against those of its HTTP endpoint or
+// gRPC method, regardless of who sent it
+// Requests are counted in fixed windows when config.DistributedAlgorithm is fixed_window and in
+// sliding windows otherwise; GCRA would have every instance racing to compare-and-swap the same
+// few keys, while window counters only need increments
+//
+// Key format: {prefix}:aggregate:{target}:{identifier}:{window}, where target is "service", "http"
+// or "grpc", e.g. rate_limit:aggregate:service:1234 or rate_limit:aggregate:http:POST:/api/users:1234
+type AggregateLimiter struct {
+	windows *SlidingWindowLimiter
+
+	// sliding selects sliding-window counters over fixed-window counters
+	sliding bool
+}
+
+// NewAggregateLimiter creates a new distributed aggregate limiter
+func NewAggregateLimiter(client memcache.ClientInterface, cfg config.Config) *AggregateLimiter {
+	return &AggregateLimiter{
+		// The limits vary by target, so they are passed on each call rather than set here
+		windows: &SlidingWindowLimiter{CommonLimiter: NewCommonLimiter(client, cfg, scopeAggregate, 0, 0)},
+		sliding: cfg.DistributedAlgorithm != config.AlgorithmFixedWindow,
+	}
+}
+
+// DecideHTTP charges an HTTP request costing n to the service-wide limits and those of its endpoint
+// When the request is rejected, the decision names the limit that tripped
+func (al *AggregateLimiter) DecideHTTP(endpointKey string, n int) ratelimit.Decision {
+	return al.decide("http", endpointKey, al.windows.config.GetHTTPMethodAggregateLimits(endpointKey), n)
+}
+
+// DecideGRPC charges a gRPC call costing n to the service-wide limits and those of its method
+// When the call is rejected, the decision names the limit that tripped
+func (al *AggregateLimiter) DecideGRPC(method string, n int) ratelimit.Decision {
+	return al.decide("grpc", method, al.windows.config.GetGRPCMethodAggregateLimits(method), n)
+}
+
+// decide charges a request to the service-wide limits, then to the limits of the target's identifier
+// If the latter reject it, the service-wide counters are given back
+func (al *AggregateLimiter) decide(target, identifier string, limits []config.Limit, n int) ratelimit.Decision {
+	now := al.windows.now()
+
+	service := al.windows.config.AggregateLimits
+	if d := al.decideLimits(aggregateService, "", service, n, now); !d.Allowed {
+		return d
+	}
+
+	d := al.decideLimits(target, identifier, limits, n, now)
+	if !d.Allowed && len(service) > 0 {
+		releaseCounters(al.windows.client, al.windowKeys(aggregateService, "", service, now), requestCost(n))
+	}
+	return d
+}
+
+// decideLimits charges a request costing n to the window of every limit of the target's identifier
+// A Memcache failure is handled according to the configured failure mode
+func (al *AggregateLimiter) decideLimits(
+	target, identifier string,
+	limits []config.Limit,
+	n int,
+	now time.Time,
+) ratelimit.Decision {
+	if len(limits) == 0 {
+		return ratelimit.Allowed()
+	}
+
+	var tripped int
+	var err error
+	if al.sliding {
+		tripped, err = al.windows.decideKeysAt(target, identifier, limits, n, 0, now)
+	} else {
+		tripped, err = countWindows(
+			al.windows.client, al.windows.config, scopeAggregate, target, identifier, limits, requestCost(n), 0, now,
+		)
+	}
+	if err != nil {
+		log.Printf("memcache error updating %s %s counters: %v", scopeAggregate, target, err)
+		return failureDecision(al.windows.HandleFailure(), limits)
+	}
+	return decision(limits, tripped)
+}
+
+// windowKeys returns the keys of the current window of every limit of the target's identifier
+func (al *AggregateLimiter) windowKeys(target, identifier string, limits []config.Limit, now time.Time) []string {
+	keys := make([]string, len(limits))
+	for i, limit := range limits {
+		index := windowIndex(now, normalizePeriod(limit.Period))
+		keys[i] = al.windows.windowKeyAt(target, limitIdentifier(identifier, i, limit), index)
+	}
+	return keys
+}
+
+// Reset clears all aggregate state for testing purposes
+// For distributed limiters, this is a no-op since state is in Memcache
+func (al *AggregateLimiter) Reset() {
+	// No-op: distributed state is managed by Memcache
+}
@@ -0,0 +1,82 @@
+package distributed
+
+import (
+	"testing"
+	"time"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/memcache"
+)
+
+func TestAggregateLimiter_Decide(t *testing.T) {
+	algorithms := []config.Algorithm{config.AlgorithmFixedWindow, config.AlgorithmGCRA, config.AlgorithmSlidingWindow}
+
+	for _, algorithm := range algorithms {
+		t.Run(string(algorithm), func(t *testing.T) {
+			cfg := config.Config{
+				MemcacheKeyPrefix:    "rate_limit",
+				DistributedAlgorithm: algorithm,
+				AggregateLimits:      []config.Limit{{Rate: 5, Period: time.Minute, Burst: 5}},
+				HTTPMethodAggregateLimits: map[string][]config.Limit{
+					"POST /api/users": {{Rate: 2, Period: time.Minute, Burst: 2}},
+				},
+			}
+			client := memcache.NewMockClient()
+			clock := &fakeClock{now: time.Unix(6000, 0)}
+
+			// Two instances sharing Memcache share the limits
+			instances := make([]*AggregateLimiter, 2)
+			for i := range instances {
+				instances[i] = NewAggregateLimiter(client, cfg)
+				instances[i].windows.now = clock.Now
+			}
+
+			for i := 0; i < 2; i++ {
+				if d := instances[i].DecideHTTP("POST:/api/users", 1); !d.Allowed {
+					t.Fatalf("Request %d should be allowed", i+1)
+				}
+			}
+			d := instances[0].DecideHTTP("POST:/api/users", 1)
+			if d.Allowed || d.Limit.Rate != 2 {
+				t.Fatalf("Third request should trip the endpoint limit, got %+v", d)
+			}
+
+			// The rejected request gave its service-wide count back, so 3 remain for other methods
+			for i := 0; i < 3; i++ {
+				if d := instances[1].DecideGRPC("/UserService/GetUser", 1); !d.Allowed {
+					t.Fatalf("gRPC call %d should be allowed", i+1)
+				}
+			}
+			d = instances[0].DecideGRPC("/UserService/GetUser", 1)
+			if d.Allowed || d.Limit.Rate != 5 {
+				t.Errorf("Call beyond the service-wide limit should be rejected by it, got %+v", d)
+			}
+		})
+	}
+}
+
+func TestAggregateLimiter_FailureMode(t *testing.T) {
+	tests := []struct {
+		failureMode config.FailureMode
+		allowed     bool
+	}{
+		{config.FailureModeAllow, true},
+		{config.FailureModeDeny, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.failureMode), func(t *testing.T) {
+			cfg := config.Config{
+				MemcacheKeyPrefix:   "rate_limit",
+				MemcacheFailureMode: tt.failureMode,
+				AggregateLimits:     []config.Limit{{Rate: 5, Period: time.Minute, Burst: 5}},
+			}
+			client := memcache.NewMockClient()
+			_ = client.Close()
+
+			if d := NewAggregateLimiter(client, cfg).DecideHTTP("GET:/api/users", 1); d.Allowed != tt.allowed {
+				t.Errorf("DecideHTTP() allowed = %v, want %v", d.Allowed, tt.allowed)
+			}
+		})
+	}
+}
@@ -1,11 +1,18 @@
 package distributed
 
 import (
+	"errors"
 	"log"
 	"time"
 
 	"rate_limiter_service/internal/config"
 	"rate_limiter_service/pkg/memcache"
+	"rate_limiter_service/pkg/ratelimit"
+)
+
+const (
+	// maxReserveWindows bounds how many fixed windows ahead a reservation may be booked
+	maxReserveWindows = 8
 )
 
 // CommonLimiter provides common functionality for all distributed limiters
@@ -14,18 +21,47 @@ type CommonLimiter struct {
 	config config.Config
 	scope  string
 	rate   int
+	// window is the period the rate applies to, used as the fixed window length
+	window time.Duration
+	// limits are every limit the limiter enforces, starting with rate per window
+	limits []config.Limit
+	// now returns the current time; overridden in tests
+	now func() time.Time
 }
 
-// NewCommonLimiter creates a new common limiter
-func NewCommonLimiter(client memcache.ClientInterface, cfg config.Config, scope string, rate int) *CommonLimiter {
+// NewCommonLimiter creates a new common limiter allowing rate requests per period
+// A zero period means one second
+func NewCommonLimiter(
+	client memcache.ClientInterface,
+	cfg config.Config,
+	scope string,
+	rate int,
+	period time.Duration,
+) *CommonLimiter {
 	return &CommonLimiter{
 		client: client,
 		config: cfg,
 		scope:  scope,
 		rate:   rate,
+		window: normalizePeriod(period),
+		limits: []config.Limit{{Rate: rate, Period: normalizePeriod(period), Burst: rate}},
+		now:    time.Now,
 	}
 }
 
+// newCommonLimiterForLimits creates a common limiter enforcing every one of limits
+// The first limit is the limiter's own rate; the others get their own counters
+func newCommonLimiterForLimits(
+	client memcache.ClientInterface,
+	cfg config.Config,
+	scope string,
+	limits []config.Limit,
+) *CommonLimiter {
+	cl := NewCommonLimiter(client, cfg, scope, limits[0].Rate, limits[0].Period)
+	cl.limits = limits
+	return cl
+}
+
 // GetClient returns the underlying Memcache client
 func (cl *CommonLimiter) GetClient() memcache.ClientInterface {
 	return cl.client
@@ -46,11 +82,25 @@ func (cl *CommonLimiter) GetRate() int {
 	return cl.rate
 }
 
+// GetLimits returns every limit the limiter enforces, starting with its own rate
+func (cl *CommonLimiter) GetLimits() []config.Limit {
+	return cl.limits
+}
+
+// GetWindowDuration returns the length of the fixed window the rate applies to
+func (cl *CommonLimiter) GetWindowDuration() time.Duration {
+	return cl.window
+}
+
+// GetWindowKey returns the Memcache key of the window containing the current time
+func (cl *CommonLimiter) GetWindowKey(userID, identifier string) string {
+	return cl.config.GetWindowMemcacheKey(cl.scope, userID, identifier, windowIndex(cl.now(), cl.window))
+}
+
 // GetExpiration returns the expiration time for Memcache keys
-// We add a small buffer to handle edge cases at window boundaries
+// Each key only serves one window, so it lives for the window plus a small buffer
 func (cl *CommonLimiter) GetExpiration() time.Duration {
-	// Use 2 seconds to allow for some buffer at window boundaries
-	return 2 * time.Second
+	return windowExpiration(cl.window)
 }
 
 // CheckRateLimit checks if count is within the rate limit
@@ -73,7 +123,228 @@ func (cl *CommonLimiter) HandleFailure() bool {
 	}
 }
 
+// FailureDecision returns the decision made when Memcache is unavailable,
+// following the configured failure mode
+func (cl *CommonLimiter) FailureDecision() ratelimit.Decision {
+	return failureDecision(cl.HandleFailure(), cl.limits)
+}
+
+// DecideWindows charges a request costing n tokens to the fixed window of every limit
+// When the request is rejected, the decision names the limit that tripped
+func (cl *CommonLimiter) DecideWindows(userID, identifier string, n int) ratelimit.Decision {
+	return cl.DecideWindowsWithReserve(userID, identifier, n, 0)
+}
+
+// DecideWindowsWithReserve charges a request like DecideWindows, but only admits it if the reserved
+// share of every limit's rate stays available in its window for higher priority classes
+func (cl *CommonLimiter) DecideWindowsWithReserve(
+	userID, identifier string,
+	n int,
+	reserved float64,
+) ratelimit.Decision {
+	tripped, err := countWindows(
+		cl.client, cl.config, cl.scope, userID, identifier, cl.limits, requestCost(n), reserved, cl.now(),
+	)
+	if err != nil {
+		// Handle Memcache failure based on failure mode
+		cl.LogError(userID, err)
+		return cl.FailureDecision()
+	}
+	return decision(cl.limits, tripped)
+}
+
+// RemainingInWindows returns how many requests every limit still admits in its current fixed window
+func (cl *CommonLimiter) RemainingInWindows(userID, identifier string) int {
+	remaining := -1
+	for i, limit := range cl.limits {
+		key := cl.config.GetWindowMemcacheKey(
+			cl.scope, userID, limitIdentifier(identifier, i, limit), windowIndex(cl.now(), normalizePeriod(limit.Period)),
+		)
+
+		limitRemaining := limit.Rate
+		if count, err := cl.client.Get(key); err != nil {
+			// On failure, count the limit at full capacity (conservative approach)
+			cl.LogError(userID, err)
+		} else {
+			limitRemaining = max(limit.Rate-int(count), 0)
+		}
+
+		if remaining < 0 || limitRemaining < remaining {
+			remaining = limitRemaining
+		}
+	}
+	return remaining
+}
+
+// FailureReservation returns the reservation granted when Memcache is unavailable,
+// following the configured failure mode
+func (cl *CommonLimiter) FailureReservation() *ratelimit.Reservation {
+	if cl.HandleFailure() {
+		return ratelimit.NewReservation(cl.now(), nil)
+	}
+	return ratelimit.NotGranted()
+}
+
+// ReserveWindow books n tokens for every limit in the first fixed window with room for them
+// The reservation's delay is the time until the last of those windows starts; cancelling it
+// gives the tokens back to the windows' counters
+func (cl *CommonLimiter) ReserveWindow(userID, identifier string, n int) *ratelimit.Reservation {
+	reservations := make([]*ratelimit.Reservation, len(cl.limits))
+	for i, limit := range cl.limits {
+		reservations[i] = cl.reserveLimitWindow(userID, limitIdentifier(identifier, i, limit), limit, n)
+	}
+	return ratelimit.All(reservations...)
+}
+
+// reserveLimitWindow books n tokens in the first fixed window of limit with room for them
+func (cl *CommonLimiter) reserveLimitWindow(
+	userID, identifier string,
+	limit config.Limit,
+	n int,
+) *ratelimit.Reservation {
+	cost := requestCost(n)
+	if cost > uint64(limit.Rate) {
+		return ratelimit.NotGranted()
+	}
+
+	now := cl.now()
+	window := normalizePeriod(limit.Period)
+	index := windowIndex(now, window)
+
+	for ahead := int64(0); ahead < maxReserveWindows; ahead++ {
+		key := cl.config.GetWindowMemcacheKey(cl.scope, userID, identifier, index+ahead)
+
+		// The counter must live until the end of its window
+		expiration := windowExpiration(time.Duration(ahead+1) * window)
+		count, err := cl.client.IncrementWithExpiration(key, cost, expiration)
+		if err != nil {
+			cl.LogError(userID, err)
+			return cl.FailureReservation()
+		}
+
+		if count <= uint64(limit.Rate) {
+			timeToAct := now
+			if ahead > 0 {
+				timeToAct = time.Unix(0, (index+ahead)*int64(window))
+			}
+			return ratelimit.NewReservation(timeToAct, func() {
+				cl.releaseWindow(userID, key, cost)
+			})
+		}
+
+		// The window is full, give back the overshoot and try the next one
+		cl.releaseWindow(userID, key, cost)
+	}
+
+	return ratelimit.NotGranted()
+}
+
+// releaseWindow gives tokens back to a window counter
+// A counter that has already expired has nothing left to give back
+func (cl *CommonLimiter) releaseWindow(userID, key string, cost uint64) {
+	if _, err := cl.client.Decrement(key, cost); err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+		cl.LogError(userID, err)
+	}
+}
+
 // LogError logs a Memcache error with context
 func (cl *CommonLimiter) LogError(userID string, err error) {
 	log.Printf("memcache error incrementing %s counter for user %s: %v", cl.scope, userID, err)
 }
+
+// countWindows charges a request to the fixed window of every limit
+// It returns the index of the first limit whose window is over its rate less the reserved share,
+// or -1 if every limit admits the request; windows charged before the tripped limit are given back
+// since the request is rejected
+func countWindows(
+	client memcache.ClientInterface,
+	cfg config.Config,
+	scope, userID, identifier string,
+	limits []config.Limit,
+	cost uint64,
+	reserved float64,
+	now time.Time,
+) (int, error) {
+	charged := make([]string, 0, len(limits))
+	for i, limit := range limits {
+		window := normalizePeriod(limit.Period)
+		key := cfg.GetWindowMemcacheKey(scope, userID, limitIdentifier(identifier, i, limit), windowIndex(now, window))
+
+		count, err := client.IncrementWithExpiration(key, cost, windowExpiration(window))
+		if err != nil {
+			releaseCounters(client, charged, cost)
+			return -1, err
+		}
+		if count > uint64(limit.Rate-ratelimit.ReservedTokens(limit.Rate, reserved)) {
+			// The tripped window is given back too, so the rejected request leaves no trace
+			releaseCounters(client, append(charged, key), cost)
+			return i, nil
+		}
+		charged = append(charged, key)
+	}
+	return -1, nil
+}
+
+// releaseCounters gives a rejected request's cost back to the counters it was charged to
+func releaseCounters(client memcache.ClientInterface, keys []string, cost uint64) {
+	for _, key := range keys {
+		if _, err := client.Decrement(key, cost); err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+			log.Printf("memcache error releasing counter %s: %v", key, err)
+		}
+	}
+}
+
+// limitIdentifier returns the key identifier of the i-th limit of a rule
+// The first limit keeps the plain identifier, so single-limit rules use the same keys as before;
+// additional limits get their own counters, e.g. "GET:/api/users@500/m"
+func limitIdentifier(identifier string, i int, limit config.Limit) string {
+	if i == 0 {
+		return identifier
+	}
+	return identifier + "@" + limit.String()
+}
+
+// decision converts the index of the limit that tripped, or -1, into a Decision
+func decision(limits []config.Limit, tripped int) ratelimit.Decision {
+	if tripped < 0 {
+		return ratelimit.Allowed()
+	}
+	return ratelimit.Rejected(limits[tripped])
+}
+
+// failureDecision returns the decision for a rule when Memcache is unavailable
+// A denied request is attributed to the rule's first limit
+func failureDecision(allow bool, limits []config.Limit) ratelimit.Decision {
+	if allow {
+		return ratelimit.Allowed()
+	}
+	return ratelimit.Rejected(limits[0])
+}
+
+// windowIndex returns the index of the fixed window containing t
+// Windows are aligned to the Unix epoch so every instance computes the same boundaries
+func windowIndex(t time.Time, window time.Duration) int64 {
+	return t.UnixNano() / int64(window)
+}
+
+// windowExpiration returns the TTL for a key holding a single window's counter
+// Memcache expirations have one-second granularity, so round up and add a second of slack
+func windowExpiration(window time.Duration) time.Duration {
+	return (window + time.Second - 1).Truncate(time.Second) + time.Second
+}
+
+// normalizePeriod treats a zero period as one second, matching config defaults
+func normalizePeriod(period time.Duration) time.Duration {
+	if period <= 0 {
+		return time.Second
+	}
+	return period
+}
+
+// requestCost converts a request cost into a counter increment, treating non-positive costs as 1
+func requestCost(n int) uint64 {
+	if n <= 0 {
+		return 1
+	}
+	return uint64(n)
+}
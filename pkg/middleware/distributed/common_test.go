@@ -0,0 +1,284 @@
+package distributed
+
+import (
+	"testing"
+	"time"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/memcache"
+	"rate_limiter_service/pkg/ratelimit"
+)
+
+func TestWindowIndex(t *testing.T) {
+	tests := []struct {
+		name     string
+		time     time.Time
+		window   time.Duration
+		expected int64
+	}{
+		{
+			name:     "start of window",
+			time:     time.Unix(100, 0),
+			window:   time.Second,
+			expected: 100,
+		},
+		{
+			name:     "end of window",
+			time:     time.Unix(100, int64(999*time.Millisecond)),
+			window:   time.Second,
+			expected: 100,
+		},
+		{
+			name:     "ten second window",
+			time:     time.Unix(105, 0),
+			window:   10 * time.Second,
+			expected: 10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := windowIndex(tt.time, tt.window); result != tt.expected {
+				t.Errorf("windowIndex() = %d, want %d", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWindowExpiration(t *testing.T) {
+	tests := []struct {
+		window   time.Duration
+		expected time.Duration
+	}{
+		{window: time.Second, expected: 2 * time.Second},
+		{window: 1500 * time.Millisecond, expected: 3 * time.Second},
+		{window: time.Minute, expected: 61 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if result := windowExpiration(tt.window); result != tt.expected {
+			t.Errorf("windowExpiration(%v) = %v, want %v", tt.window, result, tt.expected)
+		}
+	}
+}
+
+func TestCommonLimiter_WindowsAreAligned(t *testing.T) {
+	mock := memcache.NewMockClient()
+	cfg := config.DefaultConfig()
+	cfg.GlobalRate = 2
+
+	limiter := NewGlobalLimiter(mock, cfg)
+	clock := &fakeClock{now: time.Unix(1000, int64(900*time.Millisecond))}
+	limiter.now = clock.Now
+
+	userID := "user123"
+
+	if key := limiter.GetWindowKey(userID, ""); key != "rate_limit:global:user123:1000" {
+		t.Errorf("GetWindowKey() = %q, want %q", key, "rate_limit:global:user123:1000")
+	}
+
+	// Use up the current window late in the second
+	for i := 0; i < 2; i++ {
+		if !limiter.Allow(userID) {
+			t.Errorf("Request %d should be allowed", i+1)
+		}
+	}
+	if limiter.Allow(userID) {
+		t.Error("Third request in the same window should be denied")
+	}
+
+	// The next window starts at the second boundary, not one second after the first request
+	clock.Advance(100 * time.Millisecond)
+	if remaining := limiter.GetRemainingTokens(userID); remaining != 2 {
+		t.Errorf("Remaining tokens in new window = %d, want 2", remaining)
+	}
+	if !limiter.Allow(userID) {
+		t.Error("Request in the next window should be allowed")
+	}
+}
+
+func TestGlobalLimiter_PeriodWindow(t *testing.T) {
+	mock := memcache.NewMockClient()
+	cfg := config.DefaultConfig()
+	cfg.GlobalRate = 3
+	cfg.GlobalPeriod = time.Minute
+
+	limiter := NewGlobalLimiter(mock, cfg)
+	clock := &fakeClock{now: time.Unix(6000, 0)} // start of a minute
+	limiter.now = clock.Now
+
+	if window := limiter.GetWindowDuration(); window != time.Minute {
+		t.Errorf("GetWindowDuration() = %v, want 1m", window)
+	}
+	if expiration := limiter.GetExpiration(); expiration != 61*time.Second {
+		t.Errorf("GetExpiration() = %v, want 61s", expiration)
+	}
+
+	userID := "user123"
+	for i := 0; i < 3; i++ {
+		if !limiter.Allow(userID) {
+			t.Errorf("Request %d should be allowed", i+1)
+		}
+	}
+
+	// The window lasts a minute, not a second
+	clock.Advance(30 * time.Second)
+	if limiter.Allow(userID) {
+		t.Error("Request within the same minute should be denied")
+	}
+
+	clock.Advance(30 * time.Second)
+	if !limiter.Allow(userID) {
+		t.Error("Request in the next minute should be allowed")
+	}
+}
+
+func TestPerEndpointGCRALimiter_MethodPeriod(t *testing.T) {
+	mock := memcache.NewMockClient()
+	cfg := config.DefaultConfig()
+	cfg.PerEndpointBurstSize = 1
+	cfg.HTTPMethods = map[string]int{"GET /api/reports": 2}
+	cfg.HTTPMethodPeriods = map[string]time.Duration{"GET /api/reports": time.Minute}
+
+	limiter := NewPerEndpointGCRALimiter(mock, cfg)
+	clock := newFakeClock()
+	limiter.now = clock.Now
+
+	if !limiter.Allow("user123", "GET", "/api/reports") {
+		t.Fatal("First request should be allowed")
+	}
+
+	// 2 per minute means one request every 30 seconds
+	clock.Advance(29 * time.Second)
+	if limiter.Allow("user123", "GET", "/api/reports") {
+		t.Error("Request before the emission interval should be denied")
+	}
+	clock.Advance(time.Second)
+	if !limiter.Allow("user123", "GET", "/api/reports") {
+		t.Error("Request after the emission interval should be allowed")
+	}
+}
+
+func TestGlobalLimiters_MultipleLimits(t *testing.T) {
+	perMinute := config.Limit{Rate: 2, Period: time.Minute, Burst: 2}
+
+	cfg := config.DefaultConfig()
+	cfg.GlobalRate = 3
+	cfg.GlobalBurstSize = 3
+	cfg.GlobalExtraLimits = []config.Limit{perMinute}
+
+	type decider interface {
+		Decide(userID string, n int) ratelimit.Decision
+		Allow(userID string) bool
+		GetRemainingTokens(userID string) int
+	}
+	// Each constructor returns the limiter and its clock, so the test can replace it
+	constructors := []struct {
+		name string
+		new  func(client memcache.ClientInterface, cfg config.Config) (decider, *func() time.Time)
+	}{
+		{"fixed window", func(client memcache.ClientInterface, cfg config.Config) (decider, *func() time.Time) {
+			l := NewGlobalLimiter(client, cfg)
+			return l, &l.now
+		}},
+		{"GCRA", func(client memcache.ClientInterface, cfg config.Config) (decider, *func() time.Time) {
+			l := NewGlobalGCRALimiter(client, cfg)
+			return l, &l.now
+		}},
+		{"sliding window", func(client memcache.ClientInterface, cfg config.Config) (decider, *func() time.Time) {
+			l := NewGlobalSlidingWindowLimiter(client, cfg)
+			return l, &l.now
+		}},
+	}
+
+	for _, c := range constructors {
+		t.Run(c.name, func(t *testing.T) {
+			mock := memcache.NewMockClient()
+			clock := &fakeClock{now: time.Unix(6000, 0)}
+
+			limiter, now := c.new(mock, cfg)
+			*now = clock.Now
+
+			for i := 0; i < 2; i++ {
+				if d := limiter.Decide("user123", 1); !d.Allowed {
+					t.Fatalf("Request %d should be allowed, rejected by %v", i+1, d.Limit)
+				}
+			}
+
+			// The per-second limit has room for a third request, the per-minute one does not
+			d := limiter.Decide("user123", 1)
+			if d.Allowed || d.Limit != perMinute {
+				t.Fatalf("Decide() = %+v, want rejection by %v", d, perMinute)
+			}
+			if remaining := limiter.GetRemainingTokens("user123"); remaining != 0 {
+				t.Errorf("GetRemainingTokens() = %d, want 0", remaining)
+			}
+
+			// The rejected request was not charged to the per-second limit
+			single := cfg
+			single.GlobalExtraLimits = nil
+			primary, primaryNow := c.new(mock, single)
+			*primaryNow = clock.Now
+			if !primary.Allow("user123") {
+				t.Error("Per-second limit should still have room for a third request")
+			}
+		})
+	}
+}
+
+func TestGlobalLimiters_DecideWithReserve(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.GlobalRate = 10
+	cfg.GlobalBurstSize = 10
+
+	type decider interface {
+		DecideWithReserve(userID string, n int, reserved float64) ratelimit.Decision
+	}
+	constructors := []struct {
+		name string
+		new  func(client memcache.ClientInterface, cfg config.Config) (decider, *func() time.Time)
+	}{
+		{"fixed window", func(client memcache.ClientInterface, cfg config.Config) (decider, *func() time.Time) {
+			l := NewGlobalLimiter(client, cfg)
+			return l, &l.now
+		}},
+		{"GCRA", func(client memcache.ClientInterface, cfg config.Config) (decider, *func() time.Time) {
+			l := NewGlobalGCRALimiter(client, cfg)
+			return l, &l.now
+		}},
+		{"sliding window", func(client memcache.ClientInterface, cfg config.Config) (decider, *func() time.Time) {
+			l := NewGlobalSlidingWindowLimiter(client, cfg)
+			return l, &l.now
+		}},
+	}
+
+	for _, c := range constructors {
+		t.Run(c.name, func(t *testing.T) {
+			mock := memcache.NewMockClient()
+			clock := &fakeClock{now: time.Unix(6000, 0)}
+
+			limiter, now := c.new(mock, cfg)
+			*now = clock.Now
+
+			// A class that must leave 30% of the limit stops at 7 requests
+			for i := 0; i < 7; i++ {
+				if d := limiter.DecideWithReserve("user123", 1, 0.3); !d.Allowed {
+					t.Fatalf("Low priority request %d should be allowed", i+1)
+				}
+			}
+			if d := limiter.DecideWithReserve("user123", 1, 0.3); d.Allowed {
+				t.Fatal("Low priority request 8 should be shed")
+			}
+
+			// The shed request was not charged, so the reserved share is intact for the top class
+			for i := 0; i < 3; i++ {
+				if d := limiter.DecideWithReserve("user123", 1, 0); !d.Allowed {
+					t.Fatalf("High priority request %d should use the reserve", i+1)
+				}
+			}
+			if d := limiter.DecideWithReserve("user123", 1, 0); d.Allowed {
+				t.Error("Requests beyond the limit should be rejected for every class")
+			}
+		})
+	}
+}
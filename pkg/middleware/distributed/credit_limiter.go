@@ -0,0 +1,149 @@
+package distributed
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/memcache"
+	"rate_limiter_service/pkg/ratelimit"
+)
+
+const (
+	scopeCredits = "credits"
+
+	// creditMaxRetries bounds the number of CAS attempts when instances race on the same balance
+	creditMaxRetries = 32
+)
+
+// CreditLimiter keeps per-user prepaid credit balances in Memcache
+// Balances are stored without an expiration and updated with gets/CAS, so a charge never takes a
+// balance below zero even when instances race
+// Memcache is their only store: a balance that is evicted, or lost when Memcache restarts, reads as
+// zero and must be topped up again from the system of record
+//
+// Key format: {prefix}:credits:{user_id}, e.g. rate_limit:credits:user123
+type CreditLimiter struct {
+	client memcache.ClientInterface
+	config config.Config
+}
+
+// NewCreditLimiter creates a new distributed credit limiter
+func NewCreditLimiter(client memcache.ClientInterface, cfg config.Config) *CreditLimiter {
+	return &CreditLimiter{
+		client: client,
+		config: cfg,
+	}
+}
+
+// Charge draws a request costing n credits from the user's balance
+// A balance short of the cost is left untouched and the request is rejected
+// Unlike the rate limiters, charges fail closed whatever the failure mode: a balance that cannot be
+// read or updated rejects the request, since credits are paid for and must not be given away
+func (cl *CreditLimiter) Charge(userID string, n int) ratelimit.CreditDecision {
+	cost := int(requestCost(n))
+
+	var decision ratelimit.CreditDecision
+	err := cl.update(userID, false, func(balance int) (int, bool) {
+		if balance < cost {
+			decision = ratelimit.CreditInsufficient(balance, cost)
+			return balance, false
+		}
+		decision = ratelimit.CreditCharged(balance-cost, cost)
+		return balance - cost, true
+	})
+	if err != nil {
+		log.Printf("memcache error charging %s of user %s: %v", scopeCredits, userID, err)
+		return ratelimit.CreditInsufficient(0, cost)
+	}
+	return decision
+}
+
+// TopUp adds amount credits to the user's balance and returns the new balance
+func (cl *CreditLimiter) TopUp(userID string, amount int) (int, error) {
+	if amount <= 0 {
+		return 0, fmt.Errorf("top-up amount must be positive, got %d", amount)
+	}
+
+	var balance int
+	err := cl.update(userID, true, func(current int) (int, bool) {
+		balance = current + amount
+		return balance, true
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to top up %s of user %s: %w", scopeCredits, userID, err)
+	}
+	return balance, nil
+}
+
+// GetBalance returns the user's balance, or zero if it cannot be read
+func (cl *CreditLimiter) GetBalance(userID string) int {
+	balance, err := cl.client.Get(cl.key(userID))
+	if err != nil {
+		log.Printf("memcache error reading %s of user %s: %v", scopeCredits, userID, err)
+		return 0
+	}
+	return int(balance)
+}
+
+// update applies change to the user's balance, retrying when another instance updates it
+// concurrently; change returns the new balance and whether to store it
+// A missing balance counts as zero and is only created when create is set
+func (cl *CreditLimiter) update(userID string, create bool, change func(balance int) (int, bool)) error {
+	key := cl.key(userID)
+
+	for attempt := 0; attempt < creditMaxRetries; attempt++ {
+		item, err := cl.client.Gets(key)
+		if err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+			return err
+		}
+
+		balance := 0
+		if item != nil {
+			balance = int(item.Value)
+		}
+		updated, store := change(balance)
+		if !store || (item == nil && !create) {
+			return nil
+		}
+
+		// Balances never expire
+		if item == nil {
+			err = cl.client.Add(key, uint64(updated), 0)
+		} else {
+			item.Value = uint64(updated)
+			err = cl.client.CompareAndSwap(item, 0)
+		}
+
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, memcache.ErrNotStored),
+			errors.Is(err, memcache.ErrCASConflict),
+			errors.Is(err, memcache.ErrCacheMiss):
+			// Another instance won the race, re-read the balance and try again
+			continue
+		default:
+			return err
+		}
+	}
+
+	return fmt.Errorf("gave up updating key %q after %d conflicting writes", key, creditMaxRetries)
+}
+
+// key returns the Memcache key of the user's balance
+func (cl *CreditLimiter) key(userID string) string {
+	return cl.config.GetMemcacheKey(scopeCredits, userID, "")
+}
+
+// Reset clears all credit state for testing purposes
+// For distributed limiters, this is a no-op since state is in Memcache
+func (cl *CreditLimiter) Reset() {
+	// No-op: distributed state is managed by Memcache
+}
+
+// Close is a no-op; balances are written to Memcache as requests are charged
+func (cl *CreditLimiter) Close() error {
+	return nil
+}
@@ -0,0 +1,80 @@
+package distributed
+
+import (
+	"errors"
+	"testing"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/memcache"
+)
+
+func TestCreditLimiter_Charge(t *testing.T) {
+	cfg := config.Config{
+		MemcacheKeyPrefix: "rate_limit",
+		ChargeCredits:     true,
+	}
+	client := memcache.NewMockClient()
+
+	// Instances sharing Memcache share the balances
+	first := NewCreditLimiter(client, cfg)
+	second := NewCreditLimiter(client, cfg)
+
+	if d := first.Charge("user123", 1); d.Allowed {
+		t.Fatalf("Charge() without credits should be rejected, got %+v", d)
+	}
+	if _, err := client.Gets("rate_limit:credits:user123"); !errors.Is(err, memcache.ErrCacheMiss) {
+		t.Error("A rejected charge should not create a balance")
+	}
+
+	if balance, err := first.TopUp("user123", 5); err != nil || balance != 5 {
+		t.Fatalf("TopUp() = %d, %v, want 5", balance, err)
+	}
+	if d := second.Charge("user123", 3); !d.Allowed || d.Balance != 2 {
+		t.Fatalf("Charge(3) should leave 2 credits, got %+v", d)
+	}
+	if d := first.Charge("user123", 3); d.Allowed || d.Balance != 2 {
+		t.Errorf("Charge(3) over the balance should be rejected, got %+v", d)
+	}
+
+	if balance, _ := client.Get("rate_limit:credits:user123"); balance != 2 {
+		t.Errorf("stored balance = %d, want 2", balance)
+	}
+	if balance := second.GetBalance("user123"); balance != 2 {
+		t.Errorf("GetBalance() = %d, want 2", balance)
+	}
+	if _, err := first.TopUp("user123", 0); err == nil {
+		t.Error("TopUp(0) should be rejected")
+	}
+}
+
+func TestCreditLimiter_FailureMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		failureMode config.FailureMode
+		allowed     bool
+	}{
+		// Credits are paid for, so an unreadable balance never lets requests through for free
+		{name: "fail open", failureMode: config.FailureModeAllow, allowed: false},
+		{name: "fail closed", failureMode: config.FailureModeDeny, allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Config{
+				MemcacheKeyPrefix:   "rate_limit",
+				MemcacheFailureMode: tt.failureMode,
+				ChargeCredits:       true,
+			}
+			client := memcache.NewMockClient()
+			_ = client.Close()
+
+			cl := NewCreditLimiter(client, cfg)
+			if d := cl.Charge("user123", 1); d.Allowed != tt.allowed {
+				t.Errorf("Charge().Allowed = %v, want %v", d.Allowed, tt.allowed)
+			}
+			if _, err := cl.TopUp("user123", 5); err == nil {
+				t.Error("TopUp() should report the Memcache failure")
+			}
+		})
+	}
+}
@@ -0,0 +1,504 @@
+package distributed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/memcache"
+	"rate_limiter_service/pkg/ratelimit"
+)
+
+const (
+	// gcraMaxRetries bounds the number of CAS attempts when instances race on the same key
+	gcraMaxRetries = 32
+)
+
+// GCRALimiter enforces rate and burst limits per user using the Generic Cell Rate Algorithm
+// The theoretical arrival time (TAT) of each key is stored in Memcache as Unix nanoseconds
+// and updated with gets/CAS, so every instance sees the same rate and burst behavior as the
+// in-memory TokenBucket
+// Each limit of the rule has its own TAT; a request must conform to all of them
+type GCRALimiter struct {
+	*CommonLimiter
+
+	// burst is the number of requests that may be sent back-to-back under the first limit
+	burst int
+}
+
+// newGCRALimiter creates a GCRA limiter for the given scope enforcing every one of limits
+func newGCRALimiter(
+	client memcache.ClientInterface,
+	cfg config.Config,
+	scope string,
+	limits []config.Limit,
+) *GCRALimiter {
+	return &GCRALimiter{
+		CommonLimiter: newCommonLimiterForLimits(client, cfg, scope, limits),
+		burst:         limits[0].Burst,
+	}
+}
+
+// NewGlobalGCRALimiter creates a distributed global limiter using GCRA
+func NewGlobalGCRALimiter(client memcache.ClientInterface, cfg config.Config) *GCRALimiter {
+	return newGCRALimiter(client, cfg, scopeGlobal, cfg.GetGlobalLimits())
+}
+
+// NewHTTPGCRALimiter creates a distributed HTTP-only limiter using GCRA
+func NewHTTPGCRALimiter(client memcache.ClientInterface, cfg config.Config) *GCRALimiter {
+	return newGCRALimiter(client, cfg, scopeHTTP, cfg.GetHTTPLimits())
+}
+
+// NewGRPCGCRALimiter creates a distributed gRPC-only limiter using GCRA
+func NewGRPCGCRALimiter(client memcache.ClientInterface, cfg config.Config) *GCRALimiter {
+	return newGCRALimiter(client, cfg, scopeGRPC, cfg.GetGRPCLimits())
+}
+
+// Allow checks if the request for the given user is allowed
+// Returns true if allowed, false if rate limited
+func (gl *GCRALimiter) Allow(userID string) bool {
+	return gl.AllowN(userID, 1)
+}
+
+// AllowN checks if a request costing n tokens for the given user is allowed
+// Returns true if allowed, false if rate limited
+func (gl *GCRALimiter) AllowN(userID string, n int) bool {
+	return gl.Decide(userID, n).Allowed
+}
+
+// Decide checks a request costing n tokens against every limit of the tier
+// When the request is rejected, the decision names the limit that tripped
+func (gl *GCRALimiter) Decide(userID string, n int) ratelimit.Decision {
+	return gl.DecideWithReserve(userID, n, 0)
+}
+
+// DecideWithReserve checks a request like Decide, but only admits it if the reserved share of every
+// limit's burst stays available for higher priority classes
+func (gl *GCRALimiter) DecideWithReserve(userID string, n int, reserved float64) ratelimit.Decision {
+	tripped, err := gl.decideKeys(userID, "", gl.limits, n, reserved)
+	if err != nil {
+		// Handle Memcache failure based on failure mode
+		gl.LogError(userID, err)
+		return gl.FailureDecision()
+	}
+	return decision(gl.limits, tripped)
+}
+
+// Reserve books n tokens for the given user, pushing the TATs forward even if they are not available yet
+// The reservation's delay is the time until every TAT is back within its burst tolerance
+func (gl *GCRALimiter) Reserve(userID string, n int) *ratelimit.Reservation {
+	reservation, err := gl.reserveKeys(userID, "", gl.limits, n)
+	if err != nil {
+		// Handle Memcache failure based on failure mode
+		gl.LogError(userID, err)
+		return gl.FailureReservation()
+	}
+	return reservation
+}
+
+// Wait blocks until n tokens are available for the given user or ctx is done
+func (gl *GCRALimiter) Wait(ctx context.Context, userID string, n int) error {
+	return ratelimit.Wait(ctx, gl.Reserve(userID, n))
+}
+
+// GetRemainingTokens returns the number of requests the user may still send without waiting
+func (gl *GCRALimiter) GetRemainingTokens(userID string) int {
+	remaining, err := gl.remainingForKeys(userID, "", gl.limits)
+	if err != nil {
+		// On failure, return full capacity (conservative approach)
+		gl.LogError(userID, err)
+		return normalizeBurst(gl.burst)
+	}
+	return remaining
+}
+
+// Reset clears all rate limiting state for testing purposes
+// For distributed limiters, this is a no-op since state is in Memcache
+func (gl *GCRALimiter) Reset() {
+	// No-op: distributed state is managed by Memcache
+	// Tests should use mock Memcache client for state management
+}
+
+// decideKeys applies GCRA to the key of every limit for a request costing n tokens, keeping the
+// reserved share of each burst for higher priority classes
+// It returns the index of the first limit the request does not conform to, or -1; the TATs
+// already pushed forward for earlier limits are moved back since the request is rejected
+func (gl *GCRALimiter) decideKeys(
+	userID, identifier string,
+	limits []config.Limit,
+	n int,
+	reserved float64,
+) (int, error) {
+	type charge struct {
+		key       string
+		increment time.Duration
+	}
+	charged := make([]charge, 0, len(limits))
+
+	for i, limit := range limits {
+		key := gl.config.GetMemcacheKey(gl.scope, userID, limitIdentifier(identifier, i, limit))
+		interval := emissionInterval(limit.Rate, limit.Period)
+
+		keep := ratelimit.ReservedTokens(normalizeBurst(limit.Burst), reserved)
+		allowed, err := gl.allowKey(key, interval, limit.Burst, n, keep)
+		if err != nil || !allowed {
+			for _, c := range charged {
+				gl.releaseKey(c.key, c.increment)
+			}
+			if err != nil {
+				return -1, err
+			}
+			return i, nil
+		}
+		charged = append(charged, charge{key, time.Duration(requestCost(n)) * interval})
+	}
+	return -1, nil
+}
+
+// reserveKeys books a request costing n tokens on the key of every limit
+// The reservation is usable once the request conforms to all of them
+func (gl *GCRALimiter) reserveKeys(
+	userID, identifier string,
+	limits []config.Limit,
+	n int,
+) (*ratelimit.Reservation, error) {
+	reservations := make([]*ratelimit.Reservation, 0, len(limits))
+	for i, limit := range limits {
+		key := gl.config.GetMemcacheKey(gl.scope, userID, limitIdentifier(identifier, i, limit))
+
+		reservation, err := gl.reserveKey(key, emissionInterval(limit.Rate, limit.Period), limit.Burst, n)
+		if err != nil {
+			for _, r := range reservations {
+				r.Cancel()
+			}
+			return nil, err
+		}
+		reservations = append(reservations, reservation)
+	}
+	return ratelimit.All(reservations...), nil
+}
+
+// remainingForKeys returns how many requests fit into the burst tolerance of every limit
+func (gl *GCRALimiter) remainingForKeys(userID, identifier string, limits []config.Limit) (int, error) {
+	remaining := -1
+	for i, limit := range limits {
+		key := gl.config.GetMemcacheKey(gl.scope, userID, limitIdentifier(identifier, i, limit))
+
+		limitRemaining, err := gl.remainingForKey(key, emissionInterval(limit.Rate, limit.Period), limit.Burst)
+		if err != nil {
+			return 0, err
+		}
+		if remaining < 0 || limitRemaining < remaining {
+			remaining = limitRemaining
+		}
+	}
+	return remaining, nil
+}
+
+// allowKey applies GCRA to the given key for a request costing n tokens, where interval is the
+// emission interval of the rate, retrying when another instance updates the key concurrently
+// The request must leave keep tokens of the burst available
+func (gl *GCRALimiter) allowKey(key string, interval time.Duration, burst, n, keep int) (bool, error) {
+	increment := time.Duration(requestCost(n)) * interval
+	tolerance := time.Duration(normalizeBurst(burst)-keep) * interval
+
+	for attempt := 0; attempt < gcraMaxRetries; attempt++ {
+		now := gl.now()
+
+		item, err := gl.client.Gets(key)
+		if err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+			return false, err
+		}
+
+		// A missing or past TAT means the bucket is full
+		tat := now
+		if item != nil {
+			if stored := time.Unix(0, int64(item.Value)); stored.After(now) {
+				tat = stored
+			}
+		}
+
+		newTAT := tat.Add(increment)
+		if newTAT.Sub(now) > tolerance {
+			return false, nil
+		}
+
+		expiration := gcraExpiration(newTAT.Sub(now))
+		if item == nil {
+			err = gl.client.Add(key, uint64(newTAT.UnixNano()), expiration)
+		} else {
+			item.Value = uint64(newTAT.UnixNano())
+			err = gl.client.CompareAndSwap(item, expiration)
+		}
+
+		switch {
+		case err == nil:
+			return true, nil
+		case errors.Is(err, memcache.ErrNotStored),
+			errors.Is(err, memcache.ErrCASConflict),
+			errors.Is(err, memcache.ErrCacheMiss):
+			// Another instance won the race, re-read the TAT and try again
+			continue
+		default:
+			return false, err
+		}
+	}
+
+	return false, fmt.Errorf("gave up updating key %q after %d conflicting writes", key, gcraMaxRetries)
+}
+
+// reserveKey books a request costing n tokens on the given key and returns when it conforms
+// A cost larger than the burst never conforms and is not granted
+func (gl *GCRALimiter) reserveKey(key string, interval time.Duration, burst, n int) (*ratelimit.Reservation, error) {
+	increment := time.Duration(requestCost(n)) * interval
+	tolerance := time.Duration(normalizeBurst(burst)) * interval
+
+	if increment > tolerance {
+		return ratelimit.NotGranted(), nil
+	}
+
+	for attempt := 0; attempt < gcraMaxRetries; attempt++ {
+		now := gl.now()
+
+		item, err := gl.client.Gets(key)
+		if err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+			return nil, err
+		}
+
+		tat := now
+		if item != nil {
+			if stored := time.Unix(0, int64(item.Value)); stored.After(now) {
+				tat = stored
+			}
+		}
+
+		newTAT := tat.Add(increment)
+		timeToAct := newTAT.Add(-tolerance)
+		if timeToAct.Before(now) {
+			timeToAct = now
+		}
+
+		expiration := gcraExpiration(newTAT.Sub(now))
+		if item == nil {
+			err = gl.client.Add(key, uint64(newTAT.UnixNano()), expiration)
+		} else {
+			item.Value = uint64(newTAT.UnixNano())
+			err = gl.client.CompareAndSwap(item, expiration)
+		}
+
+		switch {
+		case err == nil:
+			return ratelimit.NewReservation(timeToAct, func() {
+				gl.releaseKey(key, increment)
+			}), nil
+		case errors.Is(err, memcache.ErrNotStored),
+			errors.Is(err, memcache.ErrCASConflict),
+			errors.Is(err, memcache.ErrCacheMiss):
+			// Another instance won the race, re-read the TAT and try again
+			continue
+		default:
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("gave up updating key %q after %d conflicting writes", key, gcraMaxRetries)
+}
+
+// releaseKey moves the TAT of the given key back by a cancelled reservation's increment
+// This is best effort: the TAT is never moved into the past and conflicts are retried a bounded number of times
+func (gl *GCRALimiter) releaseKey(key string, increment time.Duration) {
+	for attempt := 0; attempt < gcraMaxRetries; attempt++ {
+		now := gl.now()
+
+		item, err := gl.client.Gets(key)
+		if errors.Is(err, memcache.ErrCacheMiss) {
+			return
+		}
+		if err != nil {
+			log.Printf("memcache error releasing %s reservation on key %s: %v", gl.scope, key, err)
+			return
+		}
+
+		tat := time.Unix(0, int64(item.Value))
+		if !tat.After(now) {
+			return
+		}
+
+		newTAT := tat.Add(-increment)
+		if newTAT.Before(now) {
+			newTAT = now
+		}
+
+		item.Value = uint64(newTAT.UnixNano())
+		err = gl.client.CompareAndSwap(item, gcraExpiration(newTAT.Sub(now)))
+		switch {
+		case err == nil, errors.Is(err, memcache.ErrCacheMiss):
+			return
+		case errors.Is(err, memcache.ErrCASConflict):
+			continue
+		default:
+			log.Printf("memcache error releasing %s reservation on key %s: %v", gl.scope, key, err)
+			return
+		}
+	}
+}
+
+// remainingForKey returns how many requests fit into the burst tolerance for the given key
+func (gl *GCRALimiter) remainingForKey(key string, interval time.Duration, burst int) (int, error) {
+	burst = normalizeBurst(burst)
+
+	item, err := gl.client.Gets(key)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return burst, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	backlog := time.Unix(0, int64(item.Value)).Sub(gl.now())
+	if backlog < 0 {
+		backlog = 0
+	}
+
+	remaining := int((time.Duration(burst)*interval - backlog) / interval)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, nil
+}
+
+// PerEndpointGCRALimiter enforces per-endpoint rate limits per user using GCRA
+type PerEndpointGCRALimiter struct {
+	*GCRALimiter
+}
+
+// NewPerEndpointGCRALimiter creates a distributed per-endpoint limiter using GCRA
+func NewPerEndpointGCRALimiter(client memcache.ClientInterface, cfg config.Config) *PerEndpointGCRALimiter {
+	defaultLimit := config.Limit{
+		Rate:   cfg.HTTPDefaultMethodRate,
+		Period: cfg.HTTPDefaultMethodPeriod,
+		Burst:  cfg.PerEndpointBurstSize,
+	}
+	return &PerEndpointGCRALimiter{
+		GCRALimiter: newGCRALimiter(client, cfg, scopeEndpoint, []config.Limit{defaultLimit}),
+	}
+}
+
+// Allow checks if the request for the given user and endpoint is allowed
+// Returns true if allowed, false if rate limited
+func (pel *PerEndpointGCRALimiter) Allow(userID, method, path string) bool {
+	return pel.AllowN(userID, method, path, 1)
+}
+
+// AllowN checks if a request costing n tokens for the given user and endpoint is allowed
+// Returns true if allowed, false if rate limited
+func (pel *PerEndpointGCRALimiter) AllowN(userID, method, path string, n int) bool {
+	return pel.Decide(userID, method, path, n).Allowed
+}
+
+// Decide checks a request costing n tokens against every limit of the endpoint
+// When the request is rejected, the decision names the limit that tripped
+func (pel *PerEndpointGCRALimiter) Decide(userID, method, path string, n int) ratelimit.Decision {
+	endpointKey := config.HTTPEndpointKey(method, path)
+	limits := pel.config.GetHTTPMethodLimits(endpointKey)
+
+	tripped, err := pel.decideKeys(userID, endpointKey, limits, n, 0)
+	if err != nil {
+		// Handle Memcache failure based on failure mode
+		pel.LogError(userID, err)
+		return failureDecision(pel.HandleFailure(), limits)
+	}
+	return decision(limits, tripped)
+}
+
+// GetRemainingTokens returns the number of remaining tokens for a user-endpoint combination
+func (pel *PerEndpointGCRALimiter) GetRemainingTokens(userID, method, path string) int {
+	endpointKey := config.HTTPEndpointKey(method, path)
+
+	remaining, err := pel.remainingForKeys(userID, endpointKey, pel.config.GetHTTPMethodLimits(endpointKey))
+	if err != nil {
+		// On failure, return full capacity (conservative approach)
+		pel.LogError(userID, err)
+		return normalizeBurst(pel.burst)
+	}
+	return remaining
+}
+
+// GRPCMethodGCRALimiter enforces per-method rate limits for gRPC per user using GCRA
+type GRPCMethodGCRALimiter struct {
+	*GCRALimiter
+}
+
+// NewGRPCMethodGCRALimiter creates a distributed gRPC per-method limiter using GCRA
+func NewGRPCMethodGCRALimiter(client memcache.ClientInterface, cfg config.Config) *GRPCMethodGCRALimiter {
+	defaultLimit := config.Limit{
+		Rate:   cfg.GRPCDefaultMethodRate,
+		Period: cfg.GRPCDefaultMethodPeriod,
+		Burst:  cfg.GRPCBurstSize,
+	}
+	return &GRPCMethodGCRALimiter{
+		GCRALimiter: newGCRALimiter(client, cfg, scopeGRPCMethod, []config.Limit{defaultLimit}),
+	}
+}
+
+// Allow checks if the gRPC request for the given user and method is allowed
+// Returns true if allowed, false if rate limited
+func (gml *GRPCMethodGCRALimiter) Allow(userID, method string) bool {
+	return gml.AllowN(userID, method, 1)
+}
+
+// AllowN checks if a gRPC request costing n tokens for the given user and method is allowed
+// Returns true if allowed, false if rate limited
+func (gml *GRPCMethodGCRALimiter) AllowN(userID, method string, n int) bool {
+	return gml.Decide(userID, method, n).Allowed
+}
+
+// Decide checks a gRPC request costing n tokens against every limit of the method
+// When the request is rejected, the decision names the limit that tripped
+func (gml *GRPCMethodGCRALimiter) Decide(userID, method string, n int) ratelimit.Decision {
+	limits := gml.config.GetGRPCMethodLimits(method)
+
+	tripped, err := gml.decideKeys(userID, method, limits, n, 0)
+	if err != nil {
+		// Handle Memcache failure based on failure mode
+		gml.LogError(userID, err)
+		return failureDecision(gml.HandleFailure(), limits)
+	}
+	return decision(limits, tripped)
+}
+
+// GetRemainingTokens returns the number of remaining tokens for a user-method combination
+func (gml *GRPCMethodGCRALimiter) GetRemainingTokens(userID, method string) int {
+	remaining, err := gml.remainingForKeys(userID, method, gml.config.GetGRPCMethodLimits(method))
+	if err != nil {
+		// On failure, return full capacity (conservative approach)
+		gml.LogError(userID, err)
+		return normalizeBurst(gml.burst)
+	}
+	return remaining
+}
+
+// emissionInterval returns the time between two conforming requests at the given rate per period
+func emissionInterval(rate int, period time.Duration) time.Duration {
+	if rate <= 0 {
+		rate = 1
+	}
+	return normalizePeriod(period) / time.Duration(rate)
+}
+
+// normalizeBurst applies the same minimum burst as NewTokenBucket
+func normalizeBurst(burst int) int {
+	if burst <= 0 {
+		return 1
+	}
+	return burst
+}
+
+// gcraExpiration returns a TTL covering the time until the stored TAT is reached
+// Memcache expirations have one-second granularity, so round up and add a second of slack
+func gcraExpiration(untilTAT time.Duration) time.Duration {
+	return (untilTAT/time.Second + 2) * time.Second
+}
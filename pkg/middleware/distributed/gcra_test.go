@@ -0,0 +1,284 @@
+package distributed
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/memcache"
+)
+
+// fakeClock is a manually advanced time source for deterministic tests
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Now()}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestGCRALimiter_HonorsBurst(t *testing.T) {
+	mock := memcache.NewMockClient()
+	cfg := config.DefaultConfig()
+	cfg.GlobalRate = 10
+	cfg.GlobalBurstSize = 3
+
+	limiter := NewGlobalGCRALimiter(mock, cfg)
+	clock := newFakeClock()
+	limiter.now = clock.Now
+
+	userID := "user123"
+
+	// A full burst should be allowed back-to-back
+	for i := 0; i < 3; i++ {
+		if !limiter.Allow(userID) {
+			t.Errorf("Request %d within burst should be allowed", i+1)
+		}
+	}
+
+	// The next request exceeds the burst
+	if limiter.Allow(userID) {
+		t.Error("Request beyond burst should be denied")
+	}
+
+	// One emission interval (100ms at 10/s) frees exactly one slot
+	clock.Advance(100 * time.Millisecond)
+	if !limiter.Allow(userID) {
+		t.Error("Request after one emission interval should be allowed")
+	}
+	if limiter.Allow(userID) {
+		t.Error("Only one request should be allowed after one emission interval")
+	}
+}
+
+func TestGCRALimiter_GetRemainingTokens(t *testing.T) {
+	mock := memcache.NewMockClient()
+	cfg := config.DefaultConfig()
+	cfg.HTTPRate = 2
+	cfg.HTTPBurstSize = 5
+
+	limiter := NewHTTPGCRALimiter(mock, cfg)
+	clock := newFakeClock()
+	limiter.now = clock.Now
+
+	userID := "user123"
+
+	if remaining := limiter.GetRemainingTokens(userID); remaining != 5 {
+		t.Errorf("Initial remaining tokens = %d, want 5", remaining)
+	}
+
+	for i := 0; i < 3; i++ {
+		limiter.Allow(userID)
+	}
+
+	if remaining := limiter.GetRemainingTokens(userID); remaining != 2 {
+		t.Errorf("Remaining tokens after 3 requests = %d, want 2", remaining)
+	}
+
+	// 500ms at 2/s refills one token
+	clock.Advance(500 * time.Millisecond)
+	if remaining := limiter.GetRemainingTokens(userID); remaining != 3 {
+		t.Errorf("Remaining tokens after refill = %d, want 3", remaining)
+	}
+}
+
+func TestGCRALimiter_FailureModes(t *testing.T) {
+	tests := []struct {
+		name        string
+		failureMode config.FailureMode
+		expected    bool
+	}{
+		{name: "fail-open", failureMode: config.FailureModeAllow, expected: true},
+		{name: "fail-closed", failureMode: config.FailureModeDeny, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := memcache.NewMockClient()
+			cfg := config.DefaultConfig()
+			cfg.MemcacheFailureMode = tt.failureMode
+
+			limiter := NewGRPCGCRALimiter(mock, cfg)
+
+			// Close the mock to simulate failure
+			_ = mock.Close()
+
+			if allowed := limiter.Allow("user123"); allowed != tt.expected {
+				t.Errorf("Allow() = %v, want %v", allowed, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGCRALimiter_ConcurrentInstances(t *testing.T) {
+	mock := memcache.NewMockClient()
+	cfg := config.DefaultConfig()
+	cfg.GlobalRate = 1
+	cfg.GlobalBurstSize = 20
+	cfg.MemcacheFailureMode = config.FailureModeDeny
+
+	clock := newFakeClock()
+
+	// Several limiter instances share the same Memcache, like separate service replicas
+	var allowed int64
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		limiter := NewGlobalGCRALimiter(mock, cfg)
+		limiter.now = clock.Now
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if limiter.Allow("user123") {
+					atomic.AddInt64(&allowed, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 20 {
+		t.Errorf("Allowed %d requests across instances, want exactly the burst of 20", allowed)
+	}
+}
+
+func TestPerEndpointGCRALimiter_Allow(t *testing.T) {
+	mock := memcache.NewMockClient()
+	cfg := config.DefaultConfig()
+	cfg.PerEndpointBurstSize = 2
+	cfg.HTTPDefaultMethodRate = 1
+	cfg.HTTPMethods = map[string]int{"POST:/api/upload": 1}
+
+	limiter := NewPerEndpointGCRALimiter(mock, cfg)
+	limiter.now = newFakeClock().Now
+
+	userID := "user123"
+
+	for i := 0; i < 2; i++ {
+		if !limiter.Allow(userID, "GET", "/api/users") {
+			t.Errorf("Request %d should be allowed", i+1)
+		}
+	}
+	if limiter.Allow(userID, "GET", "/api/users") {
+		t.Error("Third request should be denied")
+	}
+
+	// Other endpoints have their own state
+	if !limiter.Allow(userID, "POST", "/api/upload") {
+		t.Error("Different endpoint should be allowed")
+	}
+	if remaining := limiter.GetRemainingTokens(userID, "POST", "/api/upload"); remaining != 1 {
+		t.Errorf("Remaining tokens = %d, want 1", remaining)
+	}
+}
+
+func TestGRPCMethodGCRALimiter_Allow(t *testing.T) {
+	mock := memcache.NewMockClient()
+	cfg := config.DefaultConfig()
+	cfg.GRPCBurstSize = 2
+	cfg.GRPCDefaultMethodRate = 1
+	cfg.GRPCMethods = map[string]int{"/users.Service/List": 1}
+
+	limiter := NewGRPCMethodGCRALimiter(mock, cfg)
+	limiter.now = newFakeClock().Now
+
+	userID := "user123"
+
+	for i := 0; i < 2; i++ {
+		if !limiter.Allow(userID, "/users.Service/Get") {
+			t.Errorf("Request %d should be allowed", i+1)
+		}
+	}
+	if limiter.Allow(userID, "/users.Service/Get") {
+		t.Error("Third request should be denied")
+	}
+
+	// Other methods have their own state
+	if !limiter.Allow(userID, "/users.Service/List") {
+		t.Error("Different method should be allowed")
+	}
+	if remaining := limiter.GetRemainingTokens(userID, "/users.Service/List"); remaining != 1 {
+		t.Errorf("Remaining tokens = %d, want 1", remaining)
+	}
+}
+
+func TestGCRALimiter_AllowN(t *testing.T) {
+	mock := memcache.NewMockClient()
+	cfg := config.DefaultConfig()
+	cfg.GlobalRate = 10
+	cfg.GlobalBurstSize = 20
+
+	limiter := NewGlobalGCRALimiter(mock, cfg)
+	clock := newFakeClock()
+	limiter.now = clock.Now
+
+	userID := "user123"
+
+	if !limiter.AllowN(userID, 15) {
+		t.Error("Request costing 15 should fit into a burst of 20")
+	}
+	if limiter.AllowN(userID, 10) {
+		t.Error("Request costing 10 should be denied with 5 tokens left")
+	}
+
+	// 500ms at 10/s refills 5 tokens
+	clock.Advance(500 * time.Millisecond)
+	if !limiter.AllowN(userID, 10) {
+		t.Error("Request costing 10 should be allowed after refill")
+	}
+}
+
+func TestGCRALimiter_Reserve(t *testing.T) {
+	mock := memcache.NewMockClient()
+	cfg := config.DefaultConfig()
+	cfg.GlobalRate = 10
+	cfg.GlobalBurstSize = 2
+
+	limiter := NewGlobalGCRALimiter(mock, cfg)
+	clock := newFakeClock()
+	limiter.now = clock.Now
+
+	userID := "user123"
+
+	// The burst is available immediately
+	if r := limiter.Reserve(userID, 2); !r.OK() || r.DelayFrom(clock.Now()) != 0 {
+		t.Errorf("Reserve(2) = ok %v, delay %v, want ok without delay", r.OK(), r.DelayFrom(clock.Now()))
+	}
+
+	// Beyond the burst, each token adds one emission interval of delay
+	r := limiter.Reserve(userID, 2)
+	if delay := r.DelayFrom(clock.Now()); !r.OK() || delay != 200*time.Millisecond {
+		t.Errorf("Reserve(2) = ok %v, delay %v, want ok with 200ms delay", r.OK(), delay)
+	}
+	if limiter.Allow(userID) {
+		t.Error("Allow() should fail while tokens are reserved")
+	}
+
+	// Cancelling moves the TAT back, so waiting one interval frees a slot again
+	r.Cancel()
+	clock.Advance(100 * time.Millisecond)
+	if !limiter.Allow(userID) {
+		t.Error("Allow() should succeed after the reservation was cancelled")
+	}
+
+	// A cost larger than the burst is never granted
+	if limiter.Reserve(userID, 3).OK() {
+		t.Error("Reserve(3) should not be granted with a burst of 2")
+	}
+}
@@ -1,8 +1,11 @@
 package distributed
 
 import (
+	"context"
+
 	"rate_limiter_service/internal/config"
 	"rate_limiter_service/pkg/memcache"
+	"rate_limiter_service/pkg/ratelimit"
 )
 
 const (
@@ -17,44 +20,47 @@ type GlobalLimiter struct {
 // NewGlobalLimiter creates a new distributed global rate limiter
 func NewGlobalLimiter(client memcache.ClientInterface, cfg config.Config) *GlobalLimiter {
 	return &GlobalLimiter{
-		CommonLimiter: NewCommonLimiter(client, cfg, scopeGlobal, cfg.GlobalRate),
+		CommonLimiter: newCommonLimiterForLimits(client, cfg, scopeGlobal, cfg.GetGlobalLimits()),
 	}
 }
 
 // Allow checks if the request for the given user is allowed globally
 // Returns true if allowed, false if rate limited
 func (gl *GlobalLimiter) Allow(userID string) bool {
-	key := gl.config.GetMemcacheKey(gl.scope, userID, "")
+	return gl.AllowN(userID, 1)
+}
 
-	// Increment counter with expiration
-	newCount, err := gl.client.IncrementWithExpiration(key, 1, gl.GetExpiration())
-	if err != nil {
-		// Handle Memcache failure based on failure mode
-		gl.CommonLimiter.LogError(userID, err)
-		return gl.CommonLimiter.HandleFailure()
-	}
+// AllowN checks if a request costing n tokens for the given user is allowed
+// Returns true if allowed, false if rate limited
+func (gl *GlobalLimiter) AllowN(userID string, n int) bool {
+	return gl.Decide(userID, n).Allowed
+}
 
-	// Check if within rate limit
-	return gl.CommonLimiter.CheckRateLimit(newCount)
+// Decide checks a request costing n tokens against the fixed window of every limit of the tier
+// When the request is rejected, the decision names the limit that tripped
+func (gl *GlobalLimiter) Decide(userID string, n int) ratelimit.Decision {
+	return gl.DecideWindows(userID, "", n)
 }
 
-// GetRemainingTokens returns the number of remaining tokens for a user globally
-func (gl *GlobalLimiter) GetRemainingTokens(userID string) int {
-	key := gl.config.GetMemcacheKey(gl.scope, userID, "")
+// DecideWithReserve checks a request like Decide, but only admits it if the reserved share of every
+// limit stays available for higher priority classes
+func (gl *GlobalLimiter) DecideWithReserve(userID string, n int, reserved float64) ratelimit.Decision {
+	return gl.DecideWindowsWithReserve(userID, "", n, reserved)
+}
 
-	count, err := gl.client.Get(key)
-	if err != nil {
-		// Handle Memcache failure
-		gl.CommonLimiter.LogError(userID, err)
-		// On failure, return full capacity (conservative approach)
-		return gl.CommonLimiter.GetRate()
-	}
+// Reserve books n tokens for the given user globally in the first windows with room for them
+func (gl *GlobalLimiter) Reserve(userID string, n int) *ratelimit.Reservation {
+	return gl.ReserveWindow(userID, "", n)
+}
 
-	remaining := gl.CommonLimiter.GetRate() - int(count)
-	if remaining < 0 {
-		remaining = 0
-	}
-	return remaining
+// Wait blocks until n tokens are available for the given user globally or ctx is done
+func (gl *GlobalLimiter) Wait(ctx context.Context, userID string, n int) error {
+	return ratelimit.Wait(ctx, gl.Reserve(userID, n))
+}
+
+// GetRemainingTokens returns the number of remaining tokens for a user globally
+func (gl *GlobalLimiter) GetRemainingTokens(userID string) int {
+	return gl.RemainingInWindows(userID, "")
 }
 
 // Reset clears all rate limiting state for testing purposes
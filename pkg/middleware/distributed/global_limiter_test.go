@@ -2,6 +2,7 @@ package distributed
 
 import (
 	"testing"
+	"time"
 
 	"rate_limiter_service/internal/config"
 	"rate_limiter_service/pkg/memcache"
@@ -175,3 +176,80 @@ func TestGlobalLimiter_Reset(t *testing.T) {
 		t.Errorf("After reset and clear, remaining tokens = %d, want 10", remaining)
 	}
 }
+
+func TestGlobalLimiter_AllowN(t *testing.T) {
+	mock := memcache.NewMockClient()
+	cfg := config.DefaultConfig()
+	cfg.GlobalRate = 10
+
+	limiter := NewGlobalLimiter(mock, cfg)
+
+	userID := "user123"
+
+	if !limiter.AllowN(userID, 7) {
+		t.Error("Request costing 7 should be allowed")
+	}
+	if remaining := limiter.GetRemainingTokens(userID); remaining != 3 {
+		t.Errorf("Remaining tokens = %d, want 3", remaining)
+	}
+	if limiter.AllowN(userID, 4) {
+		t.Error("Request costing 4 should be denied with 3 tokens left")
+	}
+}
+
+func TestGlobalLimiter_Reserve(t *testing.T) {
+	mock := memcache.NewMockClient()
+	cfg := config.DefaultConfig()
+	cfg.GlobalRate = 2
+
+	limiter := NewGlobalLimiter(mock, cfg)
+	clock := &fakeClock{now: time.Unix(1000, int64(200*time.Millisecond))}
+	limiter.now = clock.Now
+
+	userID := "user123"
+
+	// The current window has room
+	if r := limiter.Reserve(userID, 2); !r.OK() || r.DelayFrom(clock.Now()) != 0 {
+		t.Errorf("Reserve(2) = ok %v, delay %v, want ok without delay", r.OK(), r.DelayFrom(clock.Now()))
+	}
+
+	// The current window is full, so the tokens are booked in the next one
+	next := limiter.Reserve(userID, 1)
+	if delay := next.DelayFrom(clock.Now()); !next.OK() || delay != 800*time.Millisecond {
+		t.Errorf("Reserve(1) = ok %v, delay %v, want ok with 800ms delay", next.OK(), delay)
+	}
+
+	// The next window only has room for one more token, so two tokens go to the one after
+	if r := limiter.Reserve(userID, 2); !r.OK() || r.DelayFrom(clock.Now()) != 1800*time.Millisecond {
+		t.Errorf("Reserve(2) = ok %v, delay %v, want ok with 1.8s delay", r.OK(), r.DelayFrom(clock.Now()))
+	}
+
+	// Cancelling gives the tokens back to the next window
+	next.Cancel()
+	if count, _ := mock.Get(cfg.GetWindowMemcacheKey("global", userID, "", 1001)); count != 0 {
+		t.Errorf("Next window count after cancel = %d, want 0", count)
+	}
+
+	// A cost larger than the rate is never granted
+	if limiter.Reserve(userID, 3).OK() {
+		t.Error("Reserve(3) should not be granted with a rate of 2")
+	}
+}
+
+func TestGlobalLimiter_ReserveFailureMode(t *testing.T) {
+	mock := memcache.NewMockClient()
+	mock.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.GlobalRate = 2
+
+	cfg.MemcacheFailureMode = config.FailureModeAllow
+	if r := NewGlobalLimiter(mock, cfg).Reserve("user123", 1); !r.OK() {
+		t.Error("Reserve() should be granted in allow failure mode")
+	}
+
+	cfg.MemcacheFailureMode = config.FailureModeDeny
+	if r := NewGlobalLimiter(mock, cfg).Reserve("user123", 1); r.OK() {
+		t.Error("Reserve() should not be granted in deny failure mode")
+	}
+}
@@ -1,8 +1,11 @@
 package distributed
 
 import (
+	"context"
+
 	"rate_limiter_service/internal/config"
 	"rate_limiter_service/pkg/memcache"
+	"rate_limiter_service/pkg/ratelimit"
 )
 
 const (
@@ -17,44 +20,47 @@ type GRPCLimiter struct {
 // NewGRPCLimiter creates a new distributed gRPC-only rate limiter
 func NewGRPCLimiter(client memcache.ClientInterface, cfg config.Config) *GRPCLimiter {
 	return &GRPCLimiter{
-		CommonLimiter: NewCommonLimiter(client, cfg, scopeGRPC, cfg.GRPCRate),
+		CommonLimiter: newCommonLimiterForLimits(client, cfg, scopeGRPC, cfg.GetGRPCLimits()),
 	}
 }
 
 // Allow checks if the gRPC request for the given user is allowed
 // Returns true if allowed, false if rate limited
 func (gl *GRPCLimiter) Allow(userID string) bool {
-	key := gl.config.GetMemcacheKey(gl.scope, userID, "")
+	return gl.AllowN(userID, 1)
+}
 
-	// Increment counter with expiration
-	newCount, err := gl.client.IncrementWithExpiration(key, 1, gl.GetExpiration())
-	if err != nil {
-		// Handle Memcache failure based on failure mode
-		gl.LogError(userID, err)
-		return gl.HandleFailure()
-	}
+// AllowN checks if a request costing n tokens for the given user is allowed
+// Returns true if allowed, false if rate limited
+func (gl *GRPCLimiter) AllowN(userID string, n int) bool {
+	return gl.Decide(userID, n).Allowed
+}
 
-	// Check if within rate limit
-	return gl.CheckRateLimit(newCount)
+// Decide checks a request costing n tokens against the fixed window of every limit of the tier
+// When the request is rejected, the decision names the limit that tripped
+func (gl *GRPCLimiter) Decide(userID string, n int) ratelimit.Decision {
+	return gl.DecideWindows(userID, "", n)
 }
 
-// GetRemainingTokens returns the number of remaining tokens for a user for gRPC requests
-func (gl *GRPCLimiter) GetRemainingTokens(userID string) int {
-	key := gl.config.GetMemcacheKey(gl.scope, userID, "")
+// DecideWithReserve checks a request like Decide, but only admits it if the reserved share of every
+// limit stays available for higher priority classes
+func (gl *GRPCLimiter) DecideWithReserve(userID string, n int, reserved float64) ratelimit.Decision {
+	return gl.DecideWindowsWithReserve(userID, "", n, reserved)
+}
 
-	count, err := gl.client.Get(key)
-	if err != nil {
-		// Handle Memcache failure
-		gl.LogError(userID, err)
-		// On failure, return full capacity (conservative approach)
-		return gl.GetRate()
-	}
+// Reserve books n tokens for the given user for gRPC requests in the first windows with room for them
+func (gl *GRPCLimiter) Reserve(userID string, n int) *ratelimit.Reservation {
+	return gl.ReserveWindow(userID, "", n)
+}
 
-	remaining := gl.GetRate() - int(count)
-	if remaining < 0 {
-		remaining = 0
-	}
-	return remaining
+// Wait blocks until n tokens are available for the given user for gRPC requests or ctx is done
+func (gl *GRPCLimiter) Wait(ctx context.Context, userID string, n int) error {
+	return ratelimit.Wait(ctx, gl.Reserve(userID, n))
+}
+
+// GetRemainingTokens returns the number of remaining tokens for a user for gRPC requests
+func (gl *GRPCLimiter) GetRemainingTokens(userID string) int {
+	return gl.RemainingInWindows(userID, "")
 }
 
 // Reset clears all rate limiting state for testing purposes
@@ -0,0 +1,98 @@
+package distributed
+
+import (
+	"log"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/memcache"
+	"rate_limiter_service/pkg/ratelimit"
+)
+
+const (
+	scopeGRPCMethod = "grpc_method"
+)
+
+// GRPCMethodLimiter enforces per-method rate limits for gRPC per user using Memcache
+type GRPCMethodLimiter struct {
+	*BaseLimiter
+}
+
+// NewGRPCMethodLimiter creates a new distributed gRPC per-method rate limiter
+func NewGRPCMethodLimiter(client memcache.ClientInterface, cfg config.Config) *GRPCMethodLimiter {
+	return &GRPCMethodLimiter{
+		BaseLimiter: NewBaseLimiter(
+			client, cfg, scopeGRPCMethod, cfg.GRPCDefaultMethodRate, cfg.GRPCDefaultMethodPeriod,
+		),
+	}
+}
+
+// Allow checks if the gRPC request for the given user and method is allowed
+// Returns true if allowed, false if rate limited
+func (gml *GRPCMethodLimiter) Allow(userID, method string) bool {
+	return gml.AllowN(userID, method, 1)
+}
+
+// AllowN checks if a gRPC request costing n tokens for the given user and method is allowed
+// Returns true if allowed, false if rate limited
+func (gml *GRPCMethodLimiter) AllowN(userID, method string, n int) bool {
+	return gml.Decide(userID, method, n).Allowed
+}
+
+// Decide charges a gRPC request costing n tokens to the fixed window of every limit of the method
+// When the request is rejected, the decision names the limit that tripped
+func (gml *GRPCMethodLimiter) Decide(userID, method string, n int) ratelimit.Decision {
+	limits := gml.config.GetGRPCMethodLimits(method)
+
+	tripped, err := countWindows(
+		gml.client, gml.config, gml.scope, userID, method, limits, requestCost(n), 0, gml.now(),
+	)
+	if err != nil {
+		// Handle Memcache failure based on failure mode
+		log.Printf("memcache error incrementing gRPC method counter for user %s, method %s: %v", userID, method, err)
+		return failureDecision(gml.handleFailure(), limits)
+	}
+	return decision(limits, tripped)
+}
+
+// GetRemainingTokens returns the number of remaining tokens for a user-method combination
+// With several limits, the most restrictive one counts
+func (gml *GRPCMethodLimiter) GetRemainingTokens(userID, method string) int {
+	remaining := -1
+	for i, limit := range gml.config.GetGRPCMethodLimits(method) {
+		key := gml.getWindowKeyFor(userID, limitIdentifier(method, i, limit), limit.Period)
+
+		limitRemaining := limit.Rate
+		if count, err := gml.client.Get(key); err != nil {
+			// On failure, count the limit at full capacity (conservative approach)
+			log.Printf("memcache error getting gRPC method counter for user %s, method %s: %v", userID, method, err)
+		} else {
+			limitRemaining = max(limit.Rate-int(count), 0)
+		}
+
+		if remaining < 0 || limitRemaining < remaining {
+			remaining = limitRemaining
+		}
+	}
+	return remaining
+}
+
+// handleFailure handles Memcache failures based on configured failure mode
+func (gml *GRPCMethodLimiter) handleFailure() bool {
+	switch gml.config.MemcacheFailureMode {
+	case config.FailureModeAllow:
+		// Fail-open: allow requests when Memcache is unavailable
+		return true
+	case config.FailureModeDeny:
+		// Fail-closed: deny requests when Memcache is unavailable
+		return false
+	default:
+		// Default to allow for safety
+		return true
+	}
+}
+
+// Reset clears all rate limiting state for testing purposes
+// For distributed limiters, this is a no-op since state is in Memcache
+func (gml *GRPCMethodLimiter) Reset() {
+	// No-op: distributed state is managed by Memcache
+}
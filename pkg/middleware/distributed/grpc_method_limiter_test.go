@@ -0,0 +1,60 @@
+package distributed
+
+import (
+	"testing"
+	"time"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/memcache"
+)
+
+func TestGRPCMethodLimiter_Allow(t *testing.T) {
+	mock := memcache.NewMockClient()
+	cfg := config.DefaultConfig()
+	cfg.MemcacheKeyPrefix = "rate_limit"
+	cfg.GRPCDefaultMethodRate = 1
+	cfg.GRPCMethods = map[string]int{"/users.Service/Get": 2}
+
+	limiter := NewGRPCMethodLimiter(mock, cfg)
+	limiter.now = (&fakeClock{now: time.Unix(1000, 0)}).Now
+
+	userID := "user123"
+
+	for i := 0; i < 2; i++ {
+		if !limiter.Allow(userID, "/users.Service/Get") {
+			t.Errorf("Request %d to configured method should be allowed", i+1)
+		}
+	}
+	if limiter.Allow(userID, "/users.Service/Get") {
+		t.Error("Third request to configured method should be denied")
+	}
+	if count, _ := mock.Get("rate_limit:grpc_method:user123:/users.Service/Get:1000"); count != 2 {
+		t.Errorf("method counter = %d, want 2", count)
+	}
+
+	// Other methods have their own counters at the default rate
+	if !limiter.Allow(userID, "/users.Service/List") {
+		t.Error("First request to default method should be allowed")
+	}
+	if remaining := limiter.GetRemainingTokens(userID, "/users.Service/List"); remaining != 0 {
+		t.Errorf("Remaining tokens = %d, want 0", remaining)
+	}
+}
+
+func TestGRPCMethodLimiter_FailureMode(t *testing.T) {
+	for _, mode := range []config.FailureMode{config.FailureModeAllow, config.FailureModeDeny} {
+		mock := memcache.NewMockClient()
+		cfg := config.DefaultConfig()
+		cfg.GRPCDefaultMethodRate = 10
+		cfg.MemcacheFailureMode = mode
+
+		limiter := NewGRPCMethodLimiter(mock, cfg)
+
+		// Close the mock to simulate failure
+		mock.Close()
+
+		if allowed := limiter.Allow("user123", "/users.Service/Get"); allowed != (mode == config.FailureModeAllow) {
+			t.Errorf("Allow() in %s mode = %v", mode, allowed)
+		}
+	}
+}
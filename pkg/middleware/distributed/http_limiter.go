@@ -1,8 +1,11 @@
 package distributed
 
 import (
+	"context"
+
 	"rate_limiter_service/internal/config"
 	"rate_limiter_service/pkg/memcache"
+	"rate_limiter_service/pkg/ratelimit"
 )
 
 const (
@@ -17,44 +20,47 @@ type HTTPLimiter struct {
 // NewHTTPLimiter creates a new distributed HTTP-only rate limiter
 func NewHTTPLimiter(client memcache.ClientInterface, cfg config.Config) *HTTPLimiter {
 	return &HTTPLimiter{
-		CommonLimiter: NewCommonLimiter(client, cfg, scopeHTTP, cfg.HTTPRate),
+		CommonLimiter: newCommonLimiterForLimits(client, cfg, scopeHTTP, cfg.GetHTTPLimits()),
 	}
 }
 
 // Allow checks if the HTTP request for the given user is allowed
 // Returns true if allowed, false if rate limited
 func (hl *HTTPLimiter) Allow(userID string) bool {
-	key := hl.config.GetMemcacheKey(hl.scope, userID, "")
+	return hl.AllowN(userID, 1)
+}
 
-	// Increment counter with expiration
-	newCount, err := hl.client.IncrementWithExpiration(key, 1, hl.GetExpiration())
-	if err != nil {
-		// Handle Memcache failure based on failure mode
-		hl.LogError(userID, err)
-		return hl.HandleFailure()
-	}
+// AllowN checks if a request costing n tokens for the given user is allowed
+// Returns true if allowed, false if rate limited
+func (hl *HTTPLimiter) AllowN(userID string, n int) bool {
+	return hl.Decide(userID, n).Allowed
+}
 
-	// Check if within rate limit
-	return hl.CheckRateLimit(newCount)
+// Decide checks a request costing n tokens against the fixed window of every limit of the tier
+// When the request is rejected, the decision names the limit that tripped
+func (hl *HTTPLimiter) Decide(userID string, n int) ratelimit.Decision {
+	return hl.DecideWindows(userID, "", n)
 }
 
-// GetRemainingTokens returns the number of remaining tokens for a user for HTTP requests
-func (hl *HTTPLimiter) GetRemainingTokens(userID string) int {
-	key := hl.config.GetMemcacheKey(hl.scope, userID, "")
+// DecideWithReserve checks a request like Decide, but only admits it if the reserved share of every
+// limit stays available for higher priority classes
+func (hl *HTTPLimiter) DecideWithReserve(userID string, n int, reserved float64) ratelimit.Decision {
+	return hl.DecideWindowsWithReserve(userID, "", n, reserved)
+}
 
-	count, err := hl.client.Get(key)
-	if err != nil {
-		// Handle Memcache failure
-		hl.LogError(userID, err)
-		// On failure, return full capacity (conservative approach)
-		return hl.GetRate()
-	}
+// Reserve books n tokens for the given user for HTTP requests in the first windows with room for them
+func (hl *HTTPLimiter) Reserve(userID string, n int) *ratelimit.Reservation {
+	return hl.ReserveWindow(userID, "", n)
+}
 
-	remaining := hl.GetRate() - int(count)
-	if remaining < 0 {
-		remaining = 0
-	}
-	return remaining
+// Wait blocks until n tokens are available for the given user for HTTP requests or ctx is done
+func (hl *HTTPLimiter) Wait(ctx context.Context, userID string, n int) error {
+	return ratelimit.Wait(ctx, hl.Reserve(userID, n))
+}
+
+// GetRemainingTokens returns the number of remaining tokens for a user for HTTP requests
+func (hl *HTTPLimiter) GetRemainingTokens(userID string) int {
+	return hl.RemainingInWindows(userID, "")
 }
 
 // Reset clears all rate limiting state for testing purposes
@@ -0,0 +1,69 @@
+package distributed
+
+import (
+	"log"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/memcache"
+	"rate_limiter_service/pkg/ratelimit"
+)
+
+const (
+	scopeLevel = "level"
+)
+
+// LevelLimiter enforces the limits of the identity hierarchy levels other than the user, such as
+// organizations and API keys, counting requests across instances in Memcache
+// Requests are counted with config.DistributedAlgorithm, like the per-user limits
+//
+// Key format: {prefix}:level:{level}:{identity}[:{window}], where identity is the path of identities
+// from the outermost level down, e.g. rate_limit:level:org:acme:1234 or
+// rate_limit:level:key:acme/user123/key1:1234; GCRA keys have no window
+type LevelLimiter struct {
+	*CommonLimiter
+
+	// decideKeys charges a request to the key of every limit of a level's identity
+	decideKeys func(level, identity string, limits []config.Limit, n int, reserved float64) (int, error)
+}
+
+// NewLevelLimiter creates a new distributed hierarchy level limiter
+func NewLevelLimiter(client memcache.ClientInterface, cfg config.Config) *LevelLimiter {
+	// The limits vary by level, so they are passed on each call rather than set here
+	cl := NewCommonLimiter(client, cfg, scopeLevel, 0, 0)
+	ll := &LevelLimiter{CommonLimiter: cl}
+
+	switch cfg.DistributedAlgorithm {
+	case config.AlgorithmGCRA:
+		ll.decideKeys = (&GCRALimiter{CommonLimiter: cl}).decideKeys
+	case config.AlgorithmSlidingWindow:
+		ll.decideKeys = (&SlidingWindowLimiter{CommonLimiter: cl}).decideKeys
+	default:
+		ll.decideKeys = func(level, identity string, limits []config.Limit, n int, reserved float64) (int, error) {
+			cost := requestCost(n)
+			return countWindows(cl.client, cl.config, scopeLevel, level, identity, limits, cost, reserved, cl.now())
+		}
+	}
+	return ll
+}
+
+// Decide charges a request costing n to the limits of an identity at the named level
+// A Memcache failure is handled according to the configured failure mode
+func (ll *LevelLimiter) Decide(level, identity string, n int) ratelimit.Decision {
+	limits := ll.config.GetLevelLimits(level)
+	if len(limits) == 0 {
+		return ratelimit.Allowed()
+	}
+
+	tripped, err := ll.decideKeys(level, identity, limits, n, 0)
+	if err != nil {
+		log.Printf("memcache error updating %s %s counters for %s: %v", scopeLevel, level, identity, err)
+		return failureDecision(ll.HandleFailure(), limits)
+	}
+	return decision(limits, tripped)
+}
+
+// Reset clears all level state for testing purposes
+// For distributed limiters, this is a no-op since state is in Memcache
+func (ll *LevelLimiter) Reset() {
+	// No-op: distributed state is managed by Memcache
+}
@@ -0,0 +1,99 @@
+package distributed
+
+import (
+	"testing"
+	"time"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/memcache"
+)
+
+func TestLevelLimiter_Decide(t *testing.T) {
+	algorithms := []config.Algorithm{config.AlgorithmFixedWindow, config.AlgorithmGCRA, config.AlgorithmSlidingWindow}
+
+	for _, algorithm := range algorithms {
+		t.Run(string(algorithm), func(t *testing.T) {
+			cfg := config.Config{
+				MemcacheKeyPrefix:    "rate_limit",
+				DistributedAlgorithm: algorithm,
+				IdentityLevels: []config.IdentityLevel{
+					{Name: "org", Header: "X-Org-ID", Limits: []config.Limit{{Rate: 3, Period: time.Minute, Burst: 3}}},
+					{Name: config.UserLevel},
+				},
+			}
+			client := memcache.NewMockClient()
+			clock := &fakeClock{now: time.Unix(6000, 0)}
+
+			// Two instances sharing Memcache share the limits of each organization
+			instances := make([]*LevelLimiter, 2)
+			for i := range instances {
+				instances[i] = NewLevelLimiter(client, cfg)
+				instances[i].now = clock.Now
+			}
+
+			for i := 0; i < 3; i++ {
+				if d := instances[i%2].Decide("org", "acme", 1); !d.Allowed {
+					t.Fatalf("Request %d should be allowed", i+1)
+				}
+			}
+			if d := instances[0].Decide("org", "acme", 1); d.Allowed || d.Limit.Rate != 3 {
+				t.Fatalf("Fourth request should trip the org limit, got %+v", d)
+			}
+			if d := instances[1].Decide("org", "globex", 1); !d.Allowed {
+				t.Error("Request from another org should be allowed")
+			}
+		})
+	}
+}
+
+func TestLevelLimiter_Key(t *testing.T) {
+	cfg := config.Config{
+		MemcacheKeyPrefix: "rate_limit",
+		IdentityLevels: []config.IdentityLevel{
+			{Name: config.UserLevel},
+			{Name: "key", Header: "X-API-Key", Limits: []config.Limit{{Rate: 2, Period: time.Minute, Burst: 2}}},
+		},
+	}
+	client := memcache.NewMockClient()
+	limiter := NewLevelLimiter(client, cfg)
+	limiter.now = (&fakeClock{now: time.Unix(6000, 0)}).Now
+
+	if d := limiter.Decide("key", "user123/key1", 1); !d.Allowed {
+		t.Fatal("First request should be allowed")
+	}
+
+	// The key holds the level and the path of identities down to it
+	count, err := client.Get("rate_limit:level:key:user123/key1:100")
+	if err != nil || count != 1 {
+		t.Errorf("counter = %d, %v, want 1", count, err)
+	}
+}
+
+func TestLevelLimiter_FailureMode(t *testing.T) {
+	tests := []struct {
+		failureMode config.FailureMode
+		allowed     bool
+	}{
+		{config.FailureModeAllow, true},
+		{config.FailureModeDeny, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.failureMode), func(t *testing.T) {
+			cfg := config.Config{
+				MemcacheKeyPrefix:   "rate_limit",
+				MemcacheFailureMode: tt.failureMode,
+				IdentityLevels: []config.IdentityLevel{
+					{Name: "org", Header: "X-Org-ID", Limits: []config.Limit{{Rate: 3, Period: time.Minute, Burst: 3}}},
+					{Name: config.UserLevel},
+				},
+			}
+			client := memcache.NewMockClient()
+			_ = client.Close()
+
+			if d := NewLevelLimiter(client, cfg).Decide("org", "acme", 1); d.Allowed != tt.allowed {
+				t.Errorf("Decide() allowed = %v, want %v", d.Allowed, tt.allowed)
+			}
+		})
+	}
+}
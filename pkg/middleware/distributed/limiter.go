@@ -12,6 +12,8 @@ import (
 type Limiter interface {
 	// Allow checks if a request is allowed
 	Allow(userID string) bool
+	// AllowN checks if a request costing n tokens is allowed
+	AllowN(userID string, n int) bool
 	// GetRemainingTokens returns the number of remaining tokens
 	GetRemainingTokens(userID string) int
 }
@@ -36,15 +38,28 @@ type BaseLimiter struct {
 	config config.Config
 	scope  string
 	rate   int
+	// window is the period the rate applies to, used as the fixed window length
+	window time.Duration
+	// now returns the current time; overridden in tests
+	now func() time.Time
 }
 
-// NewBaseLimiter creates a new base limiter
-func NewBaseLimiter(client memcache.ClientInterface, cfg config.Config, scope string, rate int) *BaseLimiter {
+// NewBaseLimiter creates a new base limiter allowing rate requests per period
+// A zero period means one second
+func NewBaseLimiter(
+	client memcache.ClientInterface,
+	cfg config.Config,
+	scope string,
+	rate int,
+	period time.Duration,
+) *BaseLimiter {
 	return &BaseLimiter{
 		client: client,
 		config: cfg,
 		scope:  scope,
 		rate:   rate,
+		window: normalizePeriod(period),
+		now:    time.Now,
 	}
 }
 
@@ -64,9 +79,19 @@ func (bl *BaseLimiter) GetScope() string {
 }
 
 // GetWindowDuration returns the duration of the rate limit window
-// For distributed limiters, we use a 1-second sliding window
+// Windows are as long as the rate's period and aligned to the epoch
 func (bl *BaseLimiter) GetWindowDuration() time.Duration {
-	return time.Second
+	return bl.window
+}
+
+// getWindowKey returns the Memcache key of the window containing the current time
+func (bl *BaseLimiter) getWindowKey(userID, identifier string) string {
+	return bl.getWindowKeyFor(userID, identifier, bl.window)
+}
+
+// getWindowKeyFor returns the Memcache key of the window of the given length containing the current time
+func (bl *BaseLimiter) getWindowKeyFor(userID, identifier string, window time.Duration) string {
+	return bl.config.GetWindowMemcacheKey(bl.scope, userID, identifier, windowIndex(bl.now(), window))
 }
 
 // checkRateLimit checks if the count is within the rate limit
@@ -75,8 +100,7 @@ func (bl *BaseLimiter) checkRateLimit(count uint64) bool {
 }
 
 // getExpiration returns the expiration time for Memcache keys
-// We add a small buffer to handle edge cases at window boundaries
+// Each key only serves one window, so it lives for the window plus a small buffer
 func (bl *BaseLimiter) getExpiration() time.Duration {
-	// Use 2 seconds to allow for some buffer at window boundaries
-	return 2 * time.Second
+	return windowExpiration(bl.window)
 }
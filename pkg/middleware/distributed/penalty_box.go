@@ -0,0 +1,164 @@
+package distributed
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/memcache"
+)
+
+const (
+	scopePenalty = "penalty"
+
+	// penaltyMaxRetries bounds the number of CAS attempts when instances race on the same offenses
+	penaltyMaxRetries = 32
+)
+
+// PenaltyBox bans users once they are rejected config.PenaltyThreshold times within
+// config.PenaltyWindow, sharing rejections and bans across instances through Memcache
+// Rejections are counted with a sliding-window counter; each ban within config.PenaltyResetAfter
+// of the previous one lasts twice as long, up to config.PenaltyMaxBan
+//
+// Key format:
+//   - {prefix}:penalty:{user_id}:rejections:{window}: rejection counters
+//   - {prefix}:penalty:{user_id}:ban: end of the current ban in Unix milliseconds
+//   - {prefix}:penalty:{user_id}:offenses: number of bans since offenses were last forgotten
+type PenaltyBox struct {
+	rejections *SlidingWindowLimiter
+}
+
+// NewPenaltyBox creates a new distributed penalty box
+func NewPenaltyBox(client memcache.ClientInterface, cfg config.Config) *PenaltyBox {
+	window := config.Limit{Rate: cfg.PenaltyThreshold, Period: cfg.PenaltyWindow, Burst: cfg.PenaltyThreshold}
+	return &PenaltyBox{
+		rejections: newSlidingWindowLimiter(client, cfg, scopePenalty, []config.Limit{window}),
+	}
+}
+
+// Banned reports whether the user is banned and, if so, when the ban ends
+// If Memcache is unavailable the user is treated as not banned; the rate limiters apply the failure mode
+func (pb *PenaltyBox) Banned(userID string) (time.Time, bool) {
+	until, err := pb.rejections.client.Get(pb.rejections.config.GetMemcacheKey(scopePenalty, userID, "ban"))
+	if err != nil {
+		pb.logError(userID, err)
+		return time.Time{}, false
+	}
+
+	bannedUntil := time.UnixMilli(int64(until))
+	if until == 0 || !pb.rejections.now().Before(bannedUntil) {
+		return time.Time{}, false
+	}
+	return bannedUntil, true
+}
+
+// Penalize counts a rejection against the user; it reports whether this started a ban and when it ends
+func (pb *PenaltyBox) Penalize(userID string) (time.Time, bool) {
+	client := pb.rejections.client
+	cfg := pb.rejections.config
+	now := pb.rejections.now()
+	window := normalizePeriod(cfg.PenaltyWindow)
+
+	// The counter must outlive its own window to serve as the previous window
+	index := windowIndex(now, window)
+	key := pb.rejections.windowKeyAt(userID, "rejections", index)
+	count, err := client.IncrementWithExpiration(key, 1, windowExpiration(2*window))
+	if err != nil {
+		pb.logError(userID, err)
+		return time.Time{}, false
+	}
+
+	// Weigh the previous window as the sliding-window counter does, against this rejection's own count
+	previous, err := client.Get(pb.rejections.windowKeyAt(userID, "rejections", index-1))
+	if err != nil {
+		pb.logError(userID, err)
+		return time.Time{}, false
+	}
+	elapsed := now.Sub(time.Unix(0, index*int64(window)))
+	estimate := float64(previous)*(1-float64(elapsed)/float64(window)) + float64(count)
+
+	// Only the rejection whose own count crosses the threshold starts a ban, so instances rejecting the
+	// same user at the same time record one offense between them; the first rejection of a window
+	// also crosses it when the previous window alone reaches the threshold
+	threshold := float64(cfg.PenaltyThreshold)
+	if estimate < threshold || (estimate-1 >= threshold && count > 1) {
+		return time.Time{}, false
+	}
+
+	offenses, err := pb.countOffense(userID)
+	if err != nil {
+		pb.logError(userID, err)
+		offenses = 1
+	}
+
+	ban := cfg.GetPenaltyBan(offenses)
+	bannedUntil := now.Add(ban)
+	banKey := cfg.GetMemcacheKey(scopePenalty, userID, "ban")
+	if err := client.Set(banKey, uint64(bannedUntil.UnixMilli()), windowExpiration(ban)); err != nil {
+		pb.logError(userID, err)
+		return time.Time{}, false
+	}
+
+	// Start counting afresh once the ban ends; a counter that is already gone needs no deleting
+	for _, counter := range []int64{index - 1, index} {
+		_ = client.Delete(pb.rejections.windowKeyAt(userID, "rejections", counter))
+	}
+	return bannedUntil, true
+}
+
+// countOffense counts a ban against the user and returns the number of bans since offenses were last
+// forgotten, retrying when another instance counts one concurrently
+// Offenses are forgotten PenaltyResetAfter after the end of the ban they start, as in the in-memory box
+func (pb *PenaltyBox) countOffense(userID string) (int, error) {
+	client := pb.rejections.client
+	cfg := pb.rejections.config
+	key := cfg.GetMemcacheKey(scopePenalty, userID, "offenses")
+
+	for attempt := 0; attempt < penaltyMaxRetries; attempt++ {
+		item, err := client.Gets(key)
+		if err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+			return 0, err
+		}
+
+		offenses := 1
+		if item != nil {
+			offenses = int(item.Value) + 1
+		}
+
+		// The count and its expiration are written together so no instance shortens another's
+		expiration := windowExpiration(cfg.GetPenaltyBan(offenses) + cfg.PenaltyResetAfter)
+		if item == nil {
+			err = client.Add(key, uint64(offenses), expiration)
+		} else {
+			item.Value = uint64(offenses)
+			err = client.CompareAndSwap(item, expiration)
+		}
+
+		switch {
+		case err == nil:
+			return offenses, nil
+		case errors.Is(err, memcache.ErrNotStored),
+			errors.Is(err, memcache.ErrCASConflict),
+			errors.Is(err, memcache.ErrCacheMiss):
+			// Another instance won the race, re-read the offenses and try again
+			continue
+		default:
+			return 0, err
+		}
+	}
+
+	return 0, fmt.Errorf("gave up updating key %q after %d conflicting writes", key, penaltyMaxRetries)
+}
+
+// logError logs a Memcache error with context
+func (pb *PenaltyBox) logError(userID string, err error) {
+	log.Printf("memcache error updating %s state for user %s: %v", scopePenalty, userID, err)
+}
+
+// Reset clears all penalty state for testing purposes
+// For distributed penalty boxes, this is a no-op since state is in Memcache
+func (pb *PenaltyBox) Reset() {
+	// No-op: distributed state is managed by Memcache
+}
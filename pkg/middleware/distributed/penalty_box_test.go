@@ -0,0 +1,135 @@
+package distributed
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/memcache"
+)
+
+func TestPenaltyBox_Penalize(t *testing.T) {
+	cfg := config.Config{
+		MemcacheKeyPrefix: "rate_limit",
+		PenaltyThreshold:  3,
+		PenaltyWindow:     time.Minute,
+		PenaltyBan:        time.Minute,
+		PenaltyMaxBan:     time.Hour,
+		PenaltyResetAfter: 24 * time.Hour,
+	}
+	client := memcache.NewMockClient()
+	pb := NewPenaltyBox(client, cfg)
+
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	pb.rejections.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if _, banned := pb.Penalize("user123"); banned {
+			t.Fatalf("Rejection %d should not start a ban", i+1)
+		}
+	}
+	bannedUntil, banned := pb.Penalize("user123")
+	if !banned || !bannedUntil.Equal(now.Add(time.Minute)) {
+		t.Fatalf("Third rejection should start a 1m ban, got %v %v", bannedUntil, banned)
+	}
+
+	// Another instance sharing the client sees the ban
+	other := NewPenaltyBox(client, cfg)
+	other.rejections.now = pb.rejections.now
+	if until, banned := other.Banned("user123"); !banned || !until.Equal(bannedUntil) {
+		t.Errorf("Banned() = %v %v, want %v true", until, banned, bannedUntil)
+	}
+
+	// The second offense doubles the ban
+	now = bannedUntil
+	if _, banned := pb.Banned("user123"); banned {
+		t.Fatal("Ban should be over")
+	}
+	for i := 0; i < 3; i++ {
+		bannedUntil, banned = pb.Penalize("user123")
+	}
+	if !banned || bannedUntil.Sub(now) != 2*time.Minute {
+		t.Errorf("Second offense should ban for 2m, got %v", bannedUntil.Sub(now))
+	}
+}
+
+func TestPenaltyBox_FailOpen(t *testing.T) {
+	cfg := config.Config{
+		MemcacheKeyPrefix: "rate_limit",
+		PenaltyThreshold:  1,
+		PenaltyWindow:     time.Minute,
+		PenaltyBan:        time.Minute,
+		PenaltyMaxBan:     time.Hour,
+	}
+	client := memcache.NewMockClient()
+	_ = client.Close()
+	pb := NewPenaltyBox(client, cfg)
+
+	if _, banned := pb.Penalize("user123"); banned {
+		t.Error("Penalize() should not ban when Memcache is unavailable")
+	}
+	if _, banned := pb.Banned("user123"); banned {
+		t.Error("Banned() should fail open when Memcache is unavailable")
+	}
+}
+
+func TestPenaltyBox_CountOffenseConcurrently(t *testing.T) {
+	cfg := config.Config{
+		MemcacheKeyPrefix: "rate_limit",
+		PenaltyThreshold:  1,
+		PenaltyWindow:     time.Minute,
+		PenaltyBan:        time.Minute,
+		PenaltyMaxBan:     time.Hour,
+		PenaltyResetAfter: 24 * time.Hour,
+	}
+	client := memcache.NewMockClient()
+
+	// Instances counting offenses at the same time must not lose any
+	const instances = 8
+	var wg sync.WaitGroup
+	for i := 0; i < instances; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := NewPenaltyBox(client, cfg).countOffense("user123"); err != nil {
+				t.Errorf("countOffense() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	offenses, err := client.Get(cfg.GetMemcacheKey(scopePenalty, "user123", "offenses"))
+	if err != nil || offenses != instances {
+		t.Errorf("offenses = %d (%v), want %d", offenses, err, instances)
+	}
+}
+
+func TestPenaltyBox_PenalizeAfterCrossing(t *testing.T) {
+	cfg := config.Config{
+		MemcacheKeyPrefix: "rate_limit",
+		PenaltyThreshold:  3,
+		PenaltyWindow:     time.Minute,
+		PenaltyBan:        time.Minute,
+		PenaltyMaxBan:     time.Hour,
+		PenaltyResetAfter: 24 * time.Hour,
+	}
+	client := memcache.NewMockClient()
+	pb := NewPenaltyBox(client, cfg)
+	now := time.Date(2026, 10, 17, 12, 0, 30, 0, time.UTC)
+	pb.rejections.now = func() time.Time { return now }
+
+	// Another instance's rejection has just crossed the threshold and is about to start the ban
+	key := pb.rejections.windowKeyAt("user123", "rejections", windowIndex(now, time.Minute))
+	if err := client.Set(key, 3, time.Hour); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	// A rejection racing with it sees the threshold exceeded but did not cross it, so it records no offense
+	if _, banned := pb.Penalize("user123"); banned {
+		t.Error("Penalize() past the threshold should leave the ban to the rejection that crossed it")
+	}
+	if offenses, _ := client.Get(cfg.GetMemcacheKey(scopePenalty, "user123", "offenses")); offenses != 0 {
+		t.Errorf("offenses = %d, want 0", offenses)
+	}
+}
@@ -1,11 +1,11 @@
 package distributed
 
 import (
-	"fmt"
 	"log"
 
 	"rate_limiter_service/internal/config"
 	"rate_limiter_service/pkg/memcache"
+	"rate_limiter_service/pkg/ratelimit"
 )
 
 const (
@@ -20,61 +20,63 @@ type PerEndpointLimiter struct {
 // NewPerEndpointLimiter creates a new distributed per-endpoint rate limiter
 func NewPerEndpointLimiter(client memcache.ClientInterface, cfg config.Config) *PerEndpointLimiter {
 	return &PerEndpointLimiter{
-		BaseLimiter: NewBaseLimiter(client, cfg, scopeEndpoint, cfg.HTTPDefaultMethodRate),
+		BaseLimiter: NewBaseLimiter(client, cfg, scopeEndpoint, cfg.HTTPDefaultMethodRate, cfg.HTTPDefaultMethodPeriod),
 	}
 }
 
 // Allow checks if the request for the given user and endpoint is allowed
 // Returns true if allowed, false if rate limited
 func (pel *PerEndpointLimiter) Allow(userID, method, path string) bool {
-	endpointKey := fmt.Sprintf("%s:%s", method, path)
-	key := pel.config.GetMemcacheKey(pel.scope, userID, endpointKey)
+	return pel.AllowN(userID, method, path, 1)
+}
+
+// AllowN checks if a request costing n tokens for the given user and endpoint is allowed
+// Returns true if allowed, false if rate limited
+func (pel *PerEndpointLimiter) AllowN(userID, method, path string, n int) bool {
+	return pel.Decide(userID, method, path, n).Allowed
+}
 
-	// Get rate for this specific endpoint
-	rate := pel.getRateForEndpoint(endpointKey)
+// Decide charges a request costing n tokens to the fixed window of every limit of the endpoint
+// When the request is rejected, the decision names the limit that tripped
+func (pel *PerEndpointLimiter) Decide(userID, method, path string, n int) ratelimit.Decision {
+	endpointKey := config.HTTPEndpointKey(method, path)
+	limits := pel.config.GetHTTPMethodLimits(endpointKey)
 
-	// Increment counter with expiration
-	newCount, err := pel.client.IncrementWithExpiration(key, 1, pel.getExpiration())
+	tripped, err := countWindows(
+		pel.client, pel.config, pel.scope, userID, endpointKey, limits, requestCost(n), 0, pel.now(),
+	)
 	if err != nil {
 		// Handle Memcache failure based on failure mode
 		log.Printf("memcache error incrementing per-endpoint counter for user %s, endpoint %s: %v", userID, endpointKey, err)
-		return pel.handleFailure()
+		return failureDecision(pel.handleFailure(), limits)
 	}
-
-	// Check if within rate limit
-	return newCount <= uint64(rate)
+	return decision(limits, tripped)
 }
 
 // GetRemainingTokens returns the number of remaining tokens for a user-endpoint combination
+// With several limits, the most restrictive one counts
 func (pel *PerEndpointLimiter) GetRemainingTokens(userID, method, path string) int {
-	endpointKey := fmt.Sprintf("%s:%s", method, path)
-	key := pel.config.GetMemcacheKey(pel.scope, userID, endpointKey)
-
-	rate := pel.getRateForEndpoint(endpointKey)
-
-	count, err := pel.client.Get(key)
-	if err != nil {
-		// Handle Memcache failure
-		log.Printf("memcache error getting per-endpoint counter for user %s, endpoint %s: %v", userID, endpointKey, err)
-		// On failure, return full capacity (conservative approach)
-		return rate
-	}
-
-	remaining := rate - int(count)
-	if remaining < 0 {
-		remaining = 0
+	endpointKey := config.HTTPEndpointKey(method, path)
+
+	remaining := -1
+	for i, limit := range pel.config.GetHTTPMethodLimits(endpointKey) {
+		key := pel.getWindowKeyFor(userID, limitIdentifier(endpointKey, i, limit), limit.Period)
+
+		limitRemaining := limit.Rate
+		if count, err := pel.client.Get(key); err != nil {
+			// On failure, count the limit at full capacity (conservative approach)
+			log.Printf("memcache error getting per-endpoint counter for user %s, endpoint %s: %v", userID, endpointKey, err)
+		} else {
+			limitRemaining = max(limit.Rate-int(count), 0)
+		}
+
+		if remaining < 0 || limitRemaining < remaining {
+			remaining = limitRemaining
+		}
 	}
 	return remaining
 }
 
-// getRateForEndpoint returns the rate limit for a specific endpoint
-func (pel *PerEndpointLimiter) getRateForEndpoint(endpointKey string) int {
-	if rate, ok := pel.config.HTTPMethods[endpointKey]; ok {
-		return rate
-	}
-	return pel.config.HTTPDefaultMethodRate
-}
-
 // handleFailure handles Memcache failures based on configured failure mode
 func (pel *PerEndpointLimiter) handleFailure() bool {
 	switch pel.config.MemcacheFailureMode {
@@ -0,0 +1,126 @@
+package distributed
+
+import (
+	"log"
+	"time"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/memcache"
+	"rate_limiter_service/pkg/ratelimit"
+)
+
+const (
+	scopeQuota = "quota"
+
+	// quotaExpirySlack keeps quota counters around a little past the end of their period,
+	// so instances with slightly skewed clocks still find them
+	quotaExpirySlack = time.Hour
+)
+
+// QuotaLimiter enforces calendar-aligned per-user quotas using Memcache counters
+// Each counter lives until its period ends, which for monthly quotas is weeks
+//
+// Key format: {prefix}:quota:{user_id}:{period}:{start}, e.g. rate_limit:quota:user123:month:2026-10
+type QuotaLimiter struct {
+	client memcache.ClientInterface
+	config config.Config
+	// now returns the current time; overridden in tests
+	now func() time.Time
+}
+
+// NewQuotaLimiter creates a new distributed quota limiter
+func NewQuotaLimiter(client memcache.ClientInterface, cfg config.Config) *QuotaLimiter {
+	return &QuotaLimiter{
+		client: client,
+		config: cfg,
+		now:    time.Now,
+	}
+}
+
+// Decide charges a request costing n to the counter of every quota of the user
+// A request rejected by one quota is given back to every counter it was charged to, including the
+// one that tripped, so rejected requests do not use up the quota
+func (ql *QuotaLimiter) Decide(userID string, n int) ratelimit.QuotaDecision {
+	cost := requestCost(n)
+	now := ql.now()
+	location := ql.config.GetQuotaLocation()
+
+	charged := make([]string, 0, len(ql.config.Quotas))
+	for _, quota := range ql.config.Quotas {
+		window, end := quota.Window(now, location)
+		key := ql.config.GetMemcacheKey(scopeQuota, userID, window)
+
+		count, err := ql.client.IncrementWithExpiration(key, cost, end.Sub(now)+quotaExpirySlack)
+		if err != nil {
+			releaseCounters(ql.client, charged, cost)
+			log.Printf("memcache error incrementing %s counter for user %s: %v", scopeQuota, userID, err)
+			return ql.failureDecision(quota, end)
+		}
+
+		charged = append(charged, key)
+		if count > uint64(quota.Limit) {
+			releaseCounters(ql.client, charged, cost)
+			return ratelimit.QuotaExceeded(quota, end)
+		}
+	}
+	return ratelimit.QuotaAllowed()
+}
+
+// Refund gives a request costing n back to the counter of every quota of the user, for requests
+// Decide charged that a later check rejected
+func (ql *QuotaLimiter) Refund(userID string, n int) {
+	now := ql.now()
+	location := ql.config.GetQuotaLocation()
+
+	keys := make([]string, 0, len(ql.config.Quotas))
+	for _, quota := range ql.config.Quotas {
+		window, _ := quota.Window(now, location)
+		keys = append(keys, ql.config.GetMemcacheKey(scopeQuota, userID, window))
+	}
+	releaseCounters(ql.client, keys, requestCost(n))
+}
+
+// GetRemainingQuota returns how many requests the user's tightest quota still admits this period
+// It returns -1 if no quotas are configured
+func (ql *QuotaLimiter) GetRemainingQuota(userID string) int {
+	now := ql.now()
+	location := ql.config.GetQuotaLocation()
+
+	remaining := -1
+	for _, quota := range ql.config.Quotas {
+		window, _ := quota.Window(now, location)
+
+		quotaRemaining := quota.Limit
+		if count, err := ql.client.Get(ql.config.GetMemcacheKey(scopeQuota, userID, window)); err != nil {
+			// On failure, count the quota at full capacity (conservative approach)
+			log.Printf("memcache error reading %s counter for user %s: %v", scopeQuota, userID, err)
+		} else {
+			quotaRemaining = max(quota.Limit-int(count), 0)
+		}
+
+		if remaining < 0 || quotaRemaining < remaining {
+			remaining = quotaRemaining
+		}
+	}
+	return remaining
+}
+
+// failureDecision returns the decision made when Memcache is unavailable, following the configured
+// failure mode; a denied request is attributed to the quota being charged
+func (ql *QuotaLimiter) failureDecision(quota config.Quota, resetAt time.Time) ratelimit.QuotaDecision {
+	if ql.config.MemcacheFailureMode == config.FailureModeDeny {
+		return ratelimit.QuotaExceeded(quota, resetAt)
+	}
+	return ratelimit.QuotaAllowed()
+}
+
+// Reset clears all quota state for testing purposes
+// For distributed limiters, this is a no-op since state is in Memcache
+func (ql *QuotaLimiter) Reset() {
+	// No-op: distributed state is managed by Memcache
+}
+
+// Close is a no-op; counters are written to Memcache as requests are charged
+func (ql *QuotaLimiter) Close() error {
+	return nil
+}
@@ -0,0 +1,101 @@
+package distributed
+
+import (
+	"testing"
+	"time"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/memcache"
+)
+
+func TestQuotaLimiter_Decide(t *testing.T) {
+	cfg := config.Config{
+		MemcacheKeyPrefix: "rate_limit",
+		Quotas: []config.Quota{
+			{Limit: 5, Period: config.QuotaPeriodMonth},
+			{Limit: 3, Period: config.QuotaPeriodDay},
+		},
+	}
+	client := memcache.NewMockClient()
+	ql := NewQuotaLimiter(client, cfg)
+
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	ql.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if d := ql.Decide("user123", 1); !d.Allowed {
+			t.Fatalf("Request %d should be allowed", i+1)
+		}
+	}
+	d := ql.Decide("user123", 1)
+	if d.Allowed || d.Quota.Period != config.QuotaPeriodDay {
+		t.Fatalf("Fourth request should exceed the daily quota, got %+v", d)
+	}
+
+	// The rejected request is given back to both counters
+	if count, _ := client.Get("rate_limit:quota:user123:month:2026-10"); count != 3 {
+		t.Errorf("monthly counter = %d, want 3", count)
+	}
+	if count, _ := client.Get("rate_limit:quota:user123:day:2026-10-17"); count != 3 {
+		t.Errorf("daily counter = %d, want 3", count)
+	}
+
+	now = now.Add(24 * time.Hour)
+	if remaining := ql.GetRemainingQuota("user123"); remaining != 2 {
+		t.Errorf("GetRemainingQuota() = %d, want 2", remaining)
+	}
+	if d := ql.Decide("user123", 3); d.Allowed || d.Quota.Period != config.QuotaPeriodMonth {
+		t.Errorf("Request costing 3 should exceed the monthly quota, got %+v", d)
+	}
+}
+
+func TestQuotaLimiter_Refund(t *testing.T) {
+	cfg := config.Config{
+		MemcacheKeyPrefix: "rate_limit",
+		Quotas: []config.Quota{
+			{Limit: 5, Period: config.QuotaPeriodMonth},
+			{Limit: 3, Period: config.QuotaPeriodDay},
+		},
+	}
+	client := memcache.NewMockClient()
+	ql := NewQuotaLimiter(client, cfg)
+
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	ql.now = func() time.Time { return now }
+
+	ql.Decide("user123", 2)
+	ql.Refund("user123", 2)
+	if count, _ := client.Get("rate_limit:quota:user123:month:2026-10"); count != 0 {
+		t.Errorf("monthly counter = %d, want 0", count)
+	}
+	if remaining := ql.GetRemainingQuota("user123"); remaining != 3 {
+		t.Errorf("GetRemainingQuota() after a refund = %d, want 3", remaining)
+	}
+}
+
+func TestQuotaLimiter_FailureMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		failureMode config.FailureMode
+		allowed     bool
+	}{
+		{name: "fail open", failureMode: config.FailureModeAllow, allowed: true},
+		{name: "fail closed", failureMode: config.FailureModeDeny, allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Config{
+				MemcacheKeyPrefix:   "rate_limit",
+				MemcacheFailureMode: tt.failureMode,
+				Quotas:              []config.Quota{{Limit: 5, Period: config.QuotaPeriodDay}},
+			}
+			client := memcache.NewMockClient()
+			_ = client.Close()
+
+			if d := NewQuotaLimiter(client, cfg).Decide("user123", 1); d.Allowed != tt.allowed {
+				t.Errorf("Decide().Allowed = %v, want %v", d.Allowed, tt.allowed)
+			}
+		})
+	}
+}
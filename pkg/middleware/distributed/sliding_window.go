@@ -0,0 +1,445 @@
+package distributed
+
+import (
+	"context"
+	"time"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/memcache"
+	"rate_limiter_service/pkg/ratelimit"
+)
+
+// SlidingWindowLimiter enforces rate limits per user using a sliding-window counter
+// It keeps Memcache counters for the current and previous fixed windows and weights the
+// previous count by how much of it still overlaps the sliding window, which prevents the
+// 2x burst fixed windows allow across a window boundary
+// Each limit of the rule has its own counters; a request must fit into all of its windows
+type SlidingWindowLimiter struct {
+	*CommonLimiter
+}
+
+// newSlidingWindowLimiter creates a sliding-window limiter for the given scope enforcing every one of limits
+// Each sliding window is as long as its limit's period
+func newSlidingWindowLimiter(
+	client memcache.ClientInterface,
+	cfg config.Config,
+	scope string,
+	limits []config.Limit,
+) *SlidingWindowLimiter {
+	return &SlidingWindowLimiter{
+		CommonLimiter: newCommonLimiterForLimits(client, cfg, scope, limits),
+	}
+}
+
+// NewGlobalSlidingWindowLimiter creates a distributed global limiter using a sliding window
+func NewGlobalSlidingWindowLimiter(client memcache.ClientInterface, cfg config.Config) *SlidingWindowLimiter {
+	return newSlidingWindowLimiter(client, cfg, scopeGlobal, cfg.GetGlobalLimits())
+}
+
+// NewHTTPSlidingWindowLimiter creates a distributed HTTP-only limiter using a sliding window
+func NewHTTPSlidingWindowLimiter(client memcache.ClientInterface, cfg config.Config) *SlidingWindowLimiter {
+	return newSlidingWindowLimiter(client, cfg, scopeHTTP, cfg.GetHTTPLimits())
+}
+
+// NewGRPCSlidingWindowLimiter creates a distributed gRPC-only limiter using a sliding window
+func NewGRPCSlidingWindowLimiter(client memcache.ClientInterface, cfg config.Config) *SlidingWindowLimiter {
+	return newSlidingWindowLimiter(client, cfg, scopeGRPC, cfg.GetGRPCLimits())
+}
+
+// Allow checks if the request for the given user is allowed
+// Returns true if allowed, false if rate limited
+func (sl *SlidingWindowLimiter) Allow(userID string) bool {
+	return sl.AllowN(userID, 1)
+}
+
+// AllowN checks if a request costing n tokens for the given user is allowed
+// Returns true if allowed, false if rate limited
+func (sl *SlidingWindowLimiter) AllowN(userID string, n int) bool {
+	return sl.Decide(userID, n).Allowed
+}
+
+// Decide checks a request costing n tokens against the sliding window of every limit of the tier
+// When the request is rejected, the decision names the limit that tripped
+func (sl *SlidingWindowLimiter) Decide(userID string, n int) ratelimit.Decision {
+	return sl.DecideWithReserve(userID, n, 0)
+}
+
+// DecideWithReserve checks a request like Decide, but only admits it if the reserved share of every
+// limit's rate stays available for higher priority classes
+func (sl *SlidingWindowLimiter) DecideWithReserve(userID string, n int, reserved float64) ratelimit.Decision {
+	tripped, err := sl.decideKeys(userID, "", sl.limits, n, reserved)
+	if err != nil {
+		// Handle Memcache failure based on failure mode
+		sl.LogError(userID, err)
+		return sl.FailureDecision()
+	}
+	return decision(sl.limits, tripped)
+}
+
+// Reserve books n tokens for the given user at the earliest time every sliding window has room for them
+func (sl *SlidingWindowLimiter) Reserve(userID string, n int) *ratelimit.Reservation {
+	reservation, err := sl.reserveKeys(userID, "", sl.limits, n)
+	if err != nil {
+		// Handle Memcache failure based on failure mode
+		sl.LogError(userID, err)
+		return sl.FailureReservation()
+	}
+	return reservation
+}
+
+// Wait blocks until n tokens are available for the given user or ctx is done
+func (sl *SlidingWindowLimiter) Wait(ctx context.Context, userID string, n int) error {
+	return ratelimit.Wait(ctx, sl.Reserve(userID, n))
+}
+
+// GetRemainingTokens returns the rate minus the weighted request count of the most restrictive sliding window
+func (sl *SlidingWindowLimiter) GetRemainingTokens(userID string) int {
+	remaining, err := sl.remainingForKeys(userID, "", sl.limits)
+	if err != nil {
+		// On failure, return full capacity (conservative approach)
+		sl.LogError(userID, err)
+		return sl.rate
+	}
+	return remaining
+}
+
+// Reset clears all rate limiting state for testing purposes
+// For distributed limiters, this is a no-op since state is in Memcache
+func (sl *SlidingWindowLimiter) Reset() {
+	// No-op: distributed state is managed by Memcache
+	// Tests should use mock Memcache client for state management
+}
+
+// decideKeys admits a request costing n tokens if it fits into the sliding window of every limit
+// alongside the reserved share of the limit's rate
+// It returns the index of the first limit the request does not fit, or -1; the counters already
+// charged for earlier limits are given back since the request is rejected
+func (sl *SlidingWindowLimiter) decideKeys(
+	userID, identifier string,
+	limits []config.Limit,
+	n int,
+	reserved float64,
+) (int, error) {
+	return sl.decideKeysAt(userID, identifier, limits, n, reserved, sl.now())
+}
+
+// decideKeysAt admits a request like decideKeys, with the sliding windows ending at now
+func (sl *SlidingWindowLimiter) decideKeysAt(
+	userID, identifier string,
+	limits []config.Limit,
+	n int,
+	reserved float64,
+	now time.Time,
+) (int, error) {
+	charged := make([]string, 0, len(limits))
+
+	for i, limit := range limits {
+		id := limitIdentifier(identifier, i, limit)
+		rate := limit.Rate - ratelimit.ReservedTokens(limit.Rate, reserved)
+		allowed, err := sl.allowKey(userID, id, rate, normalizePeriod(limit.Period), n, now)
+		if err != nil || !allowed {
+			releaseCounters(sl.client, charged, requestCost(n))
+			if err != nil {
+				return -1, err
+			}
+			return i, nil
+		}
+		charged = append(charged, sl.windowKeyAt(userID, id, windowIndex(now, normalizePeriod(limit.Period))))
+	}
+	return -1, nil
+}
+
+// reserveKeys books a request costing n tokens in the sliding window of every limit
+// The reservation is usable once the request fits into all of them
+func (sl *SlidingWindowLimiter) reserveKeys(
+	userID, identifier string,
+	limits []config.Limit,
+	n int,
+) (*ratelimit.Reservation, error) {
+	reservations := make([]*ratelimit.Reservation, 0, len(limits))
+	for i, limit := range limits {
+		reservation, err := sl.reserveKey(userID, limitIdentifier(identifier, i, limit), limit, n)
+		if err != nil {
+			for _, r := range reservations {
+				r.Cancel()
+			}
+			return nil, err
+		}
+		reservations = append(reservations, reservation)
+	}
+	return ratelimit.All(reservations...), nil
+}
+
+// remainingForKeys returns the smallest number of requests any limit's sliding window still admits
+func (sl *SlidingWindowLimiter) remainingForKeys(userID, identifier string, limits []config.Limit) (int, error) {
+	now := sl.now()
+	remaining := -1
+	for i, limit := range limits {
+		estimate, err := sl.estimate(userID, limitIdentifier(identifier, i, limit), normalizePeriod(limit.Period), now)
+		if err != nil {
+			return 0, err
+		}
+		if limitRemaining := remainingFromEstimate(limit.Rate, estimate); remaining < 0 || limitRemaining < remaining {
+			remaining = limitRemaining
+		}
+	}
+	return remaining, nil
+}
+
+// allowKey admits a request costing n tokens if the weighted count over the window stays within rate,
+// then records it; rejected requests are not counted, so they do not weigh on the following window
+func (sl *SlidingWindowLimiter) allowKey(
+	userID, identifier string,
+	rate int,
+	window time.Duration,
+	n int,
+	now time.Time,
+) (bool, error) {
+	cost := requestCost(n)
+
+	estimate, err := sl.estimate(userID, identifier, window, now)
+	if err != nil {
+		return false, err
+	}
+	if estimate+float64(cost) > float64(rate) {
+		return false, nil
+	}
+
+	// The counter must outlive its own window to serve as the previous window
+	key := sl.windowKeyAt(userID, identifier, windowIndex(now, window))
+	if _, err := sl.client.IncrementWithExpiration(key, cost, windowExpiration(2*window)); err != nil {
+		return false, err
+	}
+
+	// Re-check after incrementing in case other instances admitted requests concurrently
+	estimate, err = sl.estimate(userID, identifier, window, now)
+	if err != nil || estimate > float64(rate) {
+		// The tripped window is given back too, so the rejected request leaves no trace
+		releaseCounters(sl.client, []string{key}, cost)
+		return false, err
+	}
+	return true, nil
+}
+
+// reserveKey books a request costing n tokens in the current or next window, at the earliest
+// time the previous window's weight has decayed enough for the request to fit
+// Requests that do not fit before the end of the next window are not granted
+func (sl *SlidingWindowLimiter) reserveKey(
+	userID, identifier string,
+	limit config.Limit,
+	n int,
+) (*ratelimit.Reservation, error) {
+	now := sl.now()
+	cost := requestCost(n)
+	if cost > uint64(limit.Rate) {
+		return ratelimit.NotGranted(), nil
+	}
+
+	window := normalizePeriod(limit.Period)
+	index := windowIndex(now, window)
+	counts := make([]uint64, 3)
+	for i := range counts {
+		count, err := sl.client.Get(sl.windowKeyAt(userID, identifier, index-1+int64(i)))
+		if err != nil {
+			return nil, err
+		}
+		counts[i] = count
+	}
+
+	// Try the current window first, then the next one, whose previous window is the current one
+	for ahead := int64(0); ahead < 2; ahead++ {
+		offset, ok := slidingAdmitOffset(counts[ahead], counts[ahead+1], cost, limit.Rate, window)
+		if !ok {
+			continue
+		}
+
+		timeToAct := time.Unix(0, (index+ahead)*int64(window)).Add(offset)
+		if timeToAct.Before(now) {
+			timeToAct = now
+		}
+
+		key := sl.windowKeyAt(userID, identifier, index+ahead)
+		expiration := windowExpiration(time.Duration(ahead+2) * window)
+		if _, err := sl.client.IncrementWithExpiration(key, cost, expiration); err != nil {
+			return nil, err
+		}
+		return ratelimit.NewReservation(timeToAct, func() {
+			sl.releaseWindow(userID, key, cost)
+		}), nil
+	}
+
+	return ratelimit.NotGranted(), nil
+}
+
+// slidingAdmitOffset returns how far into a window a request costing cost fits, given the
+// counts of that window and the one before it
+func slidingAdmitOffset(previous, current, cost uint64, rate int, window time.Duration) (time.Duration, bool) {
+	room := float64(rate) - float64(current) - float64(cost)
+	if room < 0 {
+		return 0, false
+	}
+	if float64(previous) <= room {
+		return 0, true
+	}
+
+	// Solve previous * (1 - elapsed/window) <= room for elapsed
+	return time.Duration((1 - room/float64(previous)) * float64(window)), true
+}
+
+// estimate returns the weighted request count of the sliding window of the given length ending at now
+func (sl *SlidingWindowLimiter) estimate(
+	userID, identifier string,
+	window time.Duration,
+	now time.Time,
+) (float64, error) {
+	index := windowIndex(now, window)
+
+	current, err := sl.client.Get(sl.windowKeyAt(userID, identifier, index))
+	if err != nil {
+		return 0, err
+	}
+	previous, err := sl.client.Get(sl.windowKeyAt(userID, identifier, index-1))
+	if err != nil {
+		return 0, err
+	}
+
+	// The fraction of the previous window still covered by the sliding window
+	elapsed := now.Sub(time.Unix(0, index*int64(window)))
+	overlap := 1 - float64(elapsed)/float64(window)
+
+	return float64(previous)*overlap + float64(current), nil
+}
+
+// windowKeyAt returns the Memcache key of the window with the given index
+func (sl *SlidingWindowLimiter) windowKeyAt(userID, identifier string, index int64) string {
+	return sl.config.GetWindowMemcacheKey(sl.scope, userID, identifier, index)
+}
+
+// PerEndpointSlidingWindowLimiter enforces per-endpoint rate limits per user using a sliding window
+type PerEndpointSlidingWindowLimiter struct {
+	*SlidingWindowLimiter
+}
+
+// NewPerEndpointSlidingWindowLimiter creates a distributed per-endpoint limiter using a sliding window
+func NewPerEndpointSlidingWindowLimiter(
+	client memcache.ClientInterface,
+	cfg config.Config,
+) *PerEndpointSlidingWindowLimiter {
+	defaultLimit := config.Limit{
+		Rate:   cfg.HTTPDefaultMethodRate,
+		Period: cfg.HTTPDefaultMethodPeriod,
+		Burst:  cfg.HTTPDefaultMethodRate,
+	}
+	return &PerEndpointSlidingWindowLimiter{
+		SlidingWindowLimiter: newSlidingWindowLimiter(client, cfg, scopeEndpoint, []config.Limit{defaultLimit}),
+	}
+}
+
+// Allow checks if the request for the given user and endpoint is allowed
+// Returns true if allowed, false if rate limited
+func (pel *PerEndpointSlidingWindowLimiter) Allow(userID, method, path string) bool {
+	return pel.AllowN(userID, method, path, 1)
+}
+
+// AllowN checks if a request costing n tokens for the given user and endpoint is allowed
+// Returns true if allowed, false if rate limited
+func (pel *PerEndpointSlidingWindowLimiter) AllowN(userID, method, path string, n int) bool {
+	return pel.Decide(userID, method, path, n).Allowed
+}
+
+// Decide checks a request costing n tokens against the sliding window of every limit of the endpoint
+// When the request is rejected, the decision names the limit that tripped
+func (pel *PerEndpointSlidingWindowLimiter) Decide(userID, method, path string, n int) ratelimit.Decision {
+	endpointKey := config.HTTPEndpointKey(method, path)
+	limits := pel.config.GetHTTPMethodLimits(endpointKey)
+
+	tripped, err := pel.decideKeys(userID, endpointKey, limits, n, 0)
+	if err != nil {
+		// Handle Memcache failure based on failure mode
+		pel.LogError(userID, err)
+		return failureDecision(pel.HandleFailure(), limits)
+	}
+	return decision(limits, tripped)
+}
+
+// GetRemainingTokens returns the number of remaining tokens for a user-endpoint combination
+func (pel *PerEndpointSlidingWindowLimiter) GetRemainingTokens(userID, method, path string) int {
+	endpointKey := config.HTTPEndpointKey(method, path)
+	limits := pel.config.GetHTTPMethodLimits(endpointKey)
+
+	remaining, err := pel.remainingForKeys(userID, endpointKey, limits)
+	if err != nil {
+		// On failure, return full capacity (conservative approach)
+		pel.LogError(userID, err)
+		return limits[0].Rate
+	}
+	return remaining
+}
+
+// GRPCMethodSlidingWindowLimiter enforces per-method rate limits for gRPC per user using a sliding window
+type GRPCMethodSlidingWindowLimiter struct {
+	*SlidingWindowLimiter
+}
+
+// NewGRPCMethodSlidingWindowLimiter creates a distributed gRPC per-method limiter using a sliding window
+func NewGRPCMethodSlidingWindowLimiter(
+	client memcache.ClientInterface,
+	cfg config.Config,
+) *GRPCMethodSlidingWindowLimiter {
+	defaultLimit := config.Limit{
+		Rate:   cfg.GRPCDefaultMethodRate,
+		Period: cfg.GRPCDefaultMethodPeriod,
+		Burst:  cfg.GRPCDefaultMethodRate,
+	}
+	return &GRPCMethodSlidingWindowLimiter{
+		SlidingWindowLimiter: newSlidingWindowLimiter(client, cfg, scopeGRPCMethod, []config.Limit{defaultLimit}),
+	}
+}
+
+// Allow checks if the gRPC request for the given user and method is allowed
+// Returns true if allowed, false if rate limited
+func (gml *GRPCMethodSlidingWindowLimiter) Allow(userID, method string) bool {
+	return gml.AllowN(userID, method, 1)
+}
+
+// AllowN checks if a gRPC request costing n tokens for the given user and method is allowed
+// Returns true if allowed, false if rate limited
+func (gml *GRPCMethodSlidingWindowLimiter) AllowN(userID, method string, n int) bool {
+	return gml.Decide(userID, method, n).Allowed
+}
+
+// Decide checks a gRPC request costing n tokens against the sliding window of every limit of the method
+// When the request is rejected, the decision names the limit that tripped
+func (gml *GRPCMethodSlidingWindowLimiter) Decide(userID, method string, n int) ratelimit.Decision {
+	limits := gml.config.GetGRPCMethodLimits(method)
+
+	tripped, err := gml.decideKeys(userID, method, limits, n, 0)
+	if err != nil {
+		// Handle Memcache failure based on failure mode
+		gml.LogError(userID, err)
+		return failureDecision(gml.HandleFailure(), limits)
+	}
+	return decision(limits, tripped)
+}
+
+// GetRemainingTokens returns the number of remaining tokens for a user-method combination
+func (gml *GRPCMethodSlidingWindowLimiter) GetRemainingTokens(userID, method string) int {
+	limits := gml.config.GetGRPCMethodLimits(method)
+
+	remaining, err := gml.remainingForKeys(userID, method, limits)
+	if err != nil {
+		// On failure, return full capacity (conservative approach)
+		gml.LogError(userID, err)
+		return limits[0].Rate
+	}
+	return remaining
+}
+
+// remainingFromEstimate converts a weighted request count into whole remaining tokens
+func remainingFromEstimate(rate int, estimate float64) int {
+	remaining := int(float64(rate) - estimate)
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining
+}
@@ -0,0 +1,223 @@
+package distributed
+
+import (
+	"testing"
+	"time"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/memcache"
+)
+
+func TestSlidingWindowLimiter_WeightsPreviousWindow(t *testing.T) {
+	mock := memcache.NewMockClient()
+	cfg := config.DefaultConfig()
+	cfg.GlobalRate = 10
+
+	limiter := NewGlobalSlidingWindowLimiter(mock, cfg)
+	clock := &fakeClock{now: time.Unix(1000, int64(900*time.Millisecond))}
+	limiter.now = clock.Now
+
+	userID := "user123"
+
+	// Fill the window just before the boundary
+	for i := 0; i < 10; i++ {
+		if !limiter.Allow(userID) {
+			t.Errorf("Request %d should be allowed", i+1)
+		}
+	}
+	if limiter.Allow(userID) {
+		t.Error("Request beyond rate should be denied")
+	}
+
+	// 25% into the next window, 75% of the previous count still applies
+	clock.Advance(350 * time.Millisecond)
+	if remaining := limiter.GetRemainingTokens(userID); remaining != 2 {
+		t.Errorf("Remaining tokens = %d, want 2 (10 - 0.75*10)", remaining)
+	}
+
+	// A fixed window would allow another 10 requests here
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		if limiter.Allow(userID) {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("Allowed %d requests after boundary, want 2", allowed)
+	}
+
+	// Once the previous window no longer overlaps, the full rate is available again
+	clock.Advance(time.Second)
+	if remaining := limiter.GetRemainingTokens(userID); remaining < 7 {
+		t.Errorf("Remaining tokens = %d, want at least 7", remaining)
+	}
+}
+
+func TestSlidingWindowLimiter_RejectionsAreNotCounted(t *testing.T) {
+	mock := memcache.NewMockClient()
+	cfg := config.DefaultConfig()
+	cfg.HTTPRate = 2
+
+	limiter := NewHTTPSlidingWindowLimiter(mock, cfg)
+	clock := &fakeClock{now: time.Unix(2000, 0)}
+	limiter.now = clock.Now
+
+	userID := "user123"
+
+	for i := 0; i < 5; i++ {
+		limiter.Allow(userID)
+	}
+
+	count, err := mock.Get(limiter.windowKeyAt(userID, "", 2000))
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Stored count = %d, want 2", count)
+	}
+}
+
+// racingClient admits race requests of another instance into a counter just before each increment,
+// as if that instance had passed its own check at the same time
+type racingClient struct {
+	*memcache.MockClient
+	race uint64
+}
+
+func (c *racingClient) IncrementWithExpiration(key string, delta uint64, expiration time.Duration) (uint64, error) {
+	if _, err := c.MockClient.IncrementWithExpiration(key, c.race, expiration); err != nil {
+		return 0, err
+	}
+	return c.MockClient.IncrementWithExpiration(key, delta, expiration)
+}
+
+func TestSlidingWindowLimiter_RaceRejectionsAreNotCounted(t *testing.T) {
+	mock := memcache.NewMockClient()
+	cfg := config.DefaultConfig()
+	cfg.GlobalRate = 2
+
+	limiter := NewGlobalSlidingWindowLimiter(&racingClient{MockClient: mock, race: 2}, cfg)
+	clock := &fakeClock{now: time.Unix(3000, 0)}
+	limiter.now = clock.Now
+
+	userID := "user123"
+
+	// The request passes the check, but loses the race on the re-check
+	if limiter.Allow(userID) {
+		t.Fatal("Request admitted by another instance at the same time should be rejected")
+	}
+
+	// Only the racing instance's requests stay counted
+	count, err := mock.Get(limiter.windowKeyAt(userID, "", 3000))
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Stored count = %d, want 2", count)
+	}
+}
+
+func TestSlidingWindowLimiter_FailureModeDeny(t *testing.T) {
+	mock := memcache.NewMockClient()
+	cfg := config.DefaultConfig()
+	cfg.MemcacheFailureMode = config.FailureModeDeny
+
+	limiter := NewGRPCSlidingWindowLimiter(mock, cfg)
+
+	// Close the mock to simulate failure
+	_ = mock.Close()
+
+	if limiter.Allow("user123") {
+		t.Error("Request should be denied in fail-closed mode")
+	}
+}
+
+func TestPerEndpointSlidingWindowLimiter_Allow(t *testing.T) {
+	mock := memcache.NewMockClient()
+	cfg := config.DefaultConfig()
+	cfg.HTTPDefaultMethodRate = 1
+	cfg.HTTPMethods = map[string]int{"GET:/api/users": 3}
+
+	limiter := NewPerEndpointSlidingWindowLimiter(mock, cfg)
+	limiter.now = (&fakeClock{now: time.Unix(3000, 0)}).Now
+
+	userID := "user123"
+
+	for i := 0; i < 3; i++ {
+		if !limiter.Allow(userID, "GET", "/api/users") {
+			t.Errorf("Request %d to configured endpoint should be allowed", i+1)
+		}
+	}
+	if limiter.Allow(userID, "GET", "/api/users") {
+		t.Error("Fourth request to configured endpoint should be denied")
+	}
+
+	if !limiter.Allow(userID, "GET", "/api/orders") {
+		t.Error("First request to default endpoint should be allowed")
+	}
+	if remaining := limiter.GetRemainingTokens(userID, "GET", "/api/orders"); remaining != 0 {
+		t.Errorf("Remaining tokens = %d, want 0", remaining)
+	}
+}
+
+func TestGRPCMethodSlidingWindowLimiter_Allow(t *testing.T) {
+	mock := memcache.NewMockClient()
+	cfg := config.DefaultConfig()
+	cfg.GRPCDefaultMethodRate = 1
+	cfg.GRPCMethods = map[string]int{"/users.Service/Get": 3}
+
+	limiter := NewGRPCMethodSlidingWindowLimiter(mock, cfg)
+	limiter.now = (&fakeClock{now: time.Unix(3000, 0)}).Now
+
+	userID := "user123"
+
+	for i := 0; i < 3; i++ {
+		if !limiter.Allow(userID, "/users.Service/Get") {
+			t.Errorf("Request %d to configured method should be allowed", i+1)
+		}
+	}
+	if limiter.Allow(userID, "/users.Service/Get") {
+		t.Error("Fourth request to configured method should be denied")
+	}
+
+	if !limiter.Allow(userID, "/users.Service/List") {
+		t.Error("First request to default method should be allowed")
+	}
+	if remaining := limiter.GetRemainingTokens(userID, "/users.Service/List"); remaining != 0 {
+		t.Errorf("Remaining tokens = %d, want 0", remaining)
+	}
+}
+
+func TestSlidingWindowLimiter_Reserve(t *testing.T) {
+	mock := memcache.NewMockClient()
+	cfg := config.DefaultConfig()
+	cfg.GlobalRate = 10
+
+	limiter := NewGlobalSlidingWindowLimiter(mock, cfg)
+	clock := &fakeClock{now: time.Unix(1000, int64(500*time.Millisecond))}
+	limiter.now = clock.Now
+
+	userID := "user123"
+
+	// The current window has room
+	if r := limiter.Reserve(userID, 10); !r.OK() || r.DelayFrom(clock.Now()) != 0 {
+		t.Errorf("Reserve(10) = ok %v, delay %v, want ok without delay", r.OK(), r.DelayFrom(clock.Now()))
+	}
+
+	// The next window must wait until 40% of this window's count has slid out
+	r := limiter.Reserve(userID, 4)
+	if delay := r.DelayFrom(clock.Now()); !r.OK() || delay != 900*time.Millisecond {
+		t.Errorf("Reserve(4) = ok %v, delay %v, want ok with 900ms delay", r.OK(), delay)
+	}
+
+	// Cancelling gives the tokens back to the next window
+	r.Cancel()
+	if count, _ := mock.Get(cfg.GetWindowMemcacheKey("global", userID, "", 1001)); count != 0 {
+		t.Errorf("Next window count after cancel = %d, want 0", count)
+	}
+
+	// A cost larger than the rate is never granted
+	if limiter.Reserve(userID, 11).OK() {
+		t.Error("Reserve(11) should not be granted with a rate of 10")
+	}
+}
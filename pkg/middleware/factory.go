@@ -1,13 +1,19 @@
 package middleware
 
 import (
+	"context"
+	"log"
+
 	"rate_limiter_service/internal/config"
 	"rate_limiter_service/pkg/memcache"
 	"rate_limiter_service/pkg/middleware/distributed"
+	"rate_limiter_service/pkg/ratelimit"
 )
 
 // LimiterFactory creates limiters based on configuration
 // Returns in-memory limiters by default, distributed limiters when Memcache is configured
+// Each tier's algorithm selects its limiter; tiers without one use config.DistributedAlgorithm
+// when Memcache is configured, which defaults to fixed-window counters
 type LimiterFactory struct {
 	config config.Config
 }
@@ -19,61 +25,210 @@ func NewLimiterFactory(cfg config.Config) *LimiterFactory {
 	}
 }
 
+// newMemcacheClient creates a Memcache client from the configuration
+func (lf *LimiterFactory) newMemcacheClient() memcache.ClientInterface {
+	return memcache.NewClient(
+		lf.config.MemcacheServers,
+		lf.config.MemcacheTimeout,
+		lf.config.MemcacheMaxIdleConns,
+	)
+}
+
+// distributedAlgorithm returns the Memcache algorithm of a tier using the given algorithm, or "" if
+// the tier stays in memory
+// Token and leaky buckets are kept on the local instance even when Memcache is configured; tiers
+// without an algorithm use config.DistributedAlgorithm
+func (lf *LimiterFactory) distributedAlgorithm(algorithm config.Algorithm) config.Algorithm {
+	if !lf.config.IsDistributedEnabled() {
+		return ""
+	}
+	if algorithm == "" {
+		return lf.config.DistributedAlgorithm
+	}
+	if algorithm.IsDistributed() {
+		return algorithm
+	}
+	return ""
+}
+
 // CreateGlobalLimiter creates a global limiter (in-memory or distributed)
 func (lf *LimiterFactory) CreateGlobalLimiter() GlobalLimiterInterface {
-	if lf.config.IsDistributedEnabled() {
-		client := memcache.NewClient(
-			lf.config.MemcacheServers,
-			lf.config.MemcacheTimeout,
-			lf.config.MemcacheMaxIdleConns,
-		)
-		return distributed.NewGlobalLimiter(client, lf.config)
+	if algorithm := lf.distributedAlgorithm(lf.config.GlobalAlgorithm); algorithm != "" {
+		client := lf.newMemcacheClient()
+		switch algorithm {
+		case config.AlgorithmGCRA:
+			return distributed.NewGlobalGCRALimiter(client, lf.config)
+		case config.AlgorithmSlidingWindow:
+			return distributed.NewGlobalSlidingWindowLimiter(client, lf.config)
+		default:
+			return distributed.NewGlobalLimiter(client, lf.config)
+		}
 	}
 	return NewGlobalLimiter(lf.config)
 }
 
 // CreatePerEndpointLimiter creates a per-endpoint limiter (in-memory or distributed)
+// Strict endpoints always use an in-memory sliding log, even when the other endpoints are distributed
 func (lf *LimiterFactory) CreatePerEndpointLimiter() PerEndpointLimiterInterface {
-	if lf.config.IsDistributedEnabled() {
-		client := memcache.NewClient(
-			lf.config.MemcacheServers,
-			lf.config.MemcacheTimeout,
-			lf.config.MemcacheMaxIdleConns,
-		)
-		return distributed.NewPerEndpointLimiter(client, lf.config)
+	limiter := lf.createPerEndpointLimiter()
+	if _, inMemory := limiter.(*PerEndpointLimiter); inMemory || len(lf.config.HTTPMethodStrict) == 0 {
+		return limiter
+	}
+	return &strictEndpointLimiter{
+		config: lf.config,
+		strict: NewPerEndpointLimiter(lf.config),
+		other:  limiter,
+	}
+}
+
+// createPerEndpointLimiter creates the per-endpoint limiter of the tier algorithm
+func (lf *LimiterFactory) createPerEndpointLimiter() PerEndpointLimiterInterface {
+	if algorithm := lf.distributedAlgorithm(lf.config.HTTPMethodAlgorithm); algorithm != "" {
+		client := lf.newMemcacheClient()
+		switch algorithm {
+		case config.AlgorithmGCRA:
+			return distributed.NewPerEndpointGCRALimiter(client, lf.config)
+		case config.AlgorithmSlidingWindow:
+			return distributed.NewPerEndpointSlidingWindowLimiter(client, lf.config)
+		default:
+			return distributed.NewPerEndpointLimiter(client, lf.config)
+		}
 	}
 	return NewPerEndpointLimiter(lf.config)
 }
 
 // CreateHTTPLimiter creates an HTTP-only limiter (in-memory or distributed)
 func (lf *LimiterFactory) CreateHTTPLimiter() HTTPLimiterInterface {
-	if lf.config.IsDistributedEnabled() {
-		client := memcache.NewClient(
-			lf.config.MemcacheServers,
-			lf.config.MemcacheTimeout,
-			lf.config.MemcacheMaxIdleConns,
-		)
-		return distributed.NewHTTPLimiter(client, lf.config)
+	if algorithm := lf.distributedAlgorithm(lf.config.HTTPAlgorithm); algorithm != "" {
+		client := lf.newMemcacheClient()
+		switch algorithm {
+		case config.AlgorithmGCRA:
+			return distributed.NewHTTPGCRALimiter(client, lf.config)
+		case config.AlgorithmSlidingWindow:
+			return distributed.NewHTTPSlidingWindowLimiter(client, lf.config)
+		default:
+			return distributed.NewHTTPLimiter(client, lf.config)
+		}
 	}
 	return NewHTTPLimiter(lf.config)
 }
 
+// CreateGRPCMethodLimiter creates a distributed gRPC per-method limiter, or nil if the tier's
+// algorithm keeps it in memory; the in-memory limiter is the grpc package's InMemoryGRPCMethodLimiter
+func (lf *LimiterFactory) CreateGRPCMethodLimiter() GRPCMethodLimiterInterface {
+	algorithm := lf.distributedAlgorithm(lf.config.GRPCMethodAlgorithm)
+	if algorithm == "" {
+		return nil
+	}
+	client := lf.newMemcacheClient()
+	switch algorithm {
+	case config.AlgorithmGCRA:
+		return distributed.NewGRPCMethodGCRALimiter(client, lf.config)
+	case config.AlgorithmSlidingWindow:
+		return distributed.NewGRPCMethodSlidingWindowLimiter(client, lf.config)
+	default:
+		return distributed.NewGRPCMethodLimiter(client, lf.config)
+	}
+}
+
 // CreateGRPCLimiter creates a gRPC-only limiter (in-memory or distributed)
 func (lf *LimiterFactory) CreateGRPCLimiter() GRPCLimiterInterface {
-	if lf.config.IsDistributedEnabled() {
-		client := memcache.NewClient(
-			lf.config.MemcacheServers,
-			lf.config.MemcacheTimeout,
-			lf.config.MemcacheMaxIdleConns,
-		)
-		return distributed.NewGRPCLimiter(client, lf.config)
+	if algorithm := lf.distributedAlgorithm(lf.config.GRPCAlgorithm); algorithm != "" {
+		client := lf.newMemcacheClient()
+		switch algorithm {
+		case config.AlgorithmGCRA:
+			return distributed.NewGRPCGCRALimiter(client, lf.config)
+		case config.AlgorithmSlidingWindow:
+			return distributed.NewGRPCSlidingWindowLimiter(client, lf.config)
+		default:
+			return distributed.NewGRPCLimiter(client, lf.config)
+		}
 	}
 	return NewGRPCLimiter(lf.config)
 }
 
+// CreateQuotaLimiter creates a calendar quota limiter, or returns nil if no quotas are configured
+// Counters are kept in Memcache when it is configured, otherwise in memory and, if config.QuotaFile
+// is set, persisted to that file; a quota file that cannot be loaded is logged and quotas start empty
+// Limiters created for the same quota file share their counters, see OpenQuotaLimiter
+func (lf *LimiterFactory) CreateQuotaLimiter() QuotaLimiterInterface {
+	if len(lf.config.Quotas) == 0 {
+		return nil
+	}
+	if lf.config.IsDistributedEnabled() {
+		return distributed.NewQuotaLimiter(lf.newMemcacheClient(), lf.config)
+	}
+
+	limiter, err := OpenQuotaLimiter(lf.config)
+	if err != nil {
+		log.Printf("quota limiter: %v", err)
+	}
+	return limiter
+}
+
+// CreateCreditLimiter creates a prepaid credit limiter, or returns nil if no user is charged credits
+// Balances are kept in Memcache when it is configured, otherwise in memory and, if config.CreditFile
+// is set, persisted to that file; a credit file that cannot be loaded is logged and balances start at zero
+// Limiters created for the same credit file share their balances, see OpenCreditLimiter
+func (lf *LimiterFactory) CreateCreditLimiter() CreditLimiterInterface {
+	if !lf.config.HasCredits() {
+		return nil
+	}
+	if lf.config.IsDistributedEnabled() {
+		return distributed.NewCreditLimiter(lf.newMemcacheClient(), lf.config)
+	}
+
+	limiter, err := OpenCreditLimiter(lf.config)
+	if err != nil {
+		log.Printf("credit limiter: %v", err)
+	}
+	return limiter
+}
+
+// CreatePenaltyBox creates a penalty box (in-memory or distributed), or returns nil if
+// config.PenaltyThreshold is zero
+func (lf *LimiterFactory) CreatePenaltyBox() PenaltyBoxInterface {
+	if lf.config.PenaltyThreshold <= 0 {
+		return nil
+	}
+	if lf.config.IsDistributedEnabled() {
+		return distributed.NewPenaltyBox(lf.newMemcacheClient(), lf.config)
+	}
+	return NewPenaltyBox(lf.config)
+}
+
+// CreateAggregateLimiter creates a limiter for the limits shared by all users (in-memory or
+// distributed), or returns nil if no aggregate limits are configured
+func (lf *LimiterFactory) CreateAggregateLimiter() AggregateLimiterInterface {
+	if !lf.config.HasAggregateLimits() {
+		return nil
+	}
+	if lf.config.IsDistributedEnabled() {
+		return distributed.NewAggregateLimiter(lf.newMemcacheClient(), lf.config)
+	}
+	return NewAggregateLimiter(lf.config)
+}
+
+// CreateLevelLimiter creates a limiter for the identity hierarchy levels other than the user
+// (in-memory or distributed), or returns nil if no identity hierarchy is configured
+func (lf *LimiterFactory) CreateLevelLimiter() LevelLimiterInterface {
+	if !lf.config.HasIdentityHierarchy() {
+		return nil
+	}
+	if lf.config.IsDistributedEnabled() {
+		return distributed.NewLevelLimiter(lf.newMemcacheClient(), lf.config)
+	}
+	return NewLevelLimiter(lf.config)
+}
+
 // GlobalLimiterInterface defines the interface for global limiters
 type GlobalLimiterInterface interface {
 	Allow(userID string) bool
+	AllowN(userID string, n int) bool
+	Decide(userID string, n int) ratelimit.Decision
+	DecideWithReserve(userID string, n int, reserved float64) ratelimit.Decision
+	Reserve(userID string, n int) *ratelimit.Reservation
+	Wait(ctx context.Context, userID string, n int) error
 	GetRemainingTokens(userID string) int
 	Reset()
 }
@@ -81,13 +236,28 @@ type GlobalLimiterInterface interface {
 // PerEndpointLimiterInterface defines the interface for per-endpoint limiters
 type PerEndpointLimiterInterface interface {
 	Allow(userID, method, path string) bool
+	AllowN(userID, method, path string, n int) bool
+	Decide(userID, method, path string, n int) ratelimit.Decision
 	GetRemainingTokens(userID, method, path string) int
 	Reset()
 }
 
+// GRPCMethodLimiterInterface defines the interface for gRPC per-method limiters
+type GRPCMethodLimiterInterface interface {
+	Allow(userID, method string) bool
+	AllowN(userID, method string, n int) bool
+	Decide(userID, method string, n int) ratelimit.Decision
+	Reset()
+}
+
 // HTTPLimiterInterface defines the interface for HTTP-only limiters
 type HTTPLimiterInterface interface {
 	Allow(userID string) bool
+	AllowN(userID string, n int) bool
+	Decide(userID string, n int) ratelimit.Decision
+	DecideWithReserve(userID string, n int, reserved float64) ratelimit.Decision
+	Reserve(userID string, n int) *ratelimit.Reservation
+	Wait(ctx context.Context, userID string, n int) error
 	GetRemainingTokens(userID string) int
 	Reset()
 }
@@ -95,6 +265,11 @@ type HTTPLimiterInterface interface {
 // GRPCLimiterInterface defines the interface for gRPC-only limiters
 type GRPCLimiterInterface interface {
 	Allow(userID string) bool
+	AllowN(userID string, n int) bool
+	Decide(userID string, n int) ratelimit.Decision
+	DecideWithReserve(userID string, n int, reserved float64) ratelimit.Decision
+	Reserve(userID string, n int) *ratelimit.Reservation
+	Wait(ctx context.Context, userID string, n int) error
 	GetRemainingTokens(userID string) int
 	Reset()
 }
@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"rate_limiter_service/internal/config"
+)
+
+func TestLimiterFactory_TierAlgorithms(t *testing.T) {
+	base := config.Config{
+		GlobalRate:           100,
+		GlobalBurstSize:      10,
+		HTTPRate:             50,
+		HTTPBurstSize:        5,
+		GRPCRate:             30,
+		GRPCBurstSize:        3,
+		PerEndpointRate:      10,
+		PerEndpointBurstSize: 5,
+		MemcacheServers:      []string{"localhost:11211"},
+		MemcacheTimeout:      100 * time.Millisecond,
+		DistributedAlgorithm: config.AlgorithmFixedWindow,
+	}
+
+	tests := []struct {
+		name        string
+		global      config.Algorithm
+		http        config.Algorithm
+		perEndpoint config.Algorithm
+		grpc        config.Algorithm
+		grpcMethod  config.Algorithm
+		memcache    bool
+		expected    []string
+	}{
+		{
+			name: "in memory without memcache",
+			expected: []string{
+				"*middleware.GlobalLimiter",
+				"*middleware.HTTPLimiter",
+				"*middleware.PerEndpointLimiter",
+				"*middleware.GRPCLimiter",
+				"<nil>",
+			},
+		},
+		{
+			name:     "distributed algorithm by default",
+			memcache: true,
+			expected: []string{
+				"*distributed.GlobalLimiter",
+				"*distributed.HTTPLimiter",
+				"*distributed.PerEndpointLimiter",
+				"*distributed.GRPCLimiter",
+				"*distributed.GRPCMethodLimiter",
+			},
+		},
+		{
+			name:        "mixed algorithms",
+			global:      config.AlgorithmSlidingWindow,
+			http:        config.AlgorithmGCRA,
+			perEndpoint: config.AlgorithmTokenBucket,
+			grpc:        config.AlgorithmLeakyBucket,
+			grpcMethod:  config.AlgorithmGCRA,
+			memcache:    true,
+			expected: []string{
+				"*distributed.SlidingWindowLimiter",
+				"*distributed.GCRALimiter",
+				"*middleware.PerEndpointLimiter",
+				"*middleware.GRPCLimiter",
+				"*distributed.GRPCMethodGCRALimiter",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base
+			if !tt.memcache {
+				cfg.MemcacheServers = nil
+			}
+			cfg.GlobalAlgorithm = tt.global
+			cfg.HTTPAlgorithm = tt.http
+			cfg.HTTPMethodAlgorithm = tt.perEndpoint
+			cfg.GRPCAlgorithm = tt.grpc
+			cfg.GRPCMethodAlgorithm = tt.grpcMethod
+			factory := NewLimiterFactory(cfg)
+
+			limiters := []any{
+				factory.CreateGlobalLimiter(),
+				factory.CreateHTTPLimiter(),
+				factory.CreatePerEndpointLimiter(),
+				factory.CreateGRPCLimiter(),
+				factory.CreateGRPCMethodLimiter(),
+			}
+			for i, limiter := range limiters {
+				if got := fmt.Sprintf("%T", limiter); got != tt.expected[i] {
+					t.Errorf("limiter %d = %s, want %s", i, got, tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterFactory_StrictEndpoints(t *testing.T) {
+	cfg := config.Config{
+		PerEndpointRate:      10,
+		PerEndpointBurstSize: 5,
+		MemcacheServers:      []string{"localhost:11211"},
+		MemcacheTimeout:      100 * time.Millisecond,
+		DistributedAlgorithm: config.AlgorithmFixedWindow,
+		HTTPMethods:          map[string]int{"POST /api/payments": 1},
+		HTTPMethodStrict:     map[string]bool{"POST /api/payments": true},
+	}
+
+	// Strict endpoints stay in memory while the others share Memcache
+	limiter, ok := NewLimiterFactory(cfg).CreatePerEndpointLimiter().(*strictEndpointLimiter)
+	if !ok {
+		t.Fatal("CreatePerEndpointLimiter() should route strict endpoints to an in-memory limiter")
+	}
+	if got := fmt.Sprintf("%T", limiter.limiterFor("POST", "/api/payments")); got != "*middleware.PerEndpointLimiter" {
+		t.Errorf("strict endpoint limiter = %s, want *middleware.PerEndpointLimiter", got)
+	}
+	if got := fmt.Sprintf("%T", limiter.limiterFor("GET", "/api/users")); got != "*distributed.PerEndpointLimiter" {
+		t.Errorf("other endpoint limiter = %s, want *distributed.PerEndpointLimiter", got)
+	}
+
+	if !limiter.Allow("user123", "POST", "/api/payments") {
+		t.Fatal("First strict request should be allowed")
+	}
+	if limiter.Allow("user123", "POST", "/api/payments") {
+		t.Error("Second strict request should be rejected")
+	}
+
+	// Without Memcache the in-memory limiter handles strict endpoints itself
+	cfg.MemcacheServers = nil
+	inMemory := NewLimiterFactory(cfg).CreatePerEndpointLimiter()
+	if got := fmt.Sprintf("%T", inMemory); got != "*middleware.PerEndpointLimiter" {
+		t.Errorf("CreatePerEndpointLimiter() = %s, want *middleware.PerEndpointLimiter", got)
+	}
+}
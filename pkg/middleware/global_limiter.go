@@ -1,9 +1,11 @@
 package middleware
 
 import (
+	"context"
 	"sync"
 
 	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/ratelimit"
 )
 
 // GlobalLimiter enforces global rate limits per user across all endpoints
@@ -11,8 +13,8 @@ type GlobalLimiter struct {
 	// config holds the rate limiting configuration
 	config config.Config
 
-	// buckets stores token buckets keyed by userID
-	buckets sync.Map // map[string]*TokenBucket
+	// buckets stores token or leaky buckets keyed by userID
+	buckets sync.Map // map[string]Bucket
 }
 
 // NewGlobalLimiter creates a new global rate limiter
@@ -25,25 +27,52 @@ func NewGlobalLimiter(cfg config.Config) *GlobalLimiter {
 // Allow checks if the request for the given user is allowed globally
 // Returns true if allowed, false if rate limited
 func (gl *GlobalLimiter) Allow(userID string) bool {
-	bucket := gl.getOrCreateBucket(userID)
-	return bucket.Allow()
+	return gl.AllowN(userID, 1)
 }
 
-// getOrCreateBucket retrieves or creates a token bucket for the given user
-func (gl *GlobalLimiter) getOrCreateBucket(userID string) *TokenBucket {
+// AllowN checks if a request costing n tokens for the given user is allowed
+// Returns true if allowed, false if rate limited
+func (gl *GlobalLimiter) AllowN(userID string, n int) bool {
+	return ratelimit.Admitted(gl.Decide(userID, n))
+}
+
+// Decide checks a request costing n tokens against every limit of the tier
+// When the request is rejected, the decision names the limit that tripped
+func (gl *GlobalLimiter) Decide(userID string, n int) ratelimit.Decision {
+	return gl.DecideWithReserve(userID, n, 0)
+}
+
+// DecideWithReserve checks a request like Decide, but only admits it if the reserved share of every
+// limit stays available for higher priority classes
+func (gl *GlobalLimiter) DecideWithReserve(userID string, n int, reserved float64) ratelimit.Decision {
+	return DecideBucketWithReserve(gl.getOrCreateBucket(userID), n, reserved, gl.config.GetGlobalLimits)
+}
+
+// Reserve grants n tokens for the given user globally ahead of time without blocking
+func (gl *GlobalLimiter) Reserve(userID string, n int) *ratelimit.Reservation {
+	return gl.getOrCreateBucket(userID).ReserveN(n)
+}
+
+// Wait blocks until n tokens are available for the given user globally or ctx is done
+func (gl *GlobalLimiter) Wait(ctx context.Context, userID string, n int) error {
+	return ratelimit.Wait(ctx, gl.Reserve(userID, n))
+}
+
+// getOrCreateBucket retrieves or creates a bucket for the given user
+func (gl *GlobalLimiter) getOrCreateBucket(userID string) Bucket {
 	// Try to load existing bucket
 	if bucket, ok := gl.buckets.Load(userID); ok {
-		return bucket.(*TokenBucket)
+		return bucket.(Bucket)
 	}
 
 	// Create new bucket
-	bucket := NewTokenBucket(gl.config.GlobalBurstSize, gl.config.GlobalRate)
+	bucket := NewBucketForTier(gl.config.GlobalAlgorithm, gl.config.GetGlobalLimits(), gl.config.GlobalStart)
 
 	// Store it (may have been created by another goroutine in the meantime)
 	actual, loaded := gl.buckets.LoadOrStore(userID, bucket)
 	if loaded {
 		// Another goroutine created it, return that one instead
-		return actual.(*TokenBucket)
+		return actual.(Bucket)
 	}
 
 	return bucket
@@ -52,11 +81,11 @@ func (gl *GlobalLimiter) getOrCreateBucket(userID string) *TokenBucket {
 // GetRemainingTokens returns the number of remaining tokens for a user globally
 func (gl *GlobalLimiter) GetRemainingTokens(userID string) int {
 	if bucket, ok := gl.buckets.Load(userID); ok {
-		return bucket.(*TokenBucket).GetTokens()
+		return bucket.(Bucket).GetTokens()
 	}
 
-	// If no bucket exists yet, return the full capacity
-	return gl.config.GlobalBurstSize
+	// If no bucket exists yet, return what a new bucket starts with
+	return gl.config.GlobalStart.InitialTokens(gl.config.GlobalBurstSize)
 }
 
 // Reset clears all rate limiting state for testing purposes
@@ -69,8 +98,8 @@ type HTTPLimiter struct {
 	// config holds the rate limiting configuration
 	config config.Config
 
-	// buckets stores token buckets keyed by userID
-	buckets sync.Map // map[string]*TokenBucket
+	// buckets stores token or leaky buckets keyed by userID
+	buckets sync.Map // map[string]Bucket
 }
 
 // NewHTTPLimiter creates a new HTTP-only rate limiter
@@ -83,25 +112,52 @@ func NewHTTPLimiter(cfg config.Config) *HTTPLimiter {
 // Allow checks if the HTTP request for the given user is allowed
 // Returns true if allowed, false if rate limited
 func (hl *HTTPLimiter) Allow(userID string) bool {
-	bucket := hl.getOrCreateBucket(userID)
-	return bucket.Allow()
+	return hl.AllowN(userID, 1)
+}
+
+// AllowN checks if a request costing n tokens for the given user is allowed
+// Returns true if allowed, false if rate limited
+func (hl *HTTPLimiter) AllowN(userID string, n int) bool {
+	return ratelimit.Admitted(hl.Decide(userID, n))
+}
+
+// Decide checks a request costing n tokens against every limit of the tier
+// When the request is rejected, the decision names the limit that tripped
+func (hl *HTTPLimiter) Decide(userID string, n int) ratelimit.Decision {
+	return hl.DecideWithReserve(userID, n, 0)
+}
+
+// DecideWithReserve checks a request like Decide, but only admits it if the reserved share of every
+// limit stays available for higher priority classes
+func (hl *HTTPLimiter) DecideWithReserve(userID string, n int, reserved float64) ratelimit.Decision {
+	return DecideBucketWithReserve(hl.getOrCreateBucket(userID), n, reserved, hl.config.GetHTTPLimits)
+}
+
+// Reserve grants n tokens for the given user for HTTP requests ahead of time without blocking
+func (hl *HTTPLimiter) Reserve(userID string, n int) *ratelimit.Reservation {
+	return hl.getOrCreateBucket(userID).ReserveN(n)
+}
+
+// Wait blocks until n tokens are available for the given user for HTTP requests or ctx is done
+func (hl *HTTPLimiter) Wait(ctx context.Context, userID string, n int) error {
+	return ratelimit.Wait(ctx, hl.Reserve(userID, n))
 }
 
-// getOrCreateBucket retrieves or creates a token bucket for the given user
-func (hl *HTTPLimiter) getOrCreateBucket(userID string) *TokenBucket {
+// getOrCreateBucket retrieves or creates a bucket for the given user
+func (hl *HTTPLimiter) getOrCreateBucket(userID string) Bucket {
 	// Try to load existing bucket
 	if bucket, ok := hl.buckets.Load(userID); ok {
-		return bucket.(*TokenBucket)
+		return bucket.(Bucket)
 	}
 
 	// Create new bucket
-	bucket := NewTokenBucket(hl.config.HTTPBurstSize, hl.config.HTTPRate)
+	bucket := NewBucketForTier(hl.config.HTTPAlgorithm, hl.config.GetHTTPLimits(), hl.config.HTTPStart)
 
 	// Store it (may have been created by another goroutine in the meantime)
 	actual, loaded := hl.buckets.LoadOrStore(userID, bucket)
 	if loaded {
 		// Another goroutine created it, return that one instead
-		return actual.(*TokenBucket)
+		return actual.(Bucket)
 	}
 
 	return bucket
@@ -110,11 +166,11 @@ func (hl *HTTPLimiter) getOrCreateBucket(userID string) *TokenBucket {
 // GetRemainingTokens returns the number of remaining tokens for a user for HTTP requests
 func (hl *HTTPLimiter) GetRemainingTokens(userID string) int {
 	if bucket, ok := hl.buckets.Load(userID); ok {
-		return bucket.(*TokenBucket).GetTokens()
+		return bucket.(Bucket).GetTokens()
 	}
 
-	// If no bucket exists yet, return the full capacity
-	return hl.config.HTTPBurstSize
+	// If no bucket exists yet, return what a new bucket starts with
+	return hl.config.HTTPStart.InitialTokens(hl.config.HTTPBurstSize)
 }
 
 // Reset clears all rate limiting state for testing purposes
@@ -127,8 +183,8 @@ type GRPCLimiter struct {
 	// config holds the rate limiting configuration
 	config config.Config
 
-	// buckets stores token buckets keyed by userID
-	buckets sync.Map // map[string]*TokenBucket
+	// buckets stores token or leaky buckets keyed by userID
+	buckets sync.Map // map[string]Bucket
 }
 
 // NewGRPCLimiter creates a new gRPC-only rate limiter
@@ -141,25 +197,52 @@ func NewGRPCLimiter(cfg config.Config) *GRPCLimiter {
 // Allow checks if the gRPC request for the given user is allowed
 // Returns true if allowed, false if rate limited
 func (gl *GRPCLimiter) Allow(userID string) bool {
-	bucket := gl.getOrCreateBucket(userID)
-	return bucket.Allow()
+	return gl.AllowN(userID, 1)
 }
 
-// getOrCreateBucket retrieves or creates a token bucket for the given user
-func (gl *GRPCLimiter) getOrCreateBucket(userID string) *TokenBucket {
+// AllowN checks if a request costing n tokens for the given user is allowed
+// Returns true if allowed, false if rate limited
+func (gl *GRPCLimiter) AllowN(userID string, n int) bool {
+	return ratelimit.Admitted(gl.Decide(userID, n))
+}
+
+// Decide checks a request costing n tokens against every limit of the tier
+// When the request is rejected, the decision names the limit that tripped
+func (gl *GRPCLimiter) Decide(userID string, n int) ratelimit.Decision {
+	return gl.DecideWithReserve(userID, n, 0)
+}
+
+// DecideWithReserve checks a request like Decide, but only admits it if the reserved share of every
+// limit stays available for higher priority classes
+func (gl *GRPCLimiter) DecideWithReserve(userID string, n int, reserved float64) ratelimit.Decision {
+	return DecideBucketWithReserve(gl.getOrCreateBucket(userID), n, reserved, gl.config.GetGRPCLimits)
+}
+
+// Reserve grants n tokens for the given user for gRPC requests ahead of time without blocking
+func (gl *GRPCLimiter) Reserve(userID string, n int) *ratelimit.Reservation {
+	return gl.getOrCreateBucket(userID).ReserveN(n)
+}
+
+// Wait blocks until n tokens are available for the given user for gRPC requests or ctx is done
+func (gl *GRPCLimiter) Wait(ctx context.Context, userID string, n int) error {
+	return ratelimit.Wait(ctx, gl.Reserve(userID, n))
+}
+
+// getOrCreateBucket retrieves or creates a bucket for the given user
+func (gl *GRPCLimiter) getOrCreateBucket(userID string) Bucket {
 	// Try to load existing bucket
 	if bucket, ok := gl.buckets.Load(userID); ok {
-		return bucket.(*TokenBucket)
+		return bucket.(Bucket)
 	}
 
 	// Create new bucket
-	bucket := NewTokenBucket(gl.config.GRPCBurstSize, gl.config.GRPCRate)
+	bucket := NewBucketForTier(gl.config.GRPCAlgorithm, gl.config.GetGRPCLimits(), gl.config.GRPCStart)
 
 	// Store it (may have been created by another goroutine in the meantime)
 	actual, loaded := gl.buckets.LoadOrStore(userID, bucket)
 	if loaded {
 		// Another goroutine created it, return that one instead
-		return actual.(*TokenBucket)
+		return actual.(Bucket)
 	}
 
 	return bucket
@@ -168,14 +251,14 @@ func (gl *GRPCLimiter) getOrCreateBucket(userID string) *TokenBucket {
 // GetRemainingTokens returns the number of remaining tokens for a user for gRPC requests
 func (gl *GRPCLimiter) GetRemainingTokens(userID string) int {
 	if bucket, ok := gl.buckets.Load(userID); ok {
-		return bucket.(*TokenBucket).GetTokens()
+		return bucket.(Bucket).GetTokens()
 	}
 
-	// If no bucket exists yet, return the full capacity
-	return gl.config.GRPCBurstSize
+	// If no bucket exists yet, return what a new bucket starts with
+	return gl.config.GRPCStart.InitialTokens(gl.config.GRPCBurstSize)
 }
 
 // Reset clears all rate limiting state for testing purposes
 func (gl *GRPCLimiter) Reset() {
 	gl.buckets = sync.Map{}
-}
\ No newline at end of file
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rate_limiter_service/internal/config"
+)
+
+func TestGlobalLimiter_Wait(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.GlobalRate = 20 // 50ms per token
+	cfg.GlobalBurstSize = 1
+
+	limiter := NewGlobalLimiter(cfg)
+	userID := "worker"
+
+	// The first token is available immediately
+	if err := limiter.Wait(context.Background(), userID, 1); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+
+	// The second one blocks until the bucket has refilled
+	start := time.Now()
+	if err := limiter.Wait(context.Background(), userID, 1); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Wait() returned after %v, want about 50ms", elapsed)
+	}
+
+	// A deadline before the tokens become available fails and gives them back
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx, userID, 1); err == nil {
+		t.Error("Wait() should fail when the deadline is too early")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if !limiter.Allow(userID) {
+		t.Error("Allow() should succeed once the cancelled reservation's token has refilled")
+	}
+
+	// A cost larger than the burst can never be waited for
+	if err := limiter.Wait(context.Background(), userID, 2); err == nil {
+		t.Error("Wait() should fail for a cost larger than the burst")
+	}
+}
+
+func TestGlobalLimiter_GetRemainingTokens_InitialFill(t *testing.T) {
+	quarter := 0.25
+	cfg := config.DefaultConfig()
+	cfg.GlobalRate = 1
+	cfg.GlobalPeriod = time.Hour
+	cfg.GlobalBurstSize = 8
+	cfg.GlobalStart = config.BucketStart{InitialFill: &quarter}
+
+	limiter := NewGlobalLimiter(cfg)
+
+	// A user without a bucket yet reports what the bucket will start with, not the full burst
+	if remaining := limiter.GetRemainingTokens("user123"); remaining != 2 {
+		t.Errorf("GetRemainingTokens() before the first request = %d, want 2", remaining)
+	}
+	limiter.Allow("user123")
+	if remaining := limiter.GetRemainingTokens("user123"); remaining != 1 {
+		t.Errorf("GetRemainingTokens() after the first request = %d, want 1", remaining)
+	}
+}
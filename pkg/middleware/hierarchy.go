@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"sync"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/ratelimit"
+)
+
+// LevelLimiterInterface defines the interface for limiters of the identity hierarchy levels other
+// than the user, such as organizations and API keys
+type LevelLimiterInterface interface {
+	// Decide charges a request costing n to the limits of an identity at the named level
+	Decide(level, identity string, n int) ratelimit.Decision
+	// Reset clears all level state for testing purposes
+	Reset()
+}
+
+// LevelLimiter enforces the limits of the identity hierarchy levels in memory, with one token
+// bucket per limit and identity
+type LevelLimiter struct {
+	config config.Config
+
+	// mu protects buckets
+	mu sync.Mutex
+	// buckets are keyed by "{level}:{identity}"
+	buckets map[string]*MultiBucket
+}
+
+// NewLevelLimiter creates a new in-memory hierarchy level limiter
+func NewLevelLimiter(cfg config.Config) *LevelLimiter {
+	return &LevelLimiter{
+		config:  cfg,
+		buckets: make(map[string]*MultiBucket),
+	}
+}
+
+// Decide charges a request costing n to the limits of an identity at the named level
+// When the request is rejected, the decision names the limit that tripped
+func (ll *LevelLimiter) Decide(level, identity string, n int) ratelimit.Decision {
+	limits := ll.config.GetLevelLimits(level)
+	if len(limits) == 0 {
+		return ratelimit.Allowed()
+	}
+
+	key := level + ":" + identity
+	ll.mu.Lock()
+	bucket, exists := ll.buckets[key]
+	if !exists {
+		bucket = NewMultiBucket(limits)
+		ll.buckets[key] = bucket
+	}
+	ll.mu.Unlock()
+
+	return bucket.DecideN(max(n, 1))
+}
+
+// Reset clears all level state for testing purposes
+func (ll *LevelLimiter) Reset() {
+	ll.mu.Lock()
+	defer ll.mu.Unlock()
+	ll.buckets = make(map[string]*MultiBucket)
+}
+
+// DecideLevels charges a request costing n to the hierarchy levels above the user if outer is set,
+// or to those below it otherwise, given the request's identity at every level
+// Levels are checked from the innermost to the outermost and levels the request is not identified
+// at are skipped; it returns the decision of the first level to reject the request and its name
+func DecideLevels(
+	ll LevelLimiterInterface,
+	cfg config.Config,
+	identities []string,
+	outer bool,
+	n int,
+) (ratelimit.Decision, string) {
+	user := cfg.GetUserLevel()
+	for i := len(identities) - 1; i >= 0; i-- {
+		if i == user || (i < user) != outer || identities[i] == "" {
+			continue
+		}
+		level := cfg.IdentityLevels[i].Name
+		if d := ll.Decide(level, cfg.GetLevelIdentity(identities, i), n); !d.Allowed {
+			return d, level
+		}
+	}
+	return ratelimit.Allowed(), ""
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"rate_limiter_service/internal/config"
+)
+
+// hierarchyConfig returns a configuration with organizations above users and API keys below them
+func hierarchyConfig() config.Config {
+	return config.Config{
+		IdentityLevels: []config.IdentityLevel{
+			{
+				Name:   "org",
+				Header: "X-Org-ID",
+				Limits: []config.Limit{{Rate: 3, Period: time.Minute, Burst: 3}},
+			},
+			{Name: config.UserLevel},
+			{
+				Name:   "key",
+				Header: "X-API-Key",
+				Limits: []config.Limit{{Rate: 2, Period: time.Minute, Burst: 2}},
+			},
+		},
+	}
+}
+
+func TestLevelLimiter_Decide(t *testing.T) {
+	limiter := NewLevelLimiter(hierarchyConfig())
+
+	for i := 0; i < 3; i++ {
+		if d := limiter.Decide("org", "acme", 1); !d.Allowed {
+			t.Fatalf("Request %d should be allowed", i+1)
+		}
+	}
+	if d := limiter.Decide("org", "acme", 1); d.Allowed || d.Limit.Rate != 3 {
+		t.Fatalf("Fourth request should trip the org limit, got %+v", d)
+	}
+
+	// Each identity has its own buckets, and levels without limits admit everything
+	if d := limiter.Decide("org", "globex", 1); !d.Allowed {
+		t.Error("Request from another org should be allowed")
+	}
+	if d := limiter.Decide(config.UserLevel, "acme/user123", 100); !d.Allowed {
+		t.Error("The user level has no limits of its own and should allow the request")
+	}
+
+	limiter.Reset()
+	if d := limiter.Decide("org", "acme", 1); !d.Allowed {
+		t.Error("Request after Reset() should be allowed")
+	}
+}
+
+func TestDecideLevels(t *testing.T) {
+	cfg := hierarchyConfig()
+	limiter := NewLevelLimiter(cfg)
+
+	tests := []struct {
+		name       string
+		identities []string
+		outer      bool
+		allowed    bool
+		level      string
+	}{
+		{"first key request", []string{"acme", "user1", "key1"}, false, true, ""},
+		{"second key request", []string{"acme", "user1", "key1"}, false, true, ""},
+		{"key limit trips", []string{"acme", "user1", "key1"}, false, false, "key"},
+		{"same key under another user counts separately", []string{"acme", "user2", "key1"}, false, true, ""},
+		{"request without a key skips the level", []string{"acme", "user1", ""}, false, true, ""},
+		{"first org request", []string{"acme", "user1", "key1"}, true, true, ""},
+		{"second org request", []string{"acme", "user2", ""}, true, true, ""},
+		{"third org request", []string{"acme", "user3", ""}, true, true, ""},
+		{"org limit trips for every user", []string{"acme", "user4", ""}, true, false, "org"},
+		{"request without an org skips the level", []string{"", "user4", ""}, true, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, level := DecideLevels(limiter, cfg, tt.identities, tt.outer, 1)
+			if d.Allowed != tt.allowed || level != tt.level {
+				t.Errorf("DecideLevels(%v, outer %v) = %v, %q, want %v, %q",
+					tt.identities, tt.outer, d.Allowed, level, tt.allowed, tt.level)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"rate_limiter_service/internal/config"
+)
+
+// JWTExtractor identifies requests by a claim of the bearer token in the Authorization header or
+// the authorization metadata key, after verifying the token's signature and its exp and nbf claims
+// Requests without a bearer token are left unidentified; tokens that cannot be verified are
+// treated as OnInvalid says
+type JWTExtractor struct {
+	// Keys verify token signatures; a token must be signed with the algorithm of the key
+	Keys []config.JWTKey
+	// Claim is the claim used as the key, e.g. "org_id"; empty means "sub"
+	Claim string
+	// PlanClaim is the claim the user's plan is read from; empty leaves the plan to the plan resolver
+	PlanClaim string
+	// Leeway is the clock skew tolerated when checking exp and nbf
+	Leeway time.Duration
+	// OnInvalid is what to do with tokens that cannot be verified; empty rejects them
+	OnInvalid config.InvalidTokenTreatment
+
+	// now returns the current time; nil means time.Now
+	now func() time.Time
+}
+
+// ExtractHTTP returns the identity the bearer token of the Authorization header asserts
+func (e JWTExtractor) ExtractHTTP(r *http.Request) (Identity, error) {
+	return e.extract(r.Header.Get("Authorization"))
+}
+
+// ExtractGRPC returns the identity the bearer token of the authorization metadata key asserts
+func (e JWTExtractor) ExtractGRPC(ctx context.Context) (Identity, error) {
+	return e.extract(metadataValue(ctx, "authorization"))
+}
+
+// extract verifies the bearer token of an authorization value and returns its identity
+func (e JWTExtractor) extract(authorization string) (Identity, error) {
+	scheme, token, found := strings.Cut(strings.TrimSpace(authorization), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return Identity{}, nil
+	}
+
+	identity, err := e.verify(strings.TrimSpace(token))
+	if err != nil {
+		if e.OnInvalid == config.InvalidTokenIgnore {
+			return Identity{}, nil
+		}
+		return Identity{}, err
+	}
+	return identity, nil
+}
+
+// jwtHeader is the JOSE header of a token
+type jwtHeader struct {
+	Algorithm string          `json:"alg"`
+	KeyID     string          `json:"kid"`
+	Critical  json.RawMessage `json:"crit"`
+}
+
+// verify checks the token's signature and validity period and returns the identity its claims assert
+func (e JWTExtractor) verify(token string) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Identity{}, errors.New("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return Identity{}, fmt.Errorf("malformed token header: %w", err)
+	}
+	if header.Critical != nil {
+		return Identity{}, errors.New("critical token header extensions are not supported")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Identity{}, errors.New("malformed token signature")
+	}
+	if !e.verifySignature(header, []byte(parts[0]+"."+parts[1]), signature) {
+		return Identity{}, errors.New("invalid token signature")
+	}
+
+	var claims map[string]any
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return Identity{}, fmt.Errorf("malformed token claims: %w", err)
+	}
+	if err := e.checkValidity(claims); err != nil {
+		return Identity{}, err
+	}
+
+	claim := e.Claim
+	if claim == "" {
+		claim = "sub"
+	}
+	key := claimString(claims[claim])
+	if key == "" {
+		return Identity{}, fmt.Errorf("token has no %s claim", claim)
+	}
+	identity := Identity{Key: key}
+	if e.PlanClaim != "" {
+		identity.Plan = claimString(claims[e.PlanClaim])
+	}
+	return identity, nil
+}
+
+// verifySignature reports whether a key of the token's algorithm, and of its key ID if both name
+// one, signed the signing input
+func (e JWTExtractor) verifySignature(header jwtHeader, signingInput, signature []byte) bool {
+	digest := sha256.Sum256(signingInput)
+	for _, key := range e.Keys {
+		if key.Algorithm != header.Algorithm || (key.ID != "" && header.KeyID != "" && key.ID != header.KeyID) {
+			continue
+		}
+
+		switch public := key.Key.(type) {
+		case []byte:
+			mac := hmac.New(sha256.New, public)
+			_, _ = mac.Write(signingInput)
+			if hmac.Equal(mac.Sum(nil), signature) {
+				return true
+			}
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature) == nil {
+				return true
+			}
+		case *ecdsa.PublicKey:
+			// ES256 signatures are the 32-byte big-endian R and S concatenated
+			if len(signature) != 64 {
+				continue
+			}
+			r := new(big.Int).SetBytes(signature[:32])
+			s := new(big.Int).SetBytes(signature[32:])
+			if ecdsa.Verify(public, digest[:], r, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkValidity checks the exp and nbf claims, allowing for the leeway
+func (e JWTExtractor) checkValidity(claims map[string]any) error {
+	now := time.Now()
+	if e.now != nil {
+		now = e.now()
+	}
+
+	if value, ok := claims["exp"]; ok {
+		exp, err := claimTime(value)
+		if err != nil {
+			return fmt.Errorf("invalid exp claim: %w", err)
+		}
+		if !now.Before(exp.Add(e.Leeway)) {
+			return errors.New("token has expired")
+		}
+	}
+	if value, ok := claims["nbf"]; ok {
+		nbf, err := claimTime(value)
+		if err != nil {
+			return fmt.Errorf("invalid nbf claim: %w", err)
+		}
+		if now.Add(e.Leeway).Before(nbf) {
+			return errors.New("token is not valid yet")
+		}
+	}
+	return nil
+}
+
+// decodeJWTSegment decodes a base64url encoded JSON segment of a token, keeping numbers exact
+func decodeJWTSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// claimString returns a string or numeric claim as a string, or "" for other claims
+func claimString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case json.Number:
+		return v.String()
+	default:
+		return ""
+	}
+}
+
+// claimTime converts a NumericDate claim, the number of seconds since the Unix epoch, to a time
+func claimTime(value any) (time.Time, error) {
+	number, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, errors.New("not a number")
+	}
+	seconds, err := number.Float64()
+	if err != nil || math.IsInf(seconds, 0) || math.Abs(seconds) > 1e15 {
+		return time.Time{}, errors.New("out of range")
+	}
+	whole, fraction := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(fraction*1e9)), nil
+}
@@ -0,0 +1,210 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+
+	"rate_limiter_service/internal/config"
+)
+
+// signTestJWT returns a token with the given header and claims signed with key
+func signTestJWT(t *testing.T, header, claims map[string]any, key any) string {
+	t.Helper()
+
+	encode := func(v any) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("Failed to encode token segment: %v", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signingInput := encode(header) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		_, _ = mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTExtractor_ExtractHTTP(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %v", err)
+	}
+
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	extractor := JWTExtractor{
+		Keys: []config.JWTKey{
+			{ID: "hmac", Algorithm: config.JWTAlgorithmHS256, Key: secret},
+			{ID: "rsa", Algorithm: config.JWTAlgorithmRS256, Key: &rsaKey.PublicKey},
+			{Algorithm: config.JWTAlgorithmES256, Key: &ecKey.PublicKey},
+		},
+		PlanClaim: "plan",
+		Leeway:    30 * time.Second,
+		now:       func() time.Time { return now },
+	}
+	valid := map[string]any{"sub": "user123", "plan": "pro", "exp": now.Add(time.Hour).Unix()}
+	numeric := map[string]any{"sub": 42}
+
+	tests := []struct {
+		name          string
+		authorization string
+		identity      Identity
+		hasError      bool
+	}{
+		{
+			name:          "HS256",
+			authorization: "Bearer " + signTestJWT(t, map[string]any{"alg": "HS256", "kid": "hmac"}, valid, secret),
+			identity:      Identity{Key: "user123", Plan: "pro"},
+		},
+		{
+			name:          "RS256",
+			authorization: "Bearer " + signTestJWT(t, map[string]any{"alg": "RS256"}, valid, rsaKey),
+			identity:      Identity{Key: "user123", Plan: "pro"},
+		},
+		{
+			name:          "ES256 with a lowercase scheme",
+			authorization: "bearer " + signTestJWT(t, map[string]any{"alg": "ES256", "kid": "any"}, valid, ecKey),
+			identity:      Identity{Key: "user123", Plan: "pro"},
+		},
+		{
+			name:          "numeric claim",
+			authorization: "Bearer " + signTestJWT(t, map[string]any{"alg": "HS256"}, numeric, secret),
+			identity:      Identity{Key: "42"},
+		},
+		{
+			name:          "no token",
+			authorization: "",
+		},
+		{
+			name:          "basic credentials",
+			authorization: "Basic dXNlcjpwYXNz",
+		},
+		{
+			name:          "malformed token",
+			authorization: "Bearer not-a-token",
+			hasError:      true,
+		},
+		{
+			name: "wrong secret",
+			authorization: "Bearer " + signTestJWT(t, map[string]any{"alg": "HS256"}, valid,
+				[]byte("fedcba9876543210fedcba9876543210")),
+			hasError: true,
+		},
+		{
+			name:          "key ID of another key",
+			authorization: "Bearer " + signTestJWT(t, map[string]any{"alg": "HS256", "kid": "rsa"}, valid, secret),
+			hasError:      true,
+		},
+		{
+			name:          "unsigned token",
+			authorization: "Bearer " + signTestJWT(t, map[string]any{"alg": "none"}, valid, nil),
+			hasError:      true,
+		},
+		{
+			name: "expired",
+			authorization: "Bearer " + signTestJWT(t, map[string]any{"alg": "HS256"},
+				map[string]any{"sub": "user123", "exp": now.Add(-time.Minute).Unix()}, secret),
+			hasError: true,
+		},
+		{
+			name: "expired within the leeway",
+			authorization: "Bearer " + signTestJWT(t, map[string]any{"alg": "HS256"},
+				map[string]any{"sub": "user123", "exp": now.Add(-10 * time.Second).Unix()}, secret),
+			identity: Identity{Key: "user123"},
+		},
+		{
+			name: "not valid yet",
+			authorization: "Bearer " + signTestJWT(t, map[string]any{"alg": "HS256"},
+				map[string]any{"sub": "user123", "nbf": now.Add(time.Minute).Unix()}, secret),
+			hasError: true,
+		},
+		{
+			name: "missing claim",
+			authorization: "Bearer " + signTestJWT(t, map[string]any{"alg": "HS256"},
+				map[string]any{"org_id": "acme"}, secret),
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/users", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			identity, err := extractor.ExtractHTTP(req)
+			if (err != nil) != tt.hasError {
+				t.Fatalf("ExtractHTTP() error = %v, hasError %v", err, tt.hasError)
+			}
+			if identity != tt.identity {
+				t.Errorf("ExtractHTTP() = %+v, want %+v", identity, tt.identity)
+			}
+		})
+	}
+}
+
+func TestJWTExtractor_ExtractGRPC(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	extractor := JWTExtractor{
+		Keys:  []config.JWTKey{{Algorithm: config.JWTAlgorithmHS256, Key: secret}},
+		Claim: "org_id",
+	}
+	token := signTestJWT(t, map[string]any{"alg": "HS256"}, map[string]any{"sub": "user123", "org_id": "acme"}, secret)
+	forged := signTestJWT(t, map[string]any{"alg": "HS256"}, map[string]any{"org_id": "acme"}, []byte("guess"))
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	if identity, err := extractor.ExtractGRPC(ctx); err != nil || identity.Key != "acme" {
+		t.Errorf("ExtractGRPC() = %+v, %v, want key %q", identity, err, "acme")
+	}
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+forged))
+	if _, err := extractor.ExtractGRPC(ctx); err == nil {
+		t.Error("ExtractGRPC() should reject a forged token")
+	}
+
+	// Ignored tokens leave the call to the next extractor
+	extractor.OnInvalid = config.InvalidTokenIgnore
+	identity, err := ChainExtractor{extractor, HeaderExtractor{MetadataKey: "user-id"}}.ExtractGRPC(
+		metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+forged, "user-id", "user456")))
+	if err != nil || identity.Key != "user456" {
+		t.Errorf("ExtractGRPC() with an ignored token = %+v, %v, want key %q", identity, err, "user456")
+	}
+}
@@ -0,0 +1,266 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+
+	"rate_limiter_service/internal/config"
+)
+
+// Identity is what a KeyExtractor learns about the caller of a request
+type Identity struct {
+	// Key is the key the request is rate limited under, usually the user ID; empty if the request
+	// does not carry one
+	Key string
+	// Plan is the plan the caller is on, e.g. read from a token claim; empty leaves the plan to the
+	// PlanResolver
+	Plan string
+}
+
+// KeyExtractor extracts the identity a request is rate limited under from an HTTP request or from
+// the incoming context of a gRPC call
+// Both methods return an empty Identity if the request does not carry a key, and an error if the
+// request must be rejected as unauthenticated, such as one with a forged token
+type KeyExtractor interface {
+	ExtractHTTP(r *http.Request) (Identity, error)
+	ExtractGRPC(ctx context.Context) (Identity, error)
+}
+
+// NewKeyExtractor creates the extractor described by config.KeyExtractors, or one reading
+// config.UserHeader and config.GrpcMetadataKey if no extractors are configured
+func NewKeyExtractor(cfg config.Config) KeyExtractor {
+	if len(cfg.KeyExtractors) == 0 {
+		return HeaderExtractor{Header: cfg.UserHeader, MetadataKey: cfg.GrpcMetadataKey}
+	}
+
+	chain := make(ChainExtractor, 0, len(cfg.KeyExtractors))
+	for _, extractor := range cfg.KeyExtractors {
+		switch extractor.Type {
+		case config.KeyExtractorHeader:
+			chain = append(chain, HeaderExtractor{Header: extractor.Headers[0], MetadataKey: extractor.MetadataKeys[0]})
+		case config.KeyExtractorHeaders:
+			chain = append(chain, HeadersExtractor{Headers: extractor.Headers, MetadataKeys: extractor.MetadataKeys})
+		case config.KeyExtractorCookie:
+			chain = append(chain, CookieExtractor{Name: extractor.Name})
+		case config.KeyExtractorQuery:
+			chain = append(chain, QueryExtractor{Param: extractor.Name})
+		case config.KeyExtractorContext:
+			chain = append(chain, ContextExtractor{})
+		case config.KeyExtractorIP:
+			chain = append(chain, ClientIPExtractor{
+				TrustedProxies:   extractor.TrustedProxies,
+				IPv6PrefixLength: extractor.IPv6PrefixLength,
+				Header:           extractor.ForwardedHeader,
+			})
+		case config.KeyExtractorJWT:
+			chain = append(chain, JWTExtractor{
+				Keys:      extractor.JWTKeys,
+				Claim:     extractor.Claim,
+				PlanClaim: extractor.PlanClaim,
+				Leeway:    extractor.Leeway,
+				OnInvalid: extractor.OnInvalid,
+			})
+		case config.KeyExtractorAPIKey:
+			chain = append(chain, APIKeyExtractor{
+				Store:       NewAPIKeyStore(extractor.KeysFile, extractor.APIKeys, extractor.ReloadInterval),
+				Header:      extractor.Headers[0],
+				Param:       extractor.Name,
+				MetadataKey: extractor.MetadataKeys[0],
+				OnInvalid:   extractor.OnInvalid,
+			})
+		case config.KeyExtractorClientCert:
+			chain = append(chain, ClientCertExtractor{
+				Sources:     extractor.CertSources,
+				TrustDomain: extractor.TrustDomain,
+			})
+		}
+	}
+	return chain
+}
+
+// HeaderExtractor reads the key from an HTTP header or a gRPC metadata key
+// An empty Header or MetadataKey leaves requests of that protocol unidentified
+type HeaderExtractor struct {
+	Header      string
+	MetadataKey string
+}
+
+// ExtractHTTP returns the value of the header
+func (e HeaderExtractor) ExtractHTTP(r *http.Request) (Identity, error) {
+	if e.Header == "" {
+		return Identity{}, nil
+	}
+	return Identity{Key: strings.TrimSpace(r.Header.Get(e.Header))}, nil
+}
+
+// ExtractGRPC returns the first value of the metadata key
+func (e HeaderExtractor) ExtractGRPC(ctx context.Context) (Identity, error) {
+	return Identity{Key: metadataValue(ctx, e.MetadataKey)}, nil
+}
+
+// HeadersExtractor reads the key from the first of several HTTP headers or gRPC metadata keys that
+// is set, e.g. a user header falling back to a client header
+type HeadersExtractor struct {
+	Headers      []string
+	MetadataKeys []string
+}
+
+// ExtractHTTP returns the value of the first header set
+func (e HeadersExtractor) ExtractHTTP(r *http.Request) (Identity, error) {
+	for _, header := range e.Headers {
+		if key := strings.TrimSpace(r.Header.Get(header)); key != "" {
+			return Identity{Key: key}, nil
+		}
+	}
+	return Identity{}, nil
+}
+
+// ExtractGRPC returns the first value of the first metadata key set
+func (e HeadersExtractor) ExtractGRPC(ctx context.Context) (Identity, error) {
+	for _, metadataKey := range e.MetadataKeys {
+		if key := metadataValue(ctx, metadataKey); key != "" {
+			return Identity{Key: key}, nil
+		}
+	}
+	return Identity{}, nil
+}
+
+// CookieExtractor reads the key from an HTTP cookie; gRPC calls are left unidentified
+type CookieExtractor struct {
+	Name string
+}
+
+// ExtractHTTP returns the value of the cookie
+func (e CookieExtractor) ExtractHTTP(r *http.Request) (Identity, error) {
+	cookie, err := r.Cookie(e.Name)
+	if err != nil {
+		return Identity{}, nil
+	}
+	return Identity{Key: strings.TrimSpace(cookie.Value)}, nil
+}
+
+// ExtractGRPC returns an empty Identity
+func (e CookieExtractor) ExtractGRPC(context.Context) (Identity, error) {
+	return Identity{}, nil
+}
+
+// QueryExtractor reads the key from an HTTP query parameter; gRPC calls are left unidentified
+type QueryExtractor struct {
+	Param string
+}
+
+// ExtractHTTP returns the value of the query parameter
+func (e QueryExtractor) ExtractHTTP(r *http.Request) (Identity, error) {
+	return Identity{Key: strings.TrimSpace(r.URL.Query().Get(e.Param))}, nil
+}
+
+// ExtractGRPC returns an empty Identity
+func (e QueryExtractor) ExtractGRPC(context.Context) (Identity, error) {
+	return Identity{}, nil
+}
+
+// keyContextKey is the context key ContextWithKey stores the key under
+type keyContextKey struct{}
+
+// ContextWithKey returns a copy of ctx carrying the key the request is rate limited under, for an
+// authentication middleware or interceptor running before the rate limiter to pass on the
+// identity it verified to a ContextExtractor
+func ContextWithKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, keyContextKey{}, key)
+}
+
+// ContextExtractor reads the key from a value of the request context
+// Key is the context key the value is stored under; nil reads the key stored by ContextWithKey
+// The value must be a string or a fmt.Stringer
+type ContextExtractor struct {
+	Key any
+}
+
+// ExtractHTTP returns the value stored in the request context
+func (e ContextExtractor) ExtractHTTP(r *http.Request) (Identity, error) {
+	return e.ExtractGRPC(r.Context())
+}
+
+// ExtractGRPC returns the value stored in the call context
+func (e ContextExtractor) ExtractGRPC(ctx context.Context) (Identity, error) {
+	contextKey := e.Key
+	if contextKey == nil {
+		contextKey = keyContextKey{}
+	}
+	switch value := ctx.Value(contextKey).(type) {
+	case string:
+		return Identity{Key: strings.TrimSpace(value)}, nil
+	case fmt.Stringer:
+		return Identity{Key: strings.TrimSpace(value.String())}, nil
+	default:
+		return Identity{}, nil
+	}
+}
+
+// FuncExtractor adapts functions supplied by the embedding application, such as a lookup of a
+// session token, to a KeyExtractor
+// A nil function leaves requests of that protocol unidentified
+type FuncExtractor struct {
+	HTTP func(r *http.Request) string
+	GRPC func(ctx context.Context) string
+}
+
+// ExtractHTTP returns the key e.HTTP(r) returns
+func (e FuncExtractor) ExtractHTTP(r *http.Request) (Identity, error) {
+	if e.HTTP == nil {
+		return Identity{}, nil
+	}
+	return Identity{Key: e.HTTP(r)}, nil
+}
+
+// ExtractGRPC returns the key e.GRPC(ctx) returns
+func (e FuncExtractor) ExtractGRPC(ctx context.Context) (Identity, error) {
+	if e.GRPC == nil {
+		return Identity{}, nil
+	}
+	return Identity{Key: e.GRPC(ctx)}, nil
+}
+
+// ChainExtractor tries several extractors in order and returns the first identity found
+// An extractor returning an error stops the chain
+type ChainExtractor []KeyExtractor
+
+// ExtractHTTP returns the first identity an extractor finds in the request
+func (c ChainExtractor) ExtractHTTP(r *http.Request) (Identity, error) {
+	for _, extractor := range c {
+		if identity, err := extractor.ExtractHTTP(r); err != nil || identity.Key != "" {
+			return identity, err
+		}
+	}
+	return Identity{}, nil
+}
+
+// ExtractGRPC returns the first identity an extractor finds in the call
+func (c ChainExtractor) ExtractGRPC(ctx context.Context) (Identity, error) {
+	for _, extractor := range c {
+		if identity, err := extractor.ExtractGRPC(ctx); err != nil || identity.Key != "" {
+			return identity, err
+		}
+	}
+	return Identity{}, nil
+}
+
+// metadataValue returns the first value of a key of the incoming gRPC metadata, or ""
+func metadataValue(ctx context.Context, key string) string {
+	if key == "" {
+		return ""
+	}
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(values[0])
+}
@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/metadata"
+
+	"rate_limiter_service/internal/config"
+)
+
+// authContextKey is a context key of an upstream authentication middleware
+type authContextKey struct{}
+
+func TestKeyExtractor_ExtractHTTP(t *testing.T) {
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest("GET", "/api/users?user_id=query-user", nil)
+		req.Header.Set("X-Client-ID", "client-user")
+		req.AddCookie(&http.Cookie{Name: "session_user", Value: "cookie-user"})
+		return req
+	}
+
+	tests := []struct {
+		name      string
+		extractor KeyExtractor
+		request   func(*http.Request) *http.Request
+		expected  string
+	}{
+		{
+			name:      "header",
+			extractor: HeaderExtractor{Header: "X-Client-ID"},
+			expected:  "client-user",
+		},
+		{
+			name:      "missing header",
+			extractor: HeaderExtractor{Header: "X-User-ID", MetadataKey: "user-id"},
+			expected:  "",
+		},
+		{
+			name:      "fallback headers",
+			extractor: HeadersExtractor{Headers: []string{"X-User-ID", "X-Client-ID"}},
+			expected:  "client-user",
+		},
+		{
+			name:      "cookie",
+			extractor: CookieExtractor{Name: "session_user"},
+			expected:  "cookie-user",
+		},
+		{
+			name:      "query parameter",
+			extractor: QueryExtractor{Param: "user_id"},
+			expected:  "query-user",
+		},
+		{
+			name:      "context key",
+			extractor: ContextExtractor{},
+			request: func(r *http.Request) *http.Request {
+				return r.WithContext(ContextWithKey(r.Context(), "context-user"))
+			},
+			expected: "context-user",
+		},
+		{
+			name:      "custom context key",
+			extractor: ContextExtractor{Key: authContextKey{}},
+			request: func(r *http.Request) *http.Request {
+				return r.WithContext(context.WithValue(r.Context(), authContextKey{}, "auth-user"))
+			},
+			expected: "auth-user",
+		},
+		{
+			name:      "function",
+			extractor: FuncExtractor{HTTP: func(r *http.Request) string { return "func-" + r.URL.Path }},
+			expected:  "func-/api/users",
+		},
+		{
+			name: "chain",
+			extractor: ChainExtractor{
+				ContextExtractor{},
+				HeaderExtractor{Header: "X-User-ID"},
+				CookieExtractor{Name: "session_user"},
+				QueryExtractor{Param: "user_id"},
+			},
+			expected: "cookie-user",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newRequest()
+			if tt.request != nil {
+				req = tt.request(req)
+			}
+			if identity, err := tt.extractor.ExtractHTTP(req); err != nil || identity.Key != tt.expected {
+				t.Errorf("ExtractHTTP() = %+v, %v, want key %q", identity, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestKeyExtractor_ExtractGRPC(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{
+		"client-id": " client-user ",
+	}))
+
+	tests := []struct {
+		name      string
+		extractor KeyExtractor
+		ctx       context.Context
+		expected  string
+	}{
+		{
+			name:      "metadata key",
+			extractor: HeaderExtractor{Header: "X-Client-ID", MetadataKey: "client-id"},
+			expected:  "client-user",
+		},
+		{
+			name:      "no metadata",
+			extractor: HeaderExtractor{MetadataKey: "client-id"},
+			ctx:       context.Background(),
+			expected:  "",
+		},
+		{
+			name:      "fallback metadata keys",
+			extractor: HeadersExtractor{MetadataKeys: []string{"user-id", "client-id"}},
+			expected:  "client-user",
+		},
+		{
+			name:      "cookies do not apply",
+			extractor: CookieExtractor{Name: "client-id"},
+			expected:  "",
+		},
+		{
+			name:      "context key",
+			extractor: ContextExtractor{},
+			ctx:       ContextWithKey(ctx, "context-user"),
+			expected:  "context-user",
+		},
+		{
+			name:      "function without gRPC",
+			extractor: FuncExtractor{HTTP: func(*http.Request) string { return "func-user" }},
+			expected:  "",
+		},
+		{
+			name: "chain",
+			extractor: ChainExtractor{
+				QueryExtractor{Param: "user_id"},
+				ContextExtractor{},
+				HeaderExtractor{MetadataKey: "client-id"},
+			},
+			expected: "client-user",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callCtx := tt.ctx
+			if callCtx == nil {
+				callCtx = ctx
+			}
+			if identity, err := tt.extractor.ExtractGRPC(callCtx); err != nil || identity.Key != tt.expected {
+				t.Errorf("ExtractGRPC() = %+v, %v, want key %q", identity, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewKeyExtractor(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/users?user_id=query-user", nil)
+	req.Header.Set("X-User-ID", "header-user")
+
+	// Without extractors, the user header identifies requests
+	cfg := config.Config{UserHeader: "X-User-ID", GrpcMetadataKey: "user-id"}
+	if identity, _ := NewKeyExtractor(cfg).ExtractHTTP(req); identity.Key != "header-user" {
+		t.Errorf("ExtractHTTP() = %q, want %q", identity.Key, "header-user")
+	}
+
+	// Configured extractors replace it
+	cfg.KeyExtractors = []config.KeyExtractor{
+		{Type: config.KeyExtractorCookie, Name: "session_user"},
+		{Type: config.KeyExtractorQuery, Name: "user_id"},
+	}
+	if identity, _ := NewKeyExtractor(cfg).ExtractHTTP(req); identity.Key != "query-user" {
+		t.Errorf("ExtractHTTP() = %q, want %q", identity.Key, "query-user")
+	}
+}
@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"rate_limiter_service/pkg/ratelimit"
+)
+
+// LeakyBucket represents a leaky bucket traffic shaper
+// Instead of rejecting bursts, it smooths them to a constant outflow: every admitted
+// request is scheduled to depart one leak interval after the previous one and Allow
+// blocks until then. Requests are only rejected when the bucket's queue is full.
+type LeakyBucket struct {
+	// mu protects concurrent access to the bucket
+	mu sync.Mutex
+
+	// capacity is the maximum number of requests queued in the bucket, including the departing one
+	capacity int
+
+	// leakRate is the number of requests leaving the bucket per period
+	leakRate int
+
+	// leakInterval is the time between two departures
+	leakInterval time.Duration
+
+	// lastDeparture is the scheduled departure time of the most recently admitted request
+	lastDeparture time.Time
+}
+
+// NewLeakyBucket creates a new leaky bucket with the specified queue capacity and leak rate per second
+func NewLeakyBucket(capacity int, leakRate int) *LeakyBucket {
+	return NewLeakyBucketWithPeriod(capacity, leakRate, time.Second)
+}
+
+// NewLeakyBucketWithPeriod creates a new leaky bucket leaking leakRate requests per period
+func NewLeakyBucketWithPeriod(capacity int, leakRate int, period time.Duration) *LeakyBucket {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	if leakRate <= 0 {
+		leakRate = 1
+	}
+	if period <= 0 {
+		period = time.Second
+	}
+
+	return &LeakyBucket{
+		capacity:     capacity,
+		leakRate:     leakRate,
+		leakInterval: period / time.Duration(leakRate),
+	}
+}
+
+// Allow queues one request and blocks until its scheduled departure time.
+// Returns true once the request may proceed, false immediately if the queue is full.
+func (lb *LeakyBucket) Allow() bool {
+	return lb.AllowN(1)
+}
+
+// AllowN queues a request costing n units and blocks until its scheduled departure time.
+// The request occupies n slots of the queue and departs once all n units have leaked.
+func (lb *LeakyBucket) AllowN(n int) bool {
+	return lb.AllowNWithReserve(n, 0)
+}
+
+// AllowNWithReserve queues a request costing n units like AllowN, but only while the reserved
+// share of the queue, kept for requests of higher priority classes, stays free.
+func (lb *LeakyBucket) AllowNWithReserve(n int, reserved float64) bool {
+	return ratelimit.Wait(context.Background(), lb.ReserveNWithReserve(n, reserved)) == nil
+}
+
+// Reserve schedules a departure for one request without waiting for it.
+// The reservation is not granted if the queue is full.
+func (lb *LeakyBucket) Reserve() *ratelimit.Reservation {
+	return lb.ReserveN(1)
+}
+
+// ReserveN schedules a departure for a request costing n units without waiting for it.
+// The reservation's delay is the time until the departure; it is not granted if the
+// queue cannot hold n more units. Cancelling it frees the slots only while it is still
+// the most recently queued request.
+func (lb *LeakyBucket) ReserveN(n int) *ratelimit.Reservation {
+	return lb.reserveN(n, 0)
+}
+
+// ReserveNWithReserve schedules a departure like ReserveN, but only while the reserved share of the
+// queue, kept for requests of higher priority classes, stays free.
+func (lb *LeakyBucket) ReserveNWithReserve(n int, reserved float64) *ratelimit.Reservation {
+	return lb.reserveN(n, ratelimit.ReservedTokens(lb.capacity, reserved))
+}
+
+// reserveN schedules a departure like ReserveN while keeping the given number of queue slots free
+func (lb *LeakyBucket) reserveN(n int, keep int) *ratelimit.Reservation {
+	if n <= 0 {
+		n = 1
+	}
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	now := time.Now()
+	departure := lb.nextDeparture(now).Add(time.Duration(n-1) * lb.leakInterval)
+
+	if lb.pending(now, departure) >= lb.capacity-keep {
+		return ratelimit.NotGranted()
+	}
+
+	lb.lastDeparture = departure
+	return ratelimit.NewReservation(departure, func() {
+		lb.mu.Lock()
+		defer lb.mu.Unlock()
+		if lb.lastDeparture.Equal(departure) {
+			lb.lastDeparture = departure.Add(-time.Duration(n) * lb.leakInterval)
+		}
+	})
+}
+
+// nextDeparture returns the earliest departure time for a request arriving at now
+func (lb *LeakyBucket) nextDeparture(now time.Time) time.Time {
+	if lb.lastDeparture.IsZero() {
+		return now
+	}
+
+	departure := lb.lastDeparture.Add(lb.leakInterval)
+	if departure.Before(now) {
+		return now
+	}
+	return departure
+}
+
+// pending returns the number of queued requests that depart before the given departure time
+func (lb *LeakyBucket) pending(now, departure time.Time) int {
+	ahead := departure.Sub(now)
+	return int((ahead + lb.leakInterval - 1) / lb.leakInterval)
+}
+
+// GetTokens returns the number of free slots in the queue
+func (lb *LeakyBucket) GetTokens() int {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	now := time.Now()
+	free := lb.capacity - lb.pending(now, lb.nextDeparture(now))
+	if free < 0 {
+		free = 0
+	}
+	return free
+}
+
+// GetCapacity returns the maximum number of queued requests
+func (lb *LeakyBucket) GetCapacity() int {
+	return lb.capacity
+}
+
+// Reset empties the queue
+func (lb *LeakyBucket) Reset() {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.lastDeparture = time.Time{}
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"rate_limiter_service/internal/config"
+)
+
+func TestNewLeakyBucket(t *testing.T) {
+	tests := []struct {
+		name             string
+		capacity         int
+		leakRate         int
+		expectedCap      int
+		expectedInterval time.Duration
+	}{
+		{
+			name:             "normal capacity and rate",
+			capacity:         5,
+			leakRate:         10,
+			expectedCap:      5,
+			expectedInterval: 100 * time.Millisecond,
+		},
+		{
+			name:             "zero capacity defaults to 1",
+			capacity:         0,
+			leakRate:         10,
+			expectedCap:      1,
+			expectedInterval: 100 * time.Millisecond,
+		},
+		{
+			name:             "zero leak rate defaults to 1",
+			capacity:         5,
+			leakRate:         0,
+			expectedCap:      5,
+			expectedInterval: time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lb := NewLeakyBucket(tt.capacity, tt.leakRate)
+			if lb.GetCapacity() != tt.expectedCap {
+				t.Errorf("capacity = %d, want %d", lb.GetCapacity(), tt.expectedCap)
+			}
+			if lb.leakInterval != tt.expectedInterval {
+				t.Errorf("leakInterval = %v, want %v", lb.leakInterval, tt.expectedInterval)
+			}
+		})
+	}
+}
+
+func TestLeakyBucket_Reserve(t *testing.T) {
+	lb := NewLeakyBucket(3, 10) // queue of 3, one departure every 100ms
+
+	// Each admitted request departs one interval after the previous one
+	expected := []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond}
+	for i, want := range expected {
+		reservation := lb.Reserve()
+		if !reservation.OK() {
+			t.Fatalf("Reserve() %d should succeed", i+1)
+		}
+		delay := reservation.Delay()
+		if delay < want-10*time.Millisecond || delay > want {
+			t.Errorf("Reserve() %d delay = %v, want about %v", i+1, delay, want)
+		}
+	}
+
+	// The queue is full now
+	if lb.Reserve().OK() {
+		t.Error("Reserve() should fail when the queue is full")
+	}
+	if tokens := lb.GetTokens(); tokens != 0 {
+		t.Errorf("GetTokens() = %d, want 0", tokens)
+	}
+
+	// Cancelling the most recent reservation frees its slot
+	lb.Reset()
+	lb.Reserve()
+	last := lb.Reserve()
+	last.Cancel()
+	if tokens := lb.GetTokens(); tokens != 2 {
+		t.Errorf("GetTokens() after cancel = %d, want 2", tokens)
+	}
+
+	// Reset empties the queue
+	lb.Reset()
+	if tokens := lb.GetTokens(); tokens != 3 {
+		t.Errorf("GetTokens() after reset = %d, want 3", tokens)
+	}
+}
+
+func TestLeakyBucket_AllowSmoothsBursts(t *testing.T) {
+	lb := NewLeakyBucket(5, 20) // one departure every 50ms
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	departures := make(chan time.Duration, 5)
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if lb.Allow() {
+				departures <- time.Since(start)
+			}
+		}()
+	}
+	wg.Wait()
+	close(departures)
+
+	var last time.Duration
+	count := 0
+	for d := range departures {
+		count++
+		if d > last {
+			last = d
+		}
+	}
+
+	if count != 5 {
+		t.Errorf("Allowed %d requests, want 5 (queued, not rejected)", count)
+	}
+	// The fifth request departs four intervals after the first
+	if last < 190*time.Millisecond {
+		t.Errorf("Last departure after %v, want at least 200ms", last)
+	}
+}
+
+func TestNewBucket(t *testing.T) {
+	if _, ok := NewBucket("", 5, 10, time.Second).(*TokenBucket); !ok {
+		t.Error("empty algorithm should create a TokenBucket")
+	}
+	if _, ok := NewBucket(config.AlgorithmTokenBucket, 5, 10, time.Second).(*TokenBucket); !ok {
+		t.Error("token_bucket should create a TokenBucket")
+	}
+	if _, ok := NewBucket(config.AlgorithmLeakyBucket, 5, 10, time.Second).(*LeakyBucket); !ok {
+		t.Error("leaky_bucket should create a LeakyBucket")
+	}
+}
@@ -1,11 +1,16 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/ratelimit"
 )
 
 // Middleware wraps an HTTP handler with rate limiting
@@ -14,104 +19,528 @@ type Middleware struct {
 	perEndpointLimiter PerEndpointLimiterInterface
 	globalLimiter      GlobalLimiterInterface
 	httpLimiter        HTTPLimiterInterface
+	concurrencyLimiter *ConcurrencyLimiter
+	adaptiveLimiter    *AdaptiveLimiter
+	quotaLimiter       QuotaLimiterInterface
+	creditLimiter      CreditLimiterInterface
+	keyExtractor       KeyExtractor
+	penaltyBox         PenaltyBoxInterface
+	aggregateLimiter   AggregateLimiterInterface
+	levelLimiter       LevelLimiterInterface
+	planResolver       PlanResolver
+	// plans holds the rate limiters of each plan; users on no plan use the limiters above
+	plans map[string]rateLimiters
+}
+
+// Option configures optional behavior of a Middleware
+type Option func(*Middleware)
+
+// WithConcurrencyLimiter makes the middleware count in-flight requests in the given limiter,
+// for example one shared with the gRPC interceptor so per-user ceilings span both protocols
+func WithConcurrencyLimiter(cl *ConcurrencyLimiter) Option {
+	return func(m *Middleware) {
+		m.concurrencyLimiter = cl
+	}
+}
+
+// WithAdaptiveLimiter makes the middleware shed load with the given adaptive limiter,
+// for example one shared with the gRPC interceptor so the in-flight limit covers the whole process
+func WithAdaptiveLimiter(al *AdaptiveLimiter) Option {
+	return func(m *Middleware) {
+		m.adaptiveLimiter = al
+	}
+}
+
+// WithQuotaLimiter makes the middleware charge calendar quotas to the given limiter,
+// for example one shared with the gRPC interceptor so quotas count both protocols
+func WithQuotaLimiter(ql QuotaLimiterInterface) Option {
+	return func(m *Middleware) {
+		m.quotaLimiter = ql
+	}
+}
+
+// WithKeyExtractor makes the middleware identify users with the given extractor instead of the
+// extractors in the config
+func WithKeyExtractor(ke KeyExtractor) Option {
+	return func(m *Middleware) {
+		m.keyExtractor = ke
+	}
+}
+
+// WithCreditLimiter makes the middleware charge prepaid credits to the given limiter,
+// for example one shared with the gRPC interceptor so both protocols draw from the same balances
+func WithCreditLimiter(cl CreditLimiterInterface) Option {
+	return func(m *Middleware) {
+		m.creditLimiter = cl
+	}
+}
+
+// WithPenaltyBox makes the middleware ban users through the given penalty box,
+// for example one shared with the gRPC interceptor so rejections on both protocols count
+func WithPenaltyBox(pb PenaltyBoxInterface) Option {
+	return func(m *Middleware) {
+		m.penaltyBox = pb
+	}
+}
+
+// WithAggregateLimiter makes the middleware charge limits shared by all users to the given limiter,
+// for example one shared with the gRPC interceptor so service-wide limits count both protocols
+func WithAggregateLimiter(al AggregateLimiterInterface) Option {
+	return func(m *Middleware) {
+		m.aggregateLimiter = al
+	}
+}
+
+// WithLevelLimiter makes the middleware charge the identity hierarchy levels to the given limiter,
+// for example one shared with the gRPC interceptor so organization limits count both protocols
+func WithLevelLimiter(ll LevelLimiterInterface) Option {
+	return func(m *Middleware) {
+		m.levelLimiter = ll
+	}
+}
+
+// WithPlanResolver makes the middleware look up each user's plan with the given resolver
+// instead of the plans.users map of the configuration
+func WithPlanResolver(pr PlanResolver) Option {
+	return func(m *Middleware) {
+		m.planResolver = pr
+	}
 }
 
 // NewMiddleware creates a new rate limiting middleware
-func NewMiddleware(cfg config.Config) *Middleware {
+func NewMiddleware(cfg config.Config, opts ...Option) *Middleware {
 	factory := NewLimiterFactory(cfg)
-	return &Middleware{
+	m := &Middleware{
 		config:             cfg,
 		perEndpointLimiter: factory.CreatePerEndpointLimiter(),
 		globalLimiter:      factory.CreateGlobalLimiter(),
 		httpLimiter:        factory.CreateHTTPLimiter(),
+		concurrencyLimiter: NewConcurrencyLimiter(cfg),
+		quotaLimiter:       factory.CreateQuotaLimiter(),
+		creditLimiter:      factory.CreateCreditLimiter(),
+		keyExtractor:       NewKeyExtractor(cfg),
+		penaltyBox:         factory.CreatePenaltyBox(),
+		aggregateLimiter:   factory.CreateAggregateLimiter(),
+		levelLimiter:       factory.CreateLevelLimiter(),
+		planResolver:       StaticPlanResolver(cfg.PlanUsers),
+	}
+	for name, plan := range cfg.Plans {
+		if m.plans == nil {
+			m.plans = make(map[string]rateLimiters, len(cfg.Plans))
+		}
+		m.plans[name] = newRateLimiters(plan)
+	}
+	if cfg.AdaptiveConcurrency {
+		m.adaptiveLimiter = NewAdaptiveLimiter(cfg)
+	}
+	for _, opt := range opts {
+		opt(m)
 	}
+	return m
 }
 
 // Handler wraps an HTTP handler with rate limiting
 func (m *Middleware) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		userID := m.extractUserID(r)
+		identity, err := m.extractIdentity(r)
+		if err != nil {
+			m.writeUnauthenticatedResponse(w)
+			return
+		}
+		userID := identity.Key
+
+		// Reject banned users before any limiter is evaluated, optionally holding them in a tarpit
+		if m.penaltyBox != nil {
+			if bannedUntil, banned := m.penaltyBox.Banned(userID); banned {
+				Tarpit(r.Context(), m.config.PenaltyTarpit, bannedUntil)
+				m.writeBannedResponse(w, bannedUntil)
+				return
+			}
+		}
+
+		// Shed load before any per-user limiter is charged
+		slot, ok := m.adaptiveLimiter.Acquire()
+		if !ok {
+			m.writeOverloadResponse(w)
+			return
+		}
+		// Requests that are rejected below or panic give the slot back without a latency sample
+		defer slot.Ignore()
+
+		// Hold a concurrency slot until the handler returns, even if it panics
+		ceilings := m.concurrencyLimiter.HTTPCeilings(userID, r.Method, r.URL.Path)
+		release, full := m.concurrencyLimiter.Acquire(ceilings...)
+		if full != nil {
+			m.penalize(userID)
+			m.writeConcurrencyLimitResponse(w, *full)
+			return
+		}
+		defer release()
+
+		// Rates, costs and per-method limits come from the user's plan
+		limiters := m.limitersFor(identity)
+
+		// Bulk endpoints may consume several tokens per request
+		endpointKey := config.HTTPEndpointKey(r.Method, r.URL.Path)
+		cost := limiters.config.GetHTTPMethodCost(endpointKey)
+
+		// Lower priority classes leave a share of the global and HTTP buckets to the classes above them
+		reserved := limiters.config.GetPriorityReserve(m.priority(r, endpointKey))
+
+		// Check the levels below the user, such as API keys, before the user's own limits
+		identities := m.extractIdentities(r, userID)
+		if d, level := m.decideLevels(identities, false, cost); !d.Allowed {
+			m.penalize(userID)
+			m.writeLevelLimitResponse(w, limiters.config, level, d.Limit)
+			return
+		}
+
+		// Traffic shaping tiers schedule the request's departure instead of delaying it; it waits once
+		// every rate limit has admitted it, and gives the departures back if a check rejects it
+		var departures Departures
+		defer departures.Cancel()
 
 		// Check global limit first
-		if !m.globalLimiter.Allow(userID) {
-			m.writeRateLimitResponse(w, "global")
+		if d := departures.Add("global", limiters.global.DecideWithReserve(userID, cost, reserved)); !d.Allowed {
+			m.penalize(userID)
+			m.writeRateLimitResponse(w, limiters.config, "global", d)
 			return
 		}
 
 		// Check HTTP-only limit
-		if !m.httpLimiter.Allow(userID) {
-			m.writeRateLimitResponse(w, "http")
+		if d := departures.Add("http", limiters.http.DecideWithReserve(userID, cost, reserved)); !d.Allowed {
+			m.penalize(userID)
+			m.writeRateLimitResponse(w, limiters.config, "http", d)
 			return
 		}
 
 		// Check per-method limit
-		if !m.perEndpointLimiter.Allow(userID, r.Method, r.URL.Path) {
-			m.writeRateLimitResponse(w, "per-method")
+		d := departures.Add("per-method", limiters.perEndpoint.Decide(userID, r.Method, r.URL.Path, cost))
+		if !d.Allowed {
+			m.penalize(userID)
+			m.writeRateLimitResponse(w, limiters.config, "per-method", d)
 			return
 		}
 
-		// Request allowed, call next handler
+		// Check the levels above the user, such as organizations, once the user's own limits admit the
+		// request; the user is not penalized for the traffic of the rest of the organization
+		if d, level := m.decideLevels(identities, true, cost); !d.Allowed {
+			m.writeLevelLimitResponse(w, limiters.config, level, d.Limit)
+			return
+		}
+
+		// Check the limits shared by all users once the user's own limits admit the request, so one
+		// user's rejected requests do not use them up; the user is not penalized for others' traffic
+		if m.aggregateLimiter != nil {
+			if d := m.aggregateLimiter.DecideHTTP(endpointKey, cost); !d.Allowed {
+				m.writeRateLimitResponse(w, limiters.config, "aggregate", d)
+				return
+			}
+		}
+
+		// Wait for the departures once every rate limit has admitted the request, and before quotas and
+		// credits are charged; a request whose client goes away first leaves the queue instead of
+		// holding its place, and has not used up its quota or paid for a response it never gets
+		// A queued request gives its adaptive slot back while it waits, so the queue is not counted as
+		// load on the backend, and is shed again if the process is at its limit once it leaves
+		queued := departures.Pending()
+		if queued {
+			slot.Ignore()
+		}
+		if tier, d, err := departures.Wait(r.Context()); err != nil {
+			m.writeRateLimitResponse(w, limiters.config, tier, d)
+			return
+		}
+		if queued {
+			if slot, ok = m.adaptiveLimiter.Acquire(); !ok {
+				m.writeOverloadResponse(w)
+				return
+			}
+			defer slot.Ignore()
+		}
+
+		// Check calendar quotas last, so requests rejected by a rate limit do not use them up
+		if m.quotaLimiter != nil {
+			if d := m.quotaLimiter.Decide(userID, cost); !d.Allowed {
+				m.penalize(userID)
+				m.writeQuotaExceededResponse(w, d)
+				return
+			}
+		}
+
+		// Charge prepaid credits after every limit, so rejected requests cost nothing; a request the
+		// balance cannot cover gives back the quota charged above
+		if m.creditLimiter != nil && limiters.config.ChargeCredits {
+			if d := m.creditLimiter.Charge(userID, cost); !d.Allowed {
+				if m.quotaLimiter != nil {
+					m.quotaLimiter.Refund(userID, cost)
+				}
+				m.writeInsufficientCreditsResponse(w, d)
+				return
+			}
+		}
+
+		// Request allowed, call next handler; its latency alone is the adaptive limiter's RTT sample
+		slot.Start()
 		next.ServeHTTP(w, r)
+		slot.Done()
 	})
 }
 
-// extractUserID extracts the user ID from the configured header
-func (m *Middleware) extractUserID(r *http.Request) string {
-	userID := r.Header.Get(m.config.UserHeader)
-	if userID == "" {
-		// If no user header is present, treat as anonymous user
-		// In a real implementation, you might want to handle this differently
-		return "anonymous"
+// extractIdentity extracts the user's identity with the key extractor, falling back to the
+// anonymous key
+func (m *Middleware) extractIdentity(r *http.Request) (Identity, error) {
+	identity, err := m.keyExtractor.ExtractHTTP(r)
+	if err != nil {
+		return Identity{}, err
 	}
-	return userID
+	if identity.Key == "" {
+		identity.Key = m.config.GetAnonymousKey()
+	}
+	return identity, nil
+}
+
+// extractIdentities returns the request's identity at every level of the identity hierarchy, read
+// from the levels' headers, or nil if no hierarchy is configured
+// The user level holds userID; levels whose header is missing are left empty
+func (m *Middleware) extractIdentities(r *http.Request, userID string) []string {
+	if !m.config.HasIdentityHierarchy() {
+		return nil
+	}
+	identities := make([]string, len(m.config.IdentityLevels))
+	for i, level := range m.config.IdentityLevels {
+		switch {
+		case level.Name == config.UserLevel:
+			identities[i] = userID
+		case level.Header != "":
+			identities[i] = strings.TrimSpace(r.Header.Get(level.Header))
+		}
+	}
+	return identities
+}
+
+// decideLevels charges a request to the hierarchy levels above or below the user, see DecideLevels
+func (m *Middleware) decideLevels(identities []string, outer bool, cost int) (ratelimit.Decision, string) {
+	if m.levelLimiter == nil {
+		return ratelimit.Allowed(), ""
+	}
+	return DecideLevels(m.levelLimiter, m.config, identities, outer, cost)
+}
+
+// limitersFor returns the rate limiters of the user's plan, or the top-level ones if the user is
+// on no defined plan and no default plan is configured
+// A plan carried by the identity, such as a token claim, takes precedence over the plan resolver
+func (m *Middleware) limitersFor(identity Identity) rateLimiters {
+	plan := identity.Plan
+	if plan == "" {
+		plan = m.planResolver.ResolvePlan(identity.Key)
+	}
+	if limiters, ok := m.plans[m.config.ResolvePlan(plan)]; ok {
+		return limiters
+	}
+	return rateLimiters{
+		config:      m.config,
+		global:      m.globalLimiter,
+		http:        m.httpLimiter,
+		perEndpoint: m.perEndpointLimiter,
+	}
+}
+
+// priority returns the priority class of the request: the class configured for the endpoint,
+// else the one named in the priority header, else the default class
+func (m *Middleware) priority(r *http.Request, endpointKey string) string {
+	requested := ""
+	if m.config.PriorityHeader != "" {
+		requested = strings.TrimSpace(r.Header.Get(m.config.PriorityHeader))
+	}
+	return m.config.ResolvePriority(m.config.GetHTTPMethodPriority(endpointKey), requested)
 }
 
 // writeRateLimitResponse writes an HTTP 429 response with appropriate headers
-func (m *Middleware) writeRateLimitResponse(w http.ResponseWriter, limitType string) {
+// The decision names the window that rejected the request, which matters for rules with several limits,
+// and the exact time the request would be admitted when the limiter knows it
+func (m *Middleware) writeRateLimitResponse(w http.ResponseWriter, cfg config.Config, limitType string,
+	d ratelimit.Decision) {
+	limit := d.Limit
+	retryAfter := getRetryAfterSeconds(cfg, limit)
+	if !d.RetryAt.IsZero() {
+		retryAfter = max(int(math.Ceil(time.Until(d.RetryAt).Seconds())), 1)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 
 	// Set rate limit headers
 	// Note: These are simplified; in production you might want more detailed headers
-	w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", m.getRateLimitForType(limitType)))
-	w.Header().Set("Retry-After", strconv.Itoa(m.getRetryAfterSeconds()))
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.Rate))
+	w.Header().Set("X-RateLimit-Window", limit.String())
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
 
 	w.WriteHeader(http.StatusTooManyRequests)
 
 	// Write a simple JSON response
-	response := fmt.Sprintf(`{"error": "rate limit exceeded", "type": "%s"}`, limitType)
+	response := fmt.Sprintf(`{"error": "rate limit exceeded", "type": "%s", "window": "%s"}`, limitType, limit)
+	_, _ = w.Write([]byte(response))
+}
+
+// writeLevelLimitResponse writes an HTTP 429 response for a request over the limits of a level of
+// the identity hierarchy, naming the level that tripped
+func (m *Middleware) writeLevelLimitResponse(w http.ResponseWriter, cfg config.Config, level string,
+	limit config.Limit) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.Rate))
+	w.Header().Set("X-RateLimit-Window", limit.String())
+	w.Header().Set("X-RateLimit-Level", level)
+	w.Header().Set("Retry-After", strconv.Itoa(getRetryAfterSeconds(cfg, limit)))
+
+	w.WriteHeader(http.StatusTooManyRequests)
+
+	response := fmt.Sprintf(`{"error": "rate limit exceeded", "type": "level", "level": "%s", "window": "%s"}`,
+		level, limit)
 	_, _ = w.Write([]byte(response))
 }
 
-// getRateLimitForType returns the rate limit for the given type
-func (m *Middleware) getRateLimitForType(limitType string) int {
-	switch limitType {
-	case "global":
-		return m.config.GlobalRate
-	case "http":
-		return m.config.HTTPRate
-	case "per-method":
-		return m.config.HTTPDefaultMethodRate
-	default:
-		return 0
+// penalize counts a rejection against the user in the penalty box, if one is configured
+func (m *Middleware) penalize(userID string) {
+	if m.penaltyBox != nil {
+		m.penaltyBox.Penalize(userID)
 	}
 }
 
-// getRetryAfterSeconds returns a reasonable retry-after time in seconds
-func (m *Middleware) getRetryAfterSeconds() int {
+// writeUnauthenticatedResponse writes an HTTP 401 response for a request whose credentials the key
+// extractor rejected, such as a forged or expired token
+func (m *Middleware) writeUnauthenticatedResponse(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+
+	w.WriteHeader(http.StatusUnauthorized)
+
+	_, _ = w.Write([]byte(`{"error": "invalid credentials", "type": "unauthenticated"}`))
+}
+
+// writeBannedResponse writes an HTTP 429 response for a request from a user in the penalty box
+// Retry-After is at least one second, since a tarpit may hold the request until the ban is nearly over
+func (m *Middleware) writeBannedResponse(w http.ResponseWriter, bannedUntil time.Time) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(max(int(math.Ceil(time.Until(bannedUntil).Seconds())), 1)))
+
+	w.WriteHeader(http.StatusTooManyRequests)
+
+	response := fmt.Sprintf(`{"error": "temporarily banned", "type": "banned", "until": "%s"}`,
+		bannedUntil.UTC().Format(time.RFC3339))
+	_, _ = w.Write([]byte(response))
+}
+
+// writeConcurrencyLimitResponse writes an HTTP 429 response for a request over a concurrency ceiling
+func (m *Middleware) writeConcurrencyLimitResponse(w http.ResponseWriter, ceiling Ceiling) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Concurrency-Limit", strconv.Itoa(ceiling.Max))
+	w.Header().Set("Retry-After", "1")
+
+	w.WriteHeader(http.StatusTooManyRequests)
+
+	response := fmt.Sprintf(`{"error": "concurrency limit exceeded", "type": "concurrency", "scope": "%s"}`, ceiling.Scope)
+	_, _ = w.Write([]byte(response))
+}
+
+// writeQuotaExceededResponse writes an HTTP 429 response for a request over a calendar quota
+// Retry-After points at the start of the quota's next period
+func (m *Middleware) writeQuotaExceededResponse(w http.ResponseWriter, d ratelimit.QuotaDecision) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Quota-Limit", strconv.Itoa(d.Quota.Limit))
+	w.Header().Set("X-Quota-Reset", d.ResetAt.UTC().Format(time.RFC3339))
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(d.ResetAt).Seconds()))))
+
+	w.WriteHeader(http.StatusTooManyRequests)
+
+	response := fmt.Sprintf(`{"error": "quota exceeded", "type": "quota", "quota": "%s", "reset": "%s"}`,
+		d.Quota, d.ResetAt.UTC().Format(time.RFC3339))
+	_, _ = w.Write([]byte(response))
+}
+
+// writeInsufficientCreditsResponse writes an HTTP 402 response for a request its user's prepaid
+// credit balance cannot cover; no retry helps until the balance is topped up
+func (m *Middleware) writeInsufficientCreditsResponse(w http.ResponseWriter, d ratelimit.CreditDecision) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Credits-Balance", strconv.Itoa(d.Balance))
+	w.Header().Set("X-Credits-Cost", strconv.Itoa(d.Cost))
+
+	w.WriteHeader(http.StatusPaymentRequired)
+
+	response := fmt.Sprintf(`{"error": "insufficient credits", "type": "credits", "balance": %d, "cost": %d}`,
+		d.Balance, d.Cost)
+	_, _ = w.Write([]byte(response))
+}
+
+// writeOverloadResponse writes an HTTP 503 response for a request shed by the adaptive limiter
+func (m *Middleware) writeOverloadResponse(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Concurrency-Limit", strconv.Itoa(m.adaptiveLimiter.Stats().Limit))
+	w.Header().Set("Retry-After", "1")
+
+	w.WriteHeader(http.StatusServiceUnavailable)
+
+	_, _ = w.Write([]byte(`{"error": "server overloaded", "type": "adaptive"}`))
+}
+
+// AdaptiveLimiter returns the limiter shedding load for this middleware, or nil if adaptive
+// concurrency is disabled; its Stats expose the current limit and measured RTT
+func (m *Middleware) AdaptiveLimiter() *AdaptiveLimiter {
+	return m.adaptiveLimiter
+}
+
+// CreditLimiter returns the limiter holding prepaid credit balances, for example to top them up,
+// or nil if no user is charged credits
+func (m *Middleware) CreditLimiter() CreditLimiterInterface {
+	return m.creditLimiter
+}
+
+// getRetryAfterSeconds returns a reasonable retry-after time in seconds from the configuration of the
+// user's plan; it is at least one second, since Retry-After cannot express less
+func getRetryAfterSeconds(cfg config.Config, limit config.Limit) int {
 	// Calculate based on token refill interval
-	// Use the more restrictive of per-endpoint or global rate
-	refillInterval := m.config.GetRefillInterval(m.config.PerEndpointRate)
-	if globalInterval := m.config.GetRefillInterval(m.config.GlobalRate); globalInterval > refillInterval {
-		refillInterval = globalInterval
-	}
+	// Use the more restrictive of per-endpoint or global rate, or of the window that tripped
+	refillInterval := cfg.GetRefillIntervalFor(cfg.PerEndpointRate, cfg.PerEndpointPeriod)
+	globalInterval := cfg.GetRefillIntervalFor(cfg.GlobalRate, cfg.GlobalPeriod)
+	limitInterval := cfg.GetRefillIntervalFor(limit.Rate, limit.Period)
+	refillInterval = max(refillInterval, globalInterval, limitInterval)
 
-	// Return approximately how long until next token is available
-	return int(refillInterval.Seconds())
+	// Return approximately how long until next token is available, rounded up
+	return max(int(math.Ceil(refillInterval.Seconds())), 1)
 }
 
 // Reset clears all rate limiting state for testing purposes
+// Prepaid credit balances are kept, as they are paid for rather than rate limiting state
 func (m *Middleware) Reset() {
 	m.perEndpointLimiter.Reset()
 	m.globalLimiter.Reset()
 	m.httpLimiter.Reset()
-}
\ No newline at end of file
+	for _, limiters := range m.plans {
+		limiters.reset()
+	}
+	m.concurrencyLimiter.Reset()
+	m.adaptiveLimiter.Reset()
+	if m.quotaLimiter != nil {
+		m.quotaLimiter.Reset()
+	}
+	if m.penaltyBox != nil {
+		m.penaltyBox.Reset()
+	}
+	if m.aggregateLimiter != nil {
+		m.aggregateLimiter.Reset()
+	}
+	if m.levelLimiter != nil {
+		m.levelLimiter.Reset()
+	}
+}
+
+// Close persists quota counters and credit balances and stops background work
+func (m *Middleware) Close() error {
+	var errs []error
+	if m.quotaLimiter != nil {
+		errs = append(errs, m.quotaLimiter.Close())
+	}
+	if m.creditLimiter != nil {
+		errs = append(errs, m.creditLimiter.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -1,21 +1,25 @@
 package middleware
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/ratelimit"
 )
 
 func TestNewMiddleware(t *testing.T) {
 	cfg := config.Config{
-		UserHeader:            "X-User-ID",
-		PerEndpointRate:       10,
-		GlobalRate:            100,
-		GlobalBurstSize:       5,
-		PerEndpointBurstSize:  5,
+		UserHeader:           "X-User-ID",
+		PerEndpointRate:      10,
+		GlobalRate:           100,
+		GlobalBurstSize:      5,
+		PerEndpointBurstSize: 5,
 	}
 
 	middleware := NewMiddleware(cfg)
@@ -190,9 +194,9 @@ func TestMiddleware_Handler_PerEndpointLimitExceeded(t *testing.T) {
 
 func TestMiddleware_ExtractUserID(t *testing.T) {
 	cfg := config.Config{
-		UserHeader:           "X-Custom-User",
-		HTTPRate:             50,
-		HTTPBurstSize:        5,
+		UserHeader:            "X-Custom-User",
+		HTTPRate:              50,
+		HTTPBurstSize:         5,
 		HTTPDefaultMethodRate: 10,
 	}
 
@@ -227,14 +231,46 @@ func TestMiddleware_ExtractUserID(t *testing.T) {
 				req.Header.Set(key, value)
 			}
 
-			result := middleware.extractUserID(req)
-			if result != tt.expected {
-				t.Errorf("extractUserID() = %q, want %q", result, tt.expected)
+			identity, err := middleware.extractIdentity(req)
+			if err != nil || identity.Key != tt.expected {
+				t.Errorf("extractIdentity() = %+v, %v, want key %q", identity, err, tt.expected)
 			}
 		})
 	}
 }
 
+func TestMiddleware_ExtractIdentity_KeyExtractor(t *testing.T) {
+	cfg := config.Config{
+		UserHeader:            "X-User-ID",
+		HTTPRate:              50,
+		HTTPBurstSize:         5,
+		HTTPDefaultMethodRate: 10,
+		AnonymousKey:          "guest",
+	}
+
+	// An upstream auth middleware's identity wins over the session cookie
+	middleware := NewMiddleware(cfg, WithKeyExtractor(ChainExtractor{
+		ContextExtractor{},
+		CookieExtractor{Name: "session_user"},
+	}))
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("X-User-ID", "header-user")
+	if identity, _ := middleware.extractIdentity(req); identity.Key != "guest" {
+		t.Errorf("extractIdentity() without a key = %q, want %q", identity.Key, "guest")
+	}
+
+	req.AddCookie(&http.Cookie{Name: "session_user", Value: "cookie-user"})
+	if identity, _ := middleware.extractIdentity(req); identity.Key != "cookie-user" {
+		t.Errorf("extractIdentity() = %q, want %q", identity.Key, "cookie-user")
+	}
+
+	req = req.WithContext(ContextWithKey(req.Context(), "auth-user"))
+	if identity, _ := middleware.extractIdentity(req); identity.Key != "auth-user" {
+		t.Errorf("extractIdentity() = %q, want %q", identity.Key, "auth-user")
+	}
+}
+
 func TestMiddleware_Handler_RateLimitHeaders(t *testing.T) {
 	cfg := config.Config{
 		UserHeader:            "X-User-ID",
@@ -278,4 +314,1134 @@ func TestMiddleware_Handler_RateLimitHeaders(t *testing.T) {
 			}
 		}
 	}
-}
\ No newline at end of file
+}
+func TestMiddleware_Handler_LeakyBucketShapesTraffic(t *testing.T) {
+	cfg := config.Config{
+		UserHeader:            "X-User-ID",
+		GlobalRate:            100,
+		GlobalBurstSize:       10,
+		HTTPRate:              100,
+		HTTPBurstSize:         10,
+		HTTPDefaultMethodRate: 20, // one request every 50ms
+		PerEndpointBurstSize:  3,  // up to 3 requests queued
+		HTTPMethodAlgorithm:   config.AlgorithmLeakyBucket,
+	}
+
+	middleware := NewMiddleware(cfg)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	wrappedHandler := middleware.Handler(handler)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("POST", "/api/ingest", nil)
+		req.Header.Set("X-User-ID", "user123")
+
+		w := httptest.NewRecorder()
+		wrappedHandler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Request %d should be delayed, not rejected, got status %d", i+1, w.Code)
+		}
+	}
+
+	// Sequential requests are spaced by the leak interval
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Three requests took %v, want at least 100ms", elapsed)
+	}
+}
+
+func TestMiddleware_Handler_LeakyBucketGivesDeparturesBack(t *testing.T) {
+	cfg := config.Config{
+		UserHeader:            "X-User-ID",
+		GlobalRate:            1, // one request per second
+		GlobalBurstSize:       2, // up to 2 requests queued
+		GlobalAlgorithm:       config.AlgorithmLeakyBucket,
+		HTTPRate:              100,
+		HTTPBurstSize:         100,
+		HTTPDefaultMethodRate: 100,
+		PerEndpointBurstSize:  1,
+		HTTPMethods:           map[string]int{"POST /api/ingest": 1},
+	}
+
+	middleware := NewMiddleware(cfg)
+	handler := middleware.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(ctx context.Context, path string) int {
+		req := httptest.NewRequest("POST", path, nil).WithContext(ctx)
+		req.Header.Set("X-User-ID", "user123")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// The first request departs at once and fills the ingest endpoint's bucket
+	if code := serve(context.Background(), "/api/ingest"); code != http.StatusOK {
+		t.Fatalf("First request should be allowed, got status %d", code)
+	}
+
+	// A request rejected by a later tier is not held in the queue and gives its departure back
+	start := time.Now()
+	if code := serve(context.Background(), "/api/ingest"); code != http.StatusTooManyRequests {
+		t.Errorf("Second request should be rejected by the per-method limit, got status %d", code)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Rejected request took %v, want it rejected without waiting for its departure", elapsed)
+	}
+	if remaining := middleware.globalLimiter.GetRemainingTokens("user123"); remaining != 1 {
+		t.Errorf("Global queue should have 1 free slot after the rejection, got %d", remaining)
+	}
+
+	// A request whose deadline comes before its departure leaves the queue
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if code := serve(ctx, "/api/users"); code != http.StatusTooManyRequests {
+		t.Errorf("Request past its deadline should be rejected, got status %d", code)
+	}
+	if remaining := middleware.globalLimiter.GetRemainingTokens("user123"); remaining != 1 {
+		t.Errorf("Global queue should have 1 free slot after the deadline, got %d", remaining)
+	}
+}
+
+func TestMiddleware_Handler_LeakyBucketCancelKeepsQuotaAndCredits(t *testing.T) {
+	cfg := config.Config{
+		UserHeader:            "X-User-ID",
+		GlobalRate:            1, // one request per second
+		GlobalBurstSize:       2, // up to 2 requests queued
+		GlobalAlgorithm:       config.AlgorithmLeakyBucket,
+		HTTPRate:              100,
+		HTTPBurstSize:         100,
+		HTTPDefaultMethodRate: 100,
+		PerEndpointRate:       100,
+		PerEndpointBurstSize:  100,
+		Quotas:                []config.Quota{{Limit: 10, Period: config.QuotaPeriodMonth}},
+		ChargeCredits:         true,
+	}
+
+	middleware := NewMiddleware(cfg)
+	defer func() { _ = middleware.Close() }()
+	if _, err := middleware.creditLimiter.TopUp("user123", 10); err != nil {
+		t.Fatalf("TopUp() error = %v", err)
+	}
+
+	handler := middleware.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(ctx context.Context) int {
+		req := httptest.NewRequest("GET", "/api/users", nil).WithContext(ctx)
+		req.Header.Set("X-User-ID", "user123")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// The first request departs at once and pays for itself
+	if code := serve(context.Background()); code != http.StatusOK {
+		t.Fatalf("First request should be allowed, got status %d", code)
+	}
+
+	// The second request is queued for a second; its client goes away while it waits
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if code := serve(ctx); code != http.StatusTooManyRequests {
+		t.Errorf("Request cancelled while queued should be rejected, got status %d", code)
+	}
+
+	if remaining := middleware.quotaLimiter.GetRemainingQuota("user123"); remaining != 9 {
+		t.Errorf("GetRemainingQuota() = %d, want 9, a request cancelled while queued must not use the quota", remaining)
+	}
+	if balance := middleware.creditLimiter.GetBalance("user123"); balance != 9 {
+		t.Errorf("GetBalance() = %d, want 9, a request cancelled while queued must not be charged", balance)
+	}
+}
+
+func TestMiddleware_Handler_MethodCost(t *testing.T) {
+	cfg := config.Config{
+		UserHeader:            "X-User-ID",
+		GlobalRate:            100,
+		GlobalBurstSize:       100,
+		HTTPRate:              100,
+		HTTPBurstSize:         25, // room for two batch requests
+		HTTPDefaultMethodRate: 100,
+		PerEndpointRate:       100,
+		PerEndpointBurstSize:  100,
+		HTTPMethodCosts:       map[string]int{"POST /api/users/batch": 10},
+	}
+
+	middleware := NewMiddleware(cfg)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	wrappedHandler := middleware.Handler(handler)
+
+	serve := func(method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-User-ID", "user123")
+		w := httptest.NewRecorder()
+		wrappedHandler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := serve("POST", "/api/users/batch"); code != http.StatusOK {
+			t.Errorf("Batch request %d should be allowed, got status %d", i+1, code)
+		}
+	}
+
+	// 20 of 25 HTTP tokens are used, so a third batch request is rejected
+	if code := serve("POST", "/api/users/batch"); code != http.StatusTooManyRequests {
+		t.Errorf("Third batch request should be rate limited, got status %d", code)
+	}
+
+	// Regular requests still cost one token
+	if code := serve("GET", "/api/users"); code != http.StatusOK {
+		t.Errorf("Regular request should be allowed, got status %d", code)
+	}
+}
+
+func TestMiddleware_Handler_MultipleLimits(t *testing.T) {
+	cfg := config.Config{
+		UserHeader:            "X-User-ID",
+		GlobalRate:            100,
+		GlobalBurstSize:       100,
+		HTTPRate:              100,
+		HTTPBurstSize:         100,
+		HTTPDefaultMethodRate: 100,
+		PerEndpointRate:       100,
+		PerEndpointBurstSize:  100,
+		HTTPMethods:           map[string]int{"GET /api/search": 10},
+		HTTPMethodExtraLimits: map[string][]config.Limit{
+			"GET /api/search": {{Rate: 2, Period: time.Minute, Burst: 2}},
+		},
+	}
+
+	middleware := NewMiddleware(cfg)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	wrappedHandler := middleware.Handler(handler)
+
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/api/search", nil)
+		req.Header.Set("X-User-ID", "user123")
+		w = httptest.NewRecorder()
+		wrappedHandler.ServeHTTP(w, req)
+	}
+
+	// The per-second limit has room, the per-minute one does not
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Third request should be rate limited, got status %d", w.Code)
+	}
+	if window := w.Header().Get("X-RateLimit-Window"); window != "2/m" {
+		t.Errorf("X-RateLimit-Window should be '2/m', got '%s'", window)
+	}
+	if limit := w.Header().Get("X-RateLimit-Limit"); limit != "2" {
+		t.Errorf("X-RateLimit-Limit should be '2', got '%s'", limit)
+	}
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "30" {
+		t.Errorf("Retry-After should be '30', got '%s'", retryAfter)
+	}
+	if body := w.Body.String(); !strings.Contains(body, `"window": "2/m"`) {
+		t.Errorf("Response should name the window that tripped, got %s", body)
+	}
+}
+
+func TestMiddleware_Handler_ConcurrencyLimit(t *testing.T) {
+	cfg := config.Config{
+		UserHeader:              "X-User-ID",
+		GlobalRate:              100,
+		GlobalBurstSize:         100,
+		HTTPRate:                100,
+		HTTPBurstSize:           100,
+		HTTPDefaultMethodRate:   100,
+		PerEndpointRate:         100,
+		PerEndpointBurstSize:    100,
+		HTTPMethodMaxConcurrent: map[string]int{"GET /api/reports": 1},
+	}
+
+	middleware := NewMiddleware(cfg)
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("mode") {
+		case "block":
+			close(started)
+			<-unblock
+		case "panic":
+			panic("report generator failed")
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	wrappedHandler := middleware.Handler(handler)
+
+	serve := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/reports"+query, nil)
+		req.Header.Set("X-User-ID", "user123")
+		w := httptest.NewRecorder()
+		wrappedHandler.ServeHTTP(w, req)
+		return w
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serve("?mode=block")
+	}()
+	<-started
+
+	// The slot is taken while the first report is generated
+	w := serve("")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Concurrent request should be rejected, got status %d", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, `"type": "concurrency"`) ||
+		!strings.Contains(body, `"scope": "per-method"`) {
+		t.Errorf("Response should name the concurrency ceiling, got %s", body)
+	}
+	if limit := w.Header().Get("X-Concurrency-Limit"); limit != "1" {
+		t.Errorf("X-Concurrency-Limit should be '1', got '%s'", limit)
+	}
+
+	close(unblock)
+	<-done
+
+	// A panicking handler still gives its slot back
+	func() {
+		defer func() { _ = recover() }()
+		serve("?mode=panic")
+	}()
+	if w := serve(""); w.Code != http.StatusOK {
+		t.Errorf("Request after the panic should be allowed, got status %d", w.Code)
+	}
+}
+
+func TestMiddleware_Handler_AdaptiveConcurrency(t *testing.T) {
+	cfg := config.Config{
+		UserHeader:            "X-User-ID",
+		GlobalRate:            1,
+		GlobalPeriod:          time.Hour,
+		GlobalBurstSize:       2,
+		HTTPRate:              100,
+		HTTPBurstSize:         100,
+		HTTPDefaultMethodRate: 100,
+		PerEndpointRate:       100,
+		PerEndpointBurstSize:  100,
+		AdaptiveConcurrency:   true,
+		AdaptiveInitialLimit:  1,
+		AdaptiveMinLimit:      1,
+		AdaptiveMaxLimit:      1,
+	}
+
+	middleware := NewMiddleware(cfg)
+
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("mode") == "block" {
+			close(started)
+			<-unblock
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	wrappedHandler := middleware.Handler(handler)
+
+	serve := func(userID, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/users"+query, nil)
+		req.Header.Set("X-User-ID", userID)
+		w := httptest.NewRecorder()
+		wrappedHandler.ServeHTTP(w, req)
+		return w
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		serve("user123", "?mode=block")
+	}()
+	<-started
+
+	// The process-wide limit applies to every user
+	w := serve("user456", "")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Request over the adaptive limit should be shed, got status %d", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, `"type": "adaptive"`) {
+		t.Errorf("Response should name the adaptive limit, got %s", body)
+	}
+	if limit := w.Header().Get("X-Concurrency-Limit"); limit != "1" {
+		t.Errorf("X-Concurrency-Limit should be '1', got '%s'", limit)
+	}
+
+	close(unblock)
+	<-done
+
+	if stats := middleware.AdaptiveLimiter().Stats(); stats.InFlight != 0 || stats.RTT <= 0 {
+		t.Errorf("Stats() = %+v, want nothing in flight and an RTT sample", stats)
+	}
+
+	// Shed requests do not consume per-user tokens
+	if w := serve("user456", ""); w.Code != http.StatusOK {
+		t.Errorf("Request after the shed one should be allowed, got status %d", w.Code)
+	}
+	if w := serve("user456", ""); w.Code != http.StatusOK {
+		t.Errorf("Second request should use the remaining burst, got status %d", w.Code)
+	}
+}
+
+func TestMiddleware_Handler_QuotaExceeded(t *testing.T) {
+	cfg := config.Config{
+		UserHeader:            "X-User-ID",
+		GlobalRate:            100,
+		GlobalBurstSize:       100,
+		HTTPRate:              100,
+		HTTPBurstSize:         100,
+		HTTPDefaultMethodRate: 100,
+		PerEndpointRate:       100,
+		PerEndpointBurstSize:  100,
+		Quotas:                []config.Quota{{Limit: 2, Period: config.QuotaPeriodMonth}},
+	}
+
+	middleware := NewMiddleware(cfg)
+	defer func() { _ = middleware.Close() }()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	wrappedHandler := middleware.Handler(handler)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/api/users", nil)
+		req.Header.Set("X-User-ID", "user123")
+		w := httptest.NewRecorder()
+		wrappedHandler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Request %d should be allowed, got status %d", i+1, w.Code)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/users", nil)
+	req.Header.Set("X-User-ID", "user123")
+	w := httptest.NewRecorder()
+	wrappedHandler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Third request should exceed the quota, got status %d", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, `"type": "quota"`) ||
+		!strings.Contains(body, `"quota": "2/month"`) {
+		t.Errorf("Response should name the quota, got %s", body)
+	}
+	if limit := w.Header().Get("X-Quota-Limit"); limit != "2" {
+		t.Errorf("X-Quota-Limit should be '2', got '%s'", limit)
+	}
+	reset, err := time.Parse(time.RFC3339, w.Header().Get("X-Quota-Reset"))
+	if err != nil || reset.Day() != 1 || !reset.After(time.Now()) {
+		t.Errorf("X-Quota-Reset should be the start of next month, got '%s'", w.Header().Get("X-Quota-Reset"))
+	}
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter == "" || retryAfter == "0" {
+		t.Errorf("Retry-After should point at the quota reset, got '%s'", retryAfter)
+	}
+}
+
+func TestMiddleware_Handler_InsufficientCredits(t *testing.T) {
+	cfg := config.Config{
+		UserHeader:            "X-User-ID",
+		GlobalRate:            100,
+		GlobalBurstSize:       100,
+		HTTPRate:              100,
+		HTTPBurstSize:         100,
+		HTTPDefaultMethodRate: 100,
+		PerEndpointRate:       100,
+		PerEndpointBurstSize:  100,
+		HTTPMethodCosts:       map[string]int{"POST /api/reports": 3},
+		ChargeCredits:         true,
+	}
+
+	middleware := NewMiddleware(cfg)
+	defer func() { _ = middleware.Close() }()
+	if _, err := middleware.CreditLimiter().TopUp("user123", 4); err != nil {
+		t.Fatalf("TopUp() error = %v", err)
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	wrappedHandler := middleware.Handler(handler)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-User-ID", "user123")
+		w := httptest.NewRecorder()
+		wrappedHandler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := serve("POST", "/api/reports"); w.Code != http.StatusOK {
+		t.Fatalf("Request costing 3 of 4 credits should be allowed, got status %d", w.Code)
+	}
+
+	w := serve("POST", "/api/reports")
+	if w.Code != http.StatusPaymentRequired {
+		t.Fatalf("Request costing 3 of 1 credit should be rejected, got status %d", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, `"type": "credits"`) ||
+		!strings.Contains(body, `"balance": 1`) || !strings.Contains(body, `"cost": 3`) {
+		t.Errorf("Response should name the balance and cost, got %s", body)
+	}
+	if balance := w.Header().Get("X-Credits-Balance"); balance != "1" {
+		t.Errorf("X-Credits-Balance should be '1', got '%s'", balance)
+	}
+
+	// The rejected request is not charged, so a cheaper one still fits
+	if w := serve("GET", "/api/users"); w.Code != http.StatusOK {
+		t.Errorf("Request costing 1 of 1 credit should be allowed, got status %d", w.Code)
+	}
+}
+
+func TestMiddleware_Handler_AdaptiveConcurrencyLeakyBucketWait(t *testing.T) {
+	cfg := config.Config{
+		UserHeader:            "X-User-ID",
+		GlobalRate:            4, // one departure every 250ms
+		GlobalBurstSize:       2,
+		GlobalAlgorithm:       config.AlgorithmLeakyBucket,
+		HTTPRate:              100,
+		HTTPBurstSize:         100,
+		HTTPDefaultMethodRate: 100,
+		PerEndpointRate:       100,
+		PerEndpointBurstSize:  100,
+		AdaptiveConcurrency:   true,
+		AdaptiveInitialLimit:  2,
+		AdaptiveMinLimit:      1,
+		AdaptiveMaxLimit:      2,
+	}
+
+	middleware := NewMiddleware(cfg)
+	handler := middleware.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(userID string) int {
+		req := httptest.NewRequest("GET", "/api/users", nil)
+		req.Header.Set("X-User-ID", userID)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// A fast backend sets the baseline RTT; every user's first request departs at once
+	for i := 0; i < 20; i++ {
+		if code := serve(fmt.Sprintf("user%d", i)); code != http.StatusOK {
+			t.Fatalf("Request %d should be allowed, got status %d", i+1, code)
+		}
+	}
+
+	// The second request of a user waits 250ms in the leaky bucket without holding an adaptive slot
+	done := make(chan int)
+	go func() { done <- serve("user0") }()
+	time.Sleep(100 * time.Millisecond)
+	if stats := middleware.AdaptiveLimiter().Stats(); stats.InFlight != 0 {
+		t.Errorf("Stats().InFlight = %d while queued, want 0", stats.InFlight)
+	}
+	if code := <-done; code != http.StatusOK {
+		t.Fatalf("Queued request should be allowed, got status %d", code)
+	}
+
+	// The wait is not counted as backend latency, so the limit does not shrink
+	stats := middleware.AdaptiveLimiter().Stats()
+	if stats.RTT > 10*time.Millisecond || stats.Limit != 2 {
+		t.Errorf("Stats() = %+v, want the RTT of the handler alone and the limit kept at 2", stats)
+	}
+}
+
+func TestMiddleware_Handler_InsufficientCreditsKeepQuota(t *testing.T) {
+	cfg := config.Config{
+		UserHeader:            "X-User-ID",
+		GlobalRate:            100,
+		GlobalBurstSize:       100,
+		HTTPRate:              100,
+		HTTPBurstSize:         100,
+		HTTPDefaultMethodRate: 100,
+		PerEndpointRate:       100,
+		PerEndpointBurstSize:  100,
+		Quotas:                []config.Quota{{Limit: 10, Period: config.QuotaPeriodMonth}},
+		ChargeCredits:         true,
+	}
+
+	middleware := NewMiddleware(cfg)
+	defer func() { _ = middleware.Close() }()
+
+	handler := middleware.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/api/users", nil)
+	req.Header.Set("X-User-ID", "user123")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusPaymentRequired {
+		t.Fatalf("Request without credits should be rejected, got status %d", w.Code)
+	}
+	if remaining := middleware.quotaLimiter.GetRemainingQuota("user123"); remaining != 10 {
+		t.Errorf("GetRemainingQuota() = %d, want 10, requests rejected for credits must not use the quota", remaining)
+	}
+}
+
+func TestMiddleware_Handler_PenaltyBox(t *testing.T) {
+	cfg := config.Config{
+		UserHeader:            "X-User-ID",
+		GlobalRate:            1,
+		GlobalBurstSize:       1,
+		HTTPRate:              100,
+		HTTPBurstSize:         100,
+		HTTPDefaultMethodRate: 100,
+		PerEndpointRate:       100,
+		PerEndpointBurstSize:  100,
+		PenaltyThreshold:      2,
+		PenaltyWindow:         time.Minute,
+		PenaltyBan:            time.Minute,
+		PenaltyMaxBan:         time.Hour,
+		PenaltyResetAfter:     time.Hour,
+	}
+
+	middleware := NewMiddleware(cfg)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	wrappedHandler := middleware.Handler(handler)
+
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/users", nil)
+		req.Header.Set("X-User-ID", "user123")
+		w := httptest.NewRecorder()
+		wrappedHandler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := serve(); w.Code != http.StatusOK {
+		t.Fatalf("First request should be allowed, got status %d", w.Code)
+	}
+	// Two rate limit rejections start a ban
+	for i := 0; i < 2; i++ {
+		if w := serve(); !strings.Contains(w.Body.String(), `"type": "global"`) {
+			t.Fatalf("Request %d should hit the global limit, got %s", i+2, w.Body.String())
+		}
+	}
+
+	w := serve()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Banned user should be rejected, got status %d", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, `"type": "banned"`) || !strings.Contains(body, `"until": "`) {
+		t.Errorf("Response should report the ban, got %s", body)
+	}
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "60" {
+		t.Errorf("Retry-After should be the remaining ban of 60 seconds, got '%s'", retryAfter)
+	}
+
+	middleware.Reset()
+	if w := serve(); w.Code != http.StatusOK {
+		t.Errorf("Request after Reset() should be allowed, got status %d", w.Code)
+	}
+}
+
+func TestMiddleware_WriteBannedResponse_RetryAfter(t *testing.T) {
+	middleware := NewMiddleware(config.Config{})
+
+	tests := []struct {
+		name        string
+		bannedUntil time.Time
+		want        string
+	}{
+		{name: "ban ending later", bannedUntil: time.Now().Add(90 * time.Second), want: "90"},
+		{name: "ban ending within the second", bannedUntil: time.Now().Add(time.Millisecond), want: "1"},
+		{name: "ban already over after a tarpit", bannedUntil: time.Now().Add(-time.Second), want: "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			middleware.writeBannedResponse(w, tt.bannedUntil)
+			if retryAfter := w.Header().Get("Retry-After"); retryAfter != tt.want {
+				t.Errorf("Retry-After = '%s', want '%s'", retryAfter, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRetryAfterSeconds(t *testing.T) {
+	fast := config.Config{GlobalRate: 100, PerEndpointRate: 50}
+
+	tests := []struct {
+		name  string
+		cfg   config.Config
+		limit config.Limit
+		want  int
+	}{
+		{name: "under a second", cfg: fast, limit: config.Limit{Rate: 10, Period: time.Second}, want: 1},
+		{name: "rounds up", cfg: fast, limit: config.Limit{Rate: 2, Period: 3 * time.Second}, want: 2},
+		{name: "slow window", cfg: fast, limit: config.Limit{Rate: 2, Period: time.Minute}, want: 30},
+		{
+			name:  "plan with a slower global rate",
+			cfg:   config.Config{GlobalRate: 1, GlobalPeriod: 10 * time.Second, PerEndpointRate: 50},
+			limit: config.Limit{Rate: 10, Period: time.Second},
+			want:  10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getRetryAfterSeconds(tt.cfg, tt.limit); got != tt.want {
+				t.Errorf("getRetryAfterSeconds() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware_WriteRateLimitResponse_RetryAfter(t *testing.T) {
+	cfg := config.Config{GlobalRate: 100, PerEndpointRate: 50}
+	middleware := NewMiddleware(cfg)
+	limit := config.Limit{Rate: 10, Period: time.Second}
+
+	tests := []struct {
+		name string
+		d    ratelimit.Decision
+		want string
+	}{
+		{name: "refill interval below a second", d: ratelimit.Rejected(limit), want: "1"},
+		{name: "retry time soon", d: ratelimit.RejectedUntil(limit, time.Now().Add(time.Millisecond)), want: "1"},
+		{name: "retry time already passed", d: ratelimit.RejectedUntil(limit, time.Now().Add(-time.Second)), want: "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			middleware.writeRateLimitResponse(w, cfg, "global", tt.d)
+			if retryAfter := w.Header().Get("Retry-After"); retryAfter != tt.want {
+				t.Errorf("Retry-After = '%s', want '%s'", retryAfter, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware_Handler_PriorityClasses(t *testing.T) {
+	cfg := config.Config{
+		UserHeader:            "X-User-ID",
+		GlobalRate:            1,
+		GlobalPeriod:          time.Minute,
+		GlobalBurstSize:       10,
+		HTTPRate:              100,
+		HTTPBurstSize:         100,
+		HTTPDefaultMethodRate: 100,
+		PerEndpointRate:       100,
+		PerEndpointBurstSize:  100,
+		PriorityClasses:       []config.PriorityClass{{Name: "critical", Reserve: 0.4}, {Name: "analytics"}},
+		PriorityHeader:        "X-Priority",
+		HTTPMethodPriorities:  map[string]string{"GET /health": "critical"},
+	}
+
+	middleware := NewMiddleware(cfg)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	wrappedHandler := middleware.Handler(handler)
+
+	serve := func(path, priority string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("X-User-ID", "user123")
+		if priority != "" {
+			req.Header.Set("X-Priority", priority)
+		}
+		w := httptest.NewRecorder()
+		wrappedHandler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Requests without a known class get the lowest one and leave 40% of the bucket alone
+	for i := 0; i < 6; i++ {
+		if code := serve("/api/events", ""); code != http.StatusOK {
+			t.Fatalf("Analytics request %d should be allowed, got status %d", i+1, code)
+		}
+	}
+	if code := serve("/api/events", "urgent"); code != http.StatusTooManyRequests {
+		t.Fatalf("Analytics request beyond its share should be shed, got status %d", code)
+	}
+
+	// Critical requests, by header or by endpoint, still get the reserved share
+	if code := serve("/api/payments", "critical"); code != http.StatusOK {
+		t.Errorf("Critical request should be allowed, got status %d", code)
+	}
+	for i := 0; i < 3; i++ {
+		if code := serve("/health", "analytics"); code != http.StatusOK {
+			t.Errorf("Health check %d should be allowed as critical, got status %d", i+1, code)
+		}
+	}
+	if code := serve("/health", ""); code != http.StatusTooManyRequests {
+		t.Errorf("Critical requests beyond the bucket should be rejected, got status %d", code)
+	}
+}
+
+func TestMiddleware_Handler_AggregateLimits(t *testing.T) {
+	cfg := config.Config{
+		UserHeader:            "X-User-ID",
+		GlobalRate:            100,
+		GlobalBurstSize:       100,
+		HTTPRate:              100,
+		HTTPBurstSize:         100,
+		HTTPDefaultMethodRate: 100,
+		PerEndpointRate:       100,
+		PerEndpointBurstSize:  100,
+		HTTPMethodAggregateLimits: map[string][]config.Limit{
+			"POST /api/users": {{Rate: 2, Period: time.Minute, Burst: 2}},
+		},
+		PenaltyThreshold:  1,
+		PenaltyWindow:     time.Minute,
+		PenaltyBan:        time.Minute,
+		PenaltyMaxBan:     time.Hour,
+		PenaltyResetAfter: time.Hour,
+	}
+
+	middleware := NewMiddleware(cfg)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	wrappedHandler := middleware.Handler(handler)
+
+	serve := func(method, userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/users", nil)
+		req.Header.Set("X-User-ID", userID)
+		w := httptest.NewRecorder()
+		wrappedHandler.ServeHTTP(w, req)
+		return w
+	}
+
+	// The endpoint limit is shared by every user
+	for _, userID := range []string{"user1", "user2"} {
+		if w := serve("POST", userID); w.Code != http.StatusOK {
+			t.Fatalf("Request from %s should be allowed, got status %d", userID, w.Code)
+		}
+	}
+	w := serve("POST", "user3")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Request beyond the aggregate limit should be rejected, got status %d", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, `"type": "aggregate"`) || !strings.Contains(body, "2/m") {
+		t.Errorf("Response should name the aggregate limit, got %s", body)
+	}
+
+	// Other endpoints are not capped and the rejected user was not penalized for others' traffic
+	if w := serve("GET", "user3"); w.Code != http.StatusOK {
+		t.Errorf("Request to another endpoint should be allowed, got status %d", w.Code)
+	}
+}
+
+func TestMiddleware_Handler_Plans(t *testing.T) {
+	base := config.Config{
+		UserHeader:            "X-User-ID",
+		GlobalRate:            100,
+		GlobalBurstSize:       100,
+		HTTPRate:              100,
+		HTTPBurstSize:         100,
+		HTTPDefaultMethodRate: 100,
+		PerEndpointRate:       100,
+		PerEndpointBurstSize:  100,
+	}
+	free := base
+	free.GlobalRate = 1
+	free.GlobalPeriod = time.Minute
+	free.GlobalBurstSize = 1
+	pro := base
+	pro.GlobalRate = 3
+	pro.GlobalPeriod = time.Minute
+	pro.GlobalBurstSize = 3
+
+	cfg := base
+	cfg.Plans = map[string]config.Config{"free": free, "pro": pro}
+	cfg.DefaultPlan = "free"
+	cfg.PlanUsers = map[string]string{"user123": "pro"}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	// admitted counts the requests from a user that get through before the first rejection
+	admitted := func(wrappedHandler http.Handler, userID string) int {
+		for i := 0; i < 10; i++ {
+			req := httptest.NewRequest("GET", "/api/users", nil)
+			req.Header.Set("X-User-ID", userID)
+			w := httptest.NewRecorder()
+			wrappedHandler.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				return i
+			}
+		}
+		return 10
+	}
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		userID   string
+		expected int
+	}{
+		{"user on a plan in the config", nil, "user123", 3},
+		{"user on the default plan", nil, "user456", 1},
+		{"plan from a resolver function", []Option{WithPlanResolver(PlanResolverFunc(func(userID string) string {
+			return "pro"
+		}))}, "user456", 3},
+		{"resolver naming an undefined plan", []Option{WithPlanResolver(PlanResolverFunc(func(userID string) string {
+			return "gold"
+		}))}, "user123", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrappedHandler := NewMiddleware(cfg, tt.opts...).Handler(handler)
+			if n := admitted(wrappedHandler, tt.userID); n != tt.expected {
+				t.Errorf("%d requests admitted, want %d", n, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMiddleware_Handler_JWT(t *testing.T) {
+	base := config.Config{
+		GlobalRate:            100,
+		GlobalBurstSize:       100,
+		HTTPRate:              100,
+		HTTPBurstSize:         100,
+		HTTPDefaultMethodRate: 100,
+		PerEndpointRate:       100,
+		PerEndpointBurstSize:  100,
+	}
+	free := base
+	free.GlobalRate = 1
+	free.GlobalPeriod = time.Minute
+	free.GlobalBurstSize = 1
+	pro := base
+	pro.GlobalRate = 3
+	pro.GlobalPeriod = time.Minute
+	pro.GlobalBurstSize = 3
+
+	cfg := base
+	cfg.Plans = map[string]config.Config{"free": free, "pro": pro}
+	cfg.DefaultPlan = "free"
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	middleware := NewMiddleware(cfg, WithKeyExtractor(JWTExtractor{
+		Keys:      []config.JWTKey{{Algorithm: config.JWTAlgorithmHS256, Key: secret}},
+		PlanClaim: "plan",
+	}))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	wrappedHandler := middleware.Handler(handler)
+
+	serve := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/users", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		wrappedHandler.ServeHTTP(w, req)
+		return w
+	}
+
+	// The plan claim puts the user on the pro plan
+	token := signTestJWT(t, map[string]any{"alg": "HS256"}, map[string]any{"sub": "user123", "plan": "pro"}, secret)
+	for i := 0; i < 3; i++ {
+		if w := serve(token); w.Code != http.StatusOK {
+			t.Fatalf("Request %d on the pro plan should be allowed, got status %d", i+1, w.Code)
+		}
+	}
+	if w := serve(token); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Fourth request should exceed the pro plan, got status %d", w.Code)
+	}
+
+	forged := signTestJWT(t, map[string]any{"alg": "HS256"}, map[string]any{"sub": "user456", "plan": "pro"},
+		[]byte("fedcba9876543210fedcba9876543210"))
+	w := serve(forged)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Forged token should be rejected, got status %d", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, `"type": "unauthenticated"`) {
+		t.Errorf("Response should be an unauthenticated error, got %s", body)
+	}
+	if challenge := w.Header().Get("WWW-Authenticate"); challenge != `Bearer error="invalid_token"` {
+		t.Errorf("WWW-Authenticate = %q", challenge)
+	}
+}
+
+func TestMiddleware_Handler_APIKey(t *testing.T) {
+	cfg := config.Config{
+		GlobalRate:            2,
+		GlobalPeriod:          time.Minute,
+		GlobalBurstSize:       2,
+		HTTPRate:              100,
+		HTTPBurstSize:         100,
+		HTTPDefaultMethodRate: 100,
+		PerEndpointRate:       100,
+		PerEndpointBurstSize:  100,
+	}
+	keys := map[string]config.APIKey{
+		config.HashAPIKey("sk_live_acme"):   {Identity: "partner-acme"},
+		config.HashAPIKey("sk_live_globex"): {Identity: "partner-globex"},
+	}
+	middleware := NewMiddleware(cfg, WithKeyExtractor(APIKeyExtractor{
+		Store:  NewAPIKeyStore("", keys, 0),
+		Header: "X-API-Key",
+	}))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	wrappedHandler := middleware.Handler(handler)
+
+	serve := func(apiKey string) int {
+		req := httptest.NewRequest("GET", "/api/users", nil)
+		req.Header.Set("X-API-Key", apiKey)
+		w := httptest.NewRecorder()
+		wrappedHandler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Each key is limited under its own identity
+	for _, apiKey := range []string{"sk_live_acme", "sk_live_acme", "sk_live_globex"} {
+		if code := serve(apiKey); code != http.StatusOK {
+			t.Fatalf("Request with %s should be allowed, got status %d", apiKey, code)
+		}
+	}
+	if code := serve("sk_live_acme"); code != http.StatusTooManyRequests {
+		t.Errorf("Third request with sk_live_acme should be rate limited, got status %d", code)
+	}
+
+	// Unknown keys are rejected instead of sharing the anonymous key
+	if code := serve("sk_live_unknown"); code != http.StatusUnauthorized {
+		t.Errorf("Request with an unknown key should be unauthenticated, got status %d", code)
+	}
+}
+
+func TestMiddleware_Handler_Hierarchy(t *testing.T) {
+	cfg := config.Config{
+		UserHeader:            "X-User-ID",
+		GlobalRate:            100,
+		GlobalBurstSize:       100,
+		HTTPRate:              100,
+		HTTPBurstSize:         100,
+		HTTPDefaultMethodRate: 100,
+		PerEndpointRate:       100,
+		PerEndpointBurstSize:  100,
+		IdentityLevels: []config.IdentityLevel{
+			{Name: "org", Header: "X-Org-ID", Limits: []config.Limit{{Rate: 3, Period: time.Minute, Burst: 3}}},
+			{Name: config.UserLevel},
+			{Name: "key", Header: "X-API-Key", Limits: []config.Limit{{Rate: 1, Period: time.Minute, Burst: 1}}},
+		},
+	}
+
+	middleware := NewMiddleware(cfg)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	wrappedHandler := middleware.Handler(handler)
+
+	serve := func(orgID, userID, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/users", nil)
+		req.Header.Set("X-User-ID", userID)
+		if orgID != "" {
+			req.Header.Set("X-Org-ID", orgID)
+		}
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		w := httptest.NewRecorder()
+		wrappedHandler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := serve("acme", "user1", "key1"); w.Code != http.StatusOK {
+		t.Fatalf("First request should be allowed, got status %d", w.Code)
+	}
+	w := serve("acme", "user1", "key1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Second request with the same API key should be rejected, got status %d", w.Code)
+	}
+	if level := w.Header().Get("X-RateLimit-Level"); level != "key" || !strings.Contains(w.Body.String(), `"level": "key"`) {
+		t.Errorf("Response should name the key level, got %q and %s", level, w.Body.String())
+	}
+
+	// The organization's limit is shared by all of its users
+	for _, userID := range []string{"user2", "user3"} {
+		if w := serve("acme", userID, ""); w.Code != http.StatusOK {
+			t.Fatalf("Request from %s should be allowed, got status %d", userID, w.Code)
+		}
+	}
+	w = serve("acme", "user4", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Request beyond the org limit should be rejected, got status %d", w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `"type": "level", "level": "org"`) || !strings.Contains(body, "3/m") {
+		t.Errorf("Response should name the org level and its window, got %s", body)
+	}
+
+	// Other organizations and requests without one are not affected
+	if w := serve("globex", "user4", ""); w.Code != http.StatusOK {
+		t.Errorf("Request from another org should be allowed, got status %d", w.Code)
+	}
+	if w := serve("", "user5", ""); w.Code != http.StatusOK {
+		t.Errorf("Request without an org should be allowed, got status %d", w.Code)
+	}
+}
+
+func TestMiddleware_Handler_StrictMethod(t *testing.T) {
+	cfg := config.Config{
+		UserHeader:            "X-User-ID",
+		GlobalRate:            100,
+		GlobalBurstSize:       100,
+		HTTPRate:              100,
+		HTTPBurstSize:         100,
+		HTTPDefaultMethodRate: 100,
+		PerEndpointRate:       100,
+		PerEndpointBurstSize:  100,
+		HTTPMethods:           map[string]int{"POST /api/payments": 2},
+		HTTPMethodPeriods:     map[string]time.Duration{"POST /api/payments": time.Hour},
+		HTTPMethodStrict:      map[string]bool{"POST /api/payments": true},
+	}
+
+	middleware := NewMiddleware(cfg)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	wrappedHandler := middleware.Handler(handler)
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "/api/payments", nil)
+		req.Header.Set("X-User-ID", "user123")
+		w := httptest.NewRecorder()
+		wrappedHandler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Request %d should be allowed, got status %d", i+1, w.Code)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/api/payments", nil)
+	req.Header.Set("X-User-ID", "user123")
+	w := httptest.NewRecorder()
+	wrappedHandler.ServeHTTP(w, req)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Third request within the hour should be rejected, got status %d", w.Code)
+	}
+
+	// The sliding log knows the first request leaves the hour, rather than estimating a refill interval
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "3600" {
+		t.Errorf("Retry-After = %s, want 3600", retryAfter)
+	}
+}
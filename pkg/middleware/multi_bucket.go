@@ -0,0 +1,218 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/ratelimit"
+)
+
+// MultiBucket enforces several limits on the same key, such as 10/s and 500/m and 20000/d,
+// with one token bucket per limit
+// A request is admitted only if every bucket has enough tokens; otherwise nothing is consumed
+type MultiBucket struct {
+	// mu serializes admissions so a request is charged to all buckets or none
+	mu sync.Mutex
+
+	// limits are the limits of the rule, in the order they are checked
+	limits []config.Limit
+
+	// buckets holds one token bucket per limit
+	buckets []*TokenBucket
+}
+
+// Ensure MultiBucket implements Bucket
+var _ Bucket = (*MultiBucket)(nil)
+
+// NewMultiBucket creates a bucket enforcing every one of the given limits
+func NewMultiBucket(limits []config.Limit) *MultiBucket {
+	return NewMultiBucketWithStart(limits, config.BucketStart{})
+}
+
+// NewMultiBucketWithStart creates a bucket enforcing every one of the given limits whose token
+// buckets start with the initial fill and warm-up of start
+func NewMultiBucketWithStart(limits []config.Limit, start config.BucketStart) *MultiBucket {
+	buckets := make([]*TokenBucket, len(limits))
+	for i, limit := range limits {
+		buckets[i] = NewTokenBucketWithStart(limit.Burst, limit.Rate, limit.Period, start)
+	}
+	return &MultiBucket{
+		limits:  limits,
+		buckets: buckets,
+	}
+}
+
+// NewBucketForLimits creates a bucket for a rule made of one or more limits
+// A single limit gets a plain bucket of the tier algorithm; several limits always use token buckets
+// The sliding log algorithm records every request instead, for one limit or several
+func NewBucketForLimits(algorithm config.Algorithm, limits []config.Limit) Bucket {
+	return NewBucketForTier(algorithm, limits, config.BucketStart{})
+}
+
+// NewBucketForTier creates a bucket for a rule made of one or more limits, see NewBucketForLimits,
+// whose token buckets start with the initial fill and warm-up of the tier
+func NewBucketForTier(algorithm config.Algorithm, limits []config.Limit, start config.BucketStart) Bucket {
+	if algorithm == config.AlgorithmSlidingLog {
+		return NewSlidingLog(limits)
+	}
+	if len(limits) != 1 {
+		return NewMultiBucketWithStart(limits, start)
+	}
+	if algorithm == config.AlgorithmLeakyBucket {
+		return NewLeakyBucketWithPeriod(limits[0].Burst, limits[0].Rate, limits[0].Period)
+	}
+	return NewTokenBucketWithStart(limits[0].Burst, limits[0].Rate, limits[0].Period, start)
+}
+
+// Allow admits one request, see DecideN
+func (mb *MultiBucket) Allow() bool {
+	return mb.AllowN(1)
+}
+
+// AllowN admits a request costing n tokens, see DecideN
+func (mb *MultiBucket) AllowN(n int) bool {
+	return mb.DecideN(n).Allowed
+}
+
+// AllowNWithReserve admits a request costing n tokens, see DecideNWithReserve
+func (mb *MultiBucket) AllowNWithReserve(n int, reserved float64) bool {
+	return mb.DecideNWithReserve(n, reserved).Allowed
+}
+
+// DecideN admits a request costing n tokens if every limit has n tokens available
+// The decision names the first limit that was short; tokens taken from earlier limits are given back
+func (mb *MultiBucket) DecideN(n int) ratelimit.Decision {
+	return mb.DecideNWithReserve(n, 0)
+}
+
+// DecideNWithReserve admits a request costing n tokens if every limit has n tokens available on top
+// of the reserved share of its capacity
+func (mb *MultiBucket) DecideNWithReserve(n int, reserved float64) ratelimit.Decision {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	for i, bucket := range mb.buckets {
+		if bucket.AllowNWithReserve(n, reserved) {
+			continue
+		}
+		for _, charged := range mb.buckets[:i] {
+			charged.refund(n)
+		}
+		return ratelimit.Rejected(mb.limits[i])
+	}
+	return ratelimit.Allowed()
+}
+
+// refund gives n tokens back to every limit of an admitted request that was rejected elsewhere
+func (mb *MultiBucket) refund(n int) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	for _, bucket := range mb.buckets {
+		bucket.refund(n)
+	}
+}
+
+// ReserveN reserves n tokens from every limit; the reservation is usable once all of them are
+// Cancelling it before then gives the tokens back to every limit, including those that were not short
+func (mb *MultiBucket) ReserveN(n int) *ratelimit.Reservation {
+	if n <= 0 {
+		n = 1
+	}
+
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	for _, bucket := range mb.buckets {
+		if n > bucket.GetCapacity() {
+			return ratelimit.NotGranted()
+		}
+	}
+
+	now := time.Now()
+	timeToAct := now
+	for _, bucket := range mb.buckets {
+		if at := now.Add(bucket.ReserveN(n).DelayFrom(now)); at.After(timeToAct) {
+			timeToAct = at
+		}
+	}
+
+	return ratelimit.NewReservation(timeToAct, func() {
+		// Tokens of a reservation that is already due have been used
+		if !time.Now().Before(timeToAct) {
+			return
+		}
+		for _, bucket := range mb.buckets {
+			bucket.refund(n)
+		}
+	})
+}
+
+// GetTokens returns the tokens of the most restrictive limit
+func (mb *MultiBucket) GetTokens() int {
+	tokens := mb.buckets[0].GetTokens()
+	for _, bucket := range mb.buckets[1:] {
+		tokens = min(tokens, bucket.GetTokens())
+	}
+	return tokens
+}
+
+// GetCapacity returns the smallest burst size of the limits
+func (mb *MultiBucket) GetCapacity() int {
+	capacity := mb.buckets[0].GetCapacity()
+	for _, bucket := range mb.buckets[1:] {
+		capacity = min(capacity, bucket.GetCapacity())
+	}
+	return capacity
+}
+
+// Reset restores every limit to a full bucket
+func (mb *MultiBucket) Reset() {
+	for _, bucket := range mb.buckets {
+		bucket.Reset()
+	}
+}
+
+// decider is implemented by buckets that can tell which of several limits rejected a request
+type decider interface {
+	DecideNWithReserve(n int, reserved float64) ratelimit.Decision
+}
+
+// shaper is implemented by buckets that delay admitted requests to a departure instead of admitting
+// them at once
+type shaper interface {
+	ReserveNWithReserve(n int, reserved float64) *ratelimit.Reservation
+}
+
+// DecideBucket admits a request costing n tokens on a bucket created by NewBucketForLimits
+// A bucket enforcing a single limit is rejected by the rule's first limit, which limits returns
+func DecideBucket(bucket Bucket, n int, limits func() []config.Limit) ratelimit.Decision {
+	return DecideBucketWithReserve(bucket, n, 0, limits)
+}
+
+// DecideBucketWithReserve admits a request costing n tokens on a bucket created by NewBucketForLimits
+// while leaving the reserved share of every limit's capacity for higher priority classes
+// Traffic shaping buckets do not delay the request; the decision carries its departure instead, so
+// the caller waits for it only once every other limit has admitted the request
+func DecideBucketWithReserve(
+	bucket Bucket,
+	n int,
+	reserved float64,
+	limits func() []config.Limit,
+) ratelimit.Decision {
+	if d, ok := bucket.(decider); ok {
+		return d.DecideNWithReserve(n, reserved)
+	}
+	if s, ok := bucket.(shaper); ok {
+		reservation := s.ReserveNWithReserve(n, reserved)
+		if !reservation.OK() {
+			return ratelimit.Rejected(limits()[0])
+		}
+		return ratelimit.AllowedAfter(limits()[0], reservation)
+	}
+	if bucket.AllowNWithReserve(n, reserved) {
+		return ratelimit.Allowed()
+	}
+	return ratelimit.Rejected(limits()[0])
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"rate_limiter_service/internal/config"
+)
+
+func TestMultiBucket_DecideN(t *testing.T) {
+	burstLimit := config.Limit{Rate: 10, Period: time.Second, Burst: 10}
+	sustainedLimit := config.Limit{Rate: 3, Period: time.Minute, Burst: 3}
+	mb := NewMultiBucket([]config.Limit{burstLimit, sustainedLimit})
+
+	for i := 0; i < 3; i++ {
+		if d := mb.DecideN(1); !d.Allowed {
+			t.Fatalf("Request %d should be allowed, rejected by %v", i+1, d.Limit)
+		}
+	}
+
+	// The burst limit has room, the per-minute limit does not
+	d := mb.DecideN(1)
+	if d.Allowed {
+		t.Fatal("Fourth request should be rejected")
+	}
+	if d.Limit != sustainedLimit {
+		t.Errorf("Rejected by %v, want %v", d.Limit, sustainedLimit)
+	}
+
+	// The rejected request does not consume tokens from the burst limit
+	if tokens := mb.buckets[0].GetTokens(); tokens != 7 {
+		t.Errorf("Burst limit tokens = %d, want 7", tokens)
+	}
+	if tokens := mb.GetTokens(); tokens != 0 {
+		t.Errorf("GetTokens() = %d, want 0", tokens)
+	}
+
+	// A cost larger than the burst limit trips the burst limit first
+	mb.Reset()
+	if d := mb.DecideN(11); d.Allowed || d.Limit != burstLimit {
+		t.Errorf("DecideN(11) = %+v, want rejection by %v", d, burstLimit)
+	}
+}
+
+func TestMultiBucket_ReserveN(t *testing.T) {
+	mb := NewMultiBucket([]config.Limit{
+		{Rate: 100, Period: time.Second, Burst: 10},
+		{Rate: 1, Period: time.Minute, Burst: 1},
+	})
+
+	if r := mb.ReserveN(1); !r.OK() || r.Delay() != 0 {
+		t.Fatalf("First reservation should be usable now, got ok=%v delay=%v", r.OK(), r.Delay())
+	}
+
+	// The second token of the per-minute limit arrives a minute later
+	r := mb.ReserveN(1)
+	if !r.OK() {
+		t.Fatal("Second reservation should be granted")
+	}
+	if delay := r.Delay(); delay < 59*time.Second || delay > time.Minute {
+		t.Errorf("Delay() = %v, want about 1m", delay)
+	}
+
+	// Cancelling gives the tokens back to every limit
+	r.Cancel()
+	if tokens := mb.buckets[0].GetTokens(); tokens != 9 {
+		t.Errorf("Burst limit tokens after cancel = %d, want 9", tokens)
+	}
+
+	if r := mb.ReserveN(2); r.OK() {
+		t.Error("Reservation larger than a limit's burst should not be granted")
+	}
+}
+
+func TestNewBucketForLimits(t *testing.T) {
+	single := []config.Limit{{Rate: 10, Period: time.Second, Burst: 5}}
+	if _, ok := NewBucketForLimits(config.AlgorithmTokenBucket, single).(*TokenBucket); !ok {
+		t.Error("A single limit should use a token bucket")
+	}
+	if _, ok := NewBucketForLimits(config.AlgorithmLeakyBucket, single).(*LeakyBucket); !ok {
+		t.Error("A single limit should use the tier's leaky bucket")
+	}
+
+	multiple := append(single, config.Limit{Rate: 100, Period: time.Minute, Burst: 100})
+	if _, ok := NewBucketForLimits(config.AlgorithmTokenBucket, multiple).(*MultiBucket); !ok {
+		t.Error("Several limits should use a multi-bucket")
+	}
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"rate_limiter_service/internal/config"
+)
+
+// PenaltyBoxInterface defines the interface for penalty boxes that ban users who keep getting rejected
+type PenaltyBoxInterface interface {
+	// Banned reports whether the user is banned and, if so, when the ban ends
+	Banned(userID string) (time.Time, bool)
+	// Penalize counts a rejection against the user; it reports whether this started a ban and when it ends
+	Penalize(userID string) (time.Time, bool)
+	// Reset clears all penalty state for testing purposes
+	Reset()
+}
+
+// penaltyRecord is the penalty state of one user
+type penaltyRecord struct {
+	// rejections are the times of the rejections within the sliding window
+	rejections []time.Time
+	// offenses counts the bans since the offenses were last forgotten
+	offenses int
+	// bannedUntil is the end of the current or last ban
+	bannedUntil time.Time
+}
+
+// PenaltyBox bans users in memory once they are rejected config.PenaltyThreshold times
+// within config.PenaltyWindow
+// Each ban within config.PenaltyResetAfter of the previous one lasts twice as long, up to
+// config.PenaltyMaxBan
+type PenaltyBox struct {
+	config config.Config
+
+	// mu protects records
+	mu sync.Mutex
+	// records holds the penalty state keyed by user ID
+	records map[string]*penaltyRecord
+
+	// now returns the current time; overridden in tests
+	now func() time.Time
+}
+
+// NewPenaltyBox creates a new in-memory penalty box
+func NewPenaltyBox(cfg config.Config) *PenaltyBox {
+	return &PenaltyBox{
+		config:  cfg,
+		records: make(map[string]*penaltyRecord),
+		now:     time.Now,
+	}
+}
+
+// Banned reports whether the user is banned and, if so, when the ban ends
+func (pb *PenaltyBox) Banned(userID string) (time.Time, bool) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	if record, ok := pb.records[userID]; ok && pb.now().Before(record.bannedUntil) {
+		return record.bannedUntil, true
+	}
+	return time.Time{}, false
+}
+
+// Penalize counts a rejection against the user; it reports whether this started a ban and when it ends
+func (pb *PenaltyBox) Penalize(userID string) (time.Time, bool) {
+	now := pb.now()
+
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	record, ok := pb.records[userID]
+	if !ok {
+		record = &penaltyRecord{}
+		pb.records[userID] = record
+	}
+
+	// Keep only the rejections still inside the sliding window
+	windowStart := now.Add(-pb.config.PenaltyWindow)
+	kept := record.rejections[:0]
+	for _, rejection := range record.rejections {
+		if rejection.After(windowStart) {
+			kept = append(kept, rejection)
+		}
+	}
+	record.rejections = append(kept, now)
+
+	if len(record.rejections) < pb.config.PenaltyThreshold {
+		return time.Time{}, false
+	}
+
+	if record.offenses > 0 && now.Sub(record.bannedUntil) >= pb.config.PenaltyResetAfter {
+		record.offenses = 0
+	}
+	record.offenses++
+	record.bannedUntil = now.Add(pb.config.GetPenaltyBan(record.offenses))
+	record.rejections = nil
+	return record.bannedUntil, true
+}
+
+// Reset clears all penalty state for testing purposes
+func (pb *PenaltyBox) Reset() {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	pb.records = make(map[string]*penaltyRecord)
+}
+
+// Tarpit holds a request from a banned user for up to delay before it is rejected, never past the
+// end of the ban, so retries are slowed down without the client seeing a response early
+// It returns early if ctx is done
+func Tarpit(ctx context.Context, delay time.Duration, bannedUntil time.Time) {
+	delay = min(delay, time.Until(bannedUntil))
+	if delay <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
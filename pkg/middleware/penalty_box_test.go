@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rate_limiter_service/internal/config"
+)
+
+func TestPenaltyBox_Penalize(t *testing.T) {
+	cfg := config.Config{
+		PenaltyThreshold:  3,
+		PenaltyWindow:     time.Minute,
+		PenaltyBan:        time.Minute,
+		PenaltyMaxBan:     3 * time.Minute,
+		PenaltyResetAfter: time.Hour,
+	}
+	pb := NewPenaltyBox(cfg)
+
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	pb.now = func() time.Time { return now }
+
+	// Rejections that fall out of the window are forgotten
+	pb.Penalize("user123")
+	pb.Penalize("user123")
+	now = now.Add(61 * time.Second)
+	if _, banned := pb.Penalize("user123"); banned {
+		t.Fatal("Rejections outside the window should not start a ban")
+	}
+
+	pb.Penalize("user123")
+	bannedUntil, banned := pb.Penalize("user123")
+	if !banned || !bannedUntil.Equal(now.Add(time.Minute)) {
+		t.Fatalf("Third rejection within the window should start a 1m ban, got %v %v", bannedUntil, banned)
+	}
+	if until, banned := pb.Banned("user123"); !banned || !until.Equal(bannedUntil) {
+		t.Errorf("Banned() = %v %v, want %v true", until, banned, bannedUntil)
+	}
+	if _, banned := pb.Banned("user456"); banned {
+		t.Error("Other users should not be banned")
+	}
+
+	// Repeat offenses double the ban up to the maximum
+	for _, want := range []time.Duration{2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		now = bannedUntil
+		if _, banned := pb.Banned("user123"); banned {
+			t.Fatal("Ban should be over")
+		}
+		for i := 0; i < 3; i++ {
+			bannedUntil, banned = pb.Penalize("user123")
+		}
+		if !banned || bannedUntil.Sub(now) != want {
+			t.Fatalf("Repeat offense should ban for %v, got %v", want, bannedUntil.Sub(now))
+		}
+	}
+
+	// Offenses are forgotten once the user behaves for PenaltyResetAfter
+	now = bannedUntil.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		bannedUntil, banned = pb.Penalize("user123")
+	}
+	if !banned || bannedUntil.Sub(now) != time.Minute {
+		t.Errorf("Offense after the reset period should ban for 1m, got %v", bannedUntil.Sub(now))
+	}
+
+	pb.Reset()
+	if _, banned := pb.Banned("user123"); banned {
+		t.Error("Reset() should lift bans")
+	}
+}
+
+func TestTarpit(t *testing.T) {
+	// The delay never outlasts the ban
+	start := time.Now()
+	Tarpit(context.Background(), time.Hour, start.Add(20*time.Millisecond))
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Tarpit should end with the ban, took %v", elapsed)
+	}
+
+	// A cancelled request is released immediately
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start = time.Now()
+	Tarpit(ctx, time.Hour, start.Add(time.Hour))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Tarpit should return once the context is done, took %v", elapsed)
+	}
+}
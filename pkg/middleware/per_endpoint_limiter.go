@@ -5,6 +5,7 @@ import (
 	"sync"
 
 	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/ratelimit"
 )
 
 // PerEndpointLimiter enforces per-endpoint rate limits per user
@@ -12,9 +13,9 @@ type PerEndpointLimiter struct {
 	// config holds the rate limiting configuration
 	config config.Config
 
-	// buckets stores token buckets keyed by "userID:endpointKey"
+	// buckets stores token or leaky buckets keyed by "userID:endpointKey"
 	// endpointKey is "method:path" (e.g., "GET:/api/users")
-	buckets sync.Map // map[string]*TokenBucket
+	buckets sync.Map // map[string]Bucket
 }
 
 // NewPerEndpointLimiter creates a new per-endpoint rate limiter
@@ -27,61 +28,111 @@ func NewPerEndpointLimiter(cfg config.Config) *PerEndpointLimiter {
 // Allow checks if the request for the given user and endpoint is allowed
 // Returns true if allowed, false if rate limited
 func (pel *PerEndpointLimiter) Allow(userID, method, path string) bool {
-	endpointKey := fmt.Sprintf("%s:%s", method, path)
+	return pel.AllowN(userID, method, path, 1)
+}
+
+// AllowN checks if a request costing n tokens for the given user and endpoint is allowed
+// Returns true if allowed, false if rate limited
+func (pel *PerEndpointLimiter) AllowN(userID, method, path string, n int) bool {
+	return ratelimit.Admitted(pel.Decide(userID, method, path, n))
+}
+
+// Decide checks a request costing n tokens against every limit of the endpoint
+// When the request is rejected, the decision names the limit that tripped
+func (pel *PerEndpointLimiter) Decide(userID, method, path string, n int) ratelimit.Decision {
+	endpointKey := config.HTTPEndpointKey(method, path)
 	bucketKey := fmt.Sprintf("%s:%s", userID, endpointKey)
 
 	// Get or create bucket for this user-endpoint combination
 	bucket := pel.getOrCreateBucket(bucketKey, endpointKey)
 
-	return bucket.Allow()
+	return DecideBucket(bucket, n, func() []config.Limit {
+		return pel.config.GetHTTPMethodLimits(endpointKey)
+	})
 }
 
-// getOrCreateBucket retrieves or creates a token bucket for the given key
-func (pel *PerEndpointLimiter) getOrCreateBucket(bucketKey, endpointKey string) *TokenBucket {
+// getOrCreateBucket retrieves or creates a bucket for the given key
+func (pel *PerEndpointLimiter) getOrCreateBucket(bucketKey, endpointKey string) Bucket {
 	// Try to load existing bucket
 	if bucket, ok := pel.buckets.Load(bucketKey); ok {
-		return bucket.(*TokenBucket)
+		return bucket.(Bucket)
 	}
 
-	// Determine rate for this endpoint
-	rate := pel.getRateForEndpoint(endpointKey)
-	burstSize := pel.config.PerEndpointBurstSize
-
-	// Create new bucket
-	bucket := NewTokenBucket(burstSize, rate)
+	// Create new bucket with the limits of this endpoint
+	algorithm := pel.config.GetHTTPMethodAlgorithm(endpointKey)
+	bucket := NewBucketForTier(algorithm, pel.config.GetHTTPMethodLimits(endpointKey), pel.config.HTTPMethodStart)
 
 	// Store it (may have been created by another goroutine in the meantime)
 	actual, loaded := pel.buckets.LoadOrStore(bucketKey, bucket)
 	if loaded {
 		// Another goroutine created it, return that one instead
-		return actual.(*TokenBucket)
+		return actual.(Bucket)
 	}
 
 	return bucket
 }
 
-// getRateForEndpoint returns the rate limit for a specific endpoint, falling back to default
-func (pel *PerEndpointLimiter) getRateForEndpoint(endpointKey string) int {
-	if rate, ok := pel.config.HTTPMethods[endpointKey]; ok {
-		return rate
-	}
-	return pel.config.HTTPDefaultMethodRate
-}
-
 // GetRemainingTokens returns the number of remaining tokens for a user-endpoint combination
 func (pel *PerEndpointLimiter) GetRemainingTokens(userID, method, path string) int {
-	endpointKey := fmt.Sprintf("%s:%s", method, path)
+	endpointKey := config.HTTPEndpointKey(method, path)
 	bucketKey := fmt.Sprintf("%s:%s", userID, endpointKey)
 
 	if bucket, ok := pel.buckets.Load(bucketKey); ok {
-		return bucket.(*TokenBucket).GetTokens()
+		return bucket.(Bucket).GetTokens()
 	}
 
-	// If no bucket exists yet, return the full capacity
-	return pel.config.PerEndpointBurstSize
+	// If no bucket exists yet, return what a new bucket starts with
+	return pel.config.HTTPMethodStart.InitialTokens(pel.config.PerEndpointBurstSize)
 }
 
 // Reset clears all rate limiting state for testing purposes
 func (pel *PerEndpointLimiter) Reset() {
 	pel.buckets = sync.Map{}
-}
\ No newline at end of file
+}
+
+// strictEndpointLimiter keeps strict endpoints in an in-memory sliding log while the other endpoints
+// use a shared limiter, since the sliding log has no distributed counterpart
+type strictEndpointLimiter struct {
+	// config holds the rate limiting configuration
+	config config.Config
+
+	// strict handles the endpoints marked as strict
+	strict *PerEndpointLimiter
+
+	// other handles every other endpoint
+	other PerEndpointLimiterInterface
+}
+
+// limiterFor returns the limiter responsible for the endpoint
+func (sel *strictEndpointLimiter) limiterFor(method, path string) PerEndpointLimiterInterface {
+	if sel.config.IsHTTPMethodStrict(config.HTTPEndpointKey(method, path)) {
+		return sel.strict
+	}
+	return sel.other
+}
+
+// Allow checks if the request for the given user and endpoint is allowed
+func (sel *strictEndpointLimiter) Allow(userID, method, path string) bool {
+	return sel.AllowN(userID, method, path, 1)
+}
+
+// AllowN checks if a request costing n tokens for the given user and endpoint is allowed
+func (sel *strictEndpointLimiter) AllowN(userID, method, path string, n int) bool {
+	return ratelimit.Admitted(sel.Decide(userID, method, path, n))
+}
+
+// Decide checks a request costing n tokens against every limit of the endpoint
+func (sel *strictEndpointLimiter) Decide(userID, method, path string, n int) ratelimit.Decision {
+	return sel.limiterFor(method, path).Decide(userID, method, path, n)
+}
+
+// GetRemainingTokens returns the number of remaining tokens for a user-endpoint combination
+func (sel *strictEndpointLimiter) GetRemainingTokens(userID, method, path string) int {
+	return sel.limiterFor(method, path).GetRemainingTokens(userID, method, path)
+}
+
+// Reset clears all rate limiting state for testing purposes
+func (sel *strictEndpointLimiter) Reset() {
+	sel.strict.Reset()
+	sel.other.Reset()
+}
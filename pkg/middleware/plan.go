@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"rate_limiter_service/internal/config"
+)
+
+// PlanResolver maps a user ID to the name of the user's plan
+// An empty or undefined plan name selects config.DefaultPlan
+type PlanResolver interface {
+	ResolvePlan(userID string) string
+}
+
+// PlanResolverFunc adapts a function supplied by the embedding application, such as a lookup in
+// its account database, to a PlanResolver
+type PlanResolverFunc func(userID string) string
+
+// ResolvePlan calls f(userID)
+func (f PlanResolverFunc) ResolvePlan(userID string) string {
+	return f(userID)
+}
+
+// StaticPlanResolver assigns plans from a map of user IDs to plan names, such as config.PlanUsers
+type StaticPlanResolver map[string]string
+
+// ResolvePlan returns the plan the map assigns the user, or ""
+func (r StaticPlanResolver) ResolvePlan(userID string) string {
+	return r[userID]
+}
+
+// rateLimiters are the per-user rate limiters of the HTTP middleware, built with one plan's numbers
+type rateLimiters struct {
+	config      config.Config
+	global      GlobalLimiterInterface
+	http        HTTPLimiterInterface
+	perEndpoint PerEndpointLimiterInterface
+}
+
+// newRateLimiters creates the HTTP middleware's rate limiters for the given configuration
+func newRateLimiters(cfg config.Config) rateLimiters {
+	factory := NewLimiterFactory(cfg)
+	return rateLimiters{
+		config:      cfg,
+		global:      factory.CreateGlobalLimiter(),
+		http:        factory.CreateHTTPLimiter(),
+		perEndpoint: factory.CreatePerEndpointLimiter(),
+	}
+}
+
+// reset clears the state of every limiter for testing purposes
+func (rl rateLimiters) reset() {
+	rl.global.Reset()
+	rl.http.Reset()
+	rl.perEndpoint.Reset()
+}
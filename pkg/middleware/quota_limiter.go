@@ -0,0 +1,329 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/ratelimit"
+)
+
+// QuotaLimiterInterface defines the interface for calendar quota limiters
+type QuotaLimiterInterface interface {
+	// Decide charges a request costing n to every quota of the user
+	Decide(userID string, n int) ratelimit.QuotaDecision
+	// Refund gives a request costing n that Decide charged back to every quota of the user
+	Refund(userID string, n int)
+	// GetRemainingQuota returns how many requests the user's tightest quota still admits this period
+	GetRemainingQuota(userID string) int
+	// Reset clears all quota state for testing purposes
+	Reset()
+	// Close persists outstanding counters and stops background work
+	Close() error
+}
+
+// quotaCounter is the usage of one quota in one calendar period
+type quotaCounter struct {
+	Count int `json:"count"`
+	// Expires is the end of the period, after which the counter is dropped
+	Expires time.Time `json:"expires"`
+}
+
+// QuotaLimiter enforces calendar-aligned per-user quotas in memory
+// When config.QuotaFile is set, counters are loaded from that file on start and written back
+// every config.QuotaFlushInterval and on Close, so they survive restarts
+type QuotaLimiter struct {
+	config config.Config
+
+	// mu protects counters and dirty
+	mu sync.Mutex
+	// counters are keyed by "userID:window", e.g. "user123:month:2026-10"
+	counters map[string]quotaCounter
+	// dirty reports whether counters changed since they were last written to the file
+	dirty bool
+	// flushMu serializes writes to the file so an older snapshot never replaces a newer one
+	flushMu sync.Mutex
+
+	// now returns the current time; overridden in tests
+	now func() time.Time
+
+	// stop ends the flush loop and done is closed once it has returned
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// refs counts the callers of OpenQuotaLimiter sharing the limiter; it is protected by quotaFilesMu
+	refs int
+}
+
+var (
+	// quotaFilesMu protects quotaFiles and the refs of the limiters in it
+	quotaFilesMu sync.Mutex
+	// quotaFiles holds the open quota limiters by quota file, so the HTTP middleware and the gRPC
+	// interceptor charge the same counters and never overwrite each other's file
+	quotaFiles = make(map[string]*QuotaLimiter)
+)
+
+// NewQuotaLimiter creates a new quota limiter, loading persisted counters from config.QuotaFile
+// A missing file starts every quota empty; a file that cannot be read or parsed is reported as an
+// error together with a limiter that starts empty
+func NewQuotaLimiter(cfg config.Config) (*QuotaLimiter, error) {
+	ql := &QuotaLimiter{
+		config:   cfg,
+		counters: make(map[string]quotaCounter),
+		now:      time.Now,
+	}
+	if cfg.QuotaFile == "" {
+		return ql, nil
+	}
+
+	err := ql.load()
+	ql.stop = make(chan struct{})
+	ql.done = make(chan struct{})
+	go ql.flushLoop(cfg.GetQuotaFlushInterval())
+	return ql, err
+}
+
+// OpenQuotaLimiter returns the quota limiter persisting to config.QuotaFile, creating it with
+// NewQuotaLimiter on first use; later callers share it, and its file, until every caller has closed it
+// A load error is only reported to the caller that created the limiter; without a quota file every
+// call creates a new limiter
+func OpenQuotaLimiter(cfg config.Config) (*QuotaLimiter, error) {
+	if cfg.QuotaFile == "" {
+		return NewQuotaLimiter(cfg)
+	}
+
+	quotaFilesMu.Lock()
+	defer quotaFilesMu.Unlock()
+
+	path := filepath.Clean(cfg.QuotaFile)
+	if ql, ok := quotaFiles[path]; ok {
+		ql.refs++
+		return ql, nil
+	}
+	ql, err := NewQuotaLimiter(cfg)
+	ql.refs = 1
+	quotaFiles[path] = ql
+	return ql, err
+}
+
+// Decide charges a request costing n to every quota of the user
+// The request is charged only if every quota admits it; otherwise the decision names the first
+// quota that would be exceeded and when it resets
+func (ql *QuotaLimiter) Decide(userID string, n int) ratelimit.QuotaDecision {
+	n = max(n, 1)
+	now := ql.now()
+	location := ql.config.GetQuotaLocation()
+
+	ql.mu.Lock()
+	defer ql.mu.Unlock()
+
+	keys := make([]string, len(ql.config.Quotas))
+	ends := make([]time.Time, len(ql.config.Quotas))
+	for i, quota := range ql.config.Quotas {
+		var window string
+		window, ends[i] = quota.Window(now, location)
+		keys[i] = userID + ":" + window
+
+		if ql.counters[keys[i]].Count+n > quota.Limit {
+			return ratelimit.QuotaExceeded(quota, ends[i])
+		}
+	}
+
+	for i, key := range keys {
+		ql.counters[key] = quotaCounter{Count: ql.counters[key].Count + n, Expires: ends[i]}
+	}
+	ql.dirty = true
+	return ratelimit.QuotaAllowed()
+}
+
+// Refund gives a request costing n back to every quota of the user, for requests Decide charged
+// that a later check rejected
+func (ql *QuotaLimiter) Refund(userID string, n int) {
+	n = max(n, 1)
+	now := ql.now()
+	location := ql.config.GetQuotaLocation()
+
+	ql.mu.Lock()
+	defer ql.mu.Unlock()
+
+	for _, quota := range ql.config.Quotas {
+		window, _ := quota.Window(now, location)
+		key := userID + ":" + window
+		counter, ok := ql.counters[key]
+		if !ok {
+			continue
+		}
+		counter.Count = max(counter.Count-n, 0)
+		ql.counters[key] = counter
+	}
+	ql.dirty = true
+}
+
+// GetRemainingQuota returns how many requests the user's tightest quota still admits this period
+// It returns -1 if no quotas are configured
+func (ql *QuotaLimiter) GetRemainingQuota(userID string) int {
+	now := ql.now()
+	location := ql.config.GetQuotaLocation()
+
+	ql.mu.Lock()
+	defer ql.mu.Unlock()
+
+	remaining := -1
+	for _, quota := range ql.config.Quotas {
+		window, _ := quota.Window(now, location)
+		quotaRemaining := max(quota.Limit-ql.counters[userID+":"+window].Count, 0)
+		if remaining < 0 || quotaRemaining < remaining {
+			remaining = quotaRemaining
+		}
+	}
+	return remaining
+}
+
+// Flush writes the counters to config.QuotaFile if they changed since the last write
+// Counters of periods that have ended are dropped first
+func (ql *QuotaLimiter) Flush() error {
+	if ql.config.QuotaFile == "" {
+		return nil
+	}
+
+	ql.flushMu.Lock()
+	defer ql.flushMu.Unlock()
+
+	ql.mu.Lock()
+	if !ql.dirty {
+		ql.mu.Unlock()
+		return nil
+	}
+	now := ql.now()
+	for key, counter := range ql.counters {
+		if !now.Before(counter.Expires) {
+			delete(ql.counters, key)
+		}
+	}
+	data, err := json.Marshal(ql.counters)
+	ql.dirty = false
+	ql.mu.Unlock()
+
+	if err == nil {
+		err = writeFileAtomic(ql.config.QuotaFile, data)
+	}
+	if err != nil {
+		// Try again on the next flush
+		ql.mu.Lock()
+		ql.dirty = true
+		ql.mu.Unlock()
+		return fmt.Errorf("failed to write quota file %q: %w", ql.config.QuotaFile, err)
+	}
+	return nil
+}
+
+// load reads persisted counters from config.QuotaFile, skipping those whose period has ended
+func (ql *QuotaLimiter) load() error {
+	// #nosec G304 - the quota file path comes from the service configuration
+	data, err := os.ReadFile(ql.config.QuotaFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read quota file %q: %w", ql.config.QuotaFile, err)
+	}
+
+	var counters map[string]quotaCounter
+	if err := json.Unmarshal(data, &counters); err != nil {
+		return fmt.Errorf("failed to parse quota file %q: %w", ql.config.QuotaFile, err)
+	}
+
+	now := ql.now()
+	for key, counter := range counters {
+		if now.Before(counter.Expires) {
+			ql.counters[key] = counter
+		}
+	}
+	return nil
+}
+
+// flushLoop writes the counters to the file every interval until Close is called
+func (ql *QuotaLimiter) flushLoop(interval time.Duration) {
+	defer close(ql.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := ql.Flush(); err != nil {
+				log.Printf("quota limiter: %v", err)
+			}
+		case <-ql.stop:
+			return
+		}
+	}
+}
+
+// Close stops the flush loop and writes outstanding counters to the file
+// A limiter shared through OpenQuotaLimiter only writes them and keeps flushing until its last
+// caller closes it
+func (ql *QuotaLimiter) Close() error {
+	if ql.stop == nil {
+		return nil
+	}
+	if !ql.release() {
+		return ql.Flush()
+	}
+	ql.closeOnce.Do(func() {
+		close(ql.stop)
+		<-ql.done
+	})
+	return ql.Flush()
+}
+
+// release drops one caller of a limiter shared through OpenQuotaLimiter and reports whether it
+// was the last one, removing the limiter from quotaFiles if so
+func (ql *QuotaLimiter) release() bool {
+	quotaFilesMu.Lock()
+	defer quotaFilesMu.Unlock()
+
+	if ql.refs > 1 {
+		ql.refs--
+		return false
+	}
+	ql.refs = 0
+	if path := filepath.Clean(ql.config.QuotaFile); quotaFiles[path] == ql {
+		delete(quotaFiles, path)
+	}
+	return true
+}
+
+// Reset clears all quota counters for testing purposes
+func (ql *QuotaLimiter) Reset() {
+	ql.mu.Lock()
+	defer ql.mu.Unlock()
+	ql.counters = make(map[string]quotaCounter)
+	ql.dirty = true
+}
+
+// writeFileAtomic replaces path with data so readers never see a partially written file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,194 @@
+package middleware
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"rate_limiter_service/internal/config"
+)
+
+func TestQuotaLimiter_Decide(t *testing.T) {
+	cfg := config.Config{
+		Quotas: []config.Quota{
+			{Limit: 5, Period: config.QuotaPeriodMonth},
+			{Limit: 3, Period: config.QuotaPeriodDay},
+		},
+	}
+	ql, err := NewQuotaLimiter(cfg)
+	if err != nil {
+		t.Fatalf("NewQuotaLimiter() error = %v", err)
+	}
+
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	ql.now = func() time.Time { return now }
+
+	// The daily quota trips first and resets at midnight
+	for i := 0; i < 3; i++ {
+		if d := ql.Decide("user123", 1); !d.Allowed {
+			t.Fatalf("Request %d should be allowed", i+1)
+		}
+	}
+	d := ql.Decide("user123", 1)
+	if d.Allowed || d.Quota.Period != config.QuotaPeriodDay {
+		t.Fatalf("Fourth request should exceed the daily quota, got %+v", d)
+	}
+	if want := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC); !d.ResetAt.Equal(want) {
+		t.Errorf("ResetAt = %v, want %v", d.ResetAt, want)
+	}
+
+	// Other users have their own quotas
+	if d := ql.Decide("user456", 1); !d.Allowed {
+		t.Error("Another user should be allowed")
+	}
+
+	// The next day only the monthly quota has room left
+	now = now.Add(24 * time.Hour)
+	if remaining := ql.GetRemainingQuota("user123"); remaining != 2 {
+		t.Errorf("GetRemainingQuota() = %d, want 2", remaining)
+	}
+	if d := ql.Decide("user123", 3); d.Allowed || d.Quota.Period != config.QuotaPeriodMonth {
+		t.Errorf("Request costing 3 should exceed the monthly quota, got %+v", d)
+	}
+	if d := ql.Decide("user123", 2); !d.Allowed {
+		t.Error("Request costing 2 should be allowed, rejected requests must not be charged")
+	}
+	if remaining := ql.GetRemainingQuota("user123"); remaining != 0 {
+		t.Errorf("GetRemainingQuota() = %d, want 0", remaining)
+	}
+}
+
+func TestQuotaLimiter_Refund(t *testing.T) {
+	cfg := config.Config{
+		Quotas: []config.Quota{
+			{Limit: 5, Period: config.QuotaPeriodMonth},
+			{Limit: 3, Period: config.QuotaPeriodDay},
+		},
+	}
+	ql, err := NewQuotaLimiter(cfg)
+	if err != nil {
+		t.Fatalf("NewQuotaLimiter() error = %v", err)
+	}
+
+	ql.Decide("user123", 2)
+	ql.Refund("user123", 2)
+	if remaining := ql.GetRemainingQuota("user123"); remaining != 3 {
+		t.Errorf("GetRemainingQuota() after a refund = %d, want 3", remaining)
+	}
+
+	// Counters never drop below zero, and users who were never charged are left alone
+	ql.Refund("user123", 5)
+	ql.Refund("user456", 1)
+	if d := ql.Decide("user123", 4); d.Allowed {
+		t.Error("Request costing 4 should still exceed the daily quota of 3")
+	}
+}
+
+func TestQuotaLimiter_Persistence(t *testing.T) {
+	cfg := config.Config{
+		Quotas:             []config.Quota{{Limit: 3, Period: config.QuotaPeriodDay}},
+		QuotaFile:          filepath.Join(t.TempDir(), "quotas.json"),
+		QuotaFlushInterval: time.Hour,
+	}
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	ql, err := NewQuotaLimiter(cfg)
+	if err != nil {
+		t.Fatalf("NewQuotaLimiter() error = %v", err)
+	}
+	ql.now = func() time.Time { return now }
+	for i := 0; i < 2; i++ {
+		ql.Decide("user123", 1)
+	}
+	if err := ql.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// A restarted limiter picks up where the previous one stopped
+	restarted, err := NewQuotaLimiter(cfg)
+	if err != nil {
+		t.Fatalf("NewQuotaLimiter() after restart error = %v", err)
+	}
+	defer func() { _ = restarted.Close() }()
+	restarted.now = func() time.Time { return now }
+
+	if remaining := restarted.GetRemainingQuota("user123"); remaining != 1 {
+		t.Errorf("GetRemainingQuota() after restart = %d, want 1", remaining)
+	}
+
+	// Counters of periods that ended while the service was down are dropped
+	now = now.Add(24 * time.Hour)
+	restarted.Decide("user456", 1)
+	if err := restarted.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	data, err := os.ReadFile(cfg.QuotaFile)
+	if err != nil {
+		t.Fatalf("Failed to read quota file: %v", err)
+	}
+	if want := `{"user456:day:2026-10-18":{"count":1,"expires":"2026-10-19T00:00:00Z"}}`; string(data) != want {
+		t.Errorf("quota file = %s, want %s", data, want)
+	}
+}
+
+func TestQuotaLimiter_CorruptFile(t *testing.T) {
+	cfg := config.Config{
+		Quotas:    []config.Quota{{Limit: 3, Period: config.QuotaPeriodDay}},
+		QuotaFile: filepath.Join(t.TempDir(), "quotas.json"),
+	}
+	if err := os.WriteFile(cfg.QuotaFile, []byte("not json"), 0600); err != nil {
+		t.Fatalf("Failed to write quota file: %v", err)
+	}
+
+	ql, err := NewQuotaLimiter(cfg)
+	if err == nil {
+		t.Error("NewQuotaLimiter() should report a corrupt quota file")
+	}
+	defer func() { _ = ql.Close() }()
+
+	if remaining := ql.GetRemainingQuota("user123"); remaining != 3 {
+		t.Errorf("GetRemainingQuota() = %d, want a full quota of 3", remaining)
+	}
+}
+
+func TestOpenQuotaLimiter_SharesFile(t *testing.T) {
+	cfg := config.Config{
+		Quotas:             []config.Quota{{Limit: 3, Period: config.QuotaPeriodMonth}},
+		QuotaFile:          filepath.Join(t.TempDir(), "quotas.json"),
+		QuotaFlushInterval: time.Hour,
+	}
+
+	// The HTTP middleware and the gRPC interceptor open the same file and charge the same quota
+	httpLimiter := NewLimiterFactory(cfg).CreateQuotaLimiter()
+	grpcLimiter := NewLimiterFactory(cfg).CreateQuotaLimiter()
+	if httpLimiter != grpcLimiter {
+		t.Fatal("CreateQuotaLimiter() should share the limiter of a quota file")
+	}
+	httpLimiter.Decide("user123", 2)
+	if d := grpcLimiter.Decide("user123", 2); d.Allowed {
+		t.Error("A user should get the quota once, not once per protocol")
+	}
+
+	// Closing one side writes the counters but keeps the limiter open for the other
+	if err := httpLimiter.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	grpcLimiter.Decide("user123", 1)
+	if err := grpcLimiter.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// Once every caller has closed it, the next one loads the file afresh
+	reopened, err := OpenQuotaLimiter(cfg)
+	if err != nil {
+		t.Fatalf("OpenQuotaLimiter() error = %v", err)
+	}
+	defer func() { _ = reopened.Close() }()
+	if reopened == grpcLimiter {
+		t.Error("OpenQuotaLimiter() should not return a closed limiter")
+	}
+	if remaining := reopened.GetRemainingQuota("user123"); remaining != 0 {
+		t.Errorf("GetRemainingQuota() after reopening = %d, want 0", remaining)
+	}
+}
@@ -0,0 +1,247 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/ratelimit"
+)
+
+// SlidingLog enforces one or more limits exactly by recording the time of every admitted request
+// A request is admitted only if, for every limit, fewer than Rate requests were admitted within the
+// preceding Period, so no span of Period ever holds more than Rate requests; burst sizes are ignored
+// Each limit keeps its times in a ring buffer of Rate entries, so memory is bounded by the rates
+type SlidingLog struct {
+	// mu serializes admissions so a request is recorded in every log or none
+	mu sync.Mutex
+
+	// limits are the limits of the rule, in the order they are checked
+	limits []config.Limit
+
+	// logs holds one request log per limit
+	logs []*requestLog
+
+	// now returns the current time; overridden in tests
+	now func() time.Time
+}
+
+// Ensure SlidingLog implements Bucket
+var _ Bucket = (*SlidingLog)(nil)
+
+// requestLog is a ring buffer of the times of the requests admitted within one limit's period,
+// oldest first
+type requestLog struct {
+	// times holds Unix nanoseconds; its length is the limit's rate
+	times []int64
+	// start is the index of the oldest entry
+	start int
+	// count is the number of entries in use
+	count int
+	// period is the length of the limit's window in nanoseconds
+	period int64
+}
+
+// NewSlidingLog creates a sliding log enforcing every one of the given limits
+func NewSlidingLog(limits []config.Limit) *SlidingLog {
+	logs := make([]*requestLog, len(limits))
+	for i, limit := range limits {
+		period := limit.Period
+		if period <= 0 {
+			period = time.Second
+		}
+		logs[i] = &requestLog{
+			times:  make([]int64, max(limit.Rate, 1)),
+			period: int64(period),
+		}
+	}
+	return &SlidingLog{
+		limits: limits,
+		logs:   logs,
+		now:    time.Now,
+	}
+}
+
+// Allow admits one request, see DecideN
+func (sl *SlidingLog) Allow() bool {
+	return sl.AllowN(1)
+}
+
+// AllowN admits a request costing n, see DecideN
+func (sl *SlidingLog) AllowN(n int) bool {
+	return sl.DecideN(n).Allowed
+}
+
+// AllowNWithReserve admits a request costing n, see DecideNWithReserve
+func (sl *SlidingLog) AllowNWithReserve(n int, reserved float64) bool {
+	return sl.DecideNWithReserve(n, reserved).Allowed
+}
+
+// DecideN admits a request costing n if every limit has room for n more requests in its period
+// A rejected decision names the first limit that was full and the exact time the request would fit
+func (sl *SlidingLog) DecideN(n int) ratelimit.Decision {
+	return sl.DecideNWithReserve(n, 0)
+}
+
+// DecideNWithReserve admits a request costing n if every limit has room for n more requests in its
+// period on top of the reserved share of its rate
+func (sl *SlidingLog) DecideNWithReserve(n int, reserved float64) ratelimit.Decision {
+	if n <= 0 {
+		n = 1
+	}
+
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	now := sl.now().UnixNano()
+	for i, rl := range sl.logs {
+		rl.expire(now)
+		keep := ratelimit.ReservedTokens(len(rl.times), reserved)
+		if at, ok := rl.nextAllowed(now, n, keep); !ok || at > now {
+			return sl.rejected(i, n, reserved, now)
+		}
+	}
+	for _, rl := range sl.logs {
+		rl.push(now, n)
+	}
+	return ratelimit.Allowed()
+}
+
+// rejected returns the decision for a request rejected by the i-th limit, with the time every limit
+// has room for it, or no retry time if it can never be admitted; sl.mu must be held
+func (sl *SlidingLog) rejected(i, n int, reserved float64, now int64) ratelimit.Decision {
+	retryAt := now
+	for _, rl := range sl.logs {
+		rl.expire(now)
+		at, ok := rl.nextAllowed(now, n, ratelimit.ReservedTokens(len(rl.times), reserved))
+		if !ok {
+			return ratelimit.Rejected(sl.limits[i])
+		}
+		retryAt = max(retryAt, at)
+	}
+	return ratelimit.RejectedUntil(sl.limits[i], time.Unix(0, retryAt))
+}
+
+// NextAllowed returns the exact time a request costing n would be admitted by every limit, or false
+// if it never can be because n exceeds a limit's rate
+func (sl *SlidingLog) NextAllowed(n int) (time.Time, bool) {
+	if n <= 0 {
+		n = 1
+	}
+
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	now := sl.now().UnixNano()
+	next := now
+	for _, rl := range sl.logs {
+		rl.expire(now)
+		at, ok := rl.nextAllowed(now, n, 0)
+		if !ok {
+			return time.Time{}, false
+		}
+		next = max(next, at)
+	}
+	return time.Unix(0, next), true
+}
+
+// ReserveN books a request costing n at the first time every limit has room for it
+// The request is recorded at that time right away, so no other request is admitted before it
+// Cancelling the reservation does not free its place in the logs, as older requests already made
+// way for it; a cost larger than a limit's rate is never granted
+func (sl *SlidingLog) ReserveN(n int) *ratelimit.Reservation {
+	if n <= 0 {
+		n = 1
+	}
+
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	now := sl.now().UnixNano()
+	timeToAct := now
+	for _, rl := range sl.logs {
+		rl.expire(now)
+		at, ok := rl.nextAllowed(now, n, 0)
+		if !ok {
+			return ratelimit.NotGranted()
+		}
+		timeToAct = max(timeToAct, at)
+	}
+
+	// Requests that leave their period by timeToAct no longer count against the booked request;
+	// the log that set timeToAct stays full until then, so nothing else is admitted in between
+	for _, rl := range sl.logs {
+		rl.expire(timeToAct)
+		rl.push(timeToAct, n)
+	}
+	return ratelimit.NewReservation(time.Unix(0, timeToAct), nil)
+}
+
+// GetTokens returns how many more requests the most restrictive limit admits right now
+func (sl *SlidingLog) GetTokens() int {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	now := sl.now().UnixNano()
+	tokens := len(sl.logs[0].times)
+	for _, rl := range sl.logs {
+		rl.expire(now)
+		tokens = min(tokens, len(rl.times)-rl.count)
+	}
+	return tokens
+}
+
+// GetCapacity returns the smallest rate of the limits
+func (sl *SlidingLog) GetCapacity() int {
+	capacity := len(sl.logs[0].times)
+	for _, rl := range sl.logs[1:] {
+		capacity = min(capacity, len(rl.times))
+	}
+	return capacity
+}
+
+// Reset forgets every recorded request
+func (sl *SlidingLog) Reset() {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	for _, rl := range sl.logs {
+		rl.start, rl.count = 0, 0
+	}
+}
+
+// expire drops the requests that left the period ending at now
+func (l *requestLog) expire(now int64) {
+	for l.count > 0 && l.at(0) <= now-l.period {
+		l.start = (l.start + 1) % len(l.times)
+		l.count--
+	}
+}
+
+// nextAllowed returns when n more requests fit into the period while keeping keep entries free,
+// or false if they never can
+func (l *requestLog) nextAllowed(now int64, n, keep int) (int64, bool) {
+	capacity := len(l.times) - keep
+	if n > capacity {
+		return 0, false
+	}
+	excess := l.count + n - capacity
+	if excess <= 0 {
+		return now, true
+	}
+	// The excess oldest requests must leave the period first
+	return l.at(excess-1) + l.period, true
+}
+
+// push records n requests at t, which is never before the newest entry; the log must have room
+func (l *requestLog) push(t int64, n int) {
+	for range n {
+		l.times[(l.start+l.count)%len(l.times)] = t
+		l.count++
+	}
+}
+
+// at returns the i-th oldest entry
+func (l *requestLog) at(i int) int64 {
+	return l.times[(l.start+i)%len(l.times)]
+}
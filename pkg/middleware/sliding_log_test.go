@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"rate_limiter_service/internal/config"
+)
+
+// newTestSlidingLog creates a sliding log whose clock is controlled by the returned pointer
+func newTestSlidingLog(limits ...config.Limit) (*SlidingLog, *time.Time) {
+	now := time.Unix(1000, 0)
+	sl := NewSlidingLog(limits)
+	sl.now = func() time.Time { return now }
+	return sl, &now
+}
+
+func TestSlidingLog_DecideN(t *testing.T) {
+	sl, now := newTestSlidingLog(config.Limit{Rate: 5, Period: time.Minute, Burst: 5})
+	start := *now
+
+	// Five requests spread over the first 40 seconds
+	for i := 0; i < 5; i++ {
+		*now = start.Add(time.Duration(i) * 10 * time.Second)
+		if d := sl.DecideN(1); !d.Allowed {
+			t.Fatalf("Request %d should be allowed", i+1)
+		}
+	}
+
+	// The sixth is rejected until the first leaves the minute, exactly at start+60s
+	*now = start.Add(59 * time.Second)
+	d := sl.DecideN(1)
+	if d.Allowed {
+		t.Fatal("Sixth request within the minute should be rejected")
+	}
+	if d.Limit.Rate != 5 {
+		t.Errorf("Limit.Rate = %d, want 5", d.Limit.Rate)
+	}
+	if expected := start.Add(time.Minute); !d.RetryAt.Equal(expected) {
+		t.Errorf("RetryAt = %v, want %v", d.RetryAt, expected)
+	}
+	if next, ok := sl.NextAllowed(1); !ok || !next.Equal(start.Add(time.Minute)) {
+		t.Errorf("NextAllowed(1) = %v, %v, want %v", next, ok, start.Add(time.Minute))
+	}
+
+	// Two more requests must wait for the second request to leave as well
+	if next, _ := sl.NextAllowed(2); !next.Equal(start.Add(70 * time.Second)) {
+		t.Errorf("NextAllowed(2) = %v, want %v", next, start.Add(70*time.Second))
+	}
+
+	*now = start.Add(time.Minute)
+	if d := sl.DecideN(1); !d.Allowed {
+		t.Error("Request once the first left the minute should be allowed")
+	}
+	if d := sl.DecideN(1); d.Allowed {
+		t.Error("No span of a minute may hold more than five requests")
+	}
+}
+
+func TestSlidingLog_MultipleLimits(t *testing.T) {
+	sl, now := newTestSlidingLog(
+		config.Limit{Rate: 2, Period: time.Second, Burst: 2},
+		config.Limit{Rate: 3, Period: time.Minute, Burst: 3},
+	)
+	start := *now
+
+	for i := 0; i < 2; i++ {
+		if d := sl.DecideN(1); !d.Allowed {
+			t.Fatalf("Request %d should be allowed", i+1)
+		}
+	}
+	d := sl.DecideN(1)
+	if d.Allowed || d.Limit.Period != time.Second {
+		t.Fatalf("Third request should trip the per-second limit, got %+v", d)
+	}
+	if !d.RetryAt.Equal(start.Add(time.Second)) {
+		t.Errorf("RetryAt = %v, want %v", d.RetryAt, start.Add(time.Second))
+	}
+
+	*now = start.Add(time.Second)
+	if d := sl.DecideN(1); !d.Allowed {
+		t.Fatal("Request in the next second should be allowed")
+	}
+
+	// The per-minute limit is full, and a rejected request is recorded in neither log
+	*now = start.Add(2 * time.Second)
+	d = sl.DecideN(1)
+	if d.Allowed || d.Limit.Period != time.Minute {
+		t.Fatalf("Fourth request should trip the per-minute limit, got %+v", d)
+	}
+	if !d.RetryAt.Equal(start.Add(time.Minute)) {
+		t.Errorf("RetryAt = %v, want %v", d.RetryAt, start.Add(time.Minute))
+	}
+	if tokens := sl.GetTokens(); tokens != 0 {
+		t.Errorf("GetTokens() = %d, want 0", tokens)
+	}
+	if capacity := sl.GetCapacity(); capacity != 2 {
+		t.Errorf("GetCapacity() = %d, want 2", capacity)
+	}
+}
+
+func TestSlidingLog_Cost(t *testing.T) {
+	sl, _ := newTestSlidingLog(config.Limit{Rate: 5, Period: time.Minute, Burst: 5})
+
+	if d := sl.DecideN(3); !d.Allowed {
+		t.Fatal("Request costing 3 should be allowed")
+	}
+	if d := sl.DecideN(3); d.Allowed {
+		t.Fatal("Second request costing 3 should be rejected")
+	}
+	if d := sl.DecideN(2); !d.Allowed {
+		t.Fatal("Request costing the remaining 2 should be allowed")
+	}
+
+	// A cost above the rate never fits, so there is no time to retry at
+	d := sl.DecideN(6)
+	if d.Allowed || !d.RetryAt.IsZero() {
+		t.Errorf("Request costing more than the rate = %+v, want rejected without RetryAt", d)
+	}
+	if _, ok := sl.NextAllowed(6); ok {
+		t.Error("NextAllowed(6) should report that the request never fits")
+	}
+}
+
+func TestSlidingLog_Reserve(t *testing.T) {
+	sl, _ := newTestSlidingLog(config.Limit{Rate: 10, Period: time.Minute, Burst: 10})
+
+	// With half the rate reserved, only five requests are admitted
+	for i := 0; i < 5; i++ {
+		if !sl.AllowNWithReserve(1, 0.5) {
+			t.Fatalf("Request %d should be allowed", i+1)
+		}
+	}
+	if sl.AllowNWithReserve(1, 0.5) {
+		t.Error("Request into the reserved share should be rejected")
+	}
+	if !sl.Allow() {
+		t.Error("Request without a reserve should be allowed")
+	}
+}
+
+func TestSlidingLog_ReserveN(t *testing.T) {
+	sl, now := newTestSlidingLog(config.Limit{Rate: 2, Period: time.Minute, Burst: 2})
+	start := *now
+
+	for i := 0; i < 2; i++ {
+		*now = start.Add(time.Duration(i) * 30 * time.Second)
+		if r := sl.ReserveN(1); !r.OK() || r.DelayFrom(*now) != 0 {
+			t.Fatalf("Reservation %d should be granted immediately", i+1)
+		}
+	}
+
+	// The third reservation is booked when the first request leaves the minute
+	r := sl.ReserveN(1)
+	if !r.OK() {
+		t.Fatal("Third reservation should be granted")
+	}
+	if delay := r.DelayFrom(*now); delay != 30*time.Second {
+		t.Errorf("DelayFrom() = %v, want %v", delay, 30*time.Second)
+	}
+
+	// The booked request holds its place, so a request arriving then is rejected
+	*now = start.Add(time.Minute)
+	if sl.Allow() {
+		t.Error("Request at the booked time should be rejected")
+	}
+	if r := sl.ReserveN(3); r.OK() {
+		t.Error("Reservation costing more than the rate should not be granted")
+	}
+}
+
+func TestSlidingLog_Reset(t *testing.T) {
+	sl, _ := newTestSlidingLog(config.Limit{Rate: 1, Period: time.Hour, Burst: 1})
+
+	if !sl.Allow() {
+		t.Fatal("First request should be allowed")
+	}
+	if sl.Allow() {
+		t.Fatal("Second request should be rejected")
+	}
+
+	sl.Reset()
+	if !sl.Allow() {
+		t.Error("Request after Reset() should be allowed")
+	}
+}
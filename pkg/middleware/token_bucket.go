@@ -1,8 +1,12 @@
 package middleware
 
 import (
+	"math"
 	"sync"
 	"time"
+
+	"rate_limiter_service/internal/config"
+	"rate_limiter_service/pkg/ratelimit"
 )
 
 // TokenBucket represents a token bucket rate limiter
@@ -14,9 +18,10 @@ type TokenBucket struct {
 	capacity int
 
 	// tokens is the current number of tokens in the bucket
+	// It goes negative while reservations are waiting for tokens to refill
 	tokens int
 
-	// refillRate is the number of tokens added per second
+	// refillRate is the number of tokens added per period
 	refillRate int
 
 	// lastRefill is the timestamp of the last token refill
@@ -24,45 +29,152 @@ type TokenBucket struct {
 
 	// refillInterval is the time between adding one token
 	refillInterval time.Duration
+
+	// initialTokens is the number of tokens the bucket starts with
+	initialTokens int
+
+	// warmUp is how long the refill rate takes to ramp up from zero to refillRate; zero disables it
+	warmUp time.Duration
+
+	// started is when the bucket was created or reset; warm-up refills are counted from it
+	started time.Time
+
+	// refilled is the number of tokens added since started, counted only while warmUp is set
+	refilled int
 }
 
-// NewTokenBucket creates a new token bucket with the specified capacity and refill rate
+// NewTokenBucket creates a new token bucket with the specified capacity and refill rate per second
 func NewTokenBucket(capacity int, refillRate int) *TokenBucket {
+	return NewTokenBucketWithPeriod(capacity, refillRate, time.Second)
+}
+
+// NewTokenBucketWithPeriod creates a new token bucket refilling refillRate tokens per period
+func NewTokenBucketWithPeriod(capacity int, refillRate int, period time.Duration) *TokenBucket {
+	return NewTokenBucketWithStart(capacity, refillRate, period, config.BucketStart{})
+}
+
+// NewTokenBucketWithStart creates a new token bucket refilling refillRate tokens per period that
+// starts with the initial fill of start and ramps its refill rate up over start's warm-up
+func NewTokenBucketWithStart(capacity, refillRate int, period time.Duration, start config.BucketStart) *TokenBucket {
 	if capacity <= 0 {
 		capacity = 1
 	}
 	if refillRate <= 0 {
 		refillRate = 1
 	}
+	if period <= 0 {
+		period = time.Second
+	}
 
+	now := time.Now()
+	initialTokens := start.InitialTokens(capacity)
 	return &TokenBucket{
 		capacity:       capacity,
-		tokens:         capacity, // Start with full bucket
+		tokens:         initialTokens,
 		refillRate:     refillRate,
-		lastRefill:     time.Now(),
-		refillInterval: time.Second / time.Duration(refillRate),
+		lastRefill:     now,
+		refillInterval: period / time.Duration(refillRate),
+		initialTokens:  initialTokens,
+		warmUp:         start.WarmUp,
+		started:        now,
 	}
 }
 
 // Allow attempts to consume one token from the bucket.
 // Returns true if the token was consumed, false if the bucket was empty.
 func (tb *TokenBucket) Allow() bool {
+	return tb.AllowN(1)
+}
+
+// AllowN attempts to consume n tokens from the bucket at once.
+// Returns true if the tokens were consumed, false if fewer than n tokens were available.
+// A cost larger than the bucket capacity can never be satisfied.
+func (tb *TokenBucket) AllowN(n int) bool {
+	return tb.AllowNWithReserve(n, 0)
+}
+
+// AllowNWithReserve attempts to consume n tokens while leaving the reserved share of the capacity
+// in the bucket, as kept for requests of higher priority classes.
+// Returns true if the tokens were consumed, false if that would dip into the reserve.
+func (tb *TokenBucket) AllowNWithReserve(n int, reserved float64) bool {
+	if n <= 0 {
+		n = 1
+	}
+
 	tb.mu.Lock()
 	defer tb.mu.Unlock()
 
 	tb.refill()
 
-	if tb.tokens > 0 {
-		tb.tokens--
+	if tb.tokens-n >= ratelimit.ReservedTokens(tb.capacity, reserved) {
+		tb.tokens -= n
 		return true
 	}
 
 	return false
 }
 
+// Reserve reserves one token, see ReserveN
+func (tb *TokenBucket) Reserve() *ratelimit.Reservation {
+	return tb.ReserveN(1)
+}
+
+// ReserveN reserves n tokens, borrowing against future refills if the bucket is short.
+// The reservation's delay is the time until the borrowed tokens have been refilled.
+// A cost larger than the bucket capacity is never granted.
+func (tb *TokenBucket) ReserveN(n int) *ratelimit.Reservation {
+	if n <= 0 {
+		n = 1
+	}
+	if n > tb.capacity {
+		return ratelimit.NotGranted()
+	}
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.refill()
+
+	timeToAct := time.Now()
+	tb.tokens -= n
+	if tb.tokens < 0 {
+		// Wait until the borrowed tokens have been refilled
+		timeToAct = tb.refillTime(-tb.tokens)
+	}
+
+	return ratelimit.NewReservation(timeToAct, func() {
+		tb.mu.Lock()
+		defer tb.mu.Unlock()
+
+		// Tokens of a reservation that is already due have been used
+		if !time.Now().Before(timeToAct) {
+			return
+		}
+		tb.refill()
+		tb.tokens += n
+		if tb.tokens > tb.capacity {
+			tb.tokens = tb.capacity
+		}
+	})
+}
+
+// refund gives n tokens back, as when a request is rejected by another limit of the same rule
+func (tb *TokenBucket) refund(n int) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.tokens += n
+	if tb.tokens > tb.capacity {
+		tb.tokens = tb.capacity
+	}
+}
+
 // refill adds tokens to the bucket based on elapsed time since last refill
 func (tb *TokenBucket) refill() {
 	now := time.Now()
+	if tb.warmUp > 0 {
+		tb.refillWarmingUp(now)
+		return
+	}
 	elapsed := now.Sub(tb.lastRefill)
 
 	// Calculate how many tokens should be added
@@ -78,11 +190,55 @@ func (tb *TokenBucket) refill() {
 	}
 }
 
+// refillWarmingUp adds the tokens produced since started by a refill rate that ramps up linearly
+// over warmUp and stays at refillRate per period afterwards
+func (tb *TokenBucket) refillWarmingUp(now time.Time) {
+	interval := float64(tb.refillInterval)
+	warmUp := float64(tb.warmUp)
+	elapsed := float64(now.Sub(tb.started))
+
+	// The tokens produced are the integral of the refill rate over the elapsed time
+	var produced float64
+	if elapsed < warmUp {
+		produced = elapsed * elapsed / (2 * warmUp * interval)
+	} else {
+		produced = warmUp/(2*interval) + (elapsed-warmUp)/interval
+	}
+
+	if tokensToAdd := int(produced) - tb.refilled; tokensToAdd > 0 {
+		tb.tokens = min(tb.tokens+tokensToAdd, tb.capacity)
+		tb.refilled += tokensToAdd
+	}
+}
+
+// refillTime returns when the k-th token after those already refilled arrives
+func (tb *TokenBucket) refillTime(k int) time.Time {
+	if tb.warmUp <= 0 {
+		// The next token arrives one interval after the last refill
+		return tb.lastRefill.Add(time.Duration(k) * tb.refillInterval)
+	}
+
+	// Invert the integral of the ramping refill rate, rounding up so the token has arrived by then
+	interval := float64(tb.refillInterval)
+	warmUp := float64(tb.warmUp)
+	target := float64(tb.refilled + k)
+	var elapsed float64
+	if rampTokens := warmUp / (2 * interval); target <= rampTokens {
+		elapsed = math.Sqrt(2 * warmUp * interval * target)
+	} else {
+		elapsed = warmUp + (target-rampTokens)*interval
+	}
+	return tb.started.Add(time.Duration(math.Ceil(elapsed)))
+}
+
 // GetTokens returns the current number of tokens in the bucket
 func (tb *TokenBucket) GetTokens() int {
 	tb.mu.Lock()
 	defer tb.mu.Unlock()
 	tb.refill()
+	if tb.tokens < 0 {
+		return 0
+	}
 	return tb.tokens
 }
 
@@ -91,10 +247,12 @@ func (tb *TokenBucket) GetCapacity() int {
 	return tb.capacity
 }
 
-// Reset fills the bucket to capacity and resets the last refill time
+// Reset restores the initial fill, full by default, and restarts the refill and any warm-up
 func (tb *TokenBucket) Reset() {
 	tb.mu.Lock()
 	defer tb.mu.Unlock()
-	tb.tokens = tb.capacity
+	tb.tokens = tb.initialTokens
 	tb.lastRefill = time.Now()
-}
\ No newline at end of file
+	tb.started = tb.lastRefill
+	tb.refilled = 0
+}
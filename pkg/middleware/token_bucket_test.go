@@ -3,6 +3,8 @@ package middleware
 import (
 	"testing"
 	"time"
+
+	"rate_limiter_service/internal/config"
 )
 
 func TestNewTokenBucket(t *testing.T) {
@@ -199,4 +201,184 @@ func TestTokenBucket_RefillInterval(t *testing.T) {
 	if tb2.refillInterval != expectedInterval2 {
 		t.Errorf("refillInterval = %v, want %v", tb2.refillInterval, expectedInterval2)
 	}
-}
\ No newline at end of file
+}
+func TestTokenBucket_AllowN(t *testing.T) {
+	tb := NewTokenBucket(10, 1)
+
+	if !tb.AllowN(6) {
+		t.Error("AllowN(6) should succeed on a full bucket of 10")
+	}
+	if tb.AllowN(5) {
+		t.Error("AllowN(5) should fail with only 4 tokens left")
+	}
+	if tokens := tb.GetTokens(); tokens != 4 {
+		t.Errorf("Failed AllowN should not consume tokens, got %d, want 4", tokens)
+	}
+	if !tb.AllowN(4) {
+		t.Error("AllowN(4) should succeed with 4 tokens left")
+	}
+
+	// A cost larger than the capacity can never be satisfied
+	tb.Reset()
+	if tb.AllowN(11) {
+		t.Error("AllowN(11) should fail on a bucket with capacity 10")
+	}
+}
+
+func TestTokenBucket_AllowNWithReserve(t *testing.T) {
+	tb := NewTokenBucket(10, 1)
+
+	// 30% of the bucket is kept for higher priority classes
+	for i := 0; i < 7; i++ {
+		if !tb.AllowNWithReserve(1, 0.3) {
+			t.Fatalf("Request %d should be allowed above the reserve", i+1)
+		}
+	}
+	if tb.AllowNWithReserve(1, 0.3) {
+		t.Error("Request dipping into the reserve should be rejected")
+	}
+	if tokens := tb.GetTokens(); tokens != 3 {
+		t.Errorf("Rejected request should not consume tokens, got %d, want 3", tokens)
+	}
+
+	// A smaller reserve still has room, no reserve may empty the bucket
+	if !tb.AllowNWithReserve(2, 0.1) {
+		t.Error("AllowNWithReserve(2, 0.1) should leave the single reserved token")
+	}
+	if !tb.AllowN(1) {
+		t.Error("AllowN(1) should use the last token")
+	}
+}
+
+func TestTokenBucket_ReserveN(t *testing.T) {
+	tb := NewTokenBucket(2, 10) // 100ms per token
+
+	// Tokens in the bucket are available immediately
+	if r := tb.ReserveN(2); !r.OK() || r.Delay() != 0 {
+		t.Errorf("ReserveN(2) = ok %v, delay %v, want ok without delay", r.OK(), r.Delay())
+	}
+
+	// The bucket is empty, so the next tokens are borrowed from future refills
+	r := tb.ReserveN(2)
+	if !r.OK() {
+		t.Fatal("ReserveN(2) should be granted with a delay")
+	}
+	if delay := r.Delay(); delay < 150*time.Millisecond || delay > 200*time.Millisecond {
+		t.Errorf("ReserveN(2) delay = %v, want about 200ms", delay)
+	}
+
+	// Borrowed tokens are not available to Allow
+	if tb.Allow() {
+		t.Error("Allow() should fail while tokens are reserved")
+	}
+	if tokens := tb.GetTokens(); tokens != 0 {
+		t.Errorf("GetTokens() = %d, want 0", tokens)
+	}
+
+	// Cancelling gives the borrowed tokens back
+	r.Cancel()
+	if r := tb.ReserveN(2); !r.OK() || r.Delay() > 200*time.Millisecond {
+		t.Errorf("ReserveN(2) after cancel delay = %v, want at most 200ms", r.Delay())
+	}
+
+	// A cost larger than the capacity is never granted
+	if tb.ReserveN(3).OK() {
+		t.Error("ReserveN(3) should not be granted on a bucket with capacity 2")
+	}
+}
+
+func TestNewTokenBucketWithPeriod(t *testing.T) {
+	tests := []struct {
+		name             string
+		refillRate       int
+		period           time.Duration
+		expectedInterval time.Duration
+	}{
+		{name: "per minute", refillRate: 300, period: time.Minute, expectedInterval: 200 * time.Millisecond},
+		{name: "fractional per second", refillRate: 1, period: 2 * time.Second, expectedInterval: 2 * time.Second},
+		{name: "per day", refillRate: 24, period: 24 * time.Hour, expectedInterval: time.Hour},
+		{name: "zero period defaults to one second", refillRate: 4, period: 0, expectedInterval: 250 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := NewTokenBucketWithPeriod(5, tt.refillRate, tt.period)
+			if tb.refillInterval != tt.expectedInterval {
+				t.Errorf("refillInterval = %v, want %v", tb.refillInterval, tt.expectedInterval)
+			}
+		})
+	}
+}
+
+func TestNewTokenBucketWithStart(t *testing.T) {
+	half := 0.5
+	empty := 0.0
+
+	tests := []struct {
+		name     string
+		start    config.BucketStart
+		expected int
+	}{
+		{name: "full by default", start: config.BucketStart{}, expected: 10},
+		{name: "half full", start: config.BucketStart{InitialFill: &half}, expected: 5},
+		{name: "empty", start: config.BucketStart{InitialFill: &empty}, expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := NewTokenBucketWithStart(10, 1, time.Minute, tt.start)
+			if tokens := tb.GetTokens(); tokens != tt.expected {
+				t.Errorf("GetTokens() = %d, want %d", tokens, tt.expected)
+			}
+
+			// Reset restores the initial fill rather than filling the bucket
+			tb.AllowN(tb.GetTokens())
+			tb.Reset()
+			if tokens := tb.GetTokens(); tokens != tt.expected {
+				t.Errorf("GetTokens() after Reset() = %d, want %d", tokens, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTokenBucket_WarmUp(t *testing.T) {
+	empty := 0.0
+	start := config.BucketStart{InitialFill: &empty, WarmUp: 10 * time.Second}
+
+	// 10 tokens per second once warm; the rate ramps up from zero over the first 10 seconds
+	tests := []struct {
+		name     string
+		elapsed  time.Duration
+		expected int
+	}{
+		{name: "just created", elapsed: 0, expected: 0},
+		{name: "halfway through the warm-up", elapsed: 5 * time.Second, expected: 12},
+		{name: "warm-up complete", elapsed: 10 * time.Second, expected: 50},
+		{name: "at the full rate afterwards", elapsed: 12 * time.Second, expected: 70},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := NewTokenBucketWithStart(100, 10, time.Second, start)
+			tb.started = tb.started.Add(-tt.elapsed)
+			if tokens := tb.GetTokens(); tokens != tt.expected {
+				t.Errorf("GetTokens() = %d, want %d", tokens, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTokenBucket_WarmUpReserveN(t *testing.T) {
+	empty := 0.0
+	start := config.BucketStart{InitialFill: &empty, WarmUp: 10 * time.Second}
+	tb := NewTokenBucketWithStart(100, 10, time.Second, start)
+
+	// The second token of the ramp arrives after 2 seconds, rather than 200ms at the full rate
+	r := tb.ReserveN(2)
+	if !r.OK() {
+		t.Fatal("ReserveN(2) should be granted with a delay")
+	}
+	if delay := r.Delay(); delay < 1900*time.Millisecond || delay > 2*time.Second {
+		t.Errorf("ReserveN(2) delay = %v, want about 2s", delay)
+	}
+}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"rate_limiter_service/internal/config"
+)
+
+// Decision is the outcome of checking a request against a rule made of one or more limits
+type Decision struct {
+	// Allowed reports whether every limit of the rule admitted the request
+	Allowed bool
+
+	// Limit is the limit that rejected the request, or that scheduled the departure of an admitted
+	// request; zero otherwise
+	Limit config.Limit
+
+	// RetryAt is when the rejected request would be admitted, for limiters that can tell exactly;
+	// zero otherwise
+	RetryAt time.Time
+
+	// Reservation is the departure a traffic shaper, such as a leaky bucket, scheduled the admitted
+	// request for; the request may proceed once it can be used, and gives it back with Cancel if
+	// another limit rejects it. Nil if the request may proceed at once
+	Reservation *Reservation
+}
+
+// Allowed returns the decision for an admitted request
+func Allowed() Decision {
+	return Decision{Allowed: true}
+}
+
+// AllowedAfter returns the decision for a request admitted by limit once reservation can be used
+func AllowedAfter(limit config.Limit, reservation *Reservation) Decision {
+	return Decision{Allowed: true, Limit: limit, Reservation: reservation}
+}
+
+// Rejected returns the decision for a request rejected by limit
+func Rejected(limit config.Limit) Decision {
+	return Decision{Limit: limit}
+}
+
+// RejectedUntil returns the decision for a request rejected by limit that would be admitted at retryAt
+func RejectedUntil(limit config.Limit, retryAt time.Time) Decision {
+	return Decision{Limit: limit, RetryAt: retryAt}
+}
+
+// Admitted reports whether the decision admitted the request, blocking until the departure a traffic
+// shaper scheduled it for; it suits callers without a context, others wait for Reservation with Wait
+func Admitted(d Decision) bool {
+	if d.Allowed && d.Reservation != nil {
+		return Wait(context.Background(), d.Reservation) == nil
+	}
+	return d.Allowed
+}
+
+// ReservedTokens returns how many of a limit's capacity tokens a reserved share of it amounts to
+// It rounds up, so a request held to a reserve never eats into the share kept for others
+func ReservedTokens(capacity int, share float64) int {
+	if share <= 0 || capacity <= 0 {
+		return 0
+	}
+	// Allow for float error, so 0.3 of 10 is 3 tokens rather than 4
+	return min(int(math.Ceil(share*float64(capacity)-1e-9)), capacity)
+}
+
+// QuotaDecision is the outcome of charging a request to a user's calendar quotas
+type QuotaDecision struct {
+	// Allowed reports whether every quota admitted the request
+	Allowed bool
+
+	// Quota is the quota that rejected the request; zero if the request was allowed
+	Quota config.Quota
+
+	// ResetAt is when the rejecting quota's period ends and it becomes available again
+	ResetAt time.Time
+}
+
+// QuotaAllowed returns the decision for a request admitted by every quota
+func QuotaAllowed() QuotaDecision {
+	return QuotaDecision{Allowed: true}
+}
+
+// QuotaExceeded returns the decision for a request rejected by quota until resetAt
+func QuotaExceeded(quota config.Quota, resetAt time.Time) QuotaDecision {
+	return QuotaDecision{Quota: quota, ResetAt: resetAt}
+}
+
+// CreditDecision is the outcome of charging a request to a user's prepaid credit balance
+type CreditDecision struct {
+	// Allowed reports whether the balance covered the request
+	Allowed bool
+
+	// Balance is the balance left after the charge, or the balance that fell short of Cost
+	Balance int
+
+	// Cost is the number of credits the request costs
+	Cost int
+}
+
+// CreditCharged returns the decision for a request of the given cost that left balance credits
+func CreditCharged(balance, cost int) CreditDecision {
+	return CreditDecision{Allowed: true, Balance: balance, Cost: cost}
+}
+
+// CreditInsufficient returns the decision for a request of the given cost that balance cannot cover
+func CreditInsufficient(balance, cost int) CreditDecision {
+	return CreditDecision{Balance: balance, Cost: cost}
+}
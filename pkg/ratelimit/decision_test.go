@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"rate_limiter_service/internal/config"
+)
+
+func TestReservedTokens(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		share    float64
+		expected int
+	}{
+		{name: "no reserve", capacity: 10, share: 0, expected: 0},
+		{name: "exact share", capacity: 10, share: 0.3, expected: 3},
+		{name: "rounds up", capacity: 10, share: 0.25, expected: 3},
+		{name: "small bucket", capacity: 1, share: 0.2, expected: 1},
+		{name: "never more than the capacity", capacity: 5, share: 1.5, expected: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReservedTokens(tt.capacity, tt.share); got != tt.expected {
+				t.Errorf("ReservedTokens(%d, %g) = %d, want %d", tt.capacity, tt.share, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAdmitted(t *testing.T) {
+	limit := config.Limit{Rate: 20, Period: time.Second}
+
+	tests := []struct {
+		name     string
+		decision Decision
+		expected bool
+		minDelay time.Duration
+	}{
+		{name: "allowed", decision: Allowed(), expected: true},
+		{name: "rejected", decision: Rejected(limit), expected: false},
+		{
+			name:     "allowed after a departure",
+			decision: AllowedAfter(limit, NewReservation(time.Now().Add(50*time.Millisecond), nil)),
+			expected: true,
+			minDelay: 40 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			if got := Admitted(tt.decision); got != tt.expected {
+				t.Errorf("Admitted() = %v, want %v", got, tt.expected)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minDelay {
+				t.Errorf("Admitted() returned after %v, want at least %v", elapsed, tt.minDelay)
+			}
+		})
+	}
+}
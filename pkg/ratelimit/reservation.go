@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrNotGranted is returned by Wait when the requested tokens can never be granted,
+// for example because the cost exceeds the burst size
+var ErrNotGranted = errors.New("rate limit reservation not granted")
+
+// Reservation holds tokens granted ahead of time by a limiter
+// The holder may act once Delay has elapsed, or give the tokens back with Cancel
+type Reservation struct {
+	// ok is false if the limiter could not grant the tokens at all
+	ok bool
+
+	// timeToAct is the time at which the reserved tokens become available
+	timeToAct time.Time
+
+	// cancel gives the reserved tokens back to the limiter; may be nil
+	cancel func()
+
+	// once ensures cancel runs at most once
+	once sync.Once
+}
+
+// NewReservation creates a granted reservation usable at timeToAct
+// cancel is called at most once by Cancel to give the tokens back
+func NewReservation(timeToAct time.Time, cancel func()) *Reservation {
+	return &Reservation{
+		ok:        true,
+		timeToAct: timeToAct,
+		cancel:    cancel,
+	}
+}
+
+// NotGranted creates a reservation for tokens the limiter cannot grant
+func NotGranted() *Reservation {
+	return &Reservation{}
+}
+
+// All combines the reservations of every limit of a rule into one
+// The combined reservation is usable once all of them are; if any was not granted,
+// the granted ones are cancelled and the result is not granted either
+func All(reservations ...*Reservation) *Reservation {
+	if len(reservations) == 1 {
+		return reservations[0]
+	}
+
+	var timeToAct time.Time
+	for _, r := range reservations {
+		if !r.OK() {
+			for _, granted := range reservations {
+				granted.Cancel()
+			}
+			return NotGranted()
+		}
+		if r.timeToAct.After(timeToAct) {
+			timeToAct = r.timeToAct
+		}
+	}
+
+	return NewReservation(timeToAct, func() {
+		for _, r := range reservations {
+			r.Cancel()
+		}
+	})
+}
+
+// OK reports whether the limiter granted the tokens
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay returns how long the holder must wait before acting
+// Returns zero if the tokens are already available
+func (r *Reservation) Delay() time.Duration {
+	return r.DelayFrom(time.Now())
+}
+
+// DelayFrom returns how long the holder must wait from the given time before acting
+func (r *Reservation) DelayFrom(now time.Time) time.Duration {
+	if !r.ok {
+		return 0
+	}
+	if delay := r.timeToAct.Sub(now); delay > 0 {
+		return delay
+	}
+	return 0
+}
+
+// Cancel gives the reserved tokens back to the limiter, as far as the limiter allows
+// Calling Cancel more than once, or on a reservation that was not granted, has no effect
+func (r *Reservation) Cancel() {
+	if !r.ok || r.cancel == nil {
+		return
+	}
+	r.once.Do(r.cancel)
+}
+
+// Wait blocks until the reservation may be used or ctx is done
+// If ctx ends first, or its deadline falls before the reservation becomes usable,
+// the reservation is cancelled and an error is returned
+func Wait(ctx context.Context, r *Reservation) error {
+	if !r.OK() {
+		return ErrNotGranted
+	}
+
+	delay := r.Delay()
+	if delay == 0 {
+		return nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(r.timeToAct) {
+		r.Cancel()
+		return fmt.Errorf("rate limit wait of %v would exceed context deadline", delay)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReservation_Delay(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		reservation *Reservation
+		expected    time.Duration
+	}{
+		{
+			name:        "available now",
+			reservation: NewReservation(now, nil),
+			expected:    0,
+		},
+		{
+			name:        "available in the past",
+			reservation: NewReservation(now.Add(-time.Second), nil),
+			expected:    0,
+		},
+		{
+			name:        "available later",
+			reservation: NewReservation(now.Add(time.Second), nil),
+			expected:    time.Second,
+		},
+		{
+			name:        "not granted",
+			reservation: NotGranted(),
+			expected:    0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if delay := tt.reservation.DelayFrom(now); delay != tt.expected {
+				t.Errorf("DelayFrom() = %v, want %v", delay, tt.expected)
+			}
+		})
+	}
+}
+
+func TestReservation_CancelRunsOnce(t *testing.T) {
+	calls := 0
+	r := NewReservation(time.Now(), func() { calls++ })
+
+	r.Cancel()
+	r.Cancel()
+
+	if calls != 1 {
+		t.Errorf("cancel called %d times, want 1", calls)
+	}
+}
+
+func TestAll(t *testing.T) {
+	now := time.Now()
+	cancelled := 0
+	cancel := func() { cancelled++ }
+
+	r := All(NewReservation(now, cancel), NewReservation(now.Add(time.Minute), cancel))
+	if !r.OK() {
+		t.Fatal("All() of granted reservations should be granted")
+	}
+	if delay := r.DelayFrom(now); delay != time.Minute {
+		t.Errorf("DelayFrom() = %v, want the longest delay of 1m", delay)
+	}
+	r.Cancel()
+	if cancelled != 2 {
+		t.Errorf("Cancel() cancelled %d reservations, want 2", cancelled)
+	}
+
+	// A reservation that was not granted gives back the others
+	cancelled = 0
+	if r := All(NewReservation(now, cancel), NotGranted()); r.OK() {
+		t.Error("All() with a reservation that was not granted should not be granted")
+	}
+	if cancelled != 1 {
+		t.Errorf("granted reservations cancelled %d times, want 1", cancelled)
+	}
+}
+
+func TestWait(t *testing.T) {
+	t.Run("not granted", func(t *testing.T) {
+		if err := Wait(context.Background(), NotGranted()); !errors.Is(err, ErrNotGranted) {
+			t.Errorf("Wait() error = %v, want %v", err, ErrNotGranted)
+		}
+	})
+
+	t.Run("waits for delay", func(t *testing.T) {
+		start := time.Now()
+		if err := Wait(context.Background(), NewReservation(start.Add(50*time.Millisecond), nil)); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < 45*time.Millisecond {
+			t.Errorf("Wait() returned after %v, want about 50ms", elapsed)
+		}
+	})
+
+	t.Run("context cancelled", func(t *testing.T) {
+		cancelled := false
+		r := NewReservation(time.Now().Add(time.Hour), func() { cancelled = true })
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+		}()
+
+		if err := Wait(ctx, r); !errors.Is(err, context.Canceled) {
+			t.Errorf("Wait() error = %v, want %v", err, context.Canceled)
+		}
+		if !cancelled {
+			t.Error("reservation should be cancelled when the context ends")
+		}
+	})
+
+	t.Run("deadline before time to act", func(t *testing.T) {
+		cancelled := false
+		r := NewReservation(time.Now().Add(time.Hour), func() { cancelled = true })
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		start := time.Now()
+		if err := Wait(ctx, r); err == nil {
+			t.Error("Wait() should fail when the deadline is too early")
+		}
+		if time.Since(start) > 100*time.Millisecond {
+			t.Error("Wait() should fail immediately instead of waiting for the deadline")
+		}
+		if !cancelled {
+			t.Error("reservation should be cancelled when the deadline is too early")
+		}
+	})
+}